@@ -0,0 +1,97 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ========== 图片访问统计 ==========
+
+// accessCounter 访问和下载次数先在内存中累计，定期批量写入，避免每次请求都写库
+type accessCounter struct {
+	mu        sync.Mutex
+	views     map[string]int64
+	downloads map[string]int64
+}
+
+var imageAccess = &accessCounter{views: map[string]int64{}, downloads: map[string]int64{}}
+
+func (a *accessCounter) add(path string, download bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if download {
+		a.downloads[path]++
+	} else {
+		a.views[path]++
+	}
+}
+
+// flush 将累计的次数写入图片记录
+func (a *accessCounter) flush() {
+	a.mu.Lock()
+	views, downloads := a.views, a.downloads
+	a.views, a.downloads = map[string]int64{}, map[string]int64{}
+	a.mu.Unlock()
+
+	for path, n := range views {
+		db.Model(&ImageRecord{}).Where("path = ?", path).Update("view_count", gorm.Expr("view_count + ?", n))
+	}
+	for path, n := range downloads {
+		db.Model(&ImageRecord{}).Where("path = ?", path).Update("download_count", gorm.Expr("download_count + ?", n))
+	}
+	if len(views)+len(downloads) > 0 {
+		log.Printf("📈 写入访问统计: %d 张图片被浏览，%d 张被下载", len(views), len(downloads))
+	}
+}
+
+// runAccessFlusher 每 30 秒写入一次访问统计
+func runAccessFlusher() {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		imageAccess.flush()
+	}
+}
+
+// serveImage GET /images/*filepath，返回图片并计数，?download=1 以附件形式下载
+func serveImage(c *gin.Context) {
+	rel := filepath.Clean("/" + c.Param("filepath"))
+	path := filepath.Join(cfg.ImageGen.OutputDir, rel)
+	if !servableImage(path) {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	download := c.Query("download") == "1"
+	if download {
+		c.FileAttachment(path, filepath.Base(path))
+	} else {
+		c.File(path)
+	}
+	// 只统计成功返回的完整请求，304 等缓存命中不计
+	if c.Request.Method == http.MethodGet && c.Writer.Status() == http.StatusOK {
+		imageAccess.add(path, download)
+	}
+}
+
+// servableImage 只返回图片目录下的普通文件：目录不列出内容，logDir 在图片目录下时其中的生成日志也不对外
+func servableImage(path string) bool {
+	if !strings.HasPrefix(path, filepath.Clean(cfg.ImageGen.OutputDir)+string(filepath.Separator)) {
+		return false
+	}
+	if logDir := cfg.ImageGen.LogDir; logDir != "" {
+		logDir = filepath.Clean(logDir)
+		if path == logDir || strings.HasPrefix(path, logDir+string(filepath.Separator)) {
+			return false
+		}
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ========== 动态 ==========
+
+// Activity 平台动态：生成、审核、发布、删除等事件
+type Activity struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Type      string    `gorm:"size:30;index;not null" json:"type"` // generated, approved, rejected, published, publish_failed, deleted, pinned, unpinned
+	ImageID   uint      `gorm:"index" json:"image_id"`
+	Actor     string    `gorm:"size:100" json:"actor"` // 用户名，系统操作为 system 或 workflow:名称
+	Detail    string    `gorm:"type:text" json:"detail"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
+
+func (Activity) TableName() string {
+	return "activities"
+}
+
+// recordActivity 记录一条动态，失败不影响主流程
+func recordActivity(kind string, imageID uint, actor, detail string) {
+	if actor == "" {
+		actor = "anonymous"
+	}
+	db.Create(&Activity{Type: kind, ImageID: imageID, Actor: actor, Detail: detail})
+}
+
+// createImageRecord 图片记录入库并记录生成动态，生成事件与记录在同一事务写入
+// 配置了 imageGen.pathTemplate 时入库后把图片移动到模板路径
+func createImageRecord(record *ImageRecord) error {
+	undo := func() {}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(record).Error; err != nil {
+			return err
+		}
+		var err error
+		if undo, err = relocateImage(tx, record); err != nil {
+			return err
+		}
+		// 试验场记录转正时才发出生成事件，压测记录不发出
+		if nonProduction(record.Status) {
+			return nil
+		}
+		return emitEvent(tx, "image.generated", record)
+	})
+	if err != nil {
+		undo()
+		return err
+	}
+	if nonProduction(record.Status) {
+		return nil
+	}
+	recordActivity("generated", record.ID, record.User, record.Platform+" "+record.Model)
+	return nil
+}
+
+// ========== 动态 API ==========
+
+// listActivities GET /api/activity?type=approved&actor=li&since=2026-02-20&page=1&page_size=50
+func listActivities(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 200 {
+		pageSize = 50
+	}
+
+	query := db.Model(&Activity{})
+	if t := c.Query("type"); t != "" {
+		query = query.Where("type = ?", t)
+	}
+	if actor := c.Query("actor"); actor != "" {
+		query = query.Where("actor = ?", actor)
+	}
+	if since := c.Query("since"); since != "" {
+		t, err := time.ParseInLocation("2006-01-02", since, bizLoc)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "since 格式应为 YYYY-MM-DD"})
+			return
+		}
+		query = query.Where("created_at >= ?", t)
+	}
+
+	var total int64
+	query.Count(&total)
+	var activities []Activity
+	query.Order("id DESC").Limit(pageSize).Offset((page - 1) * pageSize).Find(&activities)
+
+	c.JSON(200, gin.H{
+		"activities": activities,
+		"total":      total,
+		"page":       page,
+		"page_size":  pageSize,
+	})
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+
+	"image-platform/internal/publisher"
+)
+
+// ========== 告警规则 ==========
+
+// AlertsConfig 导出的 Prometheus 告警规则的阈值，未配置的按当前配置推算
+type AlertsConfig struct {
+	QueueDepth      int     `yaml:"queueDepth"`      // 排队中的异步任务数阈值，默认 imageGen.maxWorkers × 10
+	FailureRate     float64 `yaml:"failureRate"`     // 单个平台当天失败率阈值，默认 0.2
+	MinImages       int     `yaml:"minImages"`       // 当天生成数少于该值的平台不判断失败率，默认 20
+	PendingReviews  int     `yaml:"pendingReviews"`  // 待审核积压阈值，默认 200
+	DailyCost       float64 `yaml:"dailyCost"`       // 当天总成本阈值（元），0 为不告警
+	For             string  `yaml:"for"`             // 持续多久才告警，默认 15m
+	CredentialCheck int     `yaml:"credentialCheck"` // 发布平台 Cookie/Token 检测间隔（分钟），结果作为指标推送，默认 60
+}
+
+// alertRule Prometheus 规则文件中的一条告警
+type alertRule struct {
+	Alert       string            `yaml:"alert"`
+	Expr        string            `yaml:"expr"`
+	For         string            `yaml:"for,omitempty"`
+	Labels      map[string]string `yaml:"labels"`
+	Annotations map[string]string `yaml:"annotations"`
+}
+
+// metricSelector 指标的标签选择器：pushgateway 模式按 job 区分，同一 Prometheus 中有多套部署时不会互相干扰
+func metricSelector(extra ...string) string {
+	matchers := extra
+	if pc := cfg.Observability.Push; pc.Mode == "" || pc.Mode == "pushgateway" {
+		matchers = append([]string{fmt.Sprintf(`job="%s"`, pc.Job)}, extra...)
+	}
+	if len(matchers) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(matchers, ",") + "}"
+}
+
+// alertRules 按当前配置生成推荐的告警规则，指标名见 metrics.go
+func alertRules() []alertRule {
+	ac := cfg.Observability.Alerts
+	queueDepth := ac.QueueDepth
+	if queueDepth == 0 {
+		queueDepth = cfg.ImageGen.MaxWorkers * 10
+	}
+	sel := metricSelector()
+	failed := metricSelector(`status="failed"`)
+
+	rules := []alertRule{
+		{
+			Alert:       "ImagePlatformQueueBacklog",
+			Expr:        fmt.Sprintf("image_platform_task_queue_length%s > %d", sel, queueDepth),
+			For:         ac.For,
+			Labels:      map[string]string{"severity": "warning"},
+			Annotations: map[string]string{"summary": "异步生成任务积压", "description": fmt.Sprintf("排队中的任务 {{ $value }} 个，超过 %d（并发 %d）", queueDepth, cfg.ImageGen.MaxWorkers)},
+		},
+		{
+			Alert: "ImagePlatformProviderFailureRate",
+			Expr: fmt.Sprintf("sum by (platform) (image_platform_images_today%s) / sum by (platform) (image_platform_images_today%s) > %g and sum by (platform) (image_platform_images_today%s) >= %d",
+				failed, sel, ac.FailureRate, sel, ac.MinImages),
+			For:         ac.For,
+			Labels:      map[string]string{"severity": "warning"},
+			Annotations: map[string]string{"summary": "{{ $labels.platform }} 生成失败率过高", "description": fmt.Sprintf("当天失败率 {{ $value | humanizePercentage }}，超过 %g%%", ac.FailureRate*100)},
+		},
+		{
+			Alert:       "ImagePlatformReviewBacklog",
+			Expr:        fmt.Sprintf("image_platform_pending_reviews%s > %d", sel, ac.PendingReviews),
+			For:         ac.For,
+			Labels:      map[string]string{"severity": "info"},
+			Annotations: map[string]string{"summary": "待审核图片积压", "description": fmt.Sprintf("待审核 {{ $value }} 张，超过 %d", ac.PendingReviews)},
+		},
+		{
+			Alert:       "ImagePlatformPublishCredentialsExpired",
+			Expr:        fmt.Sprintf("image_platform_publish_credentials_ok%s == 0", sel),
+			Labels:      map[string]string{"severity": "critical"},
+			Annotations: map[string]string{"summary": "{{ $labels.platform }} 发布凭证失效", "description": "Cookie/Token 检测失败，定时发布会全部失败，请重新登录后更新配置"},
+		},
+		{
+			Alert:       "ImagePlatformPublishFailures",
+			Expr:        fmt.Sprintf("delta(image_platform_publish_jobs_today%s[1h]) > 0", metricSelector(`status="failed"`)),
+			Labels:      map[string]string{"severity": "warning"},
+			Annotations: map[string]string{"summary": "{{ $labels.platform }} 定时发布失败", "description": "最近 1 小时有 {{ $value }} 个定时发布任务失败"},
+		},
+		{
+			Alert:       "ImagePlatformPublishPaused",
+			Expr:        fmt.Sprintf("image_platform_publish_paused%s == 1", metricSelector(`source="system"`)),
+			Labels:      map[string]string{"severity": "critical"},
+			Annotations: map[string]string{"summary": "{{ $labels.platform }} 发布失败过多已自动暂停", "description": "1 小时内发布失败次数用尽错误预算，请检查账号状态后手动恢复（DELETE /api/admin/publish/pauses/{{ $labels.platform }}）"},
+		},
+	}
+	if ac.DailyCost > 0 {
+		rules = append(rules, alertRule{
+			Alert:       "ImagePlatformDailyCost",
+			Expr:        fmt.Sprintf("sum(image_platform_cost_today%s) > %g", sel, ac.DailyCost),
+			Labels:      map[string]string{"severity": "warning"},
+			Annotations: map[string]string{"summary": "当天生成成本超出预期", "description": fmt.Sprintf("当天成本 {{ $value }} 元，超过 %g 元", ac.DailyCost)},
+		})
+	}
+	if pc := cfg.Observability.Push; pc.Enabled && (pc.Mode == "" || pc.Mode == "pushgateway") {
+		// Pushgateway 为每个分组记录最后一次推送时间，推送停止后旧值会一直保留，其他告警不再准确
+		rules = append(rules, alertRule{
+			Alert:       "ImagePlatformMetricsStale",
+			Expr:        fmt.Sprintf("time() - push_time_seconds%s > %d", sel, pc.Interval*5),
+			Labels:      map[string]string{"severity": "warning"},
+			Annotations: map[string]string{"summary": "指标推送中断", "description": "超过 {{ $value | humanizeDuration }} 未收到推送，服务可能已停止"},
+		})
+	}
+	return rules
+}
+
+// renderAlertRules Prometheus 规则文件（rule_files 引用的格式）
+func renderAlertRules() ([]byte, error) {
+	doc := map[string]interface{}{
+		"groups": []map[string]interface{}{{"name": "image-platform", "rules": alertRules()}},
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# 由 image-platform 按当前配置生成于 %s，阈值见 observability.alerts\n", time.Now().Format(time.RFC3339))
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ========== 发布凭证检测 ==========
+
+// credentialStatus 最近一次凭证检测的结果，以指标推送，供凭证失效告警使用
+type credentialStatus struct {
+	OK        bool
+	CheckedAt time.Time
+}
+
+var (
+	credentialMu       sync.Mutex
+	credentialStatuses = map[string]credentialStatus{}
+)
+
+// recordCredentialCheck 记录检测结果，定期检测和手动检测都会更新
+func recordCredentialCheck(platform string, err error) {
+	credentialMu.Lock()
+	credentialStatuses[platform] = credentialStatus{OK: err == nil, CheckedAt: time.Now()}
+	credentialMu.Unlock()
+}
+
+// credentialSnapshot 按平台排序的检测结果
+func credentialSnapshot() ([]string, map[string]credentialStatus) {
+	credentialMu.Lock()
+	defer credentialMu.Unlock()
+	snapshot := make(map[string]credentialStatus, len(credentialStatuses))
+	names := make([]string, 0, len(credentialStatuses))
+	for name, s := range credentialStatuses {
+		snapshot[name] = s
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, snapshot
+}
+
+// checkPublishCredentials 检测全部支持凭证检测的发布平台
+func checkPublishCredentials() {
+	if pubManager == nil {
+		return
+	}
+	for _, p := range pubManager.List() {
+		if _, ok := p.(publisher.CredentialTester); !ok {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		_, err := pubManager.TestCredentials(ctx, p.Type())
+		cancel()
+		if err != nil {
+			log.Printf("[发布凭证] %s 检测失败: %v", p.Type(), err)
+		}
+		recordCredentialCheck(string(p.Type()), err)
+	}
+}
+
+// runCredentialChecker 按 observability.alerts.credentialCheck 定期检测发布凭证，只在开启指标推送时运行
+func runCredentialChecker() {
+	if !cfg.Observability.Push.Enabled {
+		return
+	}
+	checkPublishCredentials()
+	ticker := time.NewTicker(time.Duration(cfg.Observability.Alerts.CredentialCheck) * time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		checkPublishCredentials()
+	}
+}
+
+// ========== 告警规则 API ==========
+
+// getAlertRules GET /api/admin/alert-rules，返回可直接放入 Prometheus rule_files 的规则文件
+func getAlertRules(c *gin.Context) {
+	out, err := renderAlertRules()
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(200, "application/yaml; charset=utf-8", out)
+}
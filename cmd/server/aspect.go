@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"image-platform/internal/generator"
+)
+
+// ========== 尺寸比例预设 ==========
+
+// builtinPresets 内置的比例预设，尺寸为多数平台都支持的分辨率；imageGen.presets 可增加或覆盖，平台配置 presets 按平台覆盖
+var builtinPresets = map[string]string{
+	"square":          "1024x1024",
+	"portrait_9x16":   "720x1280",
+	"landscape_16x9":  "1280x720",
+	"xiaohongshu_3x4": "768x1024",
+}
+
+// platformPresets 平台可用的预设名和尺寸
+func platformPresets(p PlatformConfig) map[string]string {
+	presets := make(map[string]string, len(builtinPresets))
+	for _, layer := range []map[string]string{builtinPresets, cfg.ImageGen.Presets, p.Presets} {
+		for name, size := range layer {
+			presets[name] = normalizeSize(size)
+		}
+	}
+	return presets
+}
+
+// normalizeSize 宽高之间的 *、×、X 统一为 x
+func normalizeSize(size string) string {
+	return strings.NewReplacer("*", "x", "×", "x", "X", "x", " ", "").Replace(size)
+}
+
+// resolveSize 把预设名换算为平台的 宽x高；size 为空时使用 imageGen.preset，都为空时返回空由平台使用默认尺寸
+func resolveSize(platform, size string) string {
+	if size == "" {
+		size = cfg.ImageGen.Preset
+	}
+	if size == "" {
+		return ""
+	}
+	if s, ok := platformPresets(cfg.Platforms[platform])[size]; ok {
+		return s
+	}
+	return normalizeSize(size)
+}
+
+// validateSize 检查 size 为 宽x高 或平台可用的预设名
+func validateSize(platform, size string) error {
+	if size == "" {
+		return nil
+	}
+	presets := platformPresets(cfg.Platforms[platform])
+	if _, ok := presets[size]; ok {
+		return nil
+	}
+	if _, _, err := localSize(normalizeSize(size)); err != nil {
+		names := make([]string, 0, len(presets))
+		for name := range presets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("尺寸应为 宽x高 或预设 %s", strings.Join(names, "、"))
+	}
+	return nil
+}
+
+// localSize 解析 宽x高 尺寸，为空时使用 imageGen 配置的尺寸
+func localSize(size string) (int, int, error) {
+	if size == "" {
+		return cfg.ImageGen.Width, cfg.ImageGen.Height, nil
+	}
+	return generator.ParseSize(size)
+}
+
+// listPresets GET /api/presets?platform=，平台可用的比例预设，未指定平台时为全局预设
+func listPresets(c *gin.Context) {
+	platform := c.Query("platform")
+	p, ok := cfg.Platforms[platform]
+	if platform != "" && !ok {
+		c.JSON(404, gin.H{"error": "平台不存在"})
+		return
+	}
+	c.JSON(200, gin.H{"presets": platformPresets(p), "default": cfg.ImageGen.Preset})
+}
+
+// validatePresets 启动时检查预设的尺寸格式和 imageGen.preset
+func validatePresets() error {
+	for key, p := range cfg.Platforms {
+		for name, size := range platformPresets(p) {
+			if _, _, err := localSize(size); err != nil {
+				return fmt.Errorf("平台 %s 的预设 %s: %v", key, name, err)
+			}
+		}
+	}
+	if err := validateSize("", cfg.ImageGen.Preset); err != nil {
+		return fmt.Errorf("imageGen.preset: %v", err)
+	}
+	return nil
+}
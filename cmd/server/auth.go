@@ -0,0 +1,110 @@
+package main
+
+import (
+	"crypto/subtle"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ========== 管理员鉴权 ==========
+func adminAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if cfg.Server.AdminToken == "" {
+			c.AbortWithStatusJSON(403, gin.H{"error": "未配置管理员令牌"})
+			return
+		}
+		if !isAdminToken(c.GetHeader("X-Admin-Token")) {
+			c.AbortWithStatusJSON(401, gin.H{"error": "管理员令牌无效"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// isAdminToken 校验管理员令牌，按常量时间比较，避免通过响应耗时逐位猜出令牌
+func isAdminToken(token string) bool {
+	admin := cfg.Server.AdminToken
+	return admin != "" && subtle.ConstantTimeCompare([]byte(token), []byte(admin)) == 1
+}
+
+// ========== 调用方识别 ==========
+
+// identify 根据 X-API-Key / X-User 请求头识别调用方
+// 未携带 API Key 视为匿名调用；携带了但不匹配则拒绝
+// X-User 由客户端自行填写，只有绑定在该 API Key 的 users 中或携带有效管理员令牌时才采信，否则拒绝
+func identify() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var k APIKeyConfig
+		if key := c.GetHeader("X-API-Key"); key != "" {
+			var ok bool
+			k, ok = findAPIKey(key)
+			if !ok {
+				c.AbortWithStatusJSON(401, gin.H{"error": "API Key 无效"})
+				return
+			}
+			c.Set("apiKey", k.Name)
+			c.Set("workspace", k.Workspace)
+		}
+		admin := isAdminToken(c.GetHeader("X-Admin-Token"))
+		c.Set("admin", admin)
+		if user := c.GetHeader("X-User"); user != "" {
+			if !admin && !k.allowsUser(user) {
+				c.AbortWithStatusJSON(401, gin.H{"error": "X-User 未绑定到当前 API Key: " + user})
+				return
+			}
+			c.Set("user", user)
+		}
+		c.Next()
+	}
+}
+
+// allowsUser 该 API Key 是否可以代表 user 调用
+func (k APIKeyConfig) allowsUser(user string) bool {
+	for _, u := range k.Users {
+		if u == user {
+			return true
+		}
+	}
+	return false
+}
+
+func findAPIKey(key string) (APIKeyConfig, bool) {
+	for _, k := range cfg.Auth.APIKeys {
+		if k.Key != "" && k.Key == key {
+			return k, true
+		}
+	}
+	return APIKeyConfig{}, false
+}
+
+// currentUser 当前请求的用户名
+func currentUser(c *gin.Context) string {
+	return c.GetString("user")
+}
+
+// currentAPIKey 当前请求的 API Key 名称（不是密钥本身）
+func currentAPIKey(c *gin.Context) string {
+	return c.GetString("apiKey")
+}
+
+// currentIdentity 当前请求经过鉴权的身份：API Key 为 apikey:<名称>，管理员令牌为 admin，都没有时为空
+// 同一个 API Key 可以代表多个用户，需要区分不同的人时（如多人审核计票）使用它而不是 currentUser
+func currentIdentity(c *gin.Context) string {
+	if apiKey := currentAPIKey(c); apiKey != "" {
+		return "apikey:" + apiKey
+	}
+	if isAdmin(c) {
+		return "admin"
+	}
+	return ""
+}
+
+// isAdmin 当前请求是否携带了有效的管理员令牌
+func isAdmin(c *gin.Context) bool {
+	return c.GetBool("admin")
+}
+
+// currentWorkspace 当前请求所属工作区，由 API Key 决定
+func currentWorkspace(c *gin.Context) string {
+	return c.GetString("workspace")
+}
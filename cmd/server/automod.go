@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"image-platform/internal/moderation"
+)
+
+// ========== 自动审核 ==========
+
+// ModerationConfig 自动审核服务，多个服务按 mode 组合；未配置服务时只使用视觉模型打分
+type ModerationConfig struct {
+	Mode      string            `yaml:"mode"`      // all（默认，每个服务都要通过，得分取最低）或 weighted（加权平均）
+	Threshold float64           `yaml:"threshold"` // weighted 模式的通过分数，默认 0.5
+	Providers []ModeratorConfig `yaml:"providers"`
+}
+
+// ModeratorConfig 单个审核服务
+type ModeratorConfig struct {
+	Type         string  `yaml:"type"` // vision_llm、aliyun_green、rekognition、nsfw
+	Name         string  `yaml:"name"`
+	Weight       float64 `yaml:"weight"`       // weighted 模式的权重，默认 1
+	Threshold    float64 `yaml:"threshold"`    // 该服务判定通过的最低得分，默认 0.5
+	URL          string  `yaml:"url"`          // aliyun_green 的接入地址、nsfw 服务地址
+	Region       string  `yaml:"region"`       // rekognition 的区域
+	Service      string  `yaml:"service"`      // aliyun_green 的检测服务，默认 baselineCheck
+	ScoreField   string  `yaml:"scoreField"`   // nsfw 响应中 NSFW 概率的字段名，默认 nsfw
+	AccessKeyEnv string  `yaml:"accessKeyEnv"` // aliyun_green、rekognition 的 AK/SK 环境变量
+	SecretKeyEnv string  `yaml:"secretKeyEnv"`
+}
+
+var modManager *moderation.Manager
+
+// initModerators 按配置注册审核服务，图床上传依赖发布管理器，需在 initPublisher 之后调用
+func initModerators() *moderation.Manager {
+	mc := cfg.Moderation
+	mgr := moderation.New(moderation.Mode(mc.Mode), mc.Threshold)
+	providers := mc.Providers
+	if len(providers) == 0 {
+		providers = []ModeratorConfig{{Type: "vision_llm", Weight: 1, Threshold: 0.5}}
+	}
+	for _, p := range providers {
+		switch p.Type {
+		case "vision_llm":
+			mgr.Register(visionModerator{name: p.Name}, p.Weight, p.Threshold)
+		case "aliyun_green":
+			mgr.Register(moderation.NewAliyunGreen(p.Name, p.URL, p.Service, os.Getenv(p.AccessKeyEnv), os.Getenv(p.SecretKeyEnv),
+				func(ctx context.Context, path string) (string, error) { return pubManager.HostedURL(ctx, path) }), p.Weight, p.Threshold)
+		case "rekognition":
+			mgr.Register(moderation.NewRekognition(p.Name, p.Region, os.Getenv(p.AccessKeyEnv), os.Getenv(p.SecretKeyEnv)), p.Weight, p.Threshold)
+		case "nsfw":
+			mgr.Register(moderation.NewNSFW(p.Name, p.URL, p.ScoreField), p.Weight, p.Threshold)
+		default:
+			log.Printf("⚠️ 未知的审核服务类型: %s", p.Type)
+		}
+	}
+	return mgr
+}
+
+// validateModeration 检查审核服务配置
+func validateModeration() error {
+	mc := cfg.Moderation
+	if mc.Mode != "" && mc.Mode != string(moderation.ModeAll) && mc.Mode != string(moderation.ModeWeighted) {
+		return fmt.Errorf("moderation.mode 只能为 all 或 weighted: %s", mc.Mode)
+	}
+	for _, p := range mc.Providers {
+		switch p.Type {
+		case "vision_llm", "aliyun_green", "rekognition":
+		case "nsfw":
+			if p.URL == "" {
+				return fmt.Errorf("nsfw 审核服务未配置 url")
+			}
+		default:
+			return fmt.Errorf("未知的审核服务类型: %s", p.Type)
+		}
+	}
+	return nil
+}
+
+var scorePattern = regexp.MustCompile(`[01](?:\.\d+)?`)
+
+// visionModerator 让视觉模型评估图片是否适合发布
+type visionModerator struct {
+	name string
+}
+
+func (v visionModerator) Name() string {
+	if v.name == "" {
+		return "视觉模型"
+	}
+	return v.name
+}
+
+func (v visionModerator) Check(ctx context.Context, img moderation.Image) (*moderation.Result, error) {
+	question := fmt.Sprintf(`你是社交媒体运营的图片审核员。请评估这张 AI 生成的图片是否适合直接发布：画面质量、是否与提示词相符、是否有畸形/文字错误/违规内容。
+提示词：%s
+只回复 JSON：{"score": 0 到 1 之间的小数，越高越适合发布, "reason": "简短理由"}`, img.Prompt)
+
+	answer, err := callVisionLLM(ctx, question, img.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Score  float64 `json:"score"`
+		Reason string  `json:"reason"`
+	}
+	answer = strings.TrimSpace(answer)
+	answer = strings.TrimPrefix(strings.TrimSuffix(answer, "```"), "```json")
+	if err := json.Unmarshal([]byte(strings.TrimSpace(answer)), &result); err != nil {
+		// 模型没按格式回复时，取第一个 0-1 之间的数字
+		m := scorePattern.FindString(answer)
+		if m == "" {
+			return nil, fmt.Errorf("无法解析得分: %s", answer)
+		}
+		result.Score, _ = strconv.ParseFloat(m, 64)
+		result.Reason = answer
+	}
+	if result.Score < 0 || result.Score > 1 {
+		return nil, fmt.Errorf("得分超出范围: %v", result.Score)
+	}
+	return &moderation.Result{Score: result.Score, Reason: result.Reason}, nil
+}
+
+// autoModerate 调用已注册的审核服务评估图片，组合得分（0-1）写入 auto_score
+func autoModerate(ctx context.Context, record *ImageRecord) (*moderation.Verdict, error) {
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+
+	verdict, err := modManager.Check(ctx, moderation.Image{ID: record.ID, Path: record.Path, Prompt: record.Prompt})
+	if err != nil {
+		return nil, err
+	}
+	db.Model(&ImageRecord{}).Where("id = ?", record.ID).Update("auto_score", verdict.Score)
+	record.AutoScore = &verdict.Score
+	return verdict, nil
+}
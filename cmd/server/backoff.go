@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"image-platform/internal/generator"
+)
+
+// ========== 平台限流退避 ==========
+
+// QuotaBackoffConfig 平台返回 429、额度用尽等错误后暂停该平台，暂停期间异步任务排队等待，同步请求换平台
+type QuotaBackoffConfig struct {
+	Enabled  bool `yaml:"enabled"`
+	Cooldown int  `yaml:"cooldown"` // 平台没有返回 Retry-After 时的暂停时长（秒），默认 60
+	MaxPause int  `yaml:"maxPause"` // 单次暂停的上限（秒），默认 600
+}
+
+// providerPause 单个平台的限流暂停状态
+type providerPause struct {
+	Until  time.Time `json:"until"`
+	Reason string    `json:"reason"`
+	Pauses int       `json:"pauses"` // 累计暂停次数
+}
+
+var (
+	pauseMu    sync.Mutex
+	pauses     = make(map[string]*providerPause)
+	retryAfter = make(map[string]time.Duration) // 按请求域名记录最近一次 429 响应的 Retry-After
+)
+
+// noteRetryAfter 重试用尽仍被限流时记录 Retry-After，暂停平台时按平台要求的时长
+func noteRetryAfter(req *http.Request, resp *http.Response) {
+	if resp == nil || resp.StatusCode != http.StatusTooManyRequests {
+		return
+	}
+	secs, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || secs <= 0 {
+		return
+	}
+	pauseMu.Lock()
+	retryAfter[req.URL.Host] = time.Duration(secs) * time.Second
+	pauseMu.Unlock()
+}
+
+// platformHost 平台接口的域名，和 Retry-After 记录对应
+func platformHost(platform string) string {
+	u, err := url.Parse(cfg.Platforms[platform].URL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// pauseProvider 平台限流或额度用尽时暂停，时长取 Retry-After，没有时用 quotaBackoff.cooldown
+func pauseProvider(platform string, err error) {
+	if !cfg.QuotaBackoff.Enabled || errorCode(err) != ErrCodeProviderQuota {
+		return
+	}
+	pauseMu.Lock()
+	d := time.Duration(cfg.QuotaBackoff.Cooldown) * time.Second
+	source := "cooldown"
+	host := platformHost(platform)
+	if hint, ok := retryAfter[host]; ok {
+		d, source = hint, "retry-after"
+		delete(retryAfter, host)
+	}
+	d = min(d, time.Duration(cfg.QuotaBackoff.MaxPause)*time.Second)
+	p, ok := pauses[platform]
+	if !ok {
+		p = &providerPause{}
+		pauses[platform] = p
+	}
+	until := time.Now().Add(d)
+	extended := until.After(p.Until)
+	if extended {
+		// 并发请求同时被限流时只记一次暂停
+		if time.Now().After(p.Until) {
+			p.Pauses++
+		}
+		p.Until, p.Reason = until, err.Error()
+	}
+	pauseMu.Unlock()
+	if !extended {
+		return
+	}
+
+	log.Printf("⏳ [%s] 平台限流，暂停 %v（%s）: %v", platform, d, source, err)
+	emitEvent(db, "provider.paused", gin.H{"platform": platform, "until": until, "seconds": int(d.Seconds()), "source": source, "error": err.Error()})
+}
+
+// providerPausedUntil 平台暂停的结束时间，未暂停时返回零值
+func providerPausedUntil(platform string) time.Time {
+	pauseMu.Lock()
+	defer pauseMu.Unlock()
+	if p, ok := pauses[platform]; ok && time.Now().Before(p.Until) {
+		return p.Until
+	}
+	return time.Time{}
+}
+
+// pausedError 平台暂停中的错误，提示恢复时间
+func pausedError(platform string, until time.Time) error {
+	return genError(ErrCodeProviderQuota, "平台 %s 限流暂停中，%v 后恢复", platform, time.Until(until).Round(time.Second))
+}
+
+// checkProviderPause 生成前检查平台是否限流暂停，用于同步请求换平台
+func checkProviderPause(platform string) error {
+	if until := providerPausedUntil(platform); !until.IsZero() {
+		return pausedError(platform, until)
+	}
+	return nil
+}
+
+// waitProviderPause 调用平台前等待限流暂停结束：异步任务排队等待，调用方在等待响应的同步请求直接失败
+func waitProviderPause(ctx context.Context, platform string, progress progressFunc) error {
+	until := providerPausedUntil(platform)
+	if until.IsZero() {
+		return nil
+	}
+	if gc, ok := ctx.Value(genContextKey{}).(*genContext); !ok || gc.TaskID == "" {
+		return pausedError(platform, until)
+	}
+	log.Printf("⏳ [%s] 平台限流暂停中，任务等待到 %s", platform, until.Format("15:04:05"))
+	progress.report("waiting", 10)
+	return generator.SleepCtx(ctx, time.Until(until))
+}
+
+// ========== 平台限流退避 API ==========
+
+// listProviderPauses GET /api/admin/platforms/pauses
+func listProviderPauses(c *gin.Context) {
+	pauseMu.Lock()
+	result := gin.H{}
+	for platform, p := range pauses {
+		result[platform] = gin.H{"paused": time.Now().Before(p.Until), "until": p.Until, "reason": p.Reason, "pauses": p.Pauses}
+	}
+	pauseMu.Unlock()
+	c.JSON(200, gin.H{"enabled": cfg.QuotaBackoff.Enabled, "cooldown": cfg.QuotaBackoff.Cooldown, "pauses": result})
+}
+
+// resumeProviderPause DELETE /api/admin/platforms/:id/pause，确认额度恢复后提前结束暂停
+func resumeProviderPause(c *gin.Context) {
+	platform := c.Param("id")
+	pauseMu.Lock()
+	if p, ok := pauses[platform]; ok {
+		p.Until = time.Time{}
+	}
+	pauseMu.Unlock()
+	log.Printf("⏳ [%s] 限流暂停已手动结束（%s）", platform, currentUser(c))
+	c.JSON(200, gin.H{"message": "success"})
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ========== 平台余额 ==========
+
+// ProviderBalance 生成平台剩余额度
+type ProviderBalance struct {
+	Balance   float64   `json:"balance"`
+	Currency  string    `json:"currency"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// 余额查询较慢且有频率限制，缓存 5 分钟
+const balanceTTL = 5 * time.Minute
+
+var (
+	balanceMu    sync.Mutex
+	balanceCache = make(map[string]*ProviderBalance)
+)
+
+// getBalances 查询所有支持余额接口的已启用平台，未支持的平台不出现在结果中
+func getBalances() map[string]*ProviderBalance {
+	result := make(map[string]*ProviderBalance)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for key, p := range cfg.Platforms {
+		if !p.Enabled || !supportsBalance(p) {
+			continue
+		}
+		wg.Add(1)
+		go func(key string, p PlatformConfig) {
+			defer wg.Done()
+			b := cachedBalance(key, p)
+			mu.Lock()
+			result[key] = b
+			mu.Unlock()
+		}(key, p)
+	}
+	wg.Wait()
+	return result
+}
+
+func supportsBalance(p PlatformConfig) bool {
+	return p.Type == "siliconflow" || p.Type == "aliyun"
+}
+
+func cachedBalance(key string, p PlatformConfig) *ProviderBalance {
+	balanceMu.Lock()
+	b, ok := balanceCache[key]
+	balanceMu.Unlock()
+	if ok && time.Since(b.CheckedAt) < balanceTTL {
+		return b
+	}
+
+	b = &ProviderBalance{CheckedAt: time.Now()}
+	var err error
+	switch p.Type {
+	case "siliconflow":
+		b.Balance, b.Currency, err = siliconFlowBalance(p)
+	case "aliyun":
+		b.Balance, b.Currency, err = aliyunBalance(p)
+	}
+	if err != nil {
+		log.Printf("[%s] 查询余额失败: %v", p.Name, err)
+		b.Error = err.Error()
+	}
+
+	balanceMu.Lock()
+	balanceCache[key] = b
+	balanceMu.Unlock()
+	return b
+}
+
+// siliconFlowBalance 硅基流动 GET /v1/user/info
+func siliconFlowBalance(p PlatformConfig) (float64, string, error) {
+	req, _ := http.NewRequest("GET", strings.TrimSuffix(p.URL, "/")+"/user/info", nil)
+	req.Header.Set("Authorization", "Bearer "+p.APIKey)
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 200 {
+		return 0, "", fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		Data struct {
+			TotalBalance string `json:"totalBalance"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return 0, "", fmt.Errorf("解析响应失败: %s", string(body))
+	}
+	balance, err := strconv.ParseFloat(result.Data.TotalBalance, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("解析余额失败: %s", result.Data.TotalBalance)
+	}
+	return balance, "CNY", nil
+}
+
+// aliyunBalance 百炼没有基于 API Key 的余额接口，使用阿里云费用中心 QueryAccountBalance（需 AK/SK）
+func aliyunBalance(p PlatformConfig) (float64, string, error) {
+	if p.AccessKey == "" || p.SecretKey == "" {
+		return 0, "", fmt.Errorf("未配置 AccessKey，无法查询余额")
+	}
+
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	params := map[string]string{
+		"Action":           "QueryAccountBalance",
+		"Format":           "JSON",
+		"Version":          "2017-12-14",
+		"AccessKeyId":      p.AccessKey,
+		"SignatureMethod":  "HMAC-SHA1",
+		"SignatureVersion": "1.0",
+		"SignatureNonce":   hex.EncodeToString(nonce),
+		"Timestamp":        time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+	}
+
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = aliyunEscape(k) + "=" + aliyunEscape(params[k])
+	}
+	canonical := strings.Join(pairs, "&")
+
+	mac := hmac.New(sha1.New, []byte(p.SecretKey+"&"))
+	mac.Write([]byte("GET&%2F&" + aliyunEscape(canonical)))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	apiURL := "https://business.aliyuncs.com/?" + canonical + "&Signature=" + aliyunEscape(signature)
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(apiURL)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	var result struct {
+		Success bool   `json:"Success"`
+		Message string `json:"Message"`
+		Data    struct {
+			AvailableAmount string `json:"AvailableAmount"`
+			Currency        string `json:"Currency"`
+		} `json:"Data"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return 0, "", fmt.Errorf("解析响应失败: %s", string(body))
+	}
+	if !result.Success {
+		return 0, "", fmt.Errorf("查询失败: %s", result.Message)
+	}
+	balance, err := strconv.ParseFloat(strings.ReplaceAll(result.Data.AvailableAmount, ",", ""), 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("解析余额失败: %s", result.Data.AvailableAmount)
+	}
+	return balance, result.Data.Currency, nil
+}
+
+// aliyunEscape 阿里云 RPC 签名要求的 URL 编码
+func aliyunEscape(s string) string {
+	s = url.QueryEscape(s)
+	s = strings.ReplaceAll(s, "+", "%20")
+	s = strings.ReplaceAll(s, "*", "%2A")
+	return strings.ReplaceAll(s, "%7E", "~")
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ========== 组合批量生成 ==========
+
+// Batch 一次组合批量生成，提示词中的 {{变量}} 按取值列表展开为笛卡尔积
+type Batch struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	Template   string     `gorm:"size:1000;not null" json:"template"`
+	Variables  string     `gorm:"type:text" json:"variables"` // JSON: {"animal": ["cat", "dog"]}
+	Platform   string     `gorm:"size:50" json:"platform"`
+	Total      int        `json:"total"`
+	Failed     int        `json:"failed"`
+	Status     string     `gorm:"size:20;default:'running'" json:"status"` // running, done
+	User       string     `gorm:"size:100" json:"user"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
+
+func (Batch) TableName() string {
+	return "batches"
+}
+
+// 批量展开上限，避免一次请求耗尽额度
+const maxBatchSize = 100
+
+var promptVarPattern = regexp.MustCompile(`\{\{\s*(\w+)\s*\}\}`)
+
+// expandedPrompt 展开后的单个提示词及其变量取值
+type expandedPrompt struct {
+	Prompt string            `json:"prompt"`
+	Values map[string]string `json:"values"`
+}
+
+// expandPrompt 将模板中的 {{name}} 按 vars 展开为全部组合，holiday/solar_term 未提供时取内置值
+func expandPrompt(tpl string, vars map[string][]string) ([]expandedPrompt, error) {
+	if vars == nil {
+		vars = make(map[string][]string)
+	}
+	var names []string
+	seen := make(map[string]bool)
+	for _, m := range promptVarPattern.FindAllStringSubmatch(tpl, -1) {
+		if !seen[m[1]] {
+			seen[m[1]] = true
+			names = append(names, m[1])
+		}
+	}
+
+	total := 1
+	for _, name := range names {
+		if len(vars[name]) == 0 {
+			if v, ok := builtinPromptVar(name); ok {
+				vars[name] = []string{v}
+				continue
+			}
+			return nil, fmt.Errorf("变量 %s 没有取值", name)
+		}
+		total *= len(vars[name])
+		if total > maxBatchSize {
+			return nil, fmt.Errorf("组合数超过上限 %d", maxBatchSize)
+		}
+	}
+
+	combos := []map[string]string{{}}
+	for _, name := range names {
+		next := make([]map[string]string, 0, len(combos)*len(vars[name]))
+		for _, combo := range combos {
+			for _, v := range vars[name] {
+				m := make(map[string]string, len(combo)+1)
+				for k, val := range combo {
+					m[k] = val
+				}
+				m[name] = v
+				next = append(next, m)
+			}
+		}
+		combos = next
+	}
+
+	result := make([]expandedPrompt, len(combos))
+	for i, combo := range combos {
+		prompt := promptVarPattern.ReplaceAllStringFunc(tpl, func(s string) string {
+			return combo[promptVarPattern.FindStringSubmatch(s)[1]]
+		})
+		result[i] = expandedPrompt{Prompt: prompt, Values: combo}
+	}
+	return result, nil
+}
+
+// builtinPromptVar 未提供取值时可用的内置变量
+func builtinPromptVar(name string) (string, bool) {
+	switch name {
+	case "holiday":
+		holiday, _ := upcomingHoliday(bizNow())
+		return holiday, true
+	case "solar_term":
+		return currentSolarTerm(bizNow()), true
+	}
+	return "", false
+}
+
+// ========== 批量生成 API ==========
+
+// createBatch POST /api/batches，preview=true 时只返回展开结果
+func createBatch(c *gin.Context) {
+	var req struct {
+		Prompt    string              `json:"prompt" binding:"required"` // 如 "a {{animal}} in {{style}} style"
+		Variables map[string][]string `json:"variables"`
+		Platform  string              `json:"platform"`
+		Model     string              `json:"model"`
+		Size      string              `json:"size"`
+		Category  string              `json:"category"`
+		Preview   bool                `json:"preview"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	prompts, err := expandPrompt(req.Prompt, req.Variables)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Preview {
+		c.JSON(200, gin.H{"prompts": prompts, "total": len(prompts)})
+		return
+	}
+
+	if req.Platform == "" {
+		req.Platform = getOrCreateSettings().Platform
+	}
+	if p, ok := cfg.Platforms[req.Platform]; !ok || !p.Enabled {
+		c.JSON(400, gin.H{"error": "平台不可用: " + req.Platform})
+		return
+	}
+	if !categoryExists(req.Category) {
+		c.JSON(400, gin.H{"error": "分类不存在: " + req.Category})
+		return
+	}
+	flags := ""
+	for _, p := range prompts {
+		if err := checkCapabilities(req.Platform, req.Model, req.Size, 1, p.Prompt); err != nil {
+			c.JSON(400, gin.H{"error": err.Error(), "code": "unsupported", "prompt": p.Prompt})
+			return
+		}
+		verdict := checkPromptPolicy(c.Request.Context(), p.Prompt, req.Platform)
+		if verdict.Blocked {
+			resp := verdict.response()
+			resp["prompt"] = p.Prompt
+			c.JSON(422, resp)
+			return
+		}
+		if verdict.Flag != "" {
+			flags = verdict.Flag
+		}
+	}
+
+	varsJSON, _ := json.Marshal(req.Variables)
+	batch := Batch{
+		Template:  req.Prompt,
+		Variables: string(varsJSON),
+		Platform:  req.Platform,
+		Total:     len(prompts),
+		Status:    "running",
+		User:      currentUser(c),
+	}
+	if err := db.Create(&batch).Error; err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	base := ImageRecord{
+		User:       currentUser(c),
+		APIKey:     currentAPIKey(c),
+		Workspace:  currentWorkspace(c),
+		PolicyFlag: flags,
+		Category:   req.Category,
+		BatchID:    &batch.ID,
+	}
+	go runBatch(batch, prompts, req.Model, req.Size, base)
+
+	c.JSON(200, gin.H{"message": "success", "batch_id": batch.ID, "total": len(prompts)})
+}
+
+func runBatch(batch Batch, prompts []expandedPrompt, model, size string, base ImageRecord) {
+	log.Printf("📦 批量 #%d 开始: %d 个组合", batch.ID, len(prompts))
+	var (
+		mu     sync.Mutex
+		failed int
+		wg     sync.WaitGroup
+		sem    = make(chan struct{}, cfg.ImageGen.MaxWorkers)
+	)
+	for _, p := range prompts {
+		wg.Add(1)
+		go func(prompt string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			if _, err := generateAndSave(jobContext("batch", batch.ID), batch.Platform, prompt, size, model, base); err != nil {
+				log.Printf("📦 批量 #%d 生成失败 (%s): %v", batch.ID, prompt, err)
+				mu.Lock()
+				failed++
+				mu.Unlock()
+			}
+		}(p.Prompt)
+	}
+	wg.Wait()
+
+	now := time.Now()
+	db.Model(&Batch{}).Where("id = ?", batch.ID).Updates(map[string]interface{}{
+		"status": "done", "failed": failed, "finished_at": now})
+	log.Printf("📦 批量 #%d 完成，失败 %d", batch.ID, failed)
+	if len(prompts) > failed {
+		notifyReviewers(nil, fmt.Sprintf("批量 #%d 有 %d 张图片待审核", batch.ID, len(prompts)-failed), batch.Template, fmt.Sprintf("/api/batches/%d", batch.ID))
+	}
+}
+
+func listBatches(c *gin.Context) {
+	var batches []Batch
+	db.Order("id DESC").Limit(100).Find(&batches)
+	c.JSON(200, gin.H{"batches": batches, "total": len(batches)})
+}
+
+// getBatch 批量详情及审核进度
+func getBatch(c *gin.Context) {
+	var batch Batch
+	if err := db.First(&batch, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{"error": "批量任务不存在"})
+		return
+	}
+	var records []ImageRecord
+	db.Where("batch_id = ?", batch.ID).Order("generated_at").Find(&records)
+	stats := map[string]int{}
+	for _, r := range records {
+		stats[r.Status]++
+	}
+	c.JSON(200, gin.H{"batch": batch, "stats": stats, "records": withImageURLs(records)})
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// ========== 品牌水印 ==========
+
+// brandingFor 选择发布时使用的品牌配置：分类配置优先于发布平台配置，override 为 none 时不加
+func brandingFor(platform, category, override string) string {
+	if override != "" {
+		if override == "none" {
+			return ""
+		}
+		return override
+	}
+	if name, ok := cfg.Branding.Categories[category]; ok {
+		return name
+	}
+	return cfg.Branding.Platforms[platform]
+}
+
+// publishImagePath 返回发布用的图片路径，需要品牌处理或转码时生成处理后的副本，原图不变
+func publishImagePath(record *ImageRecord, platform, override string) (string, error) {
+	path := record.Path
+	name := brandingFor(platform, record.Category, override)
+	if name != "" {
+		var err error
+		if path, err = applyBranding(record, name); err != nil {
+			return "", err
+		}
+	}
+	if f, ok := publishFormat(platform); ok {
+		return transcodeForPublish(record, path, name, f)
+	}
+	return path, nil
+}
+
+// applyBranding 按品牌配置加边框、Logo 和标语，输出到 branded/<配置名>/，已生成过则直接复用
+func applyBranding(record *ImageRecord, name string) (string, error) {
+	profile, ok := cfg.Branding.Profiles[name]
+	if !ok {
+		return "", fmt.Errorf("品牌配置不存在: %s", name)
+	}
+	ext := strings.ToLower(filepath.Ext(record.Path))
+	if ext != ".jpg" && ext != ".jpeg" {
+		ext = ".png"
+	}
+	out := filepath.Join(cfg.ImageGen.OutputDir, "branded", name, fmt.Sprintf("%d%s", record.ID, ext))
+	if src, err := os.Stat(record.Path); err == nil {
+		if dst, err := os.Stat(out); err == nil && dst.ModTime().After(src.ModTime()) {
+			return out, nil
+		}
+	}
+
+	job := startProcessing(record.ID, "watermark", gin.H{"profile": name}, "", "")
+	if err := renderBranding(record, profile, out, ext); err != nil {
+		job.finish("", err)
+		return "", err
+	}
+	job.finish(out, nil)
+	return out, nil
+}
+
+// rerunWatermark 按处理记录的品牌配置重新生成
+func rerunWatermark(ctx context.Context, job *ProcessingJob, record *ImageRecord) (string, error) {
+	var params struct {
+		Profile string `json:"profile"`
+	}
+	if err := json.Unmarshal([]byte(job.Params), &params); err != nil || params.Profile == "" {
+		return "", genError(ErrCodeInvalid, "处理参数无效: %s", job.Params)
+	}
+	return applyBranding(record, params.Profile)
+}
+
+// renderBranding 绘制品牌元素并写入 out，失败时不留下不完整的文件
+func renderBranding(record *ImageRecord, profile BrandingProfile, out, ext string) error {
+	src, err := loadImage(record.Path)
+	if err != nil {
+		return fmt.Errorf("读取原图失败: %w", err)
+	}
+
+	// 边框：画布四周扩展 FrameWidth
+	fw := profile.FrameWidth
+	b := src.Bounds()
+	canvas := image.NewRGBA(image.Rect(0, 0, b.Dx()+2*fw, b.Dy()+2*fw))
+	if fw > 0 {
+		frame, err := parseHexColor(profile.FrameColor)
+		if err != nil {
+			return err
+		}
+		draw.Draw(canvas, canvas.Bounds(), image.NewUniform(frame), image.Point{}, draw.Src)
+	}
+	inner := image.Rect(fw, fw, fw+b.Dx(), fw+b.Dy())
+	draw.Draw(canvas, inner, src, b.Min, draw.Src)
+
+	margin := b.Dx() / 40
+	if profile.Logo != "" {
+		logo, err := loadImage(profile.Logo)
+		if err != nil {
+			return fmt.Errorf("读取 Logo 失败: %w", err)
+		}
+		pct := profile.LogoPercent
+		if pct <= 0 {
+			pct = 15
+		}
+		lw := b.Dx() * pct / 100
+		lb := logo.Bounds()
+		lh := lb.Dy() * lw / max(lb.Dx(), 1)
+		at := corner(inner, profile.Position, lw, lh, margin)
+		draw.CatmullRom.Scale(canvas, image.Rect(at.X, at.Y, at.X+lw, at.Y+lh), logo, lb, draw.Over, nil)
+	}
+
+	if profile.Tagline != "" {
+		if err := drawTagline(canvas, inner, profile, margin); err != nil {
+			return err
+		}
+	}
+
+	os.MkdirAll(filepath.Dir(out), 0755)
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if ext == ".png" {
+		err = png.Encode(f, canvas)
+	} else {
+		err = jpeg.Encode(f, canvas, &jpeg.Options{Quality: 92})
+	}
+	if err != nil {
+		os.Remove(out)
+		return err
+	}
+	return nil
+}
+
+// drawTagline 在图片底部居中绘制标语，需要配置支持中文的字体文件
+func drawTagline(canvas *image.RGBA, inner image.Rectangle, profile BrandingProfile, margin int) error {
+	if profile.Font == "" {
+		return fmt.Errorf("标语需要配置字体文件 font")
+	}
+	data, err := os.ReadFile(profile.Font)
+	if err != nil {
+		return fmt.Errorf("读取字体失败: %w", err)
+	}
+	ft, err := opentype.Parse(data)
+	if err != nil {
+		return fmt.Errorf("解析字体失败: %w", err)
+	}
+	size := profile.FontSize
+	if size <= 0 {
+		size = float64(inner.Dx()) / 30
+	}
+	face, err := opentype.NewFace(ft, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return err
+	}
+	defer face.Close()
+	textColor, err := parseHexColor(profile.TextColor)
+	if err != nil {
+		return err
+	}
+	d := &font.Drawer{Dst: canvas, Src: image.NewUniform(textColor), Face: face}
+	width := d.MeasureString(profile.Tagline).Round()
+	x := inner.Min.X + (inner.Dx()-width)/2
+	y := inner.Max.Y - margin - face.Metrics().Descent.Round()
+	d.Dot = fixed.P(x, y)
+	d.DrawString(profile.Tagline)
+	return nil
+}
+
+// corner Logo 在图片中的左上角坐标，默认右下角
+func corner(r image.Rectangle, position string, w, h, margin int) image.Point {
+	switch position {
+	case "top-left":
+		return image.Pt(r.Min.X+margin, r.Min.Y+margin)
+	case "top-right":
+		return image.Pt(r.Max.X-margin-w, r.Min.Y+margin)
+	case "bottom-left":
+		return image.Pt(r.Min.X+margin, r.Max.Y-margin-h)
+	default:
+		return image.Pt(r.Max.X-margin-w, r.Max.Y-margin-h)
+	}
+}
+
+func loadImage(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	return img, err
+}
+
+// parseHexColor 解析 #RRGGBB 或 #RRGGBBAA，为空时为白色
+func parseHexColor(s string) (color.RGBA, error) {
+	s = strings.TrimPrefix(s, "#")
+	if s == "" {
+		return color.RGBA{255, 255, 255, 255}, nil
+	}
+	if len(s) == 6 {
+		s += "ff"
+	}
+	v, err := strconv.ParseUint(s, 16, 32)
+	if len(s) != 8 || err != nil {
+		return color.RGBA{}, fmt.Errorf("颜色格式应为 #RRGGBB: %s", s)
+	}
+	return color.RGBA{uint8(v >> 24), uint8(v >> 16), uint8(v >> 8), uint8(v)}, nil
+}
+
+// ========== 品牌 API ==========
+
+// previewBranding GET /api/images/:id/branded?profile=，返回加品牌后的图片
+func previewBranding(c *gin.Context) {
+	var record ImageRecord
+	if err := db.First(&record, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{"error": "图片不存在"})
+		return
+	}
+	name := c.Query("profile")
+	if name == "" {
+		name = brandingFor(c.Query("platform"), record.Category, "")
+	}
+	if name == "" {
+		c.JSON(400, gin.H{"error": "未指定品牌配置"})
+		return
+	}
+	path, err := applyBranding(&record, name)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.File(path)
+}
+
+func listBrandingProfiles(c *gin.Context) {
+	c.JSON(200, gin.H{
+		"profiles":   cfg.Branding.Profiles,
+		"platforms":  cfg.Branding.Platforms,
+		"categories": cfg.Branding.Categories,
+	})
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ========== 平台熔断 ==========
+
+// BreakerConfig 平台连续失败达到阈值后熔断，冷却期内直接失败，不再等待平台超时
+type BreakerConfig struct {
+	Enabled   bool `yaml:"enabled"`
+	Threshold int  `yaml:"threshold"` // 连续失败次数，默认 5
+	Cooldown  int  `yaml:"cooldown"`  // 熔断时长（秒），默认 60
+}
+
+// breaker 单个平台的熔断状态：closed 正常，open 熔断中，half_open 冷却结束后放行一次试探
+type breaker struct {
+	State     string     `json:"state"`
+	Failures  int        `json:"consecutive_failures"`
+	OpenedAt  *time.Time `json:"opened_at,omitempty"`
+	Trips     int        `json:"trips"` // 累计熔断次数
+	LastError string     `json:"last_error,omitempty"`
+	probing   bool       // half_open 时试探请求是否在途
+}
+
+var (
+	breakerMu sync.Mutex
+	breakers  = make(map[string]*breaker)
+)
+
+// breakerFailure 平台侧的问题才计入连续失败，参数、内容审核等由调用方引起的错误不计
+func breakerFailure(err error) bool {
+	switch errorCode(err) {
+	case ErrCodeUnavailable, ErrCodeTimeout, ErrCodeMalformed:
+		return true
+	}
+	return false
+}
+
+func getBreaker(platform string) *breaker {
+	b, ok := breakers[platform]
+	if !ok {
+		b = &breaker{State: "closed"}
+		breakers[platform] = b
+	}
+	return b
+}
+
+// openError 熔断中的错误，提示剩余冷却时间
+func (b *breaker) openError(platform string) error {
+	remaining := time.Until(b.OpenedAt.Add(time.Duration(cfg.Breaker.Cooldown) * time.Second)).Round(time.Second)
+	if remaining > 0 {
+		return genError(ErrCodeCircuitOpen, "平台 %s 连续失败已熔断，%v 后重试", platform, remaining)
+	}
+	return genError(ErrCodeCircuitOpen, "平台 %s 熔断恢复试探中，请稍后重试", platform)
+}
+
+// checkBreaker 不占用试探名额，只判断平台当前是否熔断，用于生成前的准入检查
+func checkBreaker(platform string) error {
+	if !cfg.Breaker.Enabled {
+		return nil
+	}
+	breakerMu.Lock()
+	defer breakerMu.Unlock()
+	b, ok := breakers[platform]
+	if !ok {
+		return nil
+	}
+	cooling := b.State == "open" && time.Since(*b.OpenedAt) < time.Duration(cfg.Breaker.Cooldown)*time.Second
+	if cooling || (b.State == "half_open" && b.probing) {
+		return b.openError(platform)
+	}
+	return nil
+}
+
+// acquireBreaker 调用平台前检查熔断，放行时返回记录调用结果的函数
+// 冷却结束后只放行一个试探请求，成功则恢复，失败则重新熔断
+func acquireBreaker(platform string) (func(err error), error) {
+	if !cfg.Breaker.Enabled {
+		return func(error) {}, nil
+	}
+	breakerMu.Lock()
+	b := getBreaker(platform)
+	switch b.State {
+	case "open":
+		if time.Since(*b.OpenedAt) < time.Duration(cfg.Breaker.Cooldown)*time.Second {
+			err := b.openError(platform)
+			breakerMu.Unlock()
+			return nil, err
+		}
+		b.State = "half_open"
+		b.probing = true
+		log.Printf("🔌 [%s] 熔断冷却结束，放行试探请求", platform)
+	case "half_open":
+		if b.probing {
+			err := b.openError(platform)
+			breakerMu.Unlock()
+			return nil, err
+		}
+		b.probing = true
+	}
+	breakerMu.Unlock()
+
+	return func(err error) {
+		breakerMu.Lock()
+		defer breakerMu.Unlock()
+		b.probing = false
+		// 取消的请求不代表平台状况，不改变熔断状态
+		if errorCode(err) == ErrCodeCanceled {
+			return
+		}
+		if err == nil || !breakerFailure(err) {
+			if b.State != "closed" {
+				log.Printf("🔌 [%s] 平台恢复，关闭熔断", platform)
+			}
+			b.State, b.Failures, b.OpenedAt = "closed", 0, nil
+			return
+		}
+		b.Failures++
+		b.LastError = err.Error()
+		if b.State == "half_open" || b.Failures >= cfg.Breaker.Threshold {
+			now := time.Now()
+			if b.State != "open" {
+				b.Trips++
+			}
+			b.State, b.OpenedAt = "open", &now
+			log.Printf("🔌 [%s] 连续失败 %d 次，熔断 %d 秒: %v", platform, b.Failures, cfg.Breaker.Cooldown, err)
+		}
+	}, nil
+}
+
+// breakerStates 各平台熔断状态的副本
+func breakerStates() map[string]breaker {
+	breakerMu.Lock()
+	defer breakerMu.Unlock()
+	states := make(map[string]breaker, len(breakers))
+	for platform, b := range breakers {
+		states[platform] = *b
+	}
+	return states
+}
+
+// ========== 平台熔断 API ==========
+
+// listBreakers GET /api/admin/breakers
+func listBreakers(c *gin.Context) {
+	states := breakerStates()
+	result := gin.H{}
+	for key := range getEnabledPlatforms() {
+		b, ok := states[key]
+		if !ok {
+			b = breaker{State: "closed"}
+		}
+		h := gin.H{"state": b.State, "consecutive_failures": b.Failures, "trips": b.Trips, "last_error": b.LastError, "opened_at": b.OpenedAt}
+		if b.State == "open" {
+			h["retry_at"] = b.OpenedAt.Add(time.Duration(cfg.Breaker.Cooldown) * time.Second)
+		}
+		result[key] = h
+	}
+	c.JSON(200, gin.H{"enabled": cfg.Breaker.Enabled, "threshold": cfg.Breaker.Threshold, "cooldown": cfg.Breaker.Cooldown, "breakers": result})
+}
+
+// resetBreaker POST /api/admin/breakers/:id/reset，确认平台恢复后手动关闭熔断
+func resetBreaker(c *gin.Context) {
+	platform := c.Param("id")
+	breakerMu.Lock()
+	if b, ok := breakers[platform]; ok {
+		b.State, b.Failures, b.OpenedAt, b.probing = "closed", 0, nil, false
+	}
+	breakerMu.Unlock()
+	log.Printf("🔌 [%s] 熔断已手动重置（%s）", platform, currentUser(c))
+	c.JSON(200, gin.H{"message": "success"})
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ========== 批量删除 ==========
+
+// 单次批量删除的记录数上限，超出时需缩小筛选范围
+const bulkDeleteLimit = 5000
+
+// 预览结果的有效期，过期后需重新预览
+const bulkDeleteTTL = 10 * time.Minute
+
+// bulkFilter 批量删除、批量修改的筛选条件，至少指定一项
+type bulkFilter struct {
+	Status     string            `json:"status"`   // pending, approved, rejected, failed
+	Platform   string            `json:"platform"` // 平台配置键
+	Category   string            `json:"category"`
+	ErrorCode  string            `json:"error_code"`
+	User       string            `json:"user"`
+	Workspace  string            `json:"workspace"`
+	BatchID    *uint             `json:"batch_id"`
+	Tag        string            `json:"tag"`
+	Collection string            `json:"collection"`
+	Before     string            `json:"before"`   // 日期早于该天（不含），YYYY-MM-DD
+	After      string            `json:"after"`    // 日期不早于该天（含）
+	Metadata   map[string]string `json:"metadata"` // 元数据键值都匹配，值为空时只要求存在该键
+}
+
+// apply 把筛选条件加到查询上，没有任何条件时返回错误，避免误删全部记录
+func (f bulkFilter) apply(query *gorm.DB) (*gorm.DB, error) {
+	conds := 0
+	for column, value := range map[string]string{
+		"status": f.Status, "platform_id": f.Platform, "category": f.Category,
+		"error_code": f.ErrorCode, "user": f.User, "workspace": f.Workspace,
+	} {
+		if value != "" {
+			query = query.Where(column+" = ?", value)
+			conds++
+		}
+	}
+	if f.BatchID != nil {
+		query = query.Where("batch_id = ?", *f.BatchID)
+		conds++
+	}
+	if f.Tag != "" {
+		query = query.Where("id IN (?)", db.Model(&ImageTag{}).Select("image_id").Where("tag = ?", f.Tag))
+		conds++
+	}
+	if f.Collection != "" {
+		query = query.Where("id IN (?)", db.Model(&CollectionImage{}).Select("image_id").Where("collection = ?", f.Collection))
+		conds++
+	}
+	for _, d := range []struct{ value, op string }{{f.Before, "<"}, {f.After, ">="}} {
+		if d.value == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", d.value); err != nil {
+			return nil, fmt.Errorf("日期格式应为 YYYY-MM-DD: %s", d.value)
+		}
+		query = query.Where("date "+d.op+" ?", d.value)
+		conds++
+	}
+	if len(f.Metadata) > 0 {
+		var err error
+		if query, err = filterMetadata(query, f.Metadata); err != nil {
+			return nil, err
+		}
+		conds++
+	}
+	if conds == 0 {
+		return nil, fmt.Errorf("请至少指定一个筛选条件")
+	}
+	return query, nil
+}
+
+// bulkDeletePreview 预览时匹配到的记录，确认删除时只删除这些记录，预览后新增的匹配记录不受影响
+type bulkDeletePreview struct {
+	Filter    bulkFilter
+	IDs       []uint
+	ExpiresAt time.Time
+}
+
+var (
+	bulkDeleteMu       sync.Mutex
+	bulkDeletePreviews = make(map[string]*bulkDeletePreview)
+)
+
+// ========== 批量删除 API ==========
+
+// bulkDeleteImages POST /api/images/bulk-delete
+// 先以 dry_run（默认）预览匹配的记录并取得 confirm_token，再带 confirm_token 执行删除
+func bulkDeleteImages(c *gin.Context) {
+	var req struct {
+		Filter       bulkFilter `json:"filter"`
+		DryRun       *bool      `json:"dry_run"`
+		ConfirmToken string     `json:"confirm_token"`
+		DeleteFiles  bool       `json:"delete_files"` // 同时删除图片文件
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if req.ConfirmToken == "" && req.DryRun != nil && !*req.DryRun {
+		c.JSON(400, gin.H{"error": "请先预览（dry_run）取得 confirm_token 再执行删除"})
+		return
+	}
+	if req.ConfirmToken == "" || (req.DryRun != nil && *req.DryRun) {
+		previewBulkDelete(c, req.Filter)
+		return
+	}
+
+	bulkDeleteMu.Lock()
+	preview, ok := bulkDeletePreviews[req.ConfirmToken]
+	delete(bulkDeletePreviews, req.ConfirmToken)
+	bulkDeleteMu.Unlock()
+	if !ok || time.Now().After(preview.ExpiresAt) {
+		c.JSON(400, gin.H{"error": "confirm_token 无效或已过期，请重新预览"})
+		return
+	}
+
+	var records []ImageRecord
+	db.Select("id", "path", "file_size").Where("id IN ?", preview.IDs).Find(&records)
+	user := currentUser(c)
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for start := 0; start < len(preview.IDs); start += 500 {
+			ids := preview.IDs[start:min(start+500, len(preview.IDs))]
+			if err := tx.Where("id IN ?", ids).Delete(&ImageRecord{}).Error; err != nil {
+				return err
+			}
+			if err := deleteImageLabels(tx, ids); err != nil {
+				return err
+			}
+		}
+		for _, r := range records {
+			if err := emitEvent(tx, "image.deleted", gin.H{"id": r.ID, "actor": user, "bulk": true}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	actor := user
+	if actor == "" {
+		actor = "anonymous"
+	}
+	activities := make([]Activity, len(records))
+	var freed int64
+	for i, r := range records {
+		activities[i] = Activity{Type: "deleted", ImageID: r.ID, Actor: actor, Detail: "批量删除"}
+		if req.DeleteFiles && r.Path != "" {
+			if err := os.Remove(r.Path); err == nil {
+				freed += r.FileSize
+			}
+		}
+	}
+	if len(activities) > 0 {
+		db.CreateInBatches(activities, 500)
+	}
+	log.Printf("🗑️ 批量删除 %d 条记录（操作人 %s，筛选 %+v）", len(records), actor, preview.Filter)
+	c.JSON(200, gin.H{"message": "success", "deleted": len(records), "freed_bytes": freed})
+}
+
+func previewBulkDelete(c *gin.Context, filter bulkFilter) {
+	query, err := filter.apply(db.Model(&ImageRecord{}))
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	var records []ImageRecord
+	query.Select("id", "status", "file_size").Order("id").Limit(bulkDeleteLimit + 1).Find(&records)
+	if len(records) > bulkDeleteLimit {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("匹配记录超过 %d 条，请缩小筛选范围", bulkDeleteLimit)})
+		return
+	}
+
+	ids := make([]uint, len(records))
+	byStatus := map[string]int{}
+	var bytes int64
+	for i, r := range records {
+		ids[i] = r.ID
+		byStatus[r.Status]++
+		bytes += r.FileSize
+	}
+	result := gin.H{"dry_run": true, "matched": len(ids), "by_status": byStatus, "bytes": bytes, "sample_ids": ids[:min(len(ids), 20)]}
+	if len(ids) > 0 {
+		token := newToken()
+		expires := time.Now().Add(bulkDeleteTTL)
+		bulkDeleteMu.Lock()
+		for t, p := range bulkDeletePreviews {
+			if time.Now().After(p.ExpiresAt) {
+				delete(bulkDeletePreviews, t)
+			}
+		}
+		bulkDeletePreviews[token] = &bulkDeletePreview{Filter: filter, IDs: ids, ExpiresAt: expires}
+		bulkDeleteMu.Unlock()
+		result["confirm_token"] = token
+		result["expires_at"] = expires
+	}
+	c.JSON(200, result)
+}
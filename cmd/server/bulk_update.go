@@ -0,0 +1,269 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ========== 标签与合集 ==========
+
+// ImageTag 图片标签，一张图片可以有多个标签
+type ImageTag struct {
+	ImageID   uint      `gorm:"primaryKey" json:"image_id"`
+	Tag       string    `gorm:"primaryKey;size:50;index" json:"tag"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (ImageTag) TableName() string {
+	return "image_tags"
+}
+
+// CollectionImage 合集成员，合集按名称区分，加入第一张图片时创建
+type CollectionImage struct {
+	Collection string    `gorm:"primaryKey;size:100;index" json:"collection"`
+	ImageID    uint      `gorm:"primaryKey" json:"image_id"`
+	AddedBy    string    `gorm:"size:100" json:"added_by"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (CollectionImage) TableName() string {
+	return "collection_images"
+}
+
+// normalizeNames 去掉空白和重复的标签或合集名，超长时返回错误
+func normalizeNames(names []string, maxLen int) ([]string, error) {
+	seen := map[string]bool{}
+	result := make([]string, 0, len(names))
+	for _, n := range names {
+		n = strings.TrimSpace(n)
+		if n == "" || seen[n] {
+			continue
+		}
+		if len([]rune(n)) > maxLen {
+			return nil, fmt.Errorf("名称超过 %d 个字符: %s", maxLen, n)
+		}
+		seen[n] = true
+		result = append(result, n)
+	}
+	return result, nil
+}
+
+// deleteImageLabels 删除图片时一并删除其标签和合集成员
+func deleteImageLabels(tx *gorm.DB, ids []uint) error {
+	if err := tx.Where("image_id IN ?", ids).Delete(&ImageTag{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("image_id IN ?", ids).Delete(&CollectionImage{}).Error
+}
+
+// ========== 批量修改 ==========
+
+// 单次批量修改的记录数上限
+const bulkUpdateLimit = 5000
+
+// bulkChanges 批量修改的内容，未指定的字段不修改
+type bulkChanges struct {
+	Category          *string  `json:"category"` // 空字符串为清除分类
+	AddTags           []string `json:"add_tags"`
+	RemoveTags        []string `json:"remove_tags"`
+	AddCollections    []string `json:"add_collections"`
+	RemoveCollections []string `json:"remove_collections"`
+	Pinned            *bool    `json:"pinned"` // 待审核列表置顶（优先审核）
+}
+
+// validate 检查并规范化修改内容，没有任何修改时返回错误
+func (ch *bulkChanges) validate() error {
+	if ch.Category != nil && !categoryExists(*ch.Category) {
+		return fmt.Errorf("分类不存在: %s", *ch.Category)
+	}
+	var err error
+	for _, f := range []struct {
+		names  *[]string
+		maxLen int
+	}{{&ch.AddTags, 50}, {&ch.RemoveTags, 50}, {&ch.AddCollections, 100}, {&ch.RemoveCollections, 100}} {
+		if *f.names, err = normalizeNames(*f.names, f.maxLen); err != nil {
+			return err
+		}
+	}
+	if ch.Category == nil && ch.Pinned == nil && len(ch.AddTags)+len(ch.RemoveTags)+len(ch.AddCollections)+len(ch.RemoveCollections) == 0 {
+		return fmt.Errorf("请至少指定一项修改")
+	}
+	return nil
+}
+
+// summary 修改内容的描述，记入动态
+func (ch *bulkChanges) summary() string {
+	var parts []string
+	if ch.Category != nil {
+		parts = append(parts, "分类="+*ch.Category)
+	}
+	if ch.Pinned != nil {
+		parts = append(parts, fmt.Sprintf("置顶=%v", *ch.Pinned))
+	}
+	for _, f := range []struct {
+		label string
+		names []string
+	}{{"+标签", ch.AddTags}, {"-标签", ch.RemoveTags}, {"+合集", ch.AddCollections}, {"-合集", ch.RemoveCollections}} {
+		if len(f.names) > 0 {
+			parts = append(parts, f.label+" "+strings.Join(f.names, ","))
+		}
+	}
+	return "批量修改: " + strings.Join(parts, "; ")
+}
+
+// apply 在事务中修改一批记录
+func (ch *bulkChanges) apply(tx *gorm.DB, ids []uint, user string) error {
+	updates := map[string]interface{}{}
+	if ch.Category != nil {
+		updates["category"] = *ch.Category
+	}
+	if ch.Pinned != nil {
+		// 只有待审核的图片可以置顶
+		pinQuery := tx.Model(&ImageRecord{}).Where("id IN ?", ids)
+		pin := map[string]interface{}{"pinned": false, "pinned_at": nil}
+		if *ch.Pinned {
+			pinQuery = pinQuery.Where("status = ? AND pinned = ?", "pending", false)
+			pin = map[string]interface{}{"pinned": true, "pinned_at": time.Now()}
+		}
+		if err := pinQuery.Updates(pin).Error; err != nil {
+			return err
+		}
+	}
+	if len(updates) > 0 {
+		if err := tx.Model(&ImageRecord{}).Where("id IN ?", ids).Updates(updates).Error; err != nil {
+			return err
+		}
+	}
+	if len(ch.RemoveTags) > 0 {
+		if err := tx.Where("image_id IN ? AND tag IN ?", ids, ch.RemoveTags).Delete(&ImageTag{}).Error; err != nil {
+			return err
+		}
+	}
+	if len(ch.RemoveCollections) > 0 {
+		if err := tx.Where("image_id IN ? AND collection IN ?", ids, ch.RemoveCollections).Delete(&CollectionImage{}).Error; err != nil {
+			return err
+		}
+	}
+	now := time.Now()
+	var tags []ImageTag
+	var members []CollectionImage
+	for _, id := range ids {
+		for _, t := range ch.AddTags {
+			tags = append(tags, ImageTag{ImageID: id, Tag: t, CreatedAt: now})
+		}
+		for _, col := range ch.AddCollections {
+			members = append(members, CollectionImage{Collection: col, ImageID: id, AddedBy: user, CreatedAt: now})
+		}
+	}
+	// 已有的标签和合集成员保持不变
+	if len(tags) > 0 {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(tags, 500).Error; err != nil {
+			return err
+		}
+	}
+	if len(members) > 0 {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(members, 500).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ========== 批量修改 API ==========
+
+// bulkUpdateImages POST /api/images/bulk-update
+// 按 ids 或筛选条件批量修改分类、标签、合集和置顶，全部在一个事务中完成；dry_run 只返回匹配的记录数
+func bulkUpdateImages(c *gin.Context) {
+	var req struct {
+		IDs     []uint      `json:"ids"`
+		Filter  bulkFilter  `json:"filter"`
+		Changes bulkChanges `json:"changes"`
+		DryRun  bool        `json:"dry_run"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.Changes.validate(); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	query := db.Model(&ImageRecord{})
+	if len(req.IDs) > 0 {
+		query = query.Where("id IN ?", req.IDs)
+	} else {
+		var err error
+		if query, err = req.Filter.apply(query); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	var ids []uint
+	query.Order("id").Limit(bulkUpdateLimit+1).Pluck("id", &ids)
+	if len(ids) > bulkUpdateLimit {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("匹配记录超过 %d 条，请缩小筛选范围", bulkUpdateLimit)})
+		return
+	}
+	if req.DryRun || len(ids) == 0 {
+		c.JSON(200, gin.H{"dry_run": req.DryRun, "matched": len(ids), "sample_ids": ids[:min(len(ids), 20)]})
+		return
+	}
+
+	user := currentUser(c)
+	detail := req.Changes.summary()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for start := 0; start < len(ids); start += 500 {
+			if err := req.Changes.apply(tx, ids[start:min(start+500, len(ids))], user); err != nil {
+				return err
+			}
+		}
+		for _, id := range ids {
+			if err := emitEvent(tx, "image.updated", gin.H{"id": id, "actor": user, "changes": req.Changes, "bulk": true}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	actor := user
+	if actor == "" {
+		actor = "anonymous"
+	}
+	activities := make([]Activity, len(ids))
+	for i, id := range ids {
+		activities[i] = Activity{Type: "updated", ImageID: id, Actor: actor, Detail: detail}
+	}
+	db.CreateInBatches(activities, 500)
+	log.Printf("🏷️ 批量修改 %d 条记录（操作人 %s）: %s", len(ids), actor, detail)
+	c.JSON(200, gin.H{"message": "success", "updated": len(ids)})
+}
+
+// listTags GET /api/tags，各标签的图片数
+func listTags(c *gin.Context) {
+	var rows []struct {
+		Tag   string `json:"tag"`
+		Count int64  `json:"count"`
+	}
+	db.Model(&ImageTag{}).Select("tag, COUNT(*) AS count").Group("tag").Order("count DESC").Scan(&rows)
+	c.JSON(200, gin.H{"tags": rows})
+}
+
+// listCollections GET /api/collections，各合集的图片数
+func listCollections(c *gin.Context) {
+	var rows []struct {
+		Collection string `json:"collection"`
+		Count      int64  `json:"count"`
+	}
+	db.Model(&CollectionImage{}).Select("collection, COUNT(*) AS count").Group("collection").Order("collection").Scan(&rows)
+	c.JSON(200, gin.H{"collections": rows})
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ========== 内容日历 ==========
+
+// CalendarEntry 某天计划生成的内容，到 calendar.runAt 时由调度器自动生成
+type CalendarEntry struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	Date      string     `gorm:"size:20;index;not null" json:"date"` // 业务时区日期
+	Topic     string     `gorm:"size:255;not null" json:"topic"`
+	Template  string     `gorm:"size:100" json:"template"` // templates 中的模板名，用其 prompt 渲染提示词
+	Prompt    string     `gorm:"size:1000" json:"prompt"`  // 直接指定提示词，优先于模板
+	Platform  string     `gorm:"size:50" json:"platform"`
+	Model     string     `gorm:"size:100" json:"model"`
+	Size      string     `gorm:"size:20" json:"size"`
+	Category  string     `gorm:"size:50" json:"category"`
+	Count     int        `gorm:"default:1" json:"count"`
+	Status    string     `gorm:"size:20;default:'planned';index" json:"status"` // planned, running, done, failed
+	Generated int        `json:"generated"`
+	Failed    int        `json:"failed"`
+	CreatedBy string     `gorm:"size:100" json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	RanAt     *time.Time `json:"ran_at"`
+}
+
+func (CalendarEntry) TableName() string {
+	return "calendar_entries"
+}
+
+// calendarPrompt 计算条目的提示词：指定提示词 > 模板渲染 > 主题
+// 临近节日且配置了节日模板时，自动改用节日模板
+func calendarPrompt(e *CalendarEntry) (string, error) {
+	if e.Prompt != "" {
+		return e.Prompt, nil
+	}
+	date, err := time.ParseInLocation("2006-01-02", e.Date, bizLoc)
+	if err != nil {
+		return "", err
+	}
+	name := e.Template
+	if preset := holidayPreset(date); preset != "" {
+		name = preset
+	}
+	if name != "" {
+		t, ok := cfg.Templates[name]
+		if !ok {
+			return "", fmt.Errorf("模板不存在: %s", name)
+		}
+		prompt, err := renderTemplateAt(t.Prompt, map[string]interface{}{
+			"Topic":    e.Topic,
+			"Date":     e.Date,
+			"Category": e.Category,
+		}, date)
+		if err != nil {
+			return "", err
+		}
+		if prompt != "" {
+			return prompt, nil
+		}
+	}
+	return e.Topic, nil
+}
+
+// reachedRunAt now 是否已到当天的 runAt（HH:MM，按 now 所在时区解释），runAt 在加载配置时已校验
+func reachedRunAt(now time.Time, runAt string) bool {
+	t, err := time.Parse("15:04", runAt)
+	if err != nil {
+		return false
+	}
+	slot := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, now.Location())
+	return !now.Before(slot)
+}
+
+// runCalendarScheduler 每分钟检查一次，到达 runAt 后生成当天计划的内容
+func runCalendarScheduler() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		if !cfg.Calendar.Enabled || !reachedRunAt(bizNow(), cfg.Calendar.RunAt) {
+			continue
+		}
+		var entries []CalendarEntry
+		db.Where("date = ? AND status = ?", today(), "planned").Find(&entries)
+		for i := range entries {
+			// 多实例部署时只有抢到的实例执行
+			res := db.Model(&CalendarEntry{}).Where("id = ? AND status = ?", entries[i].ID, "planned").Update("status", "running")
+			if res.Error != nil || res.RowsAffected == 0 {
+				continue
+			}
+			runCalendarEntry(&entries[i])
+		}
+	}
+}
+
+// runCalendarEntry 生成条目计划的图片，完成后通知审核人
+func runCalendarEntry(e *CalendarEntry) {
+	finish := func(status string, generated, failed int, detail string) {
+		now := time.Now()
+		db.Model(&CalendarEntry{}).Where("id = ?", e.ID).Updates(map[string]interface{}{
+			"status": status, "generated": generated, "failed": failed, "ran_at": now})
+		log.Printf("📅 日历 #%d %s: %s", e.ID, status, detail)
+	}
+
+	prompt, err := calendarPrompt(e)
+	if err != nil {
+		finish("failed", 0, e.Count, err.Error())
+		return
+	}
+	platform := e.Platform
+	if platform == "" {
+		platform = cfg.Calendar.Platform
+	}
+	if platform == "" {
+		platform = getOrCreateSettings().Platform
+	}
+	if verdict := checkPromptPolicy(context.Background(), prompt, platform); verdict.Blocked {
+		finish("failed", 0, e.Count, "提示词不符合内容策略: "+verdict.Reason)
+		return
+	}
+
+	base := ImageRecord{User: "calendar", Category: e.Category, CalendarID: &e.ID}
+	var (
+		mu  sync.Mutex
+		ids []uint
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, cfg.ImageGen.MaxWorkers)
+	)
+	for i := 0; i < e.Count; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			record, err := generateAndSave(jobContext("calendar", e.ID), platform, prompt, e.Size, e.Model, base)
+			if err != nil {
+				log.Printf("📅 日历 #%d 生成失败: %v", e.ID, err)
+				return
+			}
+			mu.Lock()
+			ids = append(ids, record.ID)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	failed := e.Count - len(ids)
+	status := "done"
+	if len(ids) == 0 {
+		status = "failed"
+	}
+	finish(status, len(ids), failed, fmt.Sprintf("生成 %d 张，失败 %d 张", len(ids), failed))
+	if len(ids) > 0 {
+		notifyCalendarReviewers(e, ids)
+	}
+}
+
+// notifyCalendarReviewers 通过事件通知审核人有新的待审核内容，由 webhook 订阅方推送
+func notifyCalendarReviewers(e *CalendarEntry, ids []uint) {
+	payload := gin.H{
+		"entry_id":  e.ID,
+		"date":      e.Date,
+		"topic":     e.Topic,
+		"image_ids": ids,
+		"reviewers": cfg.Calendar.Reviewers,
+		"message":   fmt.Sprintf("%s「%s」已生成 %d 张图片，请审核", e.Date, e.Topic, len(ids)),
+	}
+	if err := emitEvent(db, "calendar.generated", payload); err != nil {
+		log.Printf("📅 日历 #%d 通知失败: %v", e.ID, err)
+	}
+	notifyReviewers(cfg.Calendar.Reviewers, payload["message"].(string), e.Topic, fmt.Sprintf("/api/calendar/%d", e.ID))
+}
+
+// ========== 内容日历 API ==========
+
+// listCalendar GET /api/calendar?from=&to=，默认今天起 7 天
+func listCalendar(c *gin.Context) {
+	from := c.DefaultQuery("from", today())
+	to := c.Query("to")
+	if to == "" {
+		start, err := time.ParseInLocation("2006-01-02", from, bizLoc)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "from 格式应为 YYYY-MM-DD"})
+			return
+		}
+		to = start.AddDate(0, 0, 6).Format("2006-01-02")
+	}
+	var entries []CalendarEntry
+	db.Where("date BETWEEN ? AND ?", from, to).Order("date, id").Find(&entries)
+	c.JSON(200, gin.H{"entries": entries, "total": len(entries), "from": from, "to": to})
+}
+
+// calendarRequest 创建和修改条目的请求体
+type calendarRequest struct {
+	Date     string `json:"date" binding:"required"`
+	Topic    string `json:"topic" binding:"required"`
+	Template string `json:"template"`
+	Prompt   string `json:"prompt"`
+	Platform string `json:"platform"`
+	Model    string `json:"model"`
+	Size     string `json:"size"`
+	Category string `json:"category"`
+	Count    int    `json:"count"`
+}
+
+// validate 校验请求，返回错误信息
+func (req *calendarRequest) validate() string {
+	if _, err := time.ParseInLocation("2006-01-02", req.Date, bizLoc); err != nil {
+		return "date 格式应为 YYYY-MM-DD"
+	}
+	if req.Count <= 0 {
+		req.Count = 1
+	}
+	if req.Count > 20 {
+		return "count 最大为 20"
+	}
+	if req.Template != "" {
+		if _, ok := cfg.Templates[req.Template]; !ok {
+			return "模板不存在: " + req.Template
+		}
+	}
+	if req.Platform != "" {
+		if p, ok := cfg.Platforms[req.Platform]; !ok || !p.Enabled {
+			return "平台不可用: " + req.Platform
+		}
+	}
+	if !categoryExists(req.Category) {
+		return "分类不存在: " + req.Category
+	}
+	return ""
+}
+
+func createCalendarEntry(c *gin.Context) {
+	var req calendarRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		c.JSON(400, gin.H{"error": msg})
+		return
+	}
+	entry := CalendarEntry{
+		Date:      req.Date,
+		Topic:     req.Topic,
+		Template:  req.Template,
+		Prompt:    req.Prompt,
+		Platform:  req.Platform,
+		Model:     req.Model,
+		Size:      req.Size,
+		Category:  req.Category,
+		Count:     req.Count,
+		Status:    "planned",
+		CreatedBy: currentUser(c),
+	}
+	if err := db.Create(&entry).Error; err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, entry)
+}
+
+// updateCalendarEntry 只能修改尚未执行的条目
+func updateCalendarEntry(c *gin.Context) {
+	var entry CalendarEntry
+	if err := db.First(&entry, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{"error": "日历条目不存在"})
+		return
+	}
+	if entry.Status != "planned" {
+		c.JSON(400, gin.H{"error": "条目已执行，不能修改"})
+		return
+	}
+	var req calendarRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		c.JSON(400, gin.H{"error": msg})
+		return
+	}
+	entry.Date = req.Date
+	entry.Topic = req.Topic
+	entry.Template = req.Template
+	entry.Prompt = req.Prompt
+	entry.Platform = req.Platform
+	entry.Model = req.Model
+	entry.Size = req.Size
+	entry.Category = req.Category
+	entry.Count = req.Count
+	db.Save(&entry)
+	c.JSON(200, entry)
+}
+
+func deleteCalendarEntry(c *gin.Context) {
+	db.Delete(&CalendarEntry{}, c.Param("id"))
+	c.JSON(200, gin.H{"message": "success"})
+}
+
+// getCalendarEntry 条目详情及已生成的图片
+func getCalendarEntry(c *gin.Context) {
+	var entry CalendarEntry
+	if err := db.First(&entry, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{"error": "日历条目不存在"})
+		return
+	}
+	var records []ImageRecord
+	db.Where("calendar_id = ?", entry.ID).Order("generated_at").Find(&records)
+	c.JSON(200, gin.H{"entry": entry, "records": withImageURLs(records)})
+}
+
+// runCalendarEntryNow 立即执行条目，不等到 runAt
+func runCalendarEntryNow(c *gin.Context) {
+	var entry CalendarEntry
+	if err := db.First(&entry, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{"error": "日历条目不存在"})
+		return
+	}
+	res := db.Model(&CalendarEntry{}).Where("id = ? AND status = ?", entry.ID, "planned").Update("status", "running")
+	if res.RowsAffected == 0 {
+		c.JSON(400, gin.H{"error": "条目已执行"})
+		return
+	}
+	go runCalendarEntry(&entry)
+	c.JSON(200, gin.H{"message": "success", "entry_id": entry.ID})
+}
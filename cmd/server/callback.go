@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ========== 生成完成回调 ==========
+
+// validateCallbackURL 回调地址必须是 http(s)；配置了 events.callbackHosts 时只允许其中的域名及其子域名
+func validateCallbackURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("callback_url 应为 http(s) 地址: %s", raw)
+	}
+	if len(cfg.Events.CallbackHosts) == 0 {
+		return nil
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, allowed := range cfg.Events.CallbackHosts {
+		allowed = strings.ToLower(allowed)
+		if host == allowed || strings.HasSuffix(host, "."+allowed) {
+			return nil
+		}
+	}
+	return fmt.Errorf("callback_url 的域名不在允许范围内: %s", host)
+}
+
+// taskCallback 异步任务结束时把结果 POST 到任务的 callback_url，经事件发件箱投递，失败时按同样的策略重试
+func taskCallback(t GenerateTask) {
+	if t.CallbackURL == "" {
+		return
+	}
+	var records []ImageRecord
+	if len(t.ImageIDs) > 0 {
+		db.Select("id", "path", "status").Where("id IN ?", t.ImageIDs).Order("id").Find(&records)
+	}
+	items := make([]gin.H, len(records))
+	for i, r := range records {
+		items[i] = gin.H{"id": r.ID, "path": r.Path, "image_url": imageURL(r.Path), "status": r.Status}
+	}
+	payload := gin.H{
+		"task_id":    t.ID,
+		"status":     t.Status,
+		"platform":   t.Platform,
+		"prompt":     t.Prompt,
+		"image_ids":  t.ImageIDs,
+		"records":    items,
+		"error":      t.Error,
+		"error_code": t.ErrorCode,
+	}
+	if err := emitCallback(db, t.CallbackURL, "task.finished", payload); err != nil {
+		log.Printf("🧵 任务 %s 回调写入失败: %v", t.ID, err)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"image-platform/internal/generator"
+)
+
+// ========== 平台能力 ==========
+
+// CapabilitiesConfig 平台支持的模型、尺寸和限制，未配置的项查询平台接口或使用内置值
+type CapabilitiesConfig struct {
+	Models          []string `yaml:"models"`          // 可用模型，为空时查询平台接口，查询失败使用内置列表
+	Sizes           []string `yaml:"sizes"`           // 只支持这些 宽x高（如固定尺寸的平台），为空不限制
+	MaxN            int      `yaml:"maxN"`            // 单次最多生成张数，为空为 10
+	MaxPromptLength int      `yaml:"maxPromptLength"` // 提示词最多字符数，0 为不限制
+}
+
+// platformCapabilities 平台当前的能力，页面下拉框和生成前的参数检查都以此为准
+type platformCapabilities struct {
+	Platform        string            `json:"platform"`
+	DefaultModel    string            `json:"default_model"`
+	Models          []string          `json:"models"`
+	ModelSource     string            `json:"model_source"` // config: 配置, provider: 平台接口, static: 内置列表
+	Sizes           []string          `json:"sizes"`        // 为空不限制
+	Presets         map[string]string `json:"presets"`      // 预设名 → 该平台的 宽x高
+	MaxN            int               `json:"max_n"`
+	MaxPromptLength int               `json:"max_prompt_length"`
+	Img2Img         bool              `json:"img2img"`
+	Inpaint         bool              `json:"inpaint"`
+	Control         []string          `json:"control"` // 支持的参考图引导模式
+	FetchedAt       time.Time         `json:"fetched_at"`
+	ExpiresAt       time.Time         `json:"expires_at"`
+}
+
+var (
+	capabilitiesMu    sync.Mutex
+	capabilitiesCache = map[string]*platformCapabilities{}
+)
+
+// capabilities 读取平台能力，缓存过期或 refresh 时重新获取；平台接口查询失败时同样缓存内置列表，避免每次请求都重试
+func capabilities(platform string, refresh bool) *platformCapabilities {
+	capabilitiesMu.Lock()
+	cached, ok := capabilitiesCache[platform]
+	capabilitiesMu.Unlock()
+	if ok && !refresh && time.Now().Before(cached.ExpiresAt) {
+		return cached
+	}
+
+	caps := loadCapabilities(platform)
+	capabilitiesMu.Lock()
+	capabilitiesCache[platform] = caps
+	capabilitiesMu.Unlock()
+	return caps
+}
+
+// loadCapabilities 按配置、平台接口和内置值组装平台能力
+func loadCapabilities(platform string) *platformCapabilities {
+	p := cfg.Platforms[platform]
+	pc := p.Capabilities
+	gc := generator.CapabilitiesOf(p.Type)
+	now := time.Now()
+	caps := &platformCapabilities{
+		Platform:        platform,
+		DefaultModel:    p.Model,
+		Sizes:           []string{},
+		Presets:         platformPresets(p),
+		MaxN:            pc.MaxN,
+		MaxPromptLength: pc.MaxPromptLength,
+		Img2Img:         gc.Img2Img,
+		Inpaint:         gc.Inpaint,
+		Control:         platformControlModes(platform),
+		FetchedAt:       now,
+		ExpiresAt:       now.Add(time.Duration(cfg.ImageGen.CapabilitiesTTL) * time.Minute),
+	}
+	if caps.MaxN == 0 || caps.MaxN > maxImagesPerRequest {
+		caps.MaxN = maxImagesPerRequest
+	}
+	for _, s := range pc.Sizes {
+		caps.Sizes = append(caps.Sizes, normalizeSize(s))
+	}
+
+	if len(pc.Models) > 0 {
+		caps.Models, caps.ModelSource = pc.Models, "config"
+	} else if models, err := fetchProviderModels(p); err == nil && len(models) > 0 {
+		caps.Models, caps.ModelSource = models, "provider"
+	} else {
+		if err != nil {
+			log.Printf("[%s] 查询模型列表失败，使用内置列表: %v", p.Name, err)
+		}
+		caps.Models, caps.ModelSource = []string{}, "static"
+		for _, m := range staticModels(p) {
+			if m != "" {
+				caps.Models = append(caps.Models, m)
+			}
+		}
+	}
+	return caps
+}
+
+// checkCapabilities 生成前按平台能力检查参数，size 可为预设名
+// 内置的模型列表不完整，只有配置或平台接口返回的列表才检查模型
+func checkCapabilities(platform, model, size string, n int, prompt string) error {
+	if _, ok := cfg.Platforms[platform]; !ok {
+		return nil
+	}
+	caps := capabilities(platform, false)
+	if n > caps.MaxN {
+		return fmt.Errorf("%s 单次最多生成 %d 张", platform, caps.MaxN)
+	}
+	if caps.MaxPromptLength > 0 && len([]rune(prompt)) > caps.MaxPromptLength {
+		return fmt.Errorf("%s 的提示词最多 %d 个字符，当前 %d 个", platform, caps.MaxPromptLength, len([]rune(prompt)))
+	}
+	if model != "" && caps.ModelSource != "static" && !containsString(caps.Models, model) {
+		return fmt.Errorf("%s 不支持模型 %s", platform, model)
+	}
+	if len(caps.Sizes) > 0 {
+		if resolved := resolveSize(platform, size); resolved != "" && !containsString(caps.Sizes, resolved) {
+			return fmt.Errorf("%s 只支持尺寸 %s", platform, strings.Join(caps.Sizes, "、"))
+		}
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// validateCapabilities 启动时检查配置的尺寸格式和限制
+func validateCapabilities() error {
+	keys := make([]string, 0, len(cfg.Platforms))
+	for key := range cfg.Platforms {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		pc := cfg.Platforms[key].Capabilities
+		for _, s := range pc.Sizes {
+			if _, _, err := localSize(normalizeSize(s)); err != nil {
+				return fmt.Errorf("平台 %s 的 capabilities.sizes 格式错误: %s", key, s)
+			}
+		}
+		if pc.MaxN < 0 || pc.MaxPromptLength < 0 {
+			return fmt.Errorf("平台 %s 的 capabilities.maxN、maxPromptLength 不能为负数", key)
+		}
+	}
+	return nil
+}
+
+// ========== 平台能力 API ==========
+
+// getPlatformCapabilities GET /api/platforms/:id/capabilities?refresh=true，refresh 时忽略缓存重新获取
+func getPlatformCapabilities(c *gin.Context) {
+	key := c.Param("id")
+	if p, ok := cfg.Platforms[key]; !ok || !p.Enabled {
+		c.JSON(404, gin.H{"error": "平台不存在或未启用"})
+		return
+	}
+	c.JSON(200, capabilities(key, c.Query("refresh") == "true"))
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ========== 分类 ==========
+
+// Category 图片分类（节日、产品、科普……）
+type Category struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Name        string    `gorm:"size:50;uniqueIndex;not null" json:"name"`
+	Description string    `gorm:"size:255" json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func (Category) TableName() string {
+	return "categories"
+}
+
+// categoryExists 空分类视为合法（未分类）
+func categoryExists(name string) bool {
+	if name == "" {
+		return true
+	}
+	var count int64
+	db.Model(&Category{}).Where("name = ?", name).Count(&count)
+	return count > 0
+}
+
+// filterCategory 按 ?category= 过滤图片查询
+func filterCategory(c *gin.Context, query *gorm.DB) *gorm.DB {
+	if category := c.Query("category"); category != "" {
+		return query.Where("category = ?", category)
+	}
+	return query
+}
+
+// ========== 分类管理 API ==========
+func listCategories(c *gin.Context) {
+	var categories []Category
+	db.Order("name").Find(&categories)
+
+	// 附带每个分类下的图片数量
+	var counts []struct {
+		Category string
+		Count    int64
+	}
+	db.Model(&ImageRecord{}).Select("category, COUNT(*) AS count").Group("category").Scan(&counts)
+	usage := make(map[string]int64)
+	for _, row := range counts {
+		usage[row.Category] = row.Count
+	}
+
+	result := make([]gin.H, len(categories))
+	for i, cat := range categories {
+		result[i] = gin.H{
+			"id":          cat.ID,
+			"name":        cat.Name,
+			"description": cat.Description,
+			"images":      usage[cat.Name],
+		}
+	}
+	c.JSON(200, gin.H{"categories": result, "uncategorized": usage[""]})
+}
+
+func createCategory(c *gin.Context) {
+	var req struct {
+		Name        string `json:"name" binding:"required"`
+		Description string `json:"description"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	cat := Category{Name: strings.TrimSpace(req.Name), Description: req.Description}
+	if err := db.Create(&cat).Error; err != nil {
+		c.JSON(409, gin.H{"error": "分类已存在或创建失败: " + err.Error()})
+		return
+	}
+	c.JSON(200, cat)
+}
+
+// updateCategory 修改分类，改名时同步更新已有图片
+func updateCategory(c *gin.Context) {
+	var cat Category
+	if err := db.First(&cat, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{"error": "分类不存在"})
+		return
+	}
+	var req struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	oldName := cat.Name
+	if name := strings.TrimSpace(req.Name); name != "" {
+		cat.Name = name
+	}
+	if req.Description != "" {
+		cat.Description = req.Description
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&cat).Error; err != nil {
+			return err
+		}
+		if cat.Name != oldName {
+			return tx.Model(&ImageRecord{}).Where("category = ?", oldName).Update("category", cat.Name).Error
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, cat)
+}
+
+// deleteCategory 仅允许删除未被使用的分类
+func deleteCategory(c *gin.Context) {
+	var cat Category
+	if err := db.First(&cat, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{"error": "分类不存在"})
+		return
+	}
+	var count int64
+	db.Model(&ImageRecord{}).Where("category = ?", cat.Name).Count(&count)
+	if count > 0 {
+		c.JSON(409, gin.H{"error": "分类下仍有图片，无法删除", "images": count})
+		return
+	}
+	db.Delete(&cat)
+	c.JSON(200, gin.H{"message": "success"})
+}
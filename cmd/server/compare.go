@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"image-platform/internal/generator"
+)
+
+// ========== 全平台对比 ==========
+
+// Comparison 同一提示词在全部启用平台上各生成一张，并发执行，结果并排查看，用于为某种风格挑选平台
+// 与对比实验不同：不需要指定平台和次数，不做降级，同时记录各平台的耗时
+type Comparison struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	Prompt     string     `gorm:"size:1000;not null" json:"prompt"`
+	Size       string     `gorm:"size:20" json:"size"`
+	Platforms  string     `gorm:"size:500;not null" json:"platforms"`      // 逗号分隔的平台 ID
+	Status     string     `gorm:"size:20;default:'running'" json:"status"` // running, done
+	Outcomes   string     `gorm:"type:text" json:"-"`                      // 各平台的耗时和错误 JSON
+	User       string     `gorm:"size:100" json:"user"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
+
+func (Comparison) TableName() string {
+	return "comparisons"
+}
+
+// comparisonOutcome 单个平台的对比结果，跳过的平台只有 Error
+type comparisonOutcome struct {
+	DurationMs int64  `json:"duration_ms,omitempty"`
+	Error      string `json:"error,omitempty"`
+	ErrorCode  string `json:"error_code,omitempty"`
+	Skipped    bool   `json:"skipped,omitempty"` // 暂停接收新任务、熔断或限流暂停中，未调用
+}
+
+// comparablePlatforms 参与对比的平台：指定了 platforms 时只取其中启用的，否则为全部启用且已配置好的平台，按 ID 排序
+func comparablePlatforms(requested []string) []string {
+	var platforms []string
+	if len(requested) > 0 {
+		for _, plat := range requested {
+			if p, ok := cfg.Platforms[plat]; ok && p.Enabled {
+				platforms = append(platforms, plat)
+			}
+		}
+		return platforms
+	}
+	for key, p := range cfg.Platforms {
+		if p.Enabled && platformReady(p) {
+			platforms = append(platforms, key)
+		}
+	}
+	sort.Strings(platforms)
+	return platforms
+}
+
+// runComparison 通过 generator.GenerateAll 同时调用全部平台，成功的入库为待审核记录，失败的记入失败列表
+func runComparison(cmp Comparison, negativePrompt string, base ImageRecord) {
+	platforms := strings.Split(cmp.Platforms, ",")
+	log.Printf("⚖️ 对比 #%d 开始: %s", cmp.ID, cmp.Platforms)
+	base.ComparisonID = &cmp.ID
+
+	outcomes := make(map[string]*comparisonOutcome, len(platforms))
+	var (
+		targets []generator.Target
+		called  []string
+		sizes   []string
+		bases   []ImageRecord
+	)
+	for _, plat := range platforms {
+		err := checkPlatformRouting(plat)
+		if err == nil {
+			err = checkBreaker(plat)
+		}
+		if err == nil {
+			err = checkProviderPause(plat)
+		}
+		if err != nil {
+			outcomes[plat] = &comparisonOutcome{Error: err.Error(), ErrorCode: errorCode(err), Skipped: true}
+			continue
+		}
+		size := resolveSize(plat, cmp.Size)
+		send, lang, translated := localizePrompt(plat, cmp.Prompt)
+		b := base
+		b.PromptLang, b.PromptTranslated, b.PromptSent = lang, translated, send != cmp.Prompt
+		targets = append(targets, generator.Target{Type: platformType(plat), Request: generator.GenerateRequest{
+			Platform:       plat,
+			Config:         cfg.Platforms[plat].generatorConfig(),
+			Prompt:         send,
+			Size:           size,
+			N:              1,
+			NegativePrompt: negativePrompt,
+		}})
+		called, sizes, bases = append(called, plat), append(sizes, size), append(bases, b)
+	}
+
+	results := generator.GenerateAll(jobContext("compare", cmp.ID), targets)
+	for i, r := range results {
+		plat := called[i]
+		o := &comparisonOutcome{DurationMs: r.Duration.Milliseconds()}
+		outcomes[plat] = o
+		if r.Err != nil {
+			log.Printf("⚖️ 对比 #%d [%s] 失败: %v", cmp.ID, plat, r.Err)
+			o.Error, o.ErrorCode = r.Err.Error(), errorCode(r.Err)
+			if o.ErrorCode != ErrCodeCanceled {
+				recordGenerationFailure(plat, cmp.Prompt, sizes[i], "", bases[i], r.Err)
+			}
+			continue
+		}
+		if _, err := saveGenerated(plat, cmp.Prompt, sizes[i], r.Output.Images, bases[i]); err != nil {
+			log.Printf("⚖️ 对比 #%d [%s] 保存失败: %v", cmp.ID, plat, err)
+			o.Error = err.Error()
+		}
+	}
+
+	outcomesJSON, _ := json.Marshal(outcomes)
+	now := time.Now()
+	db.Model(&Comparison{}).Where("id = ?", cmp.ID).Updates(map[string]interface{}{
+		"status": "done", "outcomes": string(outcomesJSON), "finished_at": now})
+	log.Printf("⚖️ 对比 #%d 完成", cmp.ID)
+}
+
+// ========== 全平台对比 API ==========
+
+// createComparison POST /api/generate/compare，在后台对全部启用平台（或 platforms 指定的平台）各生成一张
+func createComparison(c *gin.Context) {
+	var req struct {
+		Prompt         string   `json:"prompt" binding:"required"`
+		Size           string   `json:"size"`
+		NegativePrompt string   `json:"negative_prompt"`
+		Platforms      []string `json:"platforms"` // 为空时使用全部启用的平台
+		Category       string   `json:"category"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	platforms := comparablePlatforms(req.Platforms)
+	if len(platforms) == 0 {
+		c.JSON(400, gin.H{"error": "没有可用的平台"})
+		return
+	}
+	if !categoryExists(req.Category) {
+		c.JSON(400, gin.H{"error": "分类不存在: " + req.Category})
+		return
+	}
+	verdict := checkPromptPolicy(c.Request.Context(), req.Prompt, platforms...)
+	if verdict.Blocked {
+		c.JSON(422, verdict.response())
+		return
+	}
+
+	// 每个平台一张，额度按全部平台的成本一次预占，对比结束后释放
+	user, apiKey := currentUser(c), currentAPIKey(c)
+	var cost float64
+	for _, plat := range platforms {
+		cost += cfg.Platforms[plat].CostPerImage
+	}
+	release, err := reserveQuota(user, apiKey, len(platforms), cost)
+	if err != nil {
+		c.JSON(429, gin.H{"error": err.Error(), "code": "quota_exceeded"})
+		return
+	}
+
+	cmp := Comparison{
+		Prompt:    req.Prompt,
+		Size:      req.Size,
+		Platforms: strings.Join(platforms, ","),
+		Status:    "running",
+		User:      user,
+	}
+	if err := db.Create(&cmp).Error; err != nil {
+		release()
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	base := ImageRecord{
+		User:           user,
+		APIKey:         apiKey,
+		Workspace:      currentWorkspace(c),
+		PolicyFlag:     verdict.Flag,
+		Category:       req.Category,
+		NegativePrompt: req.NegativePrompt,
+	}
+	go func() {
+		defer release()
+		runComparison(cmp, req.NegativePrompt, base)
+	}()
+
+	c.JSON(200, gin.H{"message": "success", "comparison_id": cmp.ID, "platforms": platforms})
+}
+
+func listComparisons(c *gin.Context) {
+	var comparisons []Comparison
+	db.Order("id DESC").Limit(100).Find(&comparisons)
+	c.JSON(200, gin.H{"comparisons": comparisons, "total": len(comparisons)})
+}
+
+// getComparison GET /api/compare/:id，按平台并排返回生成的图片、耗时和失败原因
+func getComparison(c *gin.Context) {
+	var cmp Comparison
+	if err := db.First(&cmp, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{"error": "对比不存在"})
+		return
+	}
+
+	var records []ImageRecord
+	db.Where("comparison_id = ? AND status <> ?", cmp.ID, "failed").Order("generated_at").Find(&records)
+	byPlatform := make(map[string][]ImageRecord)
+	for _, r := range records {
+		byPlatform[r.PlatformID] = append(byPlatform[r.PlatformID], r)
+	}
+	outcomes := make(map[string]*comparisonOutcome)
+	if cmp.Outcomes != "" {
+		json.Unmarshal([]byte(cmp.Outcomes), &outcomes)
+	}
+
+	type platformResult struct {
+		Platform string             `json:"platform"`
+		Name     string             `json:"name"`
+		Model    string             `json:"model"`
+		Cost     float64            `json:"cost"`
+		Images   []ImageWithURL     `json:"images"`
+		Outcome  *comparisonOutcome `json:"outcome"` // 对比进行中时为空
+	}
+	results := make([]platformResult, 0)
+	for _, plat := range strings.Split(cmp.Platforms, ",") {
+		p := cfg.Platforms[plat]
+		results = append(results, platformResult{
+			Platform: plat,
+			Name:     p.Name,
+			Model:    p.Model,
+			Cost:     p.CostPerImage,
+			Images:   withImageURLs(byPlatform[plat]),
+			Outcome:  outcomes[plat],
+		})
+	}
+
+	c.JSON(200, gin.H{"comparison": cmp, "results": results})
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ========== 提示词一致性评分 ==========
+
+// ConsistencyConfig 生成后让视觉模型判断图片与提示词是否相符，得分 0-100 写入 consistency_score
+type ConsistencyConfig struct {
+	Enabled     bool `yaml:"enabled"`
+	Concurrency int  `yaml:"concurrency"` // 同时评分的图片数，默认 2
+}
+
+var (
+	consistencySem     chan struct{}
+	consistencyOnce    sync.Once
+	consistencyPattern = regexp.MustCompile(`\d{1,3}`)
+)
+
+// queueConsistency 后台为新生成的图片评分，未开启或未配置视觉模型时跳过，评分失败只记录日志
+func queueConsistency(record ImageRecord) {
+	if !cfg.Consistency.Enabled || cfg.LLM.VisionModel == "" || record.Prompt == "" {
+		return
+	}
+	consistencyOnce.Do(func() { consistencySem = make(chan struct{}, cfg.Consistency.Concurrency) })
+	go func() {
+		consistencySem <- struct{}{}
+		defer func() { <-consistencySem }()
+		ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+		defer cancel()
+		if _, _, err := scoreConsistency(ctx, &record); err != nil {
+			log.Printf("[一致性] 图片 #%d 评分失败: %v", record.ID, err)
+		}
+	}()
+}
+
+// scoreConsistency 让视觉模型评估图片与提示词的相符程度，返回 0-100 的得分和理由
+func scoreConsistency(ctx context.Context, record *ImageRecord) (int, string, error) {
+	question := fmt.Sprintf(`判断这张 AI 生成的图片是否符合提示词：主体、数量、动作、场景、风格是否一致，有没有提示词之外的无关内容。
+提示词：%s
+只回复 JSON：{"score": 0 到 100 的整数，100 为完全相符, "reason": "简短理由"}`, record.Prompt)
+
+	answer, err := callVisionLLM(ctx, question, record.Path)
+	if err != nil {
+		return 0, "", err
+	}
+
+	var result struct {
+		Score  float64 `json:"score"`
+		Reason string  `json:"reason"`
+	}
+	answer = strings.TrimSpace(answer)
+	answer = strings.TrimPrefix(strings.TrimSuffix(answer, "```"), "```json")
+	if err := json.Unmarshal([]byte(strings.TrimSpace(answer)), &result); err != nil {
+		// 模型没按格式回复时，取第一个数字
+		m := consistencyPattern.FindString(answer)
+		if m == "" {
+			return 0, "", fmt.Errorf("无法解析得分: %s", answer)
+		}
+		result.Score, _ = strconv.ParseFloat(m, 64)
+		result.Reason = answer
+	}
+	if result.Score < 0 || result.Score > 100 {
+		return 0, "", fmt.Errorf("得分超出范围: %v", result.Score)
+	}
+	score := int(result.Score + 0.5)
+	db.Model(&ImageRecord{}).Where("id = ?", record.ID).Update("consistency_score", score)
+	record.ConsistencyScore = &score
+	return score, result.Reason, nil
+}
+
+// sortConsistency sort=consistency 时按一致性得分从低到高排序，未评分的排在最后，便于审核时先看跑题的图片
+func sortConsistency(c *gin.Context, query *gorm.DB) *gorm.DB {
+	if c.Query("sort") != "consistency" {
+		return query
+	}
+	return query.Order("consistency_score IS NULL").Order("consistency_score")
+}
+
+// ========== 一致性评分 API ==========
+
+// scoreImageConsistency POST /api/images/:id/consistency，立即（重新）评分，不要求开启 consistency
+func scoreImageConsistency(c *gin.Context) {
+	var record ImageRecord
+	if err := db.First(&record, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{"error": "图片不存在"})
+		return
+	}
+	if record.Prompt == "" {
+		c.JSON(400, gin.H{"error": "图片没有提示词"})
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 60*time.Second)
+	defer cancel()
+	score, reason, err := scoreConsistency(ctx, &record)
+	if err != nil {
+		c.JSON(502, gin.H{"error": "评分失败: " + err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"id": record.ID, "consistency_score": score, "reason": reason})
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+
+	"image-platform/internal/generator"
+)
+
+// ========== 参考图引导 ==========
+
+// controlModes 支持的控制模式：canny 边缘、pose 姿态、depth 深度
+var controlModes = map[string]bool{"canny": true, "pose": true, "depth": true}
+
+// controlModel 平台在该模式下使用的模型，平台配置 controlModels 优先，其次为平台类型内置的模型；为空表示不支持
+func controlModel(platform, mode string) string {
+	caps := generator.CapabilitiesOf(platformType(platform))
+	if !caps.Control {
+		return ""
+	}
+	if m := cfg.Platforms[platform].ControlModels[mode]; m != "" {
+		return m
+	}
+	return caps.ControlModels[mode]
+}
+
+// platformControlModes 平台支持的控制模式
+func platformControlModes(platform string) []string {
+	modes := []string{}
+	for mode := range controlModes {
+		if controlModel(platform, mode) != "" {
+			modes = append(modes, mode)
+		}
+	}
+	sort.Strings(modes)
+	return modes
+}
+
+// validateControlModels 启动时检查 controlModels 中的控制模式
+func validateControlModels() error {
+	for key, p := range cfg.Platforms {
+		for mode := range p.ControlModels {
+			if !controlModes[mode] {
+				return fmt.Errorf("平台 %s 的 controlModels 中控制模式不存在: %s，可选 canny、pose、depth", key, mode)
+			}
+		}
+	}
+	return nil
+}
+
+// generateControlled 按参考图的边缘、姿态或深度引导生成 n 张图片，strength 越大越贴近参考图
+func generateControlled(ctx context.Context, platform, prompt, size, model string, g *generator.Control, n int) ([]*GenerateResult, error) {
+	p, ok := cfg.Platforms[platform]
+	if !ok || !p.Enabled {
+		return nil, genError(ErrCodeInvalid, "平台不可用: %s", platform)
+	}
+	out, err := generator.Generate(ctx, p.Type, generator.GenerateRequest{
+		Platform:  platform,
+		Config:    p.generatorConfig(),
+		Operation: generator.OpControl,
+		Prompt:    prompt,
+		Size:      size,
+		Model:     model,
+		N:         n,
+		Control:   g,
+	})
+	return out.Images, err
+}
+
+// ========== 参考图引导 API ==========
+
+// handleControlGenerate POST /api/generate/control
+// multipart 上传 image 参考图，或 JSON/表单传 image_id 引用已有图片；参考图随生成记录保存
+func handleControlGenerate(c *gin.Context) {
+	var req struct {
+		ImageID  uint    `json:"image_id" form:"image_id"`
+		Prompt   string  `json:"prompt" form:"prompt" binding:"required"`
+		Mode     string  `json:"mode" form:"mode"`         // canny、pose、depth，默认 canny
+		Strength float64 `json:"strength" form:"strength"` // 0-1，默认 0.8
+		Platform string  `json:"platform" form:"platform"`
+		Model    string  `json:"model" form:"model"`
+		Size     string  `json:"size" form:"size"`
+		Category string  `json:"category" form:"category"`
+		N        int     `json:"n" form:"n"`
+	}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(400, gin.H{"error": "请输入描述词: " + err.Error()})
+		return
+	}
+	if req.Mode == "" {
+		req.Mode = "canny"
+	}
+	if !controlModes[req.Mode] {
+		c.JSON(400, gin.H{"error": "mode 可选 canny、pose、depth"})
+		return
+	}
+	if req.Strength == 0 {
+		req.Strength = 0.8
+	}
+	if req.Strength < 0 || req.Strength > 1 {
+		c.JSON(400, gin.H{"error": "strength 取值范围 0-1"})
+		return
+	}
+	if req.N <= 0 {
+		req.N = 1
+	}
+	if req.N > maxImagesPerRequest {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("n 最大为 %d", maxImagesPerRequest)})
+		return
+	}
+	if req.Platform == "" {
+		req.Platform = getOrCreateSettings().Platform
+	}
+	model := controlModel(req.Platform, req.Mode)
+	if model == "" {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("平台 %s 不支持 %s 参考图引导", req.Platform, req.Mode), "code": "unsupported"})
+		return
+	}
+	if err := checkSourceURL(req.Platform); err != nil {
+		c.JSON(400, gin.H{"error": err.Error(), "code": "unsupported"})
+		return
+	}
+	if err := validateSize(req.Platform, req.Size); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	size := resolveSize(req.Platform, req.Size)
+	if err := checkCapabilities(req.Platform, req.Model, size, req.N, req.Prompt); err != nil {
+		c.JSON(400, gin.H{"error": err.Error(), "code": "unsupported"})
+		return
+	}
+	if err := checkPlatformRouting(req.Platform); err != nil {
+		c.JSON(503, gin.H{"error": err.Error(), "code": ErrCodeDraining})
+		return
+	}
+	if err := checkBreaker(req.Platform); err != nil {
+		c.JSON(503, gin.H{"error": err.Error(), "code": ErrCodeCircuitOpen})
+		return
+	}
+	if !categoryExists(req.Category) {
+		c.JSON(400, gin.H{"error": "分类不存在: " + req.Category})
+		return
+	}
+	verdict := checkPromptPolicy(c.Request.Context(), req.Prompt, req.Platform)
+	if verdict.Blocked {
+		c.JSON(422, verdict.response())
+		return
+	}
+	ref, err := loadSourceImage(c, req.ImageID)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, apiKey := currentUser(c), currentAPIKey(c)
+	cost := cfg.Platforms[req.Platform].CostPerImage
+	release, err := reserveQuota(user, apiKey, req.N, cost*float64(req.N))
+	if err != nil {
+		c.JSON(429, gin.H{"error": err.Error(), "code": "quota_exceeded"})
+		return
+	}
+	defer release()
+
+	base := ImageRecord{
+		User:          user,
+		APIKey:        apiKey,
+		Workspace:     currentWorkspace(c),
+		PolicyFlag:    verdict.Flag,
+		Category:      req.Category,
+		SourceID:      ref.RecordID,
+		Operation:     "control",
+		ReferencePath: ref.Path,
+		ControlMode:   req.Mode,
+	}
+	guide := &generator.Control{Image: ref.generatorImage(), Mode: req.Mode, Model: model, Strength: req.Strength}
+	send, lang, translated := localizePrompt(req.Platform, req.Prompt)
+	base.PromptLang, base.PromptTranslated, base.PromptSent = lang, translated, send != req.Prompt
+	results, err := generateControlled(withGenContext(c.Request.Context(), req.Platform, req.Prompt, size, base), req.Platform, send, size, req.Model, guide, req.N)
+	if err != nil {
+		recordGenerationFailure(req.Platform, req.Prompt, size, req.Model, base, err)
+		c.JSON(502, gin.H{"error": "生成失败: " + err.Error(), "code": "generation_failed", "error_code": errorCode(err)})
+		return
+	}
+	records, err := saveGenerated(req.Platform, req.Prompt, size, results, base)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	ids := make([]uint, len(records))
+	for i, r := range records {
+		ids[i] = r.ID
+	}
+	c.JSON(200, gin.H{"message": "success", "id": ids[0], "ids": ids, "source_id": ref.RecordID, "reference_url": imageURL(ref.Path), "images": withImageURLs(records)})
+}
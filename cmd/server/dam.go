@@ -0,0 +1,570 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"image-platform/internal/generator"
+)
+
+// ========== 素材库（DAM）同步 ==========
+
+// DAMConfig 把审核通过的图片连同元数据推送到市场部的素材库，并定期拉回素材库中修改的分类和标签
+type DAMConfig struct {
+	Enabled      bool   `yaml:"enabled"`
+	Type         string `yaml:"type"`         // api（自建素材库等 REST 接口，默认）或 webdav
+	URL          string `yaml:"url"`          // api 为接口前缀，webdav 为存放目录
+	Username     string `yaml:"username"`     // webdav 基本认证用户名
+	TokenEnv     string `yaml:"tokenEnv"`     // api 的 Bearer 令牌或 webdav 密码的环境变量
+	AutoPush     bool   `yaml:"autoPush"`     // 审核通过后自动推送
+	SyncInterval int    `yaml:"syncInterval"` // 拉取素材库修改、重试失败推送的间隔（分钟），默认 30
+}
+
+// DAMAsset 图片在素材库中的副本；Version 为素材库返回的版本（ETag），Checksum 为上次同步时本地文件和元数据的摘要
+// 两边都有修改时标记为 conflict，需要选择保留哪一边
+type DAMAsset struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	ImageID   uint       `gorm:"uniqueIndex;not null" json:"image_id"`
+	RemoteID  string     `gorm:"size:512" json:"remote_id"`
+	Version   string     `gorm:"size:255" json:"version"`
+	Checksum  string     `gorm:"size:64" json:"-"`
+	Status    string     `gorm:"size:20;index" json:"status"` // synced, conflict, failed, deleted（素材库中已删除）
+	LastError string     `gorm:"type:text" json:"last_error"`
+	PushedAt  *time.Time `json:"pushed_at"`
+	PulledAt  *time.Time `json:"pulled_at"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+func (DAMAsset) TableName() string {
+	return "dam_assets"
+}
+
+// damMetadata 推送到素材库的元数据，category 和 tags 可在素材库中修改并同步回来
+type damMetadata struct {
+	ImageID        uint     `json:"image_id"`
+	Name           string   `json:"name"`
+	Prompt         string   `json:"prompt"`
+	NegativePrompt string   `json:"negative_prompt,omitempty"`
+	Category       string   `json:"category"`
+	Tags           []string `json:"tags"`
+	Platform       string   `json:"platform"`
+	Model          string   `json:"model"`
+	Size           string   `json:"size,omitempty"`
+	Seed           *int64   `json:"seed,omitempty"`
+	Workspace      string   `json:"workspace,omitempty"`
+	ApprovedAt     string   `json:"approved_at,omitempty"`
+}
+
+// damRemote 素材库中的资产
+type damRemote struct {
+	ID       string      `json:"id"`
+	Version  string      `json:"version"`
+	Metadata damMetadata `json:"metadata"`
+}
+
+var (
+	errDAMConflict = errors.New("素材库中的资产已被修改")
+	errDAMNotFound = errors.New("素材库中的资产已删除")
+
+	// 推送和拉取串行执行，避免自动推送与手动推送同时创建两份资产
+	damMu sync.Mutex
+)
+
+// damClient 素材库接口；push 的 ifMatch 为空时不校验版本（首次推送或强制覆盖）
+type damClient interface {
+	push(ctx context.Context, remoteID, ifMatch, file string, meta damMetadata) (damRemote, error)
+	fetch(ctx context.Context, remoteID string) (damRemote, error)
+}
+
+func newDAMClient() damClient {
+	dc := cfg.DAM
+	base := strings.TrimSuffix(dc.URL, "/")
+	client := providerClient("DAM", 120*time.Second)
+	if dc.Type == "webdav" {
+		return &webdavDAM{base: base, user: dc.Username, password: os.Getenv(dc.TokenEnv), client: client}
+	}
+	return &apiDAM{base: base, token: os.Getenv(dc.TokenEnv), client: client}
+}
+
+// damMetadataOf 图片当前的元数据
+func damMetadataOf(record *ImageRecord) damMetadata {
+	meta := damMetadata{
+		ImageID: record.ID, Name: record.Name, Prompt: record.Prompt, NegativePrompt: record.NegativePrompt,
+		Category: record.Category, Tags: []string{}, Platform: record.Platform, Model: record.Model,
+		Size: record.Size, Seed: record.Seed, Workspace: record.Workspace,
+	}
+	db.Model(&ImageTag{}).Where("image_id = ?", record.ID).Order("tag").Pluck("tag", &meta.Tags)
+	if record.ModeratedAt != nil {
+		meta.ApprovedAt = record.ModeratedAt.In(bizLoc).Format(time.RFC3339)
+	}
+	return meta
+}
+
+// damChecksum 本地文件和可同步元数据的摘要，用来判断上次同步后本地是否有修改
+func damChecksum(path string, meta damMetadata) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	meta.ApprovedAt = "" // 审核时间不影响内容
+	json.NewEncoder(h).Encode(meta)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// pushToDAM 推送图片和元数据，已推送过的按上次同步的版本更新；本地没有修改时跳过，返回 changed=false
+// force 为 true 时不校验素材库版本直接覆盖，素材库中已删除的重新创建
+func pushToDAM(ctx context.Context, record *ImageRecord, force bool) (asset *DAMAsset, changed bool, err error) {
+	if record.Status != "approved" {
+		return nil, false, fmt.Errorf("只能推送审核通过的图片")
+	}
+	damMu.Lock()
+	defer damMu.Unlock()
+
+	asset = &DAMAsset{ImageID: record.ID}
+	db.Where("image_id = ?", record.ID).First(asset)
+	meta := damMetadataOf(record)
+	checksum, err := damChecksum(record.Path, meta)
+	if err != nil {
+		return asset, false, err
+	}
+	if !force {
+		switch {
+		case asset.Status == "synced" && asset.Checksum == checksum:
+			return asset, false, nil
+		case asset.Status == "conflict":
+			return asset, false, errDAMConflict
+		case asset.Status == "deleted":
+			return asset, false, errDAMNotFound
+		}
+	}
+
+	remoteID, ifMatch := asset.RemoteID, asset.Version
+	if force {
+		ifMatch = ""
+		if asset.Status == "deleted" {
+			remoteID = ""
+		}
+	}
+	remote, err := newDAMClient().push(ctx, remoteID, ifMatch, record.Path, meta)
+	switch {
+	case errors.Is(err, errDAMConflict):
+		asset.Status = "conflict"
+	case errors.Is(err, errDAMNotFound):
+		asset.Status = "deleted"
+	case err != nil && asset.Status != "conflict" && asset.Status != "deleted":
+		asset.Status = "failed"
+	case err == nil:
+		now := time.Now()
+		asset.RemoteID, asset.Version, asset.Checksum = remote.ID, remote.Version, checksum
+		asset.Status, asset.PushedAt = "synced", &now
+	}
+	asset.LastError = ""
+	if err != nil {
+		asset.LastError = err.Error()
+	}
+	if saveErr := db.Save(asset).Error; saveErr != nil && err == nil {
+		err = saveErr
+	}
+	return asset, err == nil, err
+}
+
+// pullFromDAM 拉取素材库中的修改：本地没有修改时把素材库中的分类和标签写回本地，两边都有修改时标记冲突
+// keepRemote 为 true 时用于解决冲突，直接以素材库为准
+func pullFromDAM(ctx context.Context, asset *DAMAsset, keepRemote bool) (changed bool, err error) {
+	damMu.Lock()
+	defer damMu.Unlock()
+
+	var record ImageRecord
+	if err := db.First(&record, asset.ImageID).Error; err != nil {
+		return false, err
+	}
+	remote, err := newDAMClient().fetch(ctx, asset.RemoteID)
+	now := time.Now()
+	if errors.Is(err, errDAMNotFound) {
+		db.Model(asset).Updates(map[string]interface{}{"status": "deleted", "last_error": err.Error(), "pulled_at": now})
+		return false, err
+	}
+	if err != nil {
+		return false, err
+	}
+	if remote.Version == asset.Version && !keepRemote {
+		db.Model(asset).Update("pulled_at", now)
+		return false, nil
+	}
+
+	checksum, err := damChecksum(record.Path, damMetadataOf(&record))
+	if err != nil {
+		return false, err
+	}
+	if checksum != asset.Checksum && !keepRemote {
+		db.Model(asset).Updates(map[string]interface{}{"status": "conflict", "last_error": "本地和素材库都有修改", "pulled_at": now})
+		return false, errDAMConflict
+	}
+
+	tags, err := normalizeNames(remote.Metadata.Tags, 50)
+	if err != nil {
+		return false, err
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&ImageRecord{}).Where("id = ?", record.ID).Update("category", remote.Metadata.Category).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("image_id = ?", record.ID).Delete(&ImageTag{}).Error; err != nil {
+			return err
+		}
+		for _, t := range tags {
+			if err := tx.Create(&ImageTag{ImageID: record.ID, Tag: t, CreatedAt: now}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	record.Category = remote.Metadata.Category
+	checksum, _ = damChecksum(record.Path, damMetadataOf(&record))
+	db.Model(asset).Updates(map[string]interface{}{
+		"version": remote.Version, "checksum": checksum, "status": "synced", "last_error": "", "pulled_at": now})
+	recordActivity("dam_pulled", record.ID, "dam", fmt.Sprintf("分类 %s，标签 %s", remote.Metadata.Category, strings.Join(tags, ",")))
+	return true, nil
+}
+
+// queueDAMPush 审核通过后在后台推送，失败的由定时同步重试
+func queueDAMPush(record ImageRecord) {
+	if !cfg.DAM.Enabled || !cfg.DAM.AutoPush {
+		return
+	}
+	record.Status = "approved"
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+		if _, _, err := pushToDAM(ctx, &record, false); err != nil {
+			log.Printf("[素材库] 推送图片 #%d 失败: %v", record.ID, err)
+		}
+	}()
+}
+
+// runDAMSync 定期重试失败的推送、推送本地修改并拉取素材库中的修改
+func runDAMSync() {
+	if !cfg.DAM.Enabled {
+		return
+	}
+	ticker := time.NewTicker(time.Duration(cfg.DAM.SyncInterval) * time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		syncDAM()
+	}
+}
+
+func syncDAM() {
+	var assets []DAMAsset
+	db.Where("status IN ?", []string{"synced", "failed"}).Order("id").Find(&assets)
+	pushed, pulled, failed := 0, 0, 0
+	for i := range assets {
+		asset := &assets[i]
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		var changed bool
+		var err error
+		if asset.Status == "synced" {
+			// 先拉取：素材库有修改时写回或标记冲突，没有修改时再推送本地修改
+			if changed, err = pullFromDAM(ctx, asset, false); changed {
+				pulled++
+			}
+		}
+		if err == nil && !changed {
+			var record ImageRecord
+			if db.First(&record, asset.ImageID).Error == nil && record.Status == "approved" {
+				if _, changed, err = pushToDAM(ctx, &record, false); changed {
+					pushed++
+				}
+			}
+		}
+		cancel()
+		if err != nil {
+			failed++
+			log.Printf("[素材库] 同步图片 #%d 失败: %v", asset.ImageID, err)
+		}
+	}
+	if pushed+pulled+failed > 0 {
+		log.Printf("[素材库] 同步完成：推送 %d，拉取 %d，失败或冲突 %d", pushed, pulled, failed)
+	}
+}
+
+// ========== 素材库接口 ==========
+
+// apiDAM 自建素材库等 REST 接口：
+// POST {url}/assets 创建、PUT {url}/assets/{id} 更新（multipart，file + metadata，If-Match 校验版本），
+// GET {url}/assets/{id} 返回 {"id","version","metadata"}；版本不匹配返回 409/412，资产不存在返回 404
+type apiDAM struct {
+	base   string
+	token  string
+	client *http.Client
+}
+
+func (d *apiDAM) do(req *http.Request) (damRemote, error) {
+	if d.token != "" {
+		req.Header.Set("Authorization", "Bearer "+d.token)
+	}
+	resp, body, err := generator.DoWithRetry(d.client, req)
+	if err != nil {
+		return damRemote{}, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusConflict || resp.StatusCode == http.StatusPreconditionFailed:
+		return damRemote{}, errDAMConflict
+	case resp.StatusCode == http.StatusNotFound:
+		return damRemote{}, errDAMNotFound
+	case resp.StatusCode >= 300:
+		return damRemote{}, generator.ResponseError("素材库请求失败", resp.StatusCode, body)
+	}
+	var remote damRemote
+	if err := json.Unmarshal(body, &remote); err != nil || remote.ID == "" {
+		return damRemote{}, generator.ResponseError("解析素材库响应失败", resp.StatusCode, body)
+	}
+	if remote.Version == "" {
+		remote.Version = resp.Header.Get("ETag")
+	}
+	return remote, nil
+}
+
+func (d *apiDAM) push(ctx context.Context, remoteID, ifMatch, file string, meta damMetadata) (damRemote, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return damRemote{}, err
+	}
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	fw, _ := mw.CreateFormFile("file", filepath.Base(file))
+	fw.Write(data)
+	metaJSON, _ := json.Marshal(meta)
+	mw.WriteField("metadata", string(metaJSON))
+	mw.Close()
+
+	method, url := "POST", d.base+"/assets"
+	if remoteID != "" {
+		method, url = "PUT", d.base+"/assets/"+remoteID
+	}
+	req, _ := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(buf.Bytes()))
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	return d.do(req)
+}
+
+func (d *apiDAM) fetch(ctx context.Context, remoteID string) (damRemote, error) {
+	req, _ := http.NewRequestWithContext(ctx, "GET", d.base+"/assets/"+remoteID, nil)
+	return d.do(req)
+}
+
+// webdavDAM WebDAV 目录：图片存为 {url}/{日期}/{ID}.{ext}，元数据存为同名的 .json，
+// 资产 ID 为相对路径，版本为元数据文件的 ETag
+type webdavDAM struct {
+	base     string
+	user     string
+	password string
+	client   *http.Client
+}
+
+func (d *webdavDAM) request(ctx context.Context, method, path string, body []byte) (*http.Response, []byte, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, _ := http.NewRequestWithContext(ctx, method, d.base+"/"+path, reader)
+	if d.user != "" {
+		req.SetBasicAuth(d.user, d.password)
+	}
+	return generator.DoWithRetry(d.client, req)
+}
+
+func (d *webdavDAM) push(ctx context.Context, remoteID, ifMatch, file string, meta damMetadata) (damRemote, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return damRemote{}, err
+	}
+	if remoteID == "" {
+		dir := time.Now().In(bizLoc).Format("2006-01-02")
+		remoteID = fmt.Sprintf("%s/%d%s", dir, meta.ImageID, strings.ToLower(filepath.Ext(file)))
+		// 目录已存在时返回 405，忽略
+		d.request(ctx, "MKCOL", dir+"/", nil)
+	}
+
+	// 先写元数据：带版本校验，素材库中被修改过时不覆盖图片
+	metaJSON, _ := json.MarshalIndent(meta, "", "  ")
+	req, _ := http.NewRequestWithContext(ctx, "PUT", d.base+"/"+remoteID+".json", bytes.NewReader(metaJSON))
+	req.Header.Set("Content-Type", "application/json")
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	if d.user != "" {
+		req.SetBasicAuth(d.user, d.password)
+	}
+	resp, body, err := generator.DoWithRetry(d.client, req)
+	if err != nil {
+		return damRemote{}, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusPreconditionFailed || resp.StatusCode == http.StatusConflict:
+		return damRemote{}, errDAMConflict
+	case resp.StatusCode >= 300:
+		return damRemote{}, generator.ResponseError("写入元数据失败", resp.StatusCode, body)
+	}
+	version := resp.Header.Get("ETag")
+
+	resp, body, err = d.request(ctx, "PUT", remoteID, data)
+	if err != nil {
+		return damRemote{}, err
+	}
+	if resp.StatusCode >= 300 {
+		return damRemote{}, generator.ResponseError("上传图片失败", resp.StatusCode, body)
+	}
+	if version == "" {
+		// 部分服务器 PUT 不返回 ETag，再查一次
+		if resp, _, err := d.request(ctx, "HEAD", remoteID+".json", nil); err == nil {
+			version = resp.Header.Get("ETag")
+		}
+	}
+	return damRemote{ID: remoteID, Version: version, Metadata: meta}, nil
+}
+
+func (d *webdavDAM) fetch(ctx context.Context, remoteID string) (damRemote, error) {
+	resp, body, err := d.request(ctx, "GET", remoteID+".json", nil)
+	if err != nil {
+		return damRemote{}, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return damRemote{}, errDAMNotFound
+	case resp.StatusCode >= 300:
+		return damRemote{}, generator.ResponseError("读取元数据失败", resp.StatusCode, body)
+	}
+	remote := damRemote{ID: remoteID, Version: resp.Header.Get("ETag")}
+	if err := json.Unmarshal(body, &remote.Metadata); err != nil {
+		return damRemote{}, fmt.Errorf("解析元数据失败: %v", err)
+	}
+	return remote, nil
+}
+
+// ========== 素材库同步 API ==========
+
+// pushImageToDAM POST /api/images/:id/dam，推送到素材库；?force=1 时覆盖素材库中的修改
+func pushImageToDAM(c *gin.Context) {
+	if !cfg.DAM.Enabled {
+		c.JSON(400, gin.H{"error": "未开启素材库同步"})
+		return
+	}
+	var record ImageRecord
+	if err := db.First(&record, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{"error": "图片不存在"})
+		return
+	}
+	force := c.Query("force") == "1"
+	asset, changed, err := pushToDAM(c.Request.Context(), &record, force)
+	if err != nil {
+		status := 502
+		if errors.Is(err, errDAMConflict) || errors.Is(err, errDAMNotFound) {
+			status = 409
+		} else if record.Status != "approved" {
+			status = 400
+		}
+		c.JSON(status, gin.H{"error": err.Error(), "asset": asset})
+		return
+	}
+	if changed {
+		recordActivity("dam_pushed", record.ID, currentUser(c), asset.RemoteID)
+	}
+	c.JSON(200, gin.H{"message": "success", "asset": asset, "changed": changed})
+}
+
+// getImageDAM GET /api/images/:id/dam，图片在素材库中的同步状态
+func getImageDAM(c *gin.Context) {
+	var asset DAMAsset
+	if err := db.Where("image_id = ?", c.Param("id")).First(&asset).Error; err != nil {
+		c.JSON(404, gin.H{"error": "未推送到素材库"})
+		return
+	}
+	c.JSON(200, asset)
+}
+
+// resolveDAMConflict POST /api/images/:id/dam/resolve，keep=local 用本地覆盖素材库，keep=remote 用素材库的分类和标签覆盖本地
+func resolveDAMConflict(c *gin.Context) {
+	var req struct {
+		Keep string `json:"keep" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Keep != "local" && req.Keep != "remote") {
+		c.JSON(400, gin.H{"error": "keep 只能为 local 或 remote"})
+		return
+	}
+	var asset DAMAsset
+	if err := db.Where("image_id = ?", c.Param("id")).First(&asset).Error; err != nil {
+		c.JSON(404, gin.H{"error": "未推送到素材库"})
+		return
+	}
+	var err error
+	if req.Keep == "remote" {
+		_, err = pullFromDAM(c.Request.Context(), &asset, true)
+	} else {
+		var record ImageRecord
+		if err = db.First(&record, asset.ImageID).Error; err == nil {
+			_, _, err = pushToDAM(c.Request.Context(), &record, true)
+		}
+	}
+	if err != nil {
+		c.JSON(502, gin.H{"error": err.Error()})
+		return
+	}
+	db.First(&asset, asset.ID)
+	recordActivity("dam_resolved", asset.ImageID, currentUser(c), "保留"+map[string]string{"local": "本地", "remote": "素材库"}[req.Keep])
+	c.JSON(200, gin.H{"message": "success", "asset": asset})
+}
+
+// listDAMAssets GET /api/dam/assets?status=conflict，按同步状态列出
+func listDAMAssets(c *gin.Context) {
+	query := db.Model(&DAMAsset{})
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var assets []DAMAsset
+	query.Order("updated_at DESC").Limit(200).Find(&assets)
+	var counts []struct {
+		Status string `json:"status"`
+		Count  int64  `json:"count"`
+	}
+	db.Model(&DAMAsset{}).Select("status, COUNT(*) AS count").Group("status").Scan(&counts)
+	c.JSON(200, gin.H{"assets": assets, "counts": counts})
+}
+
+// syncDAMNow POST /api/dam/sync，立即执行一次同步
+func syncDAMNow(c *gin.Context) {
+	if !cfg.DAM.Enabled {
+		c.JSON(400, gin.H{"error": "未开启素材库同步"})
+		return
+	}
+	go syncDAM()
+	c.JSON(202, gin.H{"message": "同步已开始"})
+}
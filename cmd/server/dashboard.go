@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ========== 首页看板 ==========
+
+// DashboardConfig 首页看板的组件配置，不同角色看到不同的组件
+type DashboardConfig struct {
+	Default []string            `yaml:"default"` // 未分配视图时展示的组件，为空时展示 defaultWidgets
+	Views   map[string][]string `yaml:"views"`   // 视图名 → 组件列表，按顺序展示，如 reviewer: [pending_queue]
+	Assign  map[string]string   `yaml:"assign"`  // 用户名或 API Key 名称 → 视图名，用户名优先
+}
+
+// dashboardWidget 组件按当前请求取数据，调用方的工作区等上下文从 c 中取
+type dashboardWidget func(c *gin.Context) gin.H
+
+var dashboardWidgets = map[string]dashboardWidget{
+	"pending_queue":      pendingQueueWidget,
+	"today_cost":         todayCostWidget,
+	"failing_providers":  failingProvidersWidget,
+	"upcoming_publishes": upcomingPublishesWidget,
+	"recent_activity":    recentActivityWidget,
+}
+
+// defaultWidgets 未配置 dashboard.default 时的组件
+var defaultWidgets = []string{"pending_queue", "today_cost", "failing_providers", "upcoming_publishes"}
+
+// validateDashboard 启动时检查视图中的组件名和分配的视图
+func validateDashboard() error {
+	views := map[string][]string{"default": cfg.Dashboard.Default}
+	for name, widgets := range cfg.Dashboard.Views {
+		views[name] = widgets
+	}
+	for view, widgets := range views {
+		for _, w := range widgets {
+			if _, ok := dashboardWidgets[w]; !ok {
+				return fmt.Errorf("视图 %s 中的组件不存在: %s", view, w)
+			}
+		}
+	}
+	for who, view := range cfg.Dashboard.Assign {
+		if _, ok := cfg.Dashboard.Views[view]; !ok {
+			return fmt.Errorf("%s 分配的视图不存在: %s", who, view)
+		}
+	}
+	return nil
+}
+
+// dashboardView 当前调用方的视图名和组件：?view= 指定的视图优先，其次按用户名、API Key 分配，都没有时为 default
+func dashboardView(c *gin.Context) (string, []string) {
+	candidates := []string{c.Query("view"), cfg.Dashboard.Assign[currentUser(c)], cfg.Dashboard.Assign[currentAPIKey(c)]}
+	for _, view := range candidates {
+		if widgets, ok := cfg.Dashboard.Views[view]; ok {
+			return view, widgets
+		}
+	}
+	if len(cfg.Dashboard.Default) > 0 {
+		return "default", cfg.Dashboard.Default
+	}
+	return "default", defaultWidgets
+}
+
+// pendingQueueWidget 待审核数量、最早的待审核记录和置顶的记录
+func pendingQueueWidget(c *gin.Context) gin.H {
+	var count, pinned int64
+	db.Model(&ImageRecord{}).Where("status = ?", "pending").Count(&count)
+	db.Model(&ImageRecord{}).Where("status = ? AND pinned = ?", "pending", true).Count(&pinned)
+	var next []ImageRecord
+	orderPending(db.Where("status = ?", "pending")).Order("generated_at").Limit(5).Find(&next)
+	h := gin.H{"count": count, "pinned": pinned, "next": withImageURLs(next)}
+	if len(next) > 0 {
+		var oldest ImageRecord
+		db.Where("status = ?", "pending").Order("generated_at").Limit(1).Find(&oldest)
+		h["oldest_at"] = oldest.GeneratedAt
+	}
+	return h
+}
+
+// todayCostWidget 当天的生成成本和张数，按平台
+func todayCostWidget(c *gin.Context) gin.H {
+	var rows []struct {
+		PlatformID string
+		Count      int64
+		Cost       float64
+	}
+	db.Model(&ImageRecord{}).Select("platform_id, COUNT(*) AS count, COALESCE(SUM(cost), 0) AS cost").
+		Where("date = ? AND status NOT IN ?", today(), append([]string{"failed"}, nonProductionStatuses...)).
+		Group("platform_id").Scan(&rows)
+	var images int64
+	var cost float64
+	byPlatform := gin.H{}
+	for _, r := range rows {
+		images += r.Count
+		cost += r.Cost
+		byPlatform[r.PlatformID] = gin.H{"images": r.Count, "cost": r.Cost}
+	}
+	return gin.H{"date": today(), "images": images, "cost": cost, "platforms": byPlatform}
+}
+
+// failingProvidersWidget 最近 24 小时失败过半、全部失败或熔断中的平台
+func failingProvidersWidget(c *gin.Context) gin.H {
+	failing := gin.H{}
+	for key, h := range providerHealth() {
+		if h.(gin.H)["status"] != "ok" {
+			failing[key] = h
+		}
+	}
+	return gin.H{"count": len(failing), "providers": failing}
+}
+
+// upcomingPublishesWidget 未来 24 小时内待执行的定时发布
+func upcomingPublishesWidget(c *gin.Context) gin.H {
+	var jobs []PublishJob
+	db.Where("status = ? AND scheduled_at < ?", "pending", time.Now().Add(24*time.Hour)).
+		Order("scheduled_at").Limit(10).Find(&jobs)
+	return gin.H{"count": len(jobs), "jobs": jobs}
+}
+
+// recentActivityWidget 最近 10 条动态
+func recentActivityWidget(c *gin.Context) gin.H {
+	var activities []Activity
+	db.Order("id DESC").Limit(10).Find(&activities)
+	return gin.H{"activities": activities}
+}
+
+// ========== 首页看板 API ==========
+
+// getDashboard GET /api/dashboard?view=，按当前调用方的视图组装组件数据
+func getDashboard(c *gin.Context) {
+	view, names := dashboardView(c)
+	widgets := make([]gin.H, 0, len(names))
+	for _, name := range names {
+		widgets = append(widgets, gin.H{"name": name, "data": dashboardWidgets[name](c)})
+	}
+	c.JSON(200, gin.H{"view": view, "widgets": widgets, "generated_at": time.Now()})
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ========== 训练数据集导出 ==========
+
+// 单次导出的图片数上限，超出时需缩小筛选范围
+const datasetExportLimit = 10000
+
+// datasetEntry 数据集中的一张图片
+type datasetEntry struct {
+	FileName     string                 `json:"file_name"`
+	Text         string                 `json:"text"`
+	ID           uint                   `json:"id"`
+	Category     string                 `json:"category,omitempty"`
+	Tags         []string               `json:"tags,omitempty"`
+	Platform     string                 `json:"platform"`
+	Model        string                 `json:"model"`
+	Seed         *int64                 `json:"seed,omitempty"`
+	Size         string                 `json:"size,omitempty"`
+	ProviderMeta map[string]interface{} `json:"provider_meta,omitempty"` // 平台返回的其他信息，见 internal/generator/image.go 的 providerMeta
+}
+
+var unsafeClassChars = regexp.MustCompile(`[\\/:*?"<>|\s]+`)
+
+// datasetClass folder 格式的类别目录名，未分类的图片放在 uncategorized
+func datasetClass(category string) string {
+	name := strings.Trim(unsafeClassChars.ReplaceAllString(category, "_"), "._")
+	if name == "" {
+		return "uncategorized"
+	}
+	return name
+}
+
+// datasetCaption 图片的描述文本，caption=enhanced 时优先使用扩写后实际用于生成的提示词
+func datasetCaption(record ImageRecord, caption string) string {
+	if caption == "enhanced" && record.EnhancedPrompt != "" {
+		return record.EnhancedPrompt
+	}
+	return record.Prompt
+}
+
+// writeDataset 按格式把图片和描述写入 zip：
+// folder 为 <类别>/<ID>.png + 同名 .txt；jsonl 为 images/ + captions.jsonl；
+// huggingface 为 ImageFolder 布局 data/train/ + metadata.jsonl 和数据集说明 README.md
+func writeDataset(w io.Writer, format, caption string, records []ImageRecord, tags map[uint][]string) (int, error) {
+	zw := zip.NewWriter(w)
+	var lines []datasetEntry
+	written := 0
+	for _, r := range records {
+		ext := strings.ToLower(filepath.Ext(r.Path))
+		if ext == "" {
+			ext = ".png"
+		}
+		name := fmt.Sprintf("%d%s", r.ID, ext)
+		entry := datasetEntry{
+			Text: datasetCaption(r, caption), ID: r.ID, Category: r.Category, Tags: tags[r.ID],
+			Platform: r.Platform, Model: r.Model, Seed: r.Seed, Size: r.Size, ProviderMeta: r.ProviderMeta,
+		}
+
+		var path string
+		switch format {
+		case "folder":
+			path = datasetClass(r.Category) + "/" + name
+		case "jsonl":
+			path = "images/" + name
+			entry.FileName = path
+		default:
+			path = "data/train/" + name
+			entry.FileName = name // metadata.jsonl 中为相对其所在目录的路径
+		}
+		if err := addZipFile(zw, path, r.Path); err != nil {
+			// 文件丢失的记录跳过，不中断整个导出
+			log.Printf("[数据集] 跳过图片 #%d: %v", r.ID, err)
+			continue
+		}
+		written++
+		if format == "folder" {
+			f, err := zw.Create(strings.TrimSuffix(path, ext) + ".txt")
+			if err != nil {
+				return written, err
+			}
+			io.WriteString(f, entry.Text)
+			continue
+		}
+		lines = append(lines, entry)
+	}
+
+	switch format {
+	case "jsonl":
+		if err := writeJSONL(zw, "captions.jsonl", lines); err != nil {
+			return written, err
+		}
+	case "huggingface":
+		if err := writeJSONL(zw, "data/train/metadata.jsonl", lines); err != nil {
+			return written, err
+		}
+		f, err := zw.Create("README.md")
+		if err != nil {
+			return written, err
+		}
+		fmt.Fprintf(f, "---\nconfigs:\n- config_name: default\n  data_files:\n  - split: train\n    path: data/train/*\n---\n\n"+
+			"# image-platform dataset\n\n%d approved images exported at %s. Captions are in the `text` column of `data/train/metadata.jsonl`.\n",
+			written, time.Now().Format(time.RFC3339))
+	}
+	return written, zw.Close()
+}
+
+// addZipFile 把图片文件原样写入 zip，图片已压缩，不再 deflate
+func addZipFile(zw *zip.Writer, name, path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, src)
+	return err
+}
+
+func writeJSONL(zw *zip.Writer, name string, lines []datasetEntry) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetEscapeHTML(false)
+	for _, line := range lines {
+		if err := enc.Encode(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ========== 数据集导出 API ==========
+
+// exportDataset POST /api/dataset/export，把审核通过的图片连同提示词和标签打包为 zip 下载
+// 筛选条件同批量操作（分类、标签、合集、日期等），状态固定为 approved
+func exportDataset(c *gin.Context) {
+	var req struct {
+		bulkFilter
+		Format  string `json:"format"`  // folder, jsonl, huggingface（默认）
+		Caption string `json:"caption"` // prompt（默认）或 enhanced
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Format == "" {
+		req.Format = "huggingface"
+	}
+	if req.Format != "folder" && req.Format != "jsonl" && req.Format != "huggingface" {
+		c.JSON(400, gin.H{"error": "format 只能为 folder、jsonl 或 huggingface"})
+		return
+	}
+	if req.Caption != "" && req.Caption != "prompt" && req.Caption != "enhanced" {
+		c.JSON(400, gin.H{"error": "caption 只能为 prompt 或 enhanced"})
+		return
+	}
+	req.Status = "approved"
+	query, err := req.bulkFilter.apply(db.Model(&ImageRecord{}))
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	var records []ImageRecord
+	query.Order("id").Limit(datasetExportLimit + 1).Find(&records)
+	if len(records) > datasetExportLimit {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("匹配的图片超过 %d 张，请缩小筛选范围", datasetExportLimit)})
+		return
+	}
+	if len(records) == 0 {
+		c.JSON(404, gin.H{"error": "没有匹配的图片"})
+		return
+	}
+
+	ids := make([]uint, len(records))
+	for i, r := range records {
+		ids[i] = r.ID
+	}
+	var imageTags []ImageTag
+	db.Where("image_id IN ?", ids).Order("tag").Find(&imageTags)
+	tags := map[uint][]string{}
+	for _, t := range imageTags {
+		tags[t.ImageID] = append(tags[t.ImageID], t.Tag)
+	}
+
+	filename := fmt.Sprintf("dataset-%s-%s.zip", req.Format, time.Now().In(bizLoc).Format("20060102-150405"))
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	n, err := writeDataset(c.Writer, req.Format, req.Caption, records, tags)
+	if err != nil {
+		// 响应已开始写入，只能记录日志
+		log.Printf("[数据集] 导出中断: %v", err)
+		return
+	}
+	recordActivity("dataset_exported", 0, currentUser(c), fmt.Sprintf("%s 格式导出 %d 张", req.Format, n))
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ========== 死信队列 ==========
+
+// DeadLetter 重试用尽仍失败的任务，保留完整的错误信息，可在排查后重新投递
+type DeadLetter struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	Kind       string     `gorm:"size:20;index" json:"kind"`   // generation, publish
+	RefID      string     `gorm:"size:64;index" json:"ref_id"` // 异步生成任务 ID 或发布任务 ID
+	Payload    string     `gorm:"type:text" json:"payload"`    // 重新投递所需的任务内容（JSON）
+	Error      string     `gorm:"type:text" json:"error"`      // 最后一次的错误
+	ErrorCode  string     `gorm:"size:30" json:"error_code"`
+	Attempts   int        `json:"attempts"`
+	History    string     `gorm:"type:text" json:"history"`                   // 每次失败的时间和错误，一行一次
+	Status     string     `gorm:"size:20;default:'dead';index" json:"status"` // dead, redriven, discarded
+	RedriveRef string     `gorm:"size:64" json:"redrive_ref,omitempty"`       // 重新投递后的任务 ID
+	HandledBy  string     `gorm:"size:100" json:"handled_by,omitempty"`       // 重新投递或丢弃的操作人
+	HandledAt  *time.Time `json:"handled_at,omitempty"`
+	CreatedAt  time.Time  `gorm:"index" json:"created_at"`
+}
+
+func (DeadLetter) TableName() string {
+	return "dead_letters"
+}
+
+// deadLetter 任务最终失败时放入死信队列
+func deadLetter(kind, refID string, payload interface{}, errMsg, code string, attempts int, history string) {
+	data, _ := json.Marshal(payload)
+	dl := DeadLetter{
+		Kind: kind, RefID: refID, Payload: string(data), Error: errMsg, ErrorCode: code,
+		Attempts: attempts, History: history, Status: "dead",
+	}
+	if err := db.Create(&dl).Error; err != nil {
+		log.Printf("☠️ 写入死信队列失败 [%s %s]: %v", kind, refID, err)
+		return
+	}
+	log.Printf("☠️ %s 任务 %s 进入死信队列（%d 次尝试）: %s", kind, refID, attempts, errMsg)
+}
+
+// appendHistory 追加一行失败记录
+func appendHistory(history, errMsg string) string {
+	return history + time.Now().Format("2006-01-02 15:04:05") + " " + errMsg + "\n"
+}
+
+// redrive 按死信的类型重新投递，返回新的任务 ID
+func (dl *DeadLetter) redrive() (string, error) {
+	switch dl.Kind {
+	case "publish":
+		// 发布任务原地重置为待执行，保留失败记录
+		res := db.Model(&PublishJob{}).Where("id = ? AND status = ?", dl.RefID, "failed").Updates(map[string]interface{}{
+			"status": "pending", "attempts": 0, "scheduled_at": time.Now(), "finished_at": nil})
+		if res.RowsAffected == 0 {
+			return "", fmt.Errorf("发布任务 #%s 不存在或不是失败状态", dl.RefID)
+		}
+		return dl.RefID, nil
+	case "generation":
+		var rec TaskRecord
+		if err := json.Unmarshal([]byte(dl.Payload), &rec); err != nil {
+			return "", fmt.Errorf("任务内容解析失败: %v", err)
+		}
+		old := taskFromRecord(rec)
+		old.cancel()
+		task := &GenerateTask{
+			Platform: old.Platform, Model: old.Model, Size: old.Size, Prompt: old.Prompt,
+			N: old.N, Enhance: old.Enhance, User: old.User, CallbackURL: old.CallbackURL, base: old.base,
+		}
+		if !enqueueTask(task) {
+			return "", fmt.Errorf("生成队列已满，请稍后重试")
+		}
+		return task.ID, nil
+	}
+	return "", fmt.Errorf("未知的任务类型: %s", dl.Kind)
+}
+
+// ========== 死信队列 API ==========
+
+// listDeadLetters GET /api/admin/dead-letters?kind=publish&status=dead
+func listDeadLetters(c *gin.Context) {
+	var letters []DeadLetter
+	query := db.Model(&DeadLetter{})
+	if kind := c.Query("kind"); kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	query = query.Where("status = ?", c.DefaultQuery("status", "dead"))
+	query.Order("id DESC").Limit(100).Find(&letters)
+	c.JSON(200, gin.H{"dead_letters": letters, "total": len(letters)})
+}
+
+// getDeadLetter GET /api/admin/dead-letters/:id
+func getDeadLetter(c *gin.Context) {
+	var dl DeadLetter
+	if err := db.First(&dl, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{"error": "死信不存在"})
+		return
+	}
+	c.JSON(200, dl)
+}
+
+// redriveDeadLetter POST /api/admin/dead-letters/:id/redrive，重新投递任务
+func redriveDeadLetter(c *gin.Context) {
+	var dl DeadLetter
+	if err := db.First(&dl, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{"error": "死信不存在"})
+		return
+	}
+	if dl.Status != "dead" {
+		c.JSON(409, gin.H{"error": "死信已处理", "status": dl.Status})
+		return
+	}
+	ref, err := dl.redrive()
+	if err != nil {
+		c.JSON(409, gin.H{"error": err.Error()})
+		return
+	}
+	now := time.Now()
+	db.Model(&dl).Updates(map[string]interface{}{"status": "redriven", "redrive_ref": ref, "handled_by": currentUser(c), "handled_at": now})
+	log.Printf("☠️ 死信 #%d 已重新投递: %s %s", dl.ID, dl.Kind, ref)
+	c.JSON(200, gin.H{"message": "success", "kind": dl.Kind, "ref_id": ref})
+}
+
+// discardDeadLetter DELETE /api/admin/dead-letters/:id，确认不再处理
+func discardDeadLetter(c *gin.Context) {
+	now := time.Now()
+	res := db.Model(&DeadLetter{}).Where("id = ? AND status = ?", c.Param("id"), "dead").
+		Updates(map[string]interface{}{"status": "discarded", "handled_by": currentUser(c), "handled_at": now})
+	if res.RowsAffected == 0 {
+		c.JSON(409, gin.H{"error": "死信不存在或已处理"})
+		return
+	}
+	c.JSON(200, gin.H{"message": "success"})
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ========== 提示词草稿 ==========
+
+// Draft 提示词草稿，讨论定稿后可提交生成
+type Draft struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Title     string    `gorm:"size:255" json:"title"`
+	Prompt    string    `gorm:"size:1000;not null" json:"prompt"`
+	Platform  string    `gorm:"size:50" json:"platform"`
+	Model     string    `gorm:"size:100" json:"model"`
+	Size      string    `gorm:"size:20" json:"size"`
+	Category  string    `gorm:"size:50" json:"category"`
+	Status    string    `gorm:"size:20;default:'draft';index" json:"status"` // draft, promoted, archived
+	Author    string    `gorm:"size:100;index" json:"author"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (Draft) TableName() string {
+	return "drafts"
+}
+
+// DraftComment 草稿评论
+type DraftComment struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	DraftID   uint      `gorm:"index;not null" json:"draft_id"`
+	Author    string    `gorm:"size:100" json:"author"`
+	Content   string    `gorm:"type:text;not null" json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (DraftComment) TableName() string {
+	return "draft_comments"
+}
+
+// ========== 草稿 API ==========
+func listDrafts(c *gin.Context) {
+	var drafts []Draft
+	query := db.Model(&Draft{})
+	if s := c.Query("status"); s != "" {
+		query = query.Where("status = ?", s)
+	}
+	if author := c.Query("author"); author != "" {
+		query = query.Where("author = ?", author)
+	}
+	query.Order("updated_at DESC").Limit(100).Find(&drafts)
+	c.JSON(200, gin.H{"drafts": drafts, "total": len(drafts)})
+}
+
+func createDraft(c *gin.Context) {
+	var req struct {
+		Title    string `json:"title"`
+		Prompt   string `json:"prompt" binding:"required"`
+		Platform string `json:"platform"`
+		Model    string `json:"model"`
+		Size     string `json:"size"`
+		Category string `json:"category"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	draft := Draft{
+		Title:    req.Title,
+		Prompt:   req.Prompt,
+		Platform: req.Platform,
+		Model:    req.Model,
+		Size:     req.Size,
+		Category: req.Category,
+		Status:   "draft",
+		Author:   currentUser(c),
+	}
+	if err := db.Create(&draft).Error; err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, draft)
+}
+
+// getDraft 草稿详情，附带评论和已生成的图片
+func getDraft(c *gin.Context) {
+	var draft Draft
+	if err := db.First(&draft, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{"error": "草稿不存在"})
+		return
+	}
+	var comments []DraftComment
+	db.Where("draft_id = ?", draft.ID).Order("id").Find(&comments)
+	var records []ImageRecord
+	db.Where("draft_id = ?", draft.ID).Order("generated_at DESC").Find(&records)
+	c.JSON(200, gin.H{"draft": draft, "comments": comments, "records": withImageURLs(records)})
+}
+
+func updateDraft(c *gin.Context) {
+	var draft Draft
+	if err := db.First(&draft, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{"error": "草稿不存在"})
+		return
+	}
+	var req struct {
+		Title    *string `json:"title"`
+		Prompt   *string `json:"prompt"`
+		Platform *string `json:"platform"`
+		Model    *string `json:"model"`
+		Size     *string `json:"size"`
+		Category *string `json:"category"`
+		Status   *string `json:"status"` // 可设为 archived 归档
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Title != nil {
+		draft.Title = *req.Title
+	}
+	if req.Prompt != nil && *req.Prompt != "" {
+		draft.Prompt = *req.Prompt
+	}
+	if req.Platform != nil {
+		draft.Platform = *req.Platform
+	}
+	if req.Model != nil {
+		draft.Model = *req.Model
+	}
+	if req.Size != nil {
+		draft.Size = *req.Size
+	}
+	if req.Category != nil {
+		draft.Category = *req.Category
+	}
+	if req.Status != nil {
+		switch *req.Status {
+		case "draft", "archived":
+			draft.Status = *req.Status
+		default:
+			c.JSON(400, gin.H{"error": "status 仅支持 draft 或 archived"})
+			return
+		}
+	}
+	db.Save(&draft)
+	c.JSON(200, draft)
+}
+
+func deleteDraft(c *gin.Context) {
+	db.Where("draft_id = ?", c.Param("id")).Delete(&DraftComment{})
+	db.Delete(&Draft{}, c.Param("id"))
+	c.JSON(200, gin.H{"message": "success"})
+}
+
+func addDraftComment(c *gin.Context) {
+	var draft Draft
+	if err := db.First(&draft, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{"error": "草稿不存在"})
+		return
+	}
+	var req struct {
+		Content string `json:"content" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	comment := DraftComment{DraftID: draft.ID, Author: currentUser(c), Content: req.Content}
+	db.Create(&comment)
+	c.JSON(200, comment)
+}
+
+// promoteDraft 将草稿提交生成：可指定多个平台、每个平台生成多张，后台执行
+func promoteDraft(c *gin.Context) {
+	var draft Draft
+	if err := db.First(&draft, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{"error": "草稿不存在"})
+		return
+	}
+	var req struct {
+		Platforms []string `json:"platforms"` // 为空使用草稿平台或默认设置
+		Count     int      `json:"count"`     // 每个平台生成张数，默认 1
+	}
+	c.ShouldBindJSON(&req)
+	if req.Count <= 0 {
+		req.Count = 1
+	}
+	if req.Count > 20 {
+		c.JSON(400, gin.H{"error": "count 最大为 20"})
+		return
+	}
+	platforms := req.Platforms
+	if len(platforms) == 0 {
+		plat := draft.Platform
+		if plat == "" {
+			plat = getOrCreateSettings().Platform
+		}
+		platforms = []string{plat}
+	}
+	for _, plat := range platforms {
+		if p, ok := cfg.Platforms[plat]; !ok || !p.Enabled {
+			c.JSON(400, gin.H{"error": "平台不可用: " + plat})
+			return
+		}
+	}
+	if !categoryExists(draft.Category) {
+		c.JSON(400, gin.H{"error": "分类不存在: " + draft.Category})
+		return
+	}
+	verdict := checkPromptPolicy(c.Request.Context(), draft.Prompt, platforms...)
+	if verdict.Blocked {
+		c.JSON(422, verdict.response())
+		return
+	}
+
+	base := ImageRecord{
+		User:       currentUser(c),
+		APIKey:     currentAPIKey(c),
+		Workspace:  currentWorkspace(c),
+		PolicyFlag: verdict.Flag,
+		Category:   draft.Category,
+		DraftID:    &draft.ID,
+	}
+	db.Model(&draft).Update("status", "promoted")
+
+	go func() {
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, cfg.ImageGen.MaxWorkers)
+		for _, plat := range platforms {
+			for i := 0; i < req.Count; i++ {
+				wg.Add(1)
+				go func(plat string) {
+					defer wg.Done()
+					sem <- struct{}{}
+					defer func() { <-sem }()
+					if _, err := generateAndSave(jobContext("draft", draft.ID), plat, draft.Prompt, draft.Size, draft.Model, base); err != nil {
+						log.Printf("📝 草稿 #%d [%s] 生成失败: %v", draft.ID, plat, err)
+					}
+				}(plat)
+			}
+		}
+		wg.Wait()
+		log.Printf("📝 草稿 #%d 生成完成", draft.ID)
+		notifyReviewers(nil, fmt.Sprintf("草稿「%s」已生成，待审核", draft.Title), draft.Prompt, fmt.Sprintf("/api/drafts/%d", draft.ID))
+	}()
+
+	c.JSON(200, gin.H{"message": "success", "draft_id": draft.ID, "jobs": len(platforms) * req.Count})
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ========== 平台暂停（排空） ==========
+
+// PlatformDrain 暂停接收新任务的平台，已排队和运行中的任务继续执行
+type PlatformDrain struct {
+	Platform  string    `gorm:"primaryKey;size:50" json:"platform"`
+	Reason    string    `gorm:"size:255" json:"reason"`
+	CreatedBy string    `gorm:"size:100" json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (PlatformDrain) TableName() string {
+	return "platform_drains"
+}
+
+var (
+	drainMu  sync.RWMutex
+	draining = make(map[string]PlatformDrain)
+)
+
+// loadDrains 启动时加载暂停状态，重启后仍然生效
+func loadDrains() {
+	var drains []PlatformDrain
+	db.Find(&drains)
+	drainMu.Lock()
+	for _, d := range drains {
+		draining[d.Platform] = d
+	}
+	drainMu.Unlock()
+	if len(drains) > 0 {
+		log.Printf("⏸️ %d 个平台处于暂停状态", len(drains))
+	}
+}
+
+func isDraining(platform string) bool {
+	drainMu.RLock()
+	defer drainMu.RUnlock()
+	_, ok := draining[platform]
+	return ok
+}
+
+// checkPlatformRouting 新任务进入前检查平台是否暂停
+func checkPlatformRouting(platform string) error {
+	if isDraining(platform) {
+		return genError(ErrCodeDraining, "平台 %s 已暂停接收新任务", platform)
+	}
+	return nil
+}
+
+// inflightTasks 平台排队中和运行中的异步任务数
+func inflightTasks(platform string) (queued, running int) {
+	taskMu.Lock()
+	defer taskMu.Unlock()
+	for _, t := range tasks {
+		if t.Platform != platform {
+			continue
+		}
+		switch t.Status {
+		case "queued":
+			queued++
+		case "running":
+			running++
+		}
+	}
+	return queued, running
+}
+
+// ========== 平台暂停 API ==========
+
+// listDrains GET /api/admin/platforms/drains，drained 为 true 表示在途任务已全部结束
+func listDrains(c *gin.Context) {
+	drainMu.RLock()
+	result := make([]gin.H, 0, len(draining))
+	for _, d := range draining {
+		queued, running := inflightTasks(d.Platform)
+		result = append(result, gin.H{"drain": d, "queued": queued, "running": running, "drained": queued+running == 0})
+	}
+	drainMu.RUnlock()
+	c.JSON(200, gin.H{"drains": result})
+}
+
+// drainPlatform POST /api/admin/platforms/:id/drain，停止向平台分配新任务
+func drainPlatform(c *gin.Context) {
+	platform := c.Param("id")
+	if _, ok := cfg.Platforms[platform]; !ok {
+		c.JSON(404, gin.H{"error": "平台不存在"})
+		return
+	}
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	c.ShouldBindJSON(&req)
+	d := PlatformDrain{Platform: platform, Reason: req.Reason, CreatedBy: currentUser(c), CreatedAt: time.Now()}
+	if err := db.Save(&d).Error; err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	drainMu.Lock()
+	draining[platform] = d
+	drainMu.Unlock()
+	log.Printf("⏸️ 平台 %s 暂停接收新任务: %s", platform, req.Reason)
+	queued, running := inflightTasks(platform)
+	c.JSON(200, gin.H{"message": "success", "drain": d, "queued": queued, "running": running})
+}
+
+// resumePlatform DELETE /api/admin/platforms/:id/drain，恢复接收新任务
+func resumePlatform(c *gin.Context) {
+	platform := c.Param("id")
+	db.Delete(&PlatformDrain{}, "platform = ?", platform)
+	drainMu.Lock()
+	delete(draining, platform)
+	drainMu.Unlock()
+	log.Printf("▶️ 平台 %s 恢复接收新任务", platform)
+	c.JSON(200, gin.H{"message": "success"})
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
+)
+
+// ========== 复制到其他工作区/合集 ==========
+
+// knownWorkspace 工作区由 API Key 配置决定，只能复制到已配置的工作区
+func knownWorkspace(name string) bool {
+	for _, k := range cfg.Auth.APIKeys {
+		if k.Workspace == name {
+			return true
+		}
+	}
+	return false
+}
+
+// duplicateImage POST /api/images/:id/duplicate，把审核通过的图片复制为新记录，供其他团队直接使用，不需要重新生成
+// 复制图片文件、提示词、seed、分类和标签，不复制审核记录、审核备注、访问统计和发布记录；副本为审核通过状态，source_id 指向原图
+func duplicateImage(c *gin.Context) {
+	var record ImageRecord
+	if err := db.First(&record, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{"error": "图片不存在"})
+		return
+	}
+	if record.Status != "approved" {
+		c.JSON(400, gin.H{"error": "只能复制审核通过的图片"})
+		return
+	}
+	var req struct {
+		Workspace  *string `json:"workspace"`  // 目标工作区，为空字符串表示不属于任何工作区；不传时沿用原图的工作区
+		Collection string  `json:"collection"` // 加入的合集
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Workspace == nil && req.Collection == "" {
+		c.JSON(400, gin.H{"error": "请指定 workspace 或 collection"})
+		return
+	}
+	workspace := record.Workspace
+	if req.Workspace != nil {
+		workspace = *req.Workspace
+		if workspace != "" && !knownWorkspace(workspace) {
+			c.JSON(400, gin.H{"error": "工作区不存在: " + workspace})
+			return
+		}
+	}
+	collections, err := normalizeNames([]string{req.Collection}, 100)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	data, err := os.ReadFile(record.Path)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "读取原图失败: " + err.Error()})
+		return
+	}
+	now := time.Now()
+	ext := filepath.Ext(record.Path)
+	if ext == "" {
+		ext = ".png"
+	}
+	path, err := writeImageFile(filepath.Join(cfg.ImageGen.OutputDir, bizDate(now), "copies"), newImageFilename(now, 0, ext), data)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "复制图片失败: " + err.Error()})
+		return
+	}
+
+	user := currentUser(c)
+	dup := ImageRecord{
+		Name:             filepath.Base(path),
+		Date:             bizDate(now),
+		Path:             path,
+		Platform:         record.Platform,
+		PlatformID:       record.PlatformID,
+		Model:            record.Model,
+		Prompt:           record.Prompt,
+		PromptLang:       record.PromptLang,
+		PromptTranslated: record.PromptTranslated,
+		PromptSent:       record.PromptSent,
+		EnhancedPrompt:   record.EnhancedPrompt,
+		NegativePrompt:   record.NegativePrompt,
+		Seed:             record.Seed,
+		GeneratedAt:      record.GeneratedAt,
+		Size:             record.Size,
+		Status:           "approved",
+		ModeratedAt:      &now,
+		Note:             fmt.Sprintf("由 #%d 复制", record.ID),
+		User:             user,
+		APIKey:           currentAPIKey(c),
+		Category:         record.Category,
+		SourceID:         &record.ID,
+		Operation:        "duplicate",
+		Workspace:        workspace,
+		FileSize:         int64(len(data)),
+		MimeType:         record.MimeType,
+	}
+	if err := createImageRecord(&dup); err != nil {
+		os.Remove(path)
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 标签随图片复制，合集只加入请求指定的
+	var tags []ImageTag
+	db.Where("image_id = ?", record.ID).Find(&tags)
+	for i := range tags {
+		tags[i].ImageID, tags[i].CreatedAt = dup.ID, now
+	}
+	if len(tags) > 0 {
+		db.Clauses(clause.OnConflict{DoNothing: true}).Create(&tags)
+	}
+	if len(collections) > 0 {
+		db.Clauses(clause.OnConflict{DoNothing: true}).Create(&CollectionImage{Collection: collections[0], ImageID: dup.ID, AddedBy: user, CreatedAt: now})
+	}
+
+	target := fmt.Sprintf("工作区「%s」", workspace)
+	if len(collections) > 0 {
+		target += fmt.Sprintf("合集「%s」", collections[0])
+	}
+	recordActivity("duplicated", record.ID, user, fmt.Sprintf("复制到 %s，生成 #%d", target, dup.ID))
+	c.JSON(200, gin.H{"message": "success", "id": dup.ID, "source_id": record.ID, "record": dup, "url": imageURL(dup.Path)})
+}
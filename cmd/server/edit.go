@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	_ "golang.org/x/image/webp"
+
+	"image-platform/internal/generator"
+)
+
+// ========== 局部重绘 ==========
+
+// maskRect 遮罩矩形，坐标为原图像素
+type maskRect struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// rectMask 按矩形生成 PNG 遮罩
+// transparent 为 true 时编辑区域透明、其余不透明（OpenAI），否则编辑区域白色、其余黑色（百炼）
+func rectMask(src *sourceImage, rects []maskRect, transparent bool) ([]byte, error) {
+	conf, _, err := image.DecodeConfig(bytes.NewReader(src.Data))
+	if err != nil {
+		return nil, fmt.Errorf("解析原图失败: %v", err)
+	}
+	bounds := image.Rect(0, 0, conf.Width, conf.Height)
+	keep, edit := color.NRGBA{0, 0, 0, 255}, color.NRGBA{255, 255, 255, 255}
+	if transparent {
+		edit = color.NRGBA{0, 0, 0, 0}
+	}
+	mask := image.NewNRGBA(bounds)
+	for x := 0; x < conf.Width; x++ {
+		for y := 0; y < conf.Height; y++ {
+			mask.SetNRGBA(x, y, keep)
+		}
+	}
+	for _, r := range rects {
+		area := image.Rect(r.X, r.Y, r.X+r.Width, r.Y+r.Height).Intersect(bounds)
+		if area.Empty() {
+			return nil, fmt.Errorf("遮罩区域超出原图范围: %+v", r)
+		}
+		for x := area.Min.X; x < area.Max.X; x++ {
+			for y := area.Min.Y; y < area.Max.Y; y++ {
+				mask.SetNRGBA(x, y, edit)
+			}
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, mask); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// generateInpaint 调用平台的遮罩编辑接口，模型为空时优先使用 editModel
+func generateInpaint(ctx context.Context, platform, prompt, model string, src, mask *sourceImage) ([]*GenerateResult, error) {
+	p, ok := cfg.Platforms[platform]
+	if !ok || !p.Enabled {
+		return nil, genError(ErrCodeInvalid, "平台不可用: %s", platform)
+	}
+	out, err := generator.Generate(ctx, p.Type, generator.GenerateRequest{
+		Platform:  platform,
+		Config:    p.generatorConfig(),
+		Operation: generator.OpInpaint,
+		Prompt:    prompt,
+		Model:     model,
+		N:         1,
+		Source:    src.generatorImage(),
+		Mask:      mask.generatorImage(),
+	})
+	return out.Images, err
+}
+
+// saveMask 保存遮罩文件，平台需要公网地址时通过 /images 访问
+func saveMask(data []byte) (*sourceImage, error) {
+	now := time.Now()
+	dir := filepath.Join(cfg.ImageGen.OutputDir, bizDate(now), "masks")
+	os.MkdirAll(dir, 0755)
+	path := filepath.Join(dir, fmt.Sprintf("%s_%09d.png", now.Format("150405"), now.Nanosecond()))
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return nil, fmt.Errorf("保存遮罩失败: %v", err)
+	}
+	return &sourceImage{Path: path, Data: data, MIME: "image/png"}, nil
+}
+
+// ========== 局部重绘 API ==========
+
+// editImage POST /api/images/:id/edit
+// JSON 传 rects 矩形区域，或 multipart 上传 mask 文件（遮罩格式需符合平台要求）
+// 结果入库为新的待审核记录，source_id 指向原图
+func editImage(c *gin.Context) {
+	var record ImageRecord
+	if err := db.First(&record, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{"error": "图片不存在"})
+		return
+	}
+	var req struct {
+		Prompt   string     `json:"prompt" form:"prompt" binding:"required"`
+		Platform string     `json:"platform" form:"platform"`
+		Model    string     `json:"model" form:"model"`
+		Rects    []maskRect `json:"rects" form:"-"`
+	}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(400, gin.H{"error": "请输入描述词: " + err.Error()})
+		return
+	}
+	if s := c.PostForm("rects"); s != "" {
+		if err := json.Unmarshal([]byte(s), &req.Rects); err != nil {
+			c.JSON(400, gin.H{"error": "rects 格式错误: " + err.Error()})
+			return
+		}
+	}
+	if req.Platform == "" {
+		req.Platform = getOrCreateSettings().Platform
+	}
+	caps := generator.CapabilitiesOf(platformType(req.Platform))
+	if !caps.Inpaint {
+		c.JSON(400, gin.H{"error": "平台不支持局部重绘: " + req.Platform})
+		return
+	}
+	if err := checkSourceURL(req.Platform); err != nil {
+		c.JSON(400, gin.H{"error": err.Error(), "code": "unsupported"})
+		return
+	}
+	if err := checkPlatformRouting(req.Platform); err != nil {
+		c.JSON(503, gin.H{"error": err.Error(), "code": ErrCodeDraining})
+		return
+	}
+	if err := checkBreaker(req.Platform); err != nil {
+		c.JSON(503, gin.H{"error": err.Error(), "code": ErrCodeCircuitOpen})
+		return
+	}
+	verdict := checkPromptPolicy(c.Request.Context(), req.Prompt, req.Platform)
+	if verdict.Blocked {
+		c.JSON(422, verdict.response())
+		return
+	}
+	src, err := sourceFromRecord(record.ID)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 遮罩：优先使用上传文件，否则按矩形生成
+	var maskData []byte
+	if fh, err := c.FormFile("mask"); err == nil {
+		f, err := fh.Open()
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		maskData, _, err = readSourceImage(f)
+		f.Close()
+		if err != nil {
+			c.JSON(400, gin.H{"error": "遮罩: " + err.Error()})
+			return
+		}
+	} else if len(req.Rects) > 0 {
+		if maskData, err = rectMask(src, req.Rects, caps.TransparentMask); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+	} else {
+		c.JSON(400, gin.H{"error": "请上传 mask 文件或指定 rects"})
+		return
+	}
+	mask, err := saveMask(maskData)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, apiKey := currentUser(c), currentAPIKey(c)
+	release, err := reserveQuota(user, apiKey, 1, cfg.Platforms[req.Platform].CostPerImage)
+	if err != nil {
+		c.JSON(429, gin.H{"error": err.Error(), "code": "quota_exceeded"})
+		return
+	}
+	defer release()
+
+	base := ImageRecord{
+		User:       user,
+		APIKey:     apiKey,
+		Workspace:  currentWorkspace(c),
+		PolicyFlag: verdict.Flag,
+		Category:   record.Category,
+		SourceID:   &record.ID,
+		Operation:  "inpaint",
+	}
+	send, lang, translated := localizePrompt(req.Platform, req.Prompt)
+	base.PromptLang, base.PromptTranslated, base.PromptSent = lang, translated, send != req.Prompt
+	results, err := generateInpaint(withGenContext(c.Request.Context(), req.Platform, req.Prompt, record.Size, base), req.Platform, send, req.Model, src, mask)
+	if err != nil {
+		recordGenerationFailure(req.Platform, req.Prompt, record.Size, req.Model, base, err)
+		c.JSON(502, gin.H{"error": "编辑失败: " + err.Error(), "code": "generation_failed", "error_code": errorCode(err)})
+		return
+	}
+	records, err := saveGenerated(req.Platform, req.Prompt, record.Size, results, base)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	edited := records[0]
+	recordActivity("edited", record.ID, user, fmt.Sprintf("局部重绘生成 #%d", edited.ID))
+	c.JSON(200, gin.H{"message": "success", "id": edited.ID, "source_id": record.ID, "record": edited, "url": imageURL(edited.Path), "mask_url": imageURL(mask.Path)})
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"mime"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ========== 邮件审核链接 ==========
+
+// EmailConfig 发送审核邮件的 SMTP 服务，465 端口使用 SSL，其他端口按服务器支持使用 STARTTLS
+type EmailConfig struct {
+	Host        string `yaml:"host"`
+	Port        int    `yaml:"port"` // 默认 465
+	Username    string `yaml:"username"`
+	Password    string `yaml:"password"`
+	PasswordEnv string `yaml:"passwordEnv"` // 密码（授权码）的环境变量，优先于 password
+	From        string `yaml:"from"`        // 发件人，为空使用 username
+	LinkHours   int    `yaml:"linkHours"`   // 审核链接有效期（小时），默认 72
+}
+
+// ApprovalLink 发给不登录平台的审核人的一次性审核链接，通过或拒绝后失效
+type ApprovalLink struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	Token     string     `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	ImageID   uint       `gorm:"index;not null" json:"image_id"`
+	Email     string     `gorm:"size:255;index" json:"email"`
+	Decision  string     `gorm:"size:20" json:"decision"` // approved, rejected，未使用为空
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedBy string     `gorm:"size:100" json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func (ApprovalLink) TableName() string {
+	return "approval_links"
+}
+
+// approvalSignature 审核链接中每个操作的签名，通过和拒绝的链接不能互相篡改
+func approvalSignature(token, decision string) string {
+	mac := hmac.New(sha256.New, permalinkKey)
+	mac.Write([]byte("approval:" + token + ":" + decision))
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+func approvalPath(token, decision string) string {
+	return "/approval/" + token + "?decision=" + decision + "&sig=" + approvalSignature(token, decision)
+}
+
+var approvalMailTemplate = template.Must(template.New("mail").Parse(`<p>您好，以下图片需要您审核：</p>
+<p><img src="{{.Image}}" alt="图片 #{{.ID}}" style="max-width:480px"></p>
+<p>提示词：{{.Prompt}}</p>
+<p><a href="{{.Approve}}">✅ 通过</a>&nbsp;&nbsp;&nbsp;&nbsp;<a href="{{.Reject}}">❌ 拒绝</a></p>
+<p style="color:#718096;font-size:12px">链接 {{.Expires}} 前有效，只能使用一次。</p>`))
+
+// sendMail 通过配置的 SMTP 服务发送 HTML 邮件
+func sendMail(to, subject, body string) error {
+	ec := cfg.Notifications.Email
+	if ec.Host == "" {
+		return fmt.Errorf("未配置 notifications.email")
+	}
+	from := ec.From
+	if from == "" {
+		from = ec.Username
+	}
+	sender, err := mail.ParseAddress(from)
+	if err != nil {
+		return fmt.Errorf("发件人格式错误: %w", err)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/html; charset=UTF-8\r\n\r\n",
+		sender.String(), to, mime.BEncoding.Encode("UTF-8", subject), time.Now().Format(time.RFC1123Z))
+	msg.WriteString(body)
+
+	addr := net.JoinHostPort(ec.Host, strconv.Itoa(ec.Port))
+	var auth smtp.Auth
+	if ec.Username != "" {
+		auth = smtp.PlainAuth("", ec.Username, ec.Password, ec.Host)
+	}
+	if ec.Port != 465 {
+		return smtp.SendMail(addr, auth, sender.Address, []string{to}, msg.Bytes())
+	}
+
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 15 * time.Second}, "tcp", addr, &tls.Config{ServerName: ec.Host})
+	if err != nil {
+		return err
+	}
+	client, err := smtp.NewClient(conn, ec.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+	if auth != nil {
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(sender.Address); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg.Bytes()); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// ========== 邮件审核 API ==========
+
+// requestEmailApproval POST /api/images/:id/email-approval，给每个邮箱发送一封带通过/拒绝链接的审核邮件
+func requestEmailApproval(c *gin.Context) {
+	var req struct {
+		Emails []string `json:"emails" binding:"required"`
+		Hours  int      `json:"hours"` // 链接有效期，默认 notifications.email.linkHours
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.Emails) == 0 {
+		c.JSON(400, gin.H{"error": "emails 不能为空"})
+		return
+	}
+	if cfg.Notifications.Email.Host == "" {
+		c.JSON(400, gin.H{"error": "未配置 notifications.email"})
+		return
+	}
+	if req.Hours == 0 {
+		req.Hours = cfg.Notifications.Email.LinkHours
+	}
+	if req.Hours < 0 || req.Hours > 24*30 {
+		c.JSON(400, gin.H{"error": "hours 取值范围 1-720"})
+		return
+	}
+	for _, e := range req.Emails {
+		if _, err := mail.ParseAddress(e); err != nil {
+			c.JSON(400, gin.H{"error": "邮箱格式错误: " + e})
+			return
+		}
+	}
+	var record ImageRecord
+	if err := db.First(&record, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{"error": "图片不存在"})
+		return
+	}
+	if record.Status != "pending" {
+		c.JSON(400, gin.H{"error": "只能为待审核的图片发送审核邮件"})
+		return
+	}
+
+	var sent []ApprovalLink
+	failed := gin.H{}
+	for _, email := range req.Emails {
+		link := ApprovalLink{
+			Token:     newToken(),
+			ImageID:   record.ID,
+			Email:     strings.ToLower(strings.TrimSpace(email)),
+			ExpiresAt: time.Now().Add(time.Duration(req.Hours) * time.Hour),
+			CreatedBy: currentUser(c),
+		}
+		if err := db.Create(&link).Error; err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		var body bytes.Buffer
+		approvalMailTemplate.Execute(&body, gin.H{
+			"ID":      record.ID,
+			"Prompt":  record.Prompt,
+			"Image":   publicURL(c, imageURL(record.Path)),
+			"Approve": publicURL(c, approvalPath(link.Token, "approved")),
+			"Reject":  publicURL(c, approvalPath(link.Token, "rejected")),
+			"Expires": link.ExpiresAt.In(bizLoc).Format("2006-01-02 15:04"),
+		})
+		if err := sendMail(link.Email, fmt.Sprintf("图片 #%d 待审核", record.ID), body.String()); err != nil {
+			db.Delete(&link)
+			failed[link.Email] = err.Error()
+			continue
+		}
+		sent = append(sent, link)
+	}
+	recordActivity("approval_requested", record.ID, currentUser(c), fmt.Sprintf("发送审核邮件 %d 封", len(sent)))
+	c.JSON(200, gin.H{"message": "success", "links": sent, "failed": failed})
+}
+
+// approvalPage GET/POST /approval/:token?decision=&sig=
+// GET 只显示确认页面，点击确认按钮（POST）后才生效，避免邮件客户端和安全网关预取链接时误操作
+func approvalPage(c *gin.Context) {
+	token, decision, sig := c.Param("token"), c.Query("decision"), c.Query("sig")
+	respond := func(status int, msg string) {
+		c.Data(status, "text/html; charset=utf-8", []byte(`<!DOCTYPE html><html lang="zh-CN"><head><meta charset="UTF-8"><meta name="viewport" content="width=device-width, initial-scale=1.0"><title>图片审核</title></head><body style="font-family:sans-serif;padding:32px">`+msg+`</body></html>`))
+	}
+	if (decision != "approved" && decision != "rejected") || !hmac.Equal([]byte(sig), []byte(approvalSignature(token, decision))) {
+		respond(http.StatusNotFound, "<p>链接无效</p>")
+		return
+	}
+	var link ApprovalLink
+	if err := db.Where("token = ?", token).First(&link).Error; err != nil {
+		respond(http.StatusNotFound, "<p>链接无效</p>")
+		return
+	}
+	if link.UsedAt != nil {
+		respond(http.StatusGone, "<p>该链接已使用过</p>")
+		return
+	}
+	if time.Now().After(link.ExpiresAt) {
+		respond(http.StatusGone, "<p>链接已过期</p>")
+		return
+	}
+	var record ImageRecord
+	if err := db.First(&record, link.ImageID).Error; err != nil {
+		respond(http.StatusNotFound, "<p>图片不存在</p>")
+		return
+	}
+	if record.Status != "pending" {
+		respond(http.StatusConflict, "<p>图片已审核，无需再处理</p>")
+		return
+	}
+	label := map[string]string{"approved": "通过", "rejected": "拒绝"}[decision]
+
+	if c.Request.Method == http.MethodGet {
+		respond(200, fmt.Sprintf(`<p><img src="%s" style="max-width:480px"></p><p>%s</p>
+<form method="post"><input type="text" name="note" placeholder="备注（可选）"> <button type="submit">确认%s</button></form>`,
+			template.HTMLEscapeString(imageURL(record.Path)), template.HTMLEscapeString(record.Prompt), label))
+		return
+	}
+
+	// 先占用链接再审核，并发点击时只有一次生效
+	now := time.Now()
+	result := db.Model(&ApprovalLink{}).Where("id = ? AND used_at IS NULL", link.ID).
+		Updates(map[string]interface{}{"used_at": now, "decision": decision})
+	if result.RowsAffected == 0 {
+		respond(http.StatusGone, "<p>该链接已使用过</p>")
+		return
+	}
+	if _, err := applyReview(&record, decision, c.PostForm("note"), "", "email:"+link.Email, "email:"+link.Email, "email"); err != nil {
+		respond(500, "<p>审核失败："+template.HTMLEscapeString(err.Error())+"</p>")
+		return
+	}
+	respond(200, fmt.Sprintf("<p>已%s图片 #%d，谢谢！</p>", label, record.ID))
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// ========== 提示词扩写 ==========
+
+// 默认扩写指令，可通过 llm.enhanceInstruction 覆盖
+const defaultEnhanceInstruction = `你是图片生成提示词专家。把用户的简短描述扩写为适合文生图模型的提示词：补充主体细节、场景、光线、构图和画面风格，不改变原意，不添加原文没有的人物或文字。
+只输出扩写后的提示词，不要解释，使用与原文相同的语言。`
+
+// enhancePrompt 用 LLM 扩写提示词，llm.enhanceModel 为空时使用 llm.model
+func enhancePrompt(ctx context.Context, prompt string) (string, error) {
+	model := cfg.LLM.EnhanceModel
+	if model == "" {
+		model = cfg.LLM.Model
+	}
+	instruction := cfg.LLM.EnhanceInstruction
+	if instruction == "" {
+		instruction = defaultEnhanceInstruction
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	answer, err := callLLMModel(ctx, model, instruction+"\n\n原始描述："+prompt)
+	if err != nil {
+		return "", err
+	}
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return "", fmt.Errorf("扩写结果为空")
+	}
+	return answer, nil
+}
+
+// enhanceOrOriginal 扩写失败或扩写结果不符合内容策略时返回空，调用方使用原始提示词
+func enhanceOrOriginal(ctx context.Context, prompt string) string {
+	enhanced, err := enhancePrompt(ctx, prompt)
+	if err != nil {
+		log.Printf("[扩写] 提示词扩写失败，使用原文: %v", err)
+		return ""
+	}
+	if verdict := checkPromptPolicy(ctx, enhanced); verdict.Blocked {
+		log.Printf("[扩写] 扩写结果不符合内容策略（%s），使用原文", verdict.Reason)
+		return ""
+	}
+	return enhanced
+}
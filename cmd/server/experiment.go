@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ========== 对比实验 ==========
+
+// Experiment 同一提示词在多个平台上各生成 N 次，结果归入同一实验
+type Experiment struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	Prompt     string     `gorm:"size:1000;not null" json:"prompt"`
+	Platforms  string     `gorm:"size:255;not null" json:"platforms"` // 逗号分隔的平台 ID
+	Runs       int        `json:"runs"`
+	Status     string     `gorm:"size:20;default:'running'" json:"status"` // running, done
+	Failures   string     `gorm:"type:text" json:"-"`                      // 各平台失败次数 JSON
+	User       string     `gorm:"size:100" json:"user"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
+
+func (Experiment) TableName() string {
+	return "experiments"
+}
+
+// createExperiment 创建实验并在后台执行
+func createExperiment(c *gin.Context) {
+	var req struct {
+		Prompt    string   `json:"prompt" binding:"required"`
+		Platforms []string `json:"platforms" binding:"required"`
+		Runs      int      `json:"runs"` // 每个平台生成次数，默认 1
+		Category  string   `json:"category"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Runs <= 0 {
+		req.Runs = 1
+	}
+	if req.Runs > 20 {
+		c.JSON(400, gin.H{"error": "runs 最大为 20"})
+		return
+	}
+	for _, plat := range req.Platforms {
+		if p, ok := cfg.Platforms[plat]; !ok || !p.Enabled {
+			c.JSON(400, gin.H{"error": "平台不可用: " + plat})
+			return
+		}
+	}
+	if !categoryExists(req.Category) {
+		c.JSON(400, gin.H{"error": "分类不存在: " + req.Category})
+		return
+	}
+	verdict := checkPromptPolicy(c.Request.Context(), req.Prompt, req.Platforms...)
+	if verdict.Blocked {
+		c.JSON(422, verdict.response())
+		return
+	}
+
+	exp := Experiment{
+		Prompt:    req.Prompt,
+		Platforms: strings.Join(req.Platforms, ","),
+		Runs:      req.Runs,
+		Status:    "running",
+		User:      currentUser(c),
+	}
+	if err := db.Create(&exp).Error; err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	base := ImageRecord{
+		User:       currentUser(c),
+		APIKey:     currentAPIKey(c),
+		Workspace:  currentWorkspace(c),
+		PolicyFlag: verdict.Flag,
+		Category:   req.Category,
+	}
+	go runExperiment(exp, req.Platforms, base)
+
+	c.JSON(200, gin.H{"message": "success", "experiment_id": exp.ID})
+}
+
+// runExperiment 按 MaxWorkers 并发执行实验中的全部生成
+func runExperiment(exp Experiment, platforms []string, base ImageRecord) {
+	log.Printf("🧪 实验 #%d 开始: %s × %d 次", exp.ID, exp.Platforms, exp.Runs)
+	base.ExperimentID = &exp.ID
+
+	var (
+		mu       sync.Mutex
+		failures = make(map[string]int)
+		wg       sync.WaitGroup
+		sem      = make(chan struct{}, cfg.ImageGen.MaxWorkers)
+	)
+	for _, plat := range platforms {
+		for i := 0; i < exp.Runs; i++ {
+			wg.Add(1)
+			go func(plat string) {
+				defer wg.Done()
+				sem <- struct{}{}
+				defer func() { <-sem }()
+
+				if _, err := generateAndSave(jobContext("experiment", exp.ID), plat, exp.Prompt, "", "", base); err != nil {
+					log.Printf("🧪 实验 #%d [%s] 失败: %v", exp.ID, plat, err)
+					mu.Lock()
+					failures[plat]++
+					mu.Unlock()
+				}
+			}(plat)
+		}
+	}
+	wg.Wait()
+
+	failuresJSON, _ := json.Marshal(failures)
+	now := time.Now()
+	db.Model(&Experiment{}).Where("id = ?", exp.ID).Updates(map[string]interface{}{
+		"status": "done", "failures": string(failuresJSON), "finished_at": now})
+	log.Printf("🧪 实验 #%d 完成", exp.ID)
+}
+
+func listExperiments(c *gin.Context) {
+	var experiments []Experiment
+	db.Order("id DESC").Limit(100).Find(&experiments)
+	c.JSON(200, gin.H{"experiments": experiments, "total": len(experiments)})
+}
+
+// getExperiment 实验结果：各平台生成数、失败数及审核结果
+func getExperiment(c *gin.Context) {
+	var exp Experiment
+	if err := db.First(&exp, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{"error": "实验不存在"})
+		return
+	}
+
+	var records []ImageRecord
+	db.Where("experiment_id = ?", exp.ID).Order("platform, generated_at").Find(&records)
+
+	failures := make(map[string]int)
+	if exp.Failures != "" {
+		json.Unmarshal([]byte(exp.Failures), &failures)
+	}
+
+	type platformOutcome struct {
+		Platform     string  `json:"platform"`
+		Name         string  `json:"name"`
+		Generated    int     `json:"generated"`
+		Failed       int     `json:"failed"`
+		Approved     int     `json:"approved"`
+		Rejected     int     `json:"rejected"`
+		Pending      int     `json:"pending"`
+		ApprovalRate float64 `json:"approval_rate"` // 已审核中通过的比例
+	}
+	outcomes := make([]*platformOutcome, 0)
+	byName := make(map[string]*platformOutcome)
+	for _, plat := range strings.Split(exp.Platforms, ",") {
+		o := &platformOutcome{Platform: plat, Name: cfg.Platforms[plat].Name, Failed: failures[plat]}
+		outcomes = append(outcomes, o)
+		byName[o.Name] = o
+	}
+	for _, r := range records {
+		o, ok := byName[r.Platform]
+		if !ok {
+			continue
+		}
+		o.Generated++
+		switch r.Status {
+		case "approved":
+			o.Approved++
+		case "rejected":
+			o.Rejected++
+		default:
+			o.Pending++
+		}
+	}
+	for _, o := range outcomes {
+		if reviewed := o.Approved + o.Rejected; reviewed > 0 {
+			o.ApprovalRate = float64(o.Approved) / float64(reviewed)
+		}
+	}
+
+	c.JSON(200, gin.H{
+		"experiment": exp,
+		"platforms":  outcomes,
+		"records":    withImageURLs(records),
+	})
+}
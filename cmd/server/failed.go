@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ========== 生成失败记录 ==========
+
+// recordGenerationFailure 生成失败时保存 status=failed 的记录，保留平台错误和重试所需的参数
+func recordGenerationFailure(platform, prompt, size, model string, base ImageRecord, genErr error) *ImageRecord {
+	// 试验场和压测的失败不留记录，不进入失败列表和失败统计
+	if nonProduction(base.Status) {
+		return nil
+	}
+	p := cfg.Platforms[platform]
+	if model == "" {
+		model = p.Model
+	}
+	now := time.Now()
+	record := base
+	record.ID = 0
+	record.Date = bizDate(now)
+	record.Platform = p.Name
+	record.PlatformID = platform
+	record.Model = model
+	record.Size = size
+	record.Prompt = prompt
+	record.GeneratedAt = now
+	record.Status = "failed"
+	record.Error = genErr.Error()
+	record.ErrorCode = errorCode(genErr)
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&record).Error; err != nil {
+			return err
+		}
+		return emitEvent(tx, "image.failed", gin.H{"id": record.ID, "platform": platform, "error": record.Error, "error_code": record.ErrorCode})
+	})
+	if err != nil {
+		return nil
+	}
+	recordActivity("generation_failed", record.ID, record.User, fmt.Sprintf("%s [%s]: %s", platform, record.ErrorCode, record.Error))
+	if reason := policyReason(genErr); reason != "" {
+		handlePolicyRejection(&record, reason)
+	}
+	return &record
+}
+
+// retryImage POST /api/images/:id/retry，用原参数重新生成，成功后原记录转为待审核
+// 密钥失效只能换平台重试，内容拦截和参数错误需要 force 才会重试
+func retryImage(c *gin.Context) {
+	var record ImageRecord
+	if err := db.First(&record, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{"error": "图片不存在"})
+		return
+	}
+	if record.Status != "failed" {
+		c.JSON(400, gin.H{"error": "只能重试生成失败的记录"})
+		return
+	}
+	if record.Operation != "" {
+		c.JSON(400, gin.H{"error": "图生图等操作未保存原图参数，请重新提交"})
+		return
+	}
+	var req struct {
+		Platform string `json:"platform"` // 可选，换一个平台重试
+		Force    bool   `json:"force"`    // 忽略错误分类强制重试
+	}
+	c.ShouldBindJSON(&req)
+	platform := record.PlatformID
+	if req.Platform != "" {
+		platform = req.Platform
+	}
+	if !req.Force && !retryable(record.ErrorCode) && !(record.ErrorCode == ErrCodeAuth && platform != record.PlatformID) {
+		c.JSON(409, gin.H{"error": retryHint(record.ErrorCode), "code": "not_retryable", "error_code": record.ErrorCode})
+		return
+	}
+	if p, ok := cfg.Platforms[platform]; !ok || !p.Enabled {
+		c.JSON(400, gin.H{"error": "平台不可用: " + platform})
+		return
+	}
+	if err := checkPlatformRouting(platform); err != nil {
+		c.JSON(503, gin.H{"error": err.Error(), "code": ErrCodeDraining})
+		return
+	}
+	if err := checkBreaker(platform); err != nil {
+		c.JSON(503, gin.H{"error": err.Error(), "code": ErrCodeCircuitOpen})
+		return
+	}
+	cost := cfg.Platforms[platform].CostPerImage
+	release, err := reserveQuota(record.User, record.APIKey, 1, cost)
+	if err != nil {
+		c.JSON(429, gin.H{"error": err.Error(), "code": "quota_exceeded"})
+		return
+	}
+	defer release()
+
+	model := record.Model
+	if platform != record.PlatformID {
+		model = ""
+	}
+	send, lang, translated := localizePrompt(platform, record.Prompt)
+	result, err := generateImage(c.Request.Context(), platform, send, record.Size, model, GenerateOptions{NegativePrompt: record.NegativePrompt, Seed: record.Seed})
+	if err != nil {
+		db.Model(&ImageRecord{}).Where("id = ?", record.ID).Updates(map[string]interface{}{"error": err.Error(), "error_code": errorCode(err)})
+		recordActivity("generation_failed", record.ID, currentUser(c), fmt.Sprintf("%s 重试失败 [%s]: %v", platform, errorCode(err), err))
+		c.JSON(502, gin.H{"error": err.Error(), "code": "generation_failed", "error_code": errorCode(err), "id": record.ID})
+		return
+	}
+
+	generated := newImageRecord(result, record.Prompt)
+	record.Name = generated.Name
+	record.Date = generated.Date
+	record.Path = generated.Path
+	record.Platform = generated.Platform
+	record.PlatformID = platform
+	record.Model = generated.Model
+	record.GeneratedAt = generated.GeneratedAt
+	record.FileSize = generated.FileSize
+	record.MimeType = generated.MimeType
+	record.ProviderMeta = generated.ProviderMeta
+	record.PromptLang = lang
+	record.PromptTranslated = translated
+	record.PromptSent = send != record.Prompt
+	record.Seed = result.Seed
+	record.Status = "pending"
+	record.Error = ""
+	record.ErrorCode = ""
+	record.Cost = cost
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&record).Error; err != nil {
+			return err
+		}
+		return emitEvent(tx, "image.generated", record)
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	recordActivity("generated", record.ID, currentUser(c), "重试成功: "+record.Platform+" "+record.Model)
+	c.JSON(200, gin.H{"message": "success", "record": record, "url": imageURL(record.Path)})
+}
+
+// retryHint 不可直接重试时的提示
+func retryHint(code string) string {
+	switch code {
+	case ErrCodeAuth:
+		return "平台密钥无效或已过期，请更新密钥或换平台重试"
+	case ErrCodePolicyBlocked:
+		return "提示词被平台内容审核拦截，请修改提示词后重新生成"
+	default:
+		return "请求参数错误，请检查平台和参数配置"
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"log"
+)
+
+// ========== 平台自动降级 ==========
+
+// fallbackChain 本次生成依次尝试的平台：请求的平台在前，之后是 imageGen.fallback 中其余已启用的平台
+// 对比实验、草稿多平台生成、故事和同 seed 重新生成需要固定平台，压测只调用模拟平台，都不降级
+func fallbackChain(platform string, base ImageRecord) []string {
+	chain := []string{platform}
+	if base.ExperimentID != nil || base.DraftID != nil || base.StoryID != nil || base.Operation == "regenerate" || base.Status == "loadtest" {
+		return chain
+	}
+	for _, key := range cfg.ImageGen.Fallback {
+		if p, ok := cfg.Platforms[key]; ok && p.Enabled && key != platform {
+			chain = append(chain, key)
+		}
+	}
+	return chain
+}
+
+// shouldFallback 平台侧的失败才换平台；内容审核拦截换平台绕过审核，不降级
+func shouldFallback(err error) bool {
+	switch errorCode(err) {
+	case ErrCodePolicyBlocked, ErrCodeQuota, ErrCodeCanceled:
+		return false
+	}
+	return true
+}
+
+// validateFallback 启动时检查降级平台配置
+func validateFallback() {
+	for _, key := range cfg.ImageGen.Fallback {
+		if p, ok := cfg.Platforms[key]; !ok {
+			log.Printf("⚠️ imageGen.fallback 中的平台不存在: %s", key)
+		} else if !p.Enabled {
+			log.Printf("⚠️ imageGen.fallback 中的平台未启用，将跳过: %s", key)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ========== 图片文件名 ==========
+
+// imageGen.filenameStrategy 可选的文件名策略：
+// time 时分秒（默认），ulid 按时间排序的唯一 ID，record_id 记录 ID，prompt 提示词摘要加哈希
+// record_id 和 prompt 在记录入库后才确定，文件先按 ulid 保存，入库时再改名
+var filenameStrategies = map[string]bool{"": true, "time": true, "ulid": true, "record_id": true, "prompt": true}
+
+// 同名文件存在时追加序号的最大尝试次数
+const maxNameAttempts = 1000
+
+// validateFilenameStrategy 启动时检查文件名策略
+func validateFilenameStrategy() error {
+	if !filenameStrategies[cfg.ImageGen.FilenameStrategy] {
+		return fmt.Errorf("不支持的 filenameStrategy: %s，可选 time、ulid、record_id、prompt", cfg.ImageGen.FilenameStrategy)
+	}
+	return nil
+}
+
+// crockford ULID 使用的 Crockford Base32 字母表
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// newULID 生成 ULID：48 位毫秒时间戳 + 80 位随机数，字典序即时间序
+func newULID(t time.Time) string {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], uint64(t.UnixMilli())<<16)
+	rand.Read(b[6:])
+	// 128 位按 5 位一组编码为 26 个字符，首字符只有 3 位
+	out := make([]byte, 26)
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out)
+}
+
+// newImageFilename 按文件名策略生成新图片的文件名，idx 为同一次生成中的序号
+func newImageFilename(now time.Time, idx int, ext string) string {
+	switch cfg.ImageGen.FilenameStrategy {
+	case "ulid", "record_id", "prompt":
+		return newULID(now) + ext
+	}
+	if idx > 0 {
+		return fmt.Sprintf("%s_%d%s", now.Format("150405"), idx, ext)
+	}
+	return now.Format("150405") + ext
+}
+
+// promptSlug 提示词摘要：保留字母和数字（含中文），其余字符合并为 -，最多 32 个字符
+func promptSlug(prompt string) string {
+	var b strings.Builder
+	n, dash := 0, false
+	for _, r := range strings.ToLower(prompt) {
+		if n >= 32 {
+			break
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+				n++
+			}
+			b.WriteRune(r)
+			n++
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	if b.Len() == 0 {
+		return "image"
+	}
+	return b.String()
+}
+
+// recordFilename 入库后按 record_id 或 prompt 策略确定的文件名，其他策略返回空
+func recordFilename(record *ImageRecord) string {
+	ext := filepath.Ext(record.Path)
+	switch cfg.ImageGen.FilenameStrategy {
+	case "record_id":
+		return strconv.FormatUint(uint64(record.ID), 10) + ext
+	case "prompt":
+		sum := sha256.Sum256([]byte(record.Prompt))
+		return promptSlug(record.Prompt) + "-" + hex.EncodeToString(sum[:4]) + ext
+	}
+	return ""
+}
+
+// numberedPath 第 i 个候选路径，i 为 0 时为原路径，否则在扩展名前追加 _i
+func numberedPath(path string, i int) string {
+	if i == 0 {
+		return path
+	}
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s_%d%s", strings.TrimSuffix(path, ext), i, ext)
+}
+
+// writeImageFile 把图片写入 dir/filename，同名文件已存在时追加序号，不会覆盖已有文件，返回实际路径
+func writeImageFile(dir, filename string, data []byte) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("创建目录失败: %v", err)
+	}
+	base := filepath.Join(dir, filename)
+	for i := 0; i < maxNameAttempts; i++ {
+		path := numberedPath(base, i)
+		// O_EXCL 保证并发写入同名文件时只有一个成功
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("写入失败: %v", err)
+		}
+		_, err = f.Write(data)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(path)
+			return "", fmt.Errorf("写入失败: %v", err)
+		}
+		return path, nil
+	}
+	return "", fmt.Errorf("写入失败: 同名文件过多 %s", base)
+}
+
+// moveImageFile 把图片移动到 dst，同名文件已存在时追加序号，不会覆盖已有文件，返回实际路径
+func moveImageFile(src, dst string) (string, error) {
+	for i := 0; i < maxNameAttempts; i++ {
+		path := numberedPath(dst, i)
+		// 硬链接在目标存在时失败，可以原子地占用文件名
+		err := os.Link(src, path)
+		if err == nil {
+			os.Remove(src)
+			return path, nil
+		}
+		if os.IsExist(err) {
+			continue
+		}
+		// 跨设备或不支持硬链接时检查后重命名
+		if _, statErr := os.Stat(path); statErr == nil {
+			continue
+		}
+		if err := os.Rename(src, path); err != nil {
+			return "", err
+		}
+		return path, nil
+	}
+	return "", fmt.Errorf("同名文件过多: %s", dst)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"image-platform/internal/generator"
+)
+
+// ========== 生成错误分类 ==========
+
+// 生成错误码，保存在失败记录和任务上，供重试和告警区分处理；分类规则在 internal/generator
+const (
+	ErrCodeAuth          = generator.ErrCodeAuth
+	ErrCodeProviderQuota = generator.ErrCodeProviderQuota
+	ErrCodePolicyBlocked = generator.ErrCodePolicyBlocked
+	ErrCodeTimeout       = generator.ErrCodeTimeout
+	ErrCodeMalformed     = generator.ErrCodeMalformed
+	ErrCodeUnavailable   = generator.ErrCodeUnavailable
+	ErrCodeInvalid       = generator.ErrCodeInvalid
+	ErrCodeQuota         = generator.ErrCodeQuota
+	ErrCodeDraining      = generator.ErrCodeDraining
+	ErrCodeCircuitOpen   = generator.ErrCodeCircuitOpen
+	ErrCodeCanceled      = generator.ErrCodeCanceled
+	ErrCodeUnknown       = generator.ErrCodeUnknown
+)
+
+// GenerationError 带错误码的生成错误
+type GenerationError = generator.GenerationError
+
+func genError(code, format string, args ...interface{}) error {
+	return generator.Errorf(code, format, args...)
+}
+
+// policyReason 内容策略拦截的原因，其他错误为空
+func policyReason(err error) string {
+	return generator.PolicyReason(err)
+}
+
+// errorCode 取错误码，未分类的错误为 unknown
+func errorCode(err error) string {
+	return generator.ErrorCode(err)
+}
+
+// retryable 相同参数重试是否可能成功；密钥、内容和参数问题需要先修改配置或提示词
+func retryable(code string) bool {
+	return generator.Retryable(code)
+}
+
+// migrateErrorCodes 内容审核拦截的错误码由 content_policy 改为 policy_blocked，启动时更新旧记录，
+// 失败列表和统计按新错误码筛选
+func migrateErrorCodes() {
+	for _, model := range []interface{}{&ImageRecord{}, &TaskRecord{}, &DeadLetter{}} {
+		db.Model(model).Where("error_code = ?", "content_policy").Update("error_code", ErrCodePolicyBlocked)
+	}
+}
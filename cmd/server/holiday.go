@@ -0,0 +1,143 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ========== 节日与节气 ==========
+
+// 农历节日的公历日期，每年不同，按年份维护；超出范围的年份可在 holidays.extra 中补充
+var lunarHolidays = map[string]map[int]string{
+	"春节": {2024: "02-10", 2025: "01-29", 2026: "02-17", 2027: "02-06", 2028: "01-26", 2029: "02-13", 2030: "02-03"},
+	"元宵": {2024: "02-24", 2025: "02-12", 2026: "03-03", 2027: "02-20", 2028: "02-09", 2029: "02-27", 2030: "02-17"},
+	"端午": {2024: "06-10", 2025: "05-31", 2026: "06-19", 2027: "06-09", 2028: "05-28", 2029: "06-16", 2030: "06-05"},
+	"七夕": {2024: "08-10", 2025: "08-29", 2026: "08-19", 2027: "08-08", 2028: "08-26", 2029: "08-16", 2030: "08-05"},
+	"中秋": {2024: "09-17", 2025: "10-06", 2026: "09-25", 2027: "09-15", 2028: "10-03", 2029: "09-22", 2030: "09-12"},
+}
+
+// 公历固定节日
+var fixedHolidays = map[string]string{
+	"01-01": "元旦",
+	"05-01": "劳动节",
+	"06-01": "儿童节",
+	"10-01": "国庆",
+}
+
+// 二十四节气，从小寒开始，每月两个
+var solarTerms = []string{
+	"小寒", "大寒", "立春", "雨水", "惊蛰", "春分", "清明", "谷雨", "立夏", "小满", "芒种", "夏至",
+	"小暑", "大暑", "立秋", "处暑", "白露", "秋分", "寒露", "霜降", "立冬", "小雪", "大雪", "冬至",
+}
+
+// 21 世纪节气公式的 C 值，与 solarTerms 对应
+var solarTermC = []float64{
+	5.4055, 20.12, 3.87, 18.73, 5.63, 20.646, 4.81, 20.1, 5.52, 21.04, 5.678, 21.37,
+	7.108, 22.83, 7.5, 23.13, 7.646, 23.042, 8.318, 23.438, 7.438, 22.36, 7.18, 21.94,
+}
+
+// 公式计算结果需要修正的年份
+var solarTermFix = map[int]map[string]int{
+	2019: {"小寒": -1},
+	2021: {"冬至": -1},
+	2026: {"雨水": -1},
+	2082: {"大寒": 1},
+	2084: {"春分": 1},
+	2089: {"霜降": 1, "立冬": 1},
+}
+
+// solarTermDate 第 i 个节气的日期，适用于 2001-2099 年
+func solarTermDate(year, i int) time.Time {
+	y := float64(year % 100)
+	leap := math.Floor(y / 4)
+	if i < 4 { // 小寒、大寒、立春、雨水在闰日之前
+		leap = math.Floor((y - 1) / 4)
+	}
+	day := int(math.Floor(y*0.2422+solarTermC[i])-leap) + solarTermFix[year][solarTerms[i]]
+	return time.Date(year, time.Month(i/2+1), day, 0, 0, 0, 0, bizLoc)
+}
+
+// currentSolarTerm 日期所处的节气，即当天或之前最近的一个
+func currentSolarTerm(date time.Time) string {
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, bizLoc)
+	for i := len(solarTerms) - 1; i >= 0; i-- {
+		if !solarTermDate(day.Year(), i).After(day) {
+			return solarTerms[i]
+		}
+	}
+	return "冬至" // 小寒之前仍处于上一年的冬至
+}
+
+// holidayOn 日期当天的节日，依次查找配置补充、农历节日、固定节日和清明
+func holidayOn(date time.Time) string {
+	key := date.Format("01-02")
+	if name, ok := cfg.Holidays.Extra[date.Format("2006-01-02")]; ok {
+		return name
+	}
+	for name, years := range lunarHolidays {
+		if years[date.Year()] == key {
+			return name
+		}
+	}
+	if name, ok := fixedHolidays[key]; ok {
+		return name
+	}
+	if solarTermDate(date.Year(), 6).Format("01-02") == key {
+		return "清明"
+	}
+	return ""
+}
+
+// upcomingHoliday 日期当天或之后 leadDays 天内最近的节日
+func upcomingHoliday(date time.Time) (string, time.Time) {
+	for d := 0; d <= cfg.Holidays.LeadDays; d++ {
+		day := date.AddDate(0, 0, d)
+		if name := holidayOn(day); name != "" {
+			return name, day
+		}
+	}
+	return "", time.Time{}
+}
+
+// holidayPreset 日期临近节日且配置了节日模板时返回模板名
+func holidayPreset(date time.Time) string {
+	name, _ := upcomingHoliday(date)
+	if name == "" {
+		return ""
+	}
+	return cfg.Holidays.Presets[name]
+}
+
+// ========== 节日 API ==========
+
+// listHolidays GET /api/holidays?from=&days=，列出区间内的节日和节气
+func listHolidays(c *gin.Context) {
+	from, err := time.ParseInLocation("2006-01-02", c.DefaultQuery("from", today()), bizLoc)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "from 格式应为 YYYY-MM-DD"})
+		return
+	}
+	days, _ := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if days <= 0 || days > 366 {
+		days = 30
+	}
+
+	var items []gin.H
+	for d := 0; d < days; d++ {
+		day := from.AddDate(0, 0, d)
+		date := day.Format("2006-01-02")
+		if name := holidayOn(day); name != "" {
+			items = append(items, gin.H{"date": date, "type": "holiday", "name": name, "preset": cfg.Holidays.Presets[name]})
+		}
+		for i, term := range solarTerms {
+			if solarTermDate(day.Year(), i).Format("2006-01-02") == date && term != "清明" {
+				items = append(items, gin.H{"date": date, "type": "solar_term", "name": term})
+			}
+		}
+	}
+	holiday, _ := upcomingHoliday(from)
+	c.JSON(200, gin.H{"items": items, "holiday": holiday, "solar_term": currentSolarTerm(from)})
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"image-platform/internal/generator"
+)
+
+// ========== 图生图 ==========
+
+// 上传原图的大小上限
+const maxSourceImageSize = 10 << 20
+
+// sourceImage 图生图的原图，来自上传文件或已有记录
+type sourceImage struct {
+	RecordID *uint
+	Path     string
+	Data     []byte
+	MIME     string
+}
+
+func (s *sourceImage) dataURI() string {
+	return "data:" + s.MIME + ";base64," + base64.StdEncoding.EncodeToString(s.Data)
+}
+
+// generatorImage 传给平台实现的原图，配置了 server.publicUrl 时附上原图的公网地址，只接受图片地址的平台使用
+func (s *sourceImage) generatorImage() *generator.SourceImage {
+	img := &generator.SourceImage{Name: filepath.Base(s.Path), Data: s.Data, MIME: s.MIME}
+	if cfg.Server.PublicURL != "" {
+		img.URL = strings.TrimRight(cfg.Server.PublicURL, "/") + imageURL(s.Path)
+	}
+	return img
+}
+
+// checkSourceURL 平台需要公网地址读取原图时，检查是否配置了 server.publicUrl，在调用平台前拒绝请求
+func checkSourceURL(platform string) error {
+	if generator.CapabilitiesOf(platformType(platform)).SourceURL && cfg.Server.PublicURL == "" {
+		return genError(ErrCodeInvalid, "server.publicUrl 未配置，平台 %s 需要可公网访问的原图地址", platform)
+	}
+	return nil
+}
+
+// readSourceImage 读取并校验原图内容
+func readSourceImage(r io.Reader) ([]byte, string, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxSourceImageSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(data) > maxSourceImageSize {
+		return nil, "", fmt.Errorf("原图不能超过 %d MB", maxSourceImageSize>>20)
+	}
+	mime := http.DetectContentType(data)
+	switch mime {
+	case "image/png", "image/jpeg", "image/webp":
+		return data, mime, nil
+	}
+	return nil, "", fmt.Errorf("不支持的图片格式: %s", mime)
+}
+
+// loadSourceImage 优先使用上传的 image 文件，否则读取 imageID 对应的记录
+func loadSourceImage(c *gin.Context, imageID uint) (*sourceImage, error) {
+	if fh, err := c.FormFile("image"); err == nil {
+		f, err := fh.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		data, mime, err := readSourceImage(f)
+		if err != nil {
+			return nil, err
+		}
+		// 保存上传的原图，平台需要公网地址时通过 /images 访问
+		now := time.Now()
+		dir := filepath.Join(cfg.ImageGen.OutputDir, bizDate(now), "uploads")
+		os.MkdirAll(dir, 0755)
+		ext := strings.ToLower(filepath.Ext(fh.Filename))
+		if ext == "" {
+			ext = "." + strings.TrimPrefix(mime, "image/")
+		}
+		path := filepath.Join(dir, fmt.Sprintf("%s_%09d%s", now.Format("150405"), now.Nanosecond(), ext))
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return nil, fmt.Errorf("保存原图失败: %v", err)
+		}
+		return &sourceImage{Path: path, Data: data, MIME: mime}, nil
+	}
+
+	if imageID == 0 {
+		return nil, fmt.Errorf("请上传 image 文件或指定 image_id")
+	}
+	return sourceFromRecord(imageID)
+}
+
+// sourceFromRecord 读取已有记录的图片作为原图
+func sourceFromRecord(imageID uint) (*sourceImage, error) {
+	var record ImageRecord
+	if err := db.First(&record, imageID).Error; err != nil {
+		return nil, fmt.Errorf("原图记录不存在")
+	}
+	if record.Path == "" {
+		return nil, fmt.Errorf("原图记录没有图片文件")
+	}
+	f, err := os.Open(record.Path)
+	if err != nil {
+		return nil, fmt.Errorf("读取原图失败: %v", err)
+	}
+	defer f.Close()
+	data, mime, err := readSourceImage(f)
+	if err != nil {
+		return nil, err
+	}
+	return &sourceImage{RecordID: &record.ID, Path: record.Path, Data: data, MIME: mime}, nil
+}
+
+// generateImg2Img 以原图为参考生成 n 张图片，strength 越大与原图差别越大；模型为空时优先使用 editModel
+func generateImg2Img(ctx context.Context, platform, prompt, size, model string, src *sourceImage, strength float64, n int) ([]*GenerateResult, error) {
+	p, ok := cfg.Platforms[platform]
+	if !ok || !p.Enabled {
+		return nil, genError(ErrCodeInvalid, "平台不可用: %s", platform)
+	}
+	out, err := generator.Generate(ctx, p.Type, generator.GenerateRequest{
+		Platform:  platform,
+		Config:    p.generatorConfig(),
+		Operation: generator.OpImg2Img,
+		Prompt:    prompt,
+		Size:      size,
+		Model:     model,
+		N:         n,
+		Source:    src.generatorImage(),
+		Strength:  strength,
+	})
+	return out.Images, err
+}
+
+// ========== 图生图 API ==========
+
+// handleImg2Img POST /api/generate/img2img
+// multipart 上传 image 文件，或 JSON/表单传 image_id 引用已有图片
+func handleImg2Img(c *gin.Context) {
+	var req struct {
+		ImageID  uint    `json:"image_id" form:"image_id"`
+		Prompt   string  `json:"prompt" form:"prompt" binding:"required"`
+		Strength float64 `json:"strength" form:"strength"` // 0-1，默认 0.6
+		Platform string  `json:"platform" form:"platform"`
+		Model    string  `json:"model" form:"model"`
+		Size     string  `json:"size" form:"size"`
+		Category string  `json:"category" form:"category"`
+		N        int     `json:"n" form:"n"`
+	}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(400, gin.H{"error": "请输入描述词: " + err.Error()})
+		return
+	}
+	if req.Strength == 0 {
+		req.Strength = 0.6
+	}
+	if req.Strength < 0 || req.Strength > 1 {
+		c.JSON(400, gin.H{"error": "strength 取值范围 0-1"})
+		return
+	}
+	if req.N <= 0 {
+		req.N = 1
+	}
+	if req.N > maxImagesPerRequest {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("n 最大为 %d", maxImagesPerRequest)})
+		return
+	}
+	if req.Platform == "" {
+		req.Platform = getOrCreateSettings().Platform
+	}
+	if !generator.CapabilitiesOf(platformType(req.Platform)).Img2Img {
+		c.JSON(400, gin.H{"error": "平台不支持图生图: " + req.Platform})
+		return
+	}
+	if err := checkSourceURL(req.Platform); err != nil {
+		c.JSON(400, gin.H{"error": err.Error(), "code": "unsupported"})
+		return
+	}
+	// 图生图使用 editModel，尺寸沿用原图，只检查张数和提示词长度
+	if err := checkCapabilities(req.Platform, "", "", req.N, req.Prompt); err != nil {
+		c.JSON(400, gin.H{"error": err.Error(), "code": "unsupported"})
+		return
+	}
+	if err := checkPlatformRouting(req.Platform); err != nil {
+		c.JSON(503, gin.H{"error": err.Error(), "code": ErrCodeDraining})
+		return
+	}
+	if err := checkBreaker(req.Platform); err != nil {
+		c.JSON(503, gin.H{"error": err.Error(), "code": ErrCodeCircuitOpen})
+		return
+	}
+	if !categoryExists(req.Category) {
+		c.JSON(400, gin.H{"error": "分类不存在: " + req.Category})
+		return
+	}
+	verdict := checkPromptPolicy(c.Request.Context(), req.Prompt, req.Platform)
+	if verdict.Blocked {
+		c.JSON(422, verdict.response())
+		return
+	}
+	src, err := loadSourceImage(c, req.ImageID)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, apiKey := currentUser(c), currentAPIKey(c)
+	cost := cfg.Platforms[req.Platform].CostPerImage
+	release, err := reserveQuota(user, apiKey, req.N, cost*float64(req.N))
+	if err != nil {
+		c.JSON(429, gin.H{"error": err.Error(), "code": "quota_exceeded"})
+		return
+	}
+	defer release()
+
+	base := ImageRecord{
+		User:       user,
+		APIKey:     apiKey,
+		Workspace:  currentWorkspace(c),
+		PolicyFlag: verdict.Flag,
+		Category:   req.Category,
+		SourceID:   src.RecordID,
+		Operation:  "img2img",
+	}
+	send, lang, translated := localizePrompt(req.Platform, req.Prompt)
+	base.PromptLang, base.PromptTranslated, base.PromptSent = lang, translated, send != req.Prompt
+	results, err := generateImg2Img(withGenContext(c.Request.Context(), req.Platform, req.Prompt, req.Size, base), req.Platform, send, req.Size, req.Model, src, req.Strength, req.N)
+	if err != nil {
+		recordGenerationFailure(req.Platform, req.Prompt, req.Size, req.Model, base, err)
+		c.JSON(502, gin.H{"error": "生成失败: " + err.Error(), "code": "generation_failed", "error_code": errorCode(err)})
+		return
+	}
+	records, err := saveGenerated(req.Platform, req.Prompt, req.Size, results, base)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	ids := make([]uint, len(records))
+	for i, r := range records {
+		ids[i] = r.ID
+	}
+	c.JSON(200, gin.H{"message": "success", "id": ids[0], "ids": ids, "source_id": src.RecordID, "images": withImageURLs(records)})
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"image-platform/internal/generator"
+)
+
+// ========== 提示词语言 ==========
+
+// detectLanguage 按汉字和拉丁字母的占比判断提示词语言，返回 zh、en，无法判断时为空
+func detectLanguage(text string) string {
+	var han, latin int
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			han++
+		case r < unicode.MaxASCII && unicode.IsLetter(r):
+			latin++
+		}
+	}
+	// 一个汉字的信息量约等于一个英文单词，按 1:4 折算字母数
+	switch {
+	case han == 0 && latin == 0:
+		return ""
+	case han*4 >= latin:
+		return "zh"
+	default:
+		return "en"
+	}
+}
+
+var (
+	translateMu    sync.Mutex
+	translateCache = make(map[string]string)
+)
+
+// 翻译缓存上限，超出后清空，批量生成时同一提示词只翻译一次
+const translateCacheSize = 1000
+
+// translatePrompt 按 translate.provider 把提示词翻译为 to 语言（zh/en），结果缓存在内存中
+func translatePrompt(ctx context.Context, text, to string) (string, error) {
+	key := to + "\x00" + text
+	translateMu.Lock()
+	cached, ok := translateCache[key]
+	translateMu.Unlock()
+	if ok {
+		return cached, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	defer cancel()
+	var (
+		answer string
+		err    error
+	)
+	switch cfg.Translate.Provider {
+	case "deepl":
+		answer, err = translateDeepL(ctx, text, to)
+	case "baidu":
+		answer, err = translateBaidu(ctx, text, to)
+	default:
+		answer, err = translateLLM(ctx, text, to)
+	}
+	if err != nil {
+		return "", err
+	}
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return "", fmt.Errorf("翻译结果为空")
+	}
+
+	translateMu.Lock()
+	if len(translateCache) >= translateCacheSize {
+		translateCache = make(map[string]string)
+	}
+	translateCache[key] = answer
+	translateMu.Unlock()
+	return answer, nil
+}
+
+// validateTranslate 启动时检查翻译服务配置
+func validateTranslate() error {
+	tc := cfg.Translate
+	switch tc.Provider {
+	case "", "llm":
+	case "deepl":
+		if tc.Enabled && tc.APIKey == "" {
+			return fmt.Errorf("deepl 需要配置 apiKey 或 envKey")
+		}
+	case "baidu":
+		if tc.Enabled && (tc.AppID == "" || tc.APIKey == "") {
+			return fmt.Errorf("baidu 需要配置 appId 和 apiKey")
+		}
+	default:
+		return fmt.Errorf("不支持的翻译服务 %q，可选 llm、deepl、baidu", tc.Provider)
+	}
+	return nil
+}
+
+// translateLLM 用 llm 配置的模型翻译，会保留提示词的写法
+func translateLLM(ctx context.Context, text, to string) (string, error) {
+	target := "英文"
+	if to == "zh" {
+		target = "中文"
+	}
+	return callLLM(ctx, fmt.Sprintf(`把下面的图片生成提示词翻译成%s，保留风格、构图等描述，不要解释，只输出译文。
+
+%s`, target, text))
+}
+
+// translateDeepL 调用 DeepL /v2/translate，免费版密钥以 :fx 结尾，默认使用免费版地址
+func translateDeepL(ctx context.Context, text, to string) (string, error) {
+	base := cfg.Translate.URL
+	if base == "" {
+		base = "https://api.deepl.com"
+		if strings.HasSuffix(cfg.Translate.APIKey, ":fx") {
+			base = "https://api-free.deepl.com"
+		}
+	}
+	target := "EN-US"
+	if to == "zh" {
+		target = "ZH"
+	}
+	body, _ := json.Marshal(map[string]interface{}{"text": []string{text}, "target_lang": target})
+	req, _ := http.NewRequestWithContext(ctx, "POST", strings.TrimSuffix(base, "/")+"/v2/translate", bytes.NewReader(body))
+	req.Header.Set("Authorization", "DeepL-Auth-Key "+cfg.Translate.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+	resp, data, err := generator.DoWithRetry(providerClient("deepl", 20*time.Second), req)
+	if err != nil {
+		return "", generator.RequestError("DeepL 请求失败", err)
+	}
+	if resp.StatusCode != 200 {
+		return "", generator.ResponseError("DeepL 翻译失败", resp.StatusCode, data)
+	}
+	var result struct {
+		Translations []struct {
+			Text string `json:"text"`
+		} `json:"translations"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil || len(result.Translations) == 0 {
+		return "", generator.ResponseError("DeepL 解析失败", resp.StatusCode, data)
+	}
+	return result.Translations[0].Text, nil
+}
+
+// translateBaidu 调用百度通用翻译，签名为 md5(appid+q+salt+密钥)；多行原文逐行返回，按行拼接
+func translateBaidu(ctx context.Context, text, to string) (string, error) {
+	base := cfg.Translate.URL
+	if base == "" {
+		base = "https://fanyi-api.baidu.com/api/trans/vip/translate"
+	}
+	tc := cfg.Translate
+	salt := strconv.FormatInt(time.Now().UnixNano(), 10)
+	sum := md5.Sum([]byte(tc.AppID + text + salt + tc.APIKey))
+	form := url.Values{
+		"q": {text}, "from": {"auto"}, "to": {to},
+		"appid": {tc.AppID}, "salt": {salt}, "sign": {hex.EncodeToString(sum[:])},
+	}
+	req, _ := http.NewRequestWithContext(ctx, "POST", base, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, data, err := generator.DoWithRetry(providerClient("baidu-translate", 20*time.Second), req)
+	if err != nil {
+		return "", generator.RequestError("百度翻译请求失败", err)
+	}
+	if resp.StatusCode != 200 {
+		return "", generator.ResponseError("百度翻译失败", resp.StatusCode, data)
+	}
+	var result struct {
+		ErrorCode   string `json:"error_code"`
+		ErrorMsg    string `json:"error_msg"`
+		TransResult []struct {
+			Dst string `json:"dst"`
+		} `json:"trans_result"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return "", generator.ResponseError("百度翻译解析失败", resp.StatusCode, data)
+	}
+	if result.ErrorCode != "" && result.ErrorCode != "52000" {
+		return "", fmt.Errorf("百度翻译失败 (%s): %s", result.ErrorCode, result.ErrorMsg)
+	}
+	lines := make([]string, len(result.TransResult))
+	for i, r := range result.TransResult {
+		lines[i] = r.Dst
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// localizePrompt 检测提示词语言并生成另一种语言的译文
+// 平台配置了 promptLanguage 且与原文不同时返回译文作为实际发送的提示词，记录中仍保存原文
+func localizePrompt(platform, prompt string) (send, lang, translated string) {
+	lang = detectLanguage(prompt)
+	if !cfg.Translate.Enabled || lang == "" {
+		return prompt, lang, ""
+	}
+	to := "en"
+	if lang == "en" {
+		to = "zh"
+	}
+	translated, err := translatePrompt(context.Background(), prompt, to)
+	if err != nil {
+		log.Printf("[翻译] 提示词翻译失败，使用原文: %v", err)
+		return prompt, lang, ""
+	}
+	if want := cfg.Platforms[platform].PromptLanguage; want != "" && want != lang {
+		return translated, lang, translated
+	}
+	return prompt, lang, translated
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/llms/openai"
+)
+
+// ========== 文本大模型 ==========
+
+// callLLM 调用配置的文本大模型，返回单轮回复
+func callLLM(ctx context.Context, prompt string) (string, error) {
+	return callLLMModel(ctx, cfg.LLM.Model, prompt)
+}
+
+// callLLMModel 使用指定模型调用 LLM 接口
+func callLLMModel(ctx context.Context, model, prompt string) (string, error) {
+	if cfg.LLM.URL == "" || model == "" {
+		return "", fmt.Errorf("未配置 LLM")
+	}
+	llm, err := openai.New(
+		openai.WithBaseURL(cfg.LLM.URL),
+		openai.WithModel(model),
+		openai.WithToken(cfg.LLM.APIKey),
+	)
+	if err != nil {
+		return "", fmt.Errorf("创建 LLM 客户端失败: %w", err)
+	}
+	return llms.GenerateFromSinglePrompt(ctx, llm, prompt)
+}
+
+// callVisionLLM 调用视觉模型，图片以 data URL 形式随提示词发送
+func callVisionLLM(ctx context.Context, prompt, imagePath string) (string, error) {
+	if cfg.LLM.URL == "" || cfg.LLM.VisionModel == "" {
+		return "", fmt.Errorf("未配置视觉模型")
+	}
+	data, err := os.ReadFile(imagePath)
+	if err != nil {
+		return "", fmt.Errorf("读取图片失败: %w", err)
+	}
+	llm, err := openai.New(
+		openai.WithBaseURL(cfg.LLM.URL),
+		openai.WithModel(cfg.LLM.VisionModel),
+		openai.WithToken(cfg.LLM.APIKey),
+	)
+	if err != nil {
+		return "", fmt.Errorf("创建 LLM 客户端失败: %w", err)
+	}
+
+	dataURL := "data:" + http.DetectContentType(data) + ";base64," + base64.StdEncoding.EncodeToString(data)
+	resp, err := llm.GenerateContent(ctx, []llms.MessageContent{{
+		Role:  llms.ChatMessageTypeHuman,
+		Parts: []llms.ContentPart{llms.TextPart(prompt), llms.ImageURLPart(dataURL)},
+	}})
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("视觉模型无返回")
+	}
+	return resp.Choices[0].Content, nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ========== 压测 ==========
+
+const (
+	// loadTestPlatform 压测使用的平台配置键，需配置为模拟平台并启用
+	loadTestPlatform = "mock"
+	// loadTestUser 压测任务和记录的用户，不使用默认额度
+	loadTestUser = "loadtest"
+)
+
+// handleLoadTest POST /api/admin/loadtest
+// 压测任务与 /api/generate 的异步生成走同一条路径：入队后由 worker 经平台槽位、熔断和额度预占调用模拟平台并写库，
+// 排队等待和生成耗时分开统计，用于评估 maxWorkers 和数据库连接池配置
+func handleLoadTest(c *gin.Context) {
+	var req struct {
+		Count int  `json:"count" binding:"required"` // 生成次数
+		Keep  bool `json:"keep"`                     // 是否保留生成的记录和文件
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Count <= 0 || req.Count > 10000 {
+		c.JSON(400, gin.H{"error": "count 取值范围 1-10000"})
+		return
+	}
+	p, ok := cfg.Platforms[loadTestPlatform]
+	if !ok || !p.Enabled || platformType(loadTestPlatform) != "mock" {
+		c.JSON(400, gin.H{"error": "压测需要在 platforms 中配置并启用 mock 模拟平台"})
+		return
+	}
+
+	log.Printf("🔥 压测开始: count=%d maxWorkers=%d latency=%dms", req.Count, cfg.ImageGen.MaxWorkers, p.LatencyMs)
+
+	ids := make([]string, 0, req.Count)
+	rejected := 0
+	start := time.Now()
+	for i := 0; i < req.Count; i++ {
+		task := &GenerateTask{
+			Platform: loadTestPlatform,
+			Prompt:   fmt.Sprintf("loadtest #%d", i),
+			N:        1,
+			User:     loadTestUser,
+			base:     ImageRecord{User: loadTestUser, Status: "loadtest"},
+		}
+		if !enqueueTask(task) {
+			rejected++
+			continue
+		}
+		ids = append(ids, task.ID)
+	}
+
+	// 共享队列的任务可能由其他实例执行，统一按任务表等待结束
+	ctx := c.Request.Context()
+	for len(ids) > 0 {
+		var running int64
+		db.Model(&TaskRecord{}).Where("id IN ? AND finished_at IS NULL", ids).Count(&running)
+		if running == 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			log.Printf("🔥 压测请求已断开，剩余 %d 个任务继续执行", running)
+			return
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+	total := time.Since(start)
+
+	// 取 DB 连接池状态，需在清理前读取
+	poolStats := gin.H{}
+	if sqlDB, err := db.DB(); err == nil {
+		st := sqlDB.Stats()
+		poolStats = gin.H{
+			"max_open":      st.MaxOpenConnections,
+			"open":          st.OpenConnections,
+			"in_use":        st.InUse,
+			"idle":          st.Idle,
+			"wait_count":    st.WaitCount,
+			"wait_duration": st.WaitDuration.String(),
+		}
+	}
+
+	var tasks []TaskRecord
+	if len(ids) > 0 {
+		db.Where("id IN ?", ids).Find(&tasks)
+	}
+	var queueWaits, durations []time.Duration
+	failed := 0
+	for _, t := range tasks {
+		if t.StartedAt != nil {
+			queueWaits = append(queueWaits, t.StartedAt.Sub(t.CreatedAt))
+		}
+		if t.Status != "succeeded" {
+			failed++
+			continue
+		}
+		durations = append(durations, t.FinishedAt.Sub(*t.StartedAt))
+	}
+
+	if !req.Keep && len(ids) > 0 {
+		var records []ImageRecord
+		db.Where("task_id IN ?", ids).Find(&records)
+		for _, r := range records {
+			db.Delete(&ImageRecord{}, r.ID)
+			os.Remove(r.Path)
+		}
+		db.Where("id IN ?", ids).Delete(&TaskRecord{})
+	}
+
+	sort.Slice(queueWaits, func(i, j int) bool { return queueWaits[i] < queueWaits[j] })
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	log.Printf("🔥 压测结束: 成功 %d 失败 %d 入队被拒 %d 耗时 %v", len(durations), failed, rejected, total)
+
+	c.JSON(200, gin.H{
+		"count":       req.Count,
+		"max_workers": cfg.ImageGen.MaxWorkers,
+		"latency_ms":  p.LatencyMs,
+		"succeeded":   len(durations),
+		"failed":      failed,
+		"rejected":    rejected, // 队列已满未能入队
+		"elapsed":     total.String(),
+		"throughput":  float64(len(durations)) / total.Seconds(), // 每秒成功数
+		"queue_wait":  distribution(queueWaits),                  // 入队到 worker 开始执行
+		"latency":     distribution(durations),                   // worker 开始执行到生成结果写库
+		"db_pool":     poolStats,
+	})
+}
+
+// distribution 已排序耗时的分位数
+func distribution(sorted []time.Duration) gin.H {
+	return gin.H{
+		"min": percentile(sorted, 0).String(),
+		"p50": percentile(sorted, 50).String(),
+		"p90": percentile(sorted, 90).String(),
+		"p95": percentile(sorted, 95).String(),
+		"p99": percentile(sorted, 99).String(),
+		"max": percentile(sorted, 100).String(),
+	}
+}
+
+// percentile 计算已排序耗时的百分位
+func percentile(sorted []time.Duration, pct int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := (len(sorted) - 1) * pct / 100
+	return sorted[idx]
+}
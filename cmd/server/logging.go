@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"image-platform/internal/requestid"
+)
+
+// ========== 结构化日志 ==========
+
+// LoggingConfig 应用日志和访问日志，均写入 imageGen.logDir 下的同一个日志文件
+type LoggingConfig struct {
+	Format string          `yaml:"format"` // text（默认）或 json
+	Level  string          `yaml:"level"`  // debug/info/warn/error，默认 info
+	Access AccessLogConfig `yaml:"access"`
+}
+
+// AccessLogConfig HTTP 访问日志，高频接口按比例采样；5xx 和慢请求总是记录
+type AccessLogConfig struct {
+	Enabled    bool               `yaml:"enabled"`
+	SampleRate float64            `yaml:"sampleRate"` // 默认采样比例 0-1，默认 1（全部记录）
+	Routes     map[string]float64 `yaml:"routes"`     // 按路由覆盖采样比例，如 /api/tasks/:id: 0.1，0 为不记录
+	SlowMs     int                `yaml:"slowMs"`     // 超过该耗时的请求总是记录，0 为不限制
+}
+
+// initSlog 按配置创建 slog 处理器并设为默认，标准库 log 的输出同样经过该处理器
+func initSlog(w io.Writer) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Observability.Logging.Level)); err != nil {
+		level = slog.LevelInfo
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	if strings.EqualFold(cfg.Observability.Logging.Format, "json") {
+		handler = slog.NewJSONHandler(w, opts)
+	} else {
+		handler = slog.NewTextHandler(w, opts)
+	}
+	slog.SetDefault(slog.New(handler))
+}
+
+// ========== 请求 ID ==========
+
+// validRequestID 调用方传入的请求 ID 只接受较短的字母、数字和 -_.:，否则重新生成
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_.:", r)) {
+			return false
+		}
+	}
+	return true
+}
+
+// requestID 沿用调用方的 X-Request-ID 或生成新的，放入请求的 context 并在响应头返回；
+// 同步生成和发布调用平台时带上该 ID，异步任务使用任务 ID
+func requestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestid.Header)
+		if !validRequestID(id) {
+			id = requestid.New()
+		}
+		c.Set("requestID", id)
+		c.Request = c.Request.WithContext(requestid.With(c.Request.Context(), id))
+		c.Header(requestid.Header, id)
+		c.Next()
+	}
+}
+
+// currentRequestID 当前请求的 ID
+func currentRequestID(c *gin.Context) string {
+	return c.GetString("requestID")
+}
+
+// jobContext 后台任务（批量、定时、流程等）调用平台时使用的 context，请求 ID 为 类型-ID
+func jobContext(kind string, id uint) context.Context {
+	return requestid.With(context.Background(), fmt.Sprintf("%s-%d", kind, id))
+}
+
+// accessSampled 按路由的采样比例决定是否记录，5xx 和慢请求不采样
+func accessSampled(route string, status int, latency time.Duration) bool {
+	ac := cfg.Observability.Logging.Access
+	if status >= 500 || (ac.SlowMs > 0 && latency >= time.Duration(ac.SlowMs)*time.Millisecond) {
+		return true
+	}
+	rate := ac.SampleRate
+	if r, ok := ac.Routes[route]; ok {
+		rate = r
+	}
+	return rate >= 1 || rand.Float64() < rate
+}
+
+// accessLog 记录每个请求的路由、状态码、耗时和调用方，未启用时使用 gin 默认的访问日志
+func accessLog() gin.HandlerFunc {
+	if !cfg.Observability.Logging.Access.Enabled {
+		return gin.Logger()
+	}
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		latency := time.Since(start)
+		status := c.Writer.Status()
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched" // 没有匹配路由的请求（404）统一归为一类采样
+		}
+		if !accessSampled(route, status, latency) {
+			return
+		}
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+		attrs := []slog.Attr{
+			slog.String("request_id", currentRequestID(c)),
+			slog.String("method", c.Request.Method),
+			slog.String("route", route),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Float64("latency_ms", float64(latency.Microseconds())/1000),
+			slog.Int("bytes", max(c.Writer.Size(), 0)),
+			slog.String("client_ip", c.ClientIP()),
+		}
+		if user := currentUser(c); user != "" {
+			attrs = append(attrs, slog.String("user", user))
+		}
+		if key := currentAPIKey(c); key != "" {
+			attrs = append(attrs, slog.String("api_key", key))
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("errors", c.Errors.String()))
+		}
+		slog.LogAttrs(c.Request.Context(), level, "access", attrs...)
+	}
+}
@@ -1,16 +1,14 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"os"
-	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -21,7 +19,9 @@ import (
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 
+	"image-platform/internal/generator"
 	"image-platform/internal/publisher"
+	"image-platform/internal/requestid"
 )
 
 // ========== 配置 ==========
@@ -31,10 +31,39 @@ type Config struct {
 	ImageGen   ImageGenConfig  `yaml:"imageGen"`
 	Platforms  PlatformConfigs `yaml:"platforms"`
 	Publish    PublishConfig   `yaml:"publish"`
+	Auth       AuthConfig      `yaml:"auth"`
+	Quota      QuotaConfig     `yaml:"quota"`
+	LLM        LLMConfig       `yaml:"llm"`
+	Policy     PolicyConfig    `yaml:"policy"`
+	Templates  map[string]TemplateConfig `yaml:"templates"`
+	Workflows  map[string]WorkflowConfig `yaml:"workflows"`
+	Events     EventsConfig    `yaml:"events"`
+	Calendar   CalendarConfig  `yaml:"calendar"`
+	Holidays   HolidayConfig   `yaml:"holidays"`
+	Branding   BrandingConfig  `yaml:"branding"`
+	Notifications NotificationConfig `yaml:"notifications"`
+	Observability ObservabilityConfig `yaml:"observability"`
+	Upscale       UpscaleConfig       `yaml:"upscale"`
+	Translate     TranslateConfig     `yaml:"translate"`
+	Breaker       BreakerConfig       `yaml:"breaker"`
+	QuotaBackoff  QuotaBackoffConfig  `yaml:"quotaBackoff"`
+	Queue         QueueConfig         `yaml:"queue"`
+	Moderation    ModerationConfig    `yaml:"moderation"`
+	Consistency   ConsistencyConfig   `yaml:"consistency"`
+	DAM           DAMConfig           `yaml:"dam"`
+	Playground    PlaygroundConfig    `yaml:"playground"`
+	Dashboard     DashboardConfig     `yaml:"dashboard"`
+	WeeklySummary WeeklySummaryConfig `yaml:"weeklySummary"`
+	StyleDrift    StyleDriftConfig    `yaml:"styleDrift"`
 }
 
 type ServerConfig struct {
-	Port string `yaml:"port"`
+	Port             string `yaml:"port"`
+	AdminToken       string `yaml:"adminToken"`       // 管理接口令牌，环境变量 ADMIN_TOKEN 优先
+	PublicURL        string `yaml:"publicUrl"`        // 对外访问地址，用于生成分享链接
+	Timezone         string `yaml:"timezone"`         // 业务时区，如 Asia/Shanghai，默认服务器本地时区
+	PermalinkSecret  string `yaml:"permalinkSecret"`  // 记录链接的签名密钥，环境变量 PERMALINK_SECRET 优先
+	PublicPermalinks bool   `yaml:"publicPermalinks"` // 记录链接不带签名，知道 ID 即可访问
 }
 
 type DatabaseConfig struct {
@@ -46,54 +75,337 @@ type DatabaseConfig struct {
 }
 
 type ImageGenConfig struct {
-	OutputDir  string `yaml:"outputDir"`
-	LogDir     string `yaml:"logDir"`
-	Width      int    `yaml:"width"`
-	Height     int    `yaml:"height"`
+	OutputDir        string            `yaml:"outputDir"`
+	LogDir           string            `yaml:"logDir"`
+	Width            int               `yaml:"width"`
+	Height           int               `yaml:"height"`
+	MaxWorkers       int               `yaml:"maxWorkers"`
+	MaxRetries       int               `yaml:"maxRetries"`       // 平台请求遇到 429、5xx、超时时的重试次数
+	RetryDelay       int               `yaml:"retryDelay"`       // 首次重试前等待的秒数，之后按指数增长
+	Fallback         []string          `yaml:"fallback"`         // 生成失败时依次尝试的平台
+	PathTemplate     string            `yaml:"pathTemplate"`     // 图片在 outputDir 下的存储路径模板，为空时按 日期/平台 存放
+	FilenameStrategy string            `yaml:"filenameStrategy"` // 图片文件名策略 time/ulid/record_id/prompt，为空为 time
+	Preset           string            `yaml:"preset"`           // 未指定尺寸时使用的比例预设，为空使用 width x height
+	Presets          map[string]string `yaml:"presets"`          // 自定义或覆盖内置的比例预设，值为 宽x高
+	CapabilitiesTTL  int               `yaml:"capabilitiesTTL"`  // 平台能力（模型列表等）的缓存时间（分钟），默认 60
 }
 
 type PlatformConfigs map[string]PlatformConfig
 
 type PlatformConfig struct {
-	Name        string `yaml:"name"`
-	EnvKey      string `yaml:"envKey"`
-	APIKey      string `yaml:"apiKey"`
-	URL         string `yaml:"url"`
-	Model       string `yaml:"model"`
-	Enabled     bool   `yaml:"enabled"`
-	Description string `yaml:"description"`
+	Name            string             `yaml:"name"`
+	Type            string             `yaml:"type"` // 平台类型，决定调用方式，为空时与配置键相同；未知类型按 OpenAI 兼容接口调用
+	EnvKey          string             `yaml:"envKey"`
+	APIKey          string             `yaml:"apiKey"`
+	URL             string             `yaml:"url"`
+	Model           string             `yaml:"model"`
+	Enabled         bool               `yaml:"enabled"`
+	Description     string             `yaml:"description"`
+	CostPerImage    float64            `yaml:"costPerImage"` // 单张图片预估成本（元）
+	AccessKeyEnv    string             `yaml:"accessKeyEnv"` // AK/SK 鉴权的接口使用（如阿里云余额查询）
+	SecretKeyEnv    string             `yaml:"secretKeyEnv"`
+	EditModel       string             `yaml:"editModel"`       // 图生图使用的模型，为空使用 model
+	Workflow        string             `yaml:"workflow"`        // ComfyUI API 格式的工作流文件，为空使用内置的文生图工作流
+	PromptLanguage  string             `yaml:"promptLanguage"`  // 效果更好的提示词语言 zh/en，开启翻译后按此发送
+	CredentialsFile string             `yaml:"credentialsFile"` // Vertex AI 服务账号 JSON 密钥文件，配置后使用 OAuth2 访问令牌
+	Project         string             `yaml:"project"`         // Vertex AI 项目 ID，为空使用服务账号所属项目
+	Region          string             `yaml:"region"`          // Vertex AI 区域，默认 us-central1
+	Watermark       bool               `yaml:"watermark"`       // 是否保留平台的"AI 生成"水印（豆包），默认不加
+	PollInterval    int                `yaml:"pollInterval"`    // 异步任务的查询间隔（秒），为空使用平台默认值
+	MaxWait         int                `yaml:"maxWait"`         // 异步任务的最长等待（秒），超过后按超时失败，为空使用平台默认值
+	LatencyMs       int                `yaml:"latencyMs"`       // 模拟平台每张图片的延迟（毫秒），用于压测
+	Presets         map[string]string  `yaml:"presets"`         // 只支持固定尺寸的平台按预设名覆盖尺寸，值为 宽x高
+	ResponseFormat  string             `yaml:"responseFormat"`  // OpenAI 兼容接口的 response_format：url 或 b64_json，为空不传（gpt-image-1 不接受该参数，固定返回 b64_json）
+	Capabilities    CapabilitiesConfig `yaml:"capabilities"`    // 支持的模型、尺寸和限制，见 capabilities.go
+	ControlModels   map[string]string  `yaml:"controlModels"`   // 参考图引导的控制模式 → 模型，见 control.go
+	AccessKey       string             `yaml:"-"`
+	SecretKey       string             `yaml:"-"`
 }
 
 type PublishConfig struct {
 	Xiaohongshu struct {
-		Enabled    bool   `yaml:"enabled"`
-		MCPURL     string `yaml:"mcpUrl"`
-		Cookies    string `yaml:"cookies"`
-		XSecToken  string `yaml:"xSecToken"`
+		Enabled   bool   `yaml:"enabled"`
+		MCPURL    string `yaml:"mcpUrl"`
+		Cookies   string `yaml:"cookies"`
+		XSecToken string `yaml:"xSecToken"`
 	} `yaml:"xiaohongshu"`
 	Douyin struct {
-		Enabled bool   `yaml:"enabled"`
+		Enabled bool `yaml:"enabled"`
 	} `yaml:"douyin"`
 	Bilibili struct {
 		Enabled bool   `yaml:"enabled"`
 		Cookie  string `yaml:"cookie"`
 	} `yaml:"bilibili"`
+	ImageHost struct {
+		Enabled   bool   `yaml:"enabled"`
+		Provider  string `yaml:"provider"`  // smms, imgur, custom
+		APIURL    string `yaml:"apiUrl"`    // custom 必填，smms/imgur 可覆盖默认地址
+		Token     string `yaml:"token"`     // smms Token / imgur Client-ID / custom Bearer Token
+		FileField string `yaml:"fileField"` // custom 文件字段名，默认 file
+		URLPath   string `yaml:"urlPath"`   // custom 响应中外链的 JSON 路径，如 data.url
+	} `yaml:"imageHost"`
+	Windows     map[string]PublishWindowConfig `yaml:"windows"`     // 按发布平台配置允许发布的时段
+	MaxAttempts int                            `yaml:"maxAttempts"` // 定时发布失败的最多执行次数，默认 3，用尽后进入死信队列
+	RetryDelay  int                            `yaml:"retryDelay"`  // 首次重试前等待的秒数，之后按指数增长，默认 60
+	Custom      []CustomPublishConfig          `yaml:"custom"`      // 自定义 HTTP 发布平台（自建站点、CMS 等）
+	Formats     map[string]PublishFormatConfig `yaml:"formats"`     // 按发布平台配置图片格式，覆盖平台默认的格式
+	ErrorBudget PublishBudgetConfig            `yaml:"errorBudget"` // 每小时发布失败的预算，用尽后自动暂停该平台，见 publish_budget.go
+}
+
+// CustomPublishConfig 自定义发布平台，支持修改已发布内容
+type CustomPublishConfig struct {
+	Type       string `yaml:"type"` // 平台标识，发布时的 platforms 取值
+	Name       string `yaml:"name"`
+	APIURL     string `yaml:"apiUrl"`
+	AuthHeader string `yaml:"authHeader"` // Authorization 请求头
+	AuthEnv    string `yaml:"authEnv"`    // 从环境变量读取 Authorization 请求头
+	RefPath    string `yaml:"refPath"`    // 响应中内容 ID 或链接的 JSON 路径，如 data.url
+}
+
+type AuthConfig struct {
+	APIKeys []APIKeyConfig `yaml:"apiKeys"`
+}
+
+type APIKeyConfig struct {
+	Name      string   `yaml:"name"` // 记录和报表中使用的名称
+	Key       string   `yaml:"key"`
+	EnvKey    string   `yaml:"envKey"` // 从环境变量读取密钥
+	Workspace string   `yaml:"workspace"`
+	Users     []string `yaml:"users"` // 可以通过 X-User 代表的用户，未列出的用户名会被拒绝
+}
+
+type QuotaConfig struct {
+	Enabled bool                  `yaml:"enabled"`
+	Default QuotaLimit            `yaml:"default"` // 未单独配置的用户/API Key 使用
+	Users   map[string]QuotaLimit `yaml:"users"`
+	APIKeys map[string]QuotaLimit `yaml:"apiKeys"` // 按 API Key 名称配置
+}
+
+// LLMConfig 文本大模型配置（OpenAI 兼容接口），用于提示词审查等辅助功能
+type LLMConfig struct {
+	URL                string `yaml:"url"`
+	Model              string `yaml:"model"`
+	VisionModel        string `yaml:"visionModel"`        // 图片打分等需要视觉能力的场景
+	EnhanceModel       string `yaml:"enhanceModel"`       // 提示词扩写模型，为空使用 model
+	EnhanceInstruction string `yaml:"enhanceInstruction"` // 扩写指令，为空使用内置指令
+	EnvKey             string `yaml:"envKey"`
+	APIKey             string `yaml:"apiKey"`
+}
+
+// PolicyConfig 提示词内容策略
+type PolicyConfig struct {
+	Enabled   bool                `yaml:"enabled"`
+	Keywords  []string            `yaml:"keywords"`  // 命中即拒绝
+	Sensitive []string            `yaml:"sensitive"` // 命中则放行但标记
+	LLMCheck  bool                `yaml:"llmCheck"`  // 额外调用 LLM 判断
+	Providers map[string][]string `yaml:"providers"` // 平台 ID → 该平台会拒绝的词，只在该平台生成时拦截
+	Publish   map[string][]string `yaml:"publish"`   // 发布平台 → 平台规则不允许的词（如极限词），命中即拒绝
+	Rules     []string            `yaml:"rules"`     // LLM 判断时额外遵守的规则，如发布平台的社区规范
+}
+
+// TemplateConfig 模板，字段均为 text/template 语法
+type TemplateConfig struct {
+	Prompt  string `yaml:"prompt" json:"prompt"`   // 生成提示词
+	Title   string `yaml:"title" json:"title"`     // 发布标题
+	Content string `yaml:"content" json:"content"` // 发布正文
+}
+
+// WorkflowConfig 自动化流程：生成 → 自动审核 → 达到阈值自动通过 → 定时发布
+type WorkflowConfig struct {
+	Description          string           `yaml:"description"`
+	Platform             string           `yaml:"platform"`
+	Model                string           `yaml:"model"`
+	Size                 string           `yaml:"size"`
+	Category             string           `yaml:"category"`
+	AutoModerate         bool             `yaml:"autoModerate"`
+	AutoApproveThreshold float64          `yaml:"autoApproveThreshold"` // 自动审核得分（0-1）达到该值自动通过，0 表示始终人工审核
+	Gates                []WorkflowGate   `yaml:"gates"`
+	Publish              *WorkflowPublish `yaml:"publish"`
+}
+
+// WorkflowGate 审核关卡，命中任一条件即必须人工审核，且需要 Approvals 个审核人通过
+type WorkflowGate struct {
+	Name       string   `yaml:"name"`
+	MinScore   float64  `yaml:"minScore"`   // 自动审核得分低于该值（或无得分）时命中
+	Categories []string `yaml:"categories"` // 图片分类属于其中之一时命中
+	Keywords   []string `yaml:"keywords"`   // 提示词包含其中之一时命中
+	Approvals  int      `yaml:"approvals"`  // 需要的人工通过数，默认 1
+}
+
+// WorkflowPublish 流程中的发布步骤
+type WorkflowPublish struct {
+	Platforms []string `yaml:"platforms"`
+	At        string   `yaml:"at"`       // 发布时间 HH:MM，已过则顺延到次日；为空立即发布
+	Template  string   `yaml:"template"` // templates 中的模板名
+}
+
+// EventsConfig 领域事件投递
+type EventsConfig struct {
+	Webhooks       []WebhookConfig `yaml:"webhooks"`
+	PollInterval   int             `yaml:"pollInterval"` // 发件箱轮询间隔（秒）
+	MaxAttempts    int             `yaml:"maxAttempts"`
+	CallbackSecret string          `yaml:"callbackSecret"` // 生成完成回调的 X-Signature 签名密钥
+	CallbackHosts  []string        `yaml:"callbackHosts"`  // 允许的回调域名，为空不限制
+}
+
+// CalendarConfig 内容日历自动生成
+type CalendarConfig struct {
+	Enabled   bool     `yaml:"enabled"`
+	RunAt     string   `yaml:"runAt"`     // 每天生成时间 HH:MM（业务时区），默认 08:00
+	Platform  string   `yaml:"platform"`  // 条目未指定平台时使用，为空使用默认设置
+	Reviewers []string `yaml:"reviewers"` // 生成完成后通知的审核人，随 calendar.generated 事件推送
+}
+
+// HolidayConfig 节日模板
+type HolidayConfig struct {
+	LeadDays int               `yaml:"leadDays"` // 节日前几天开始切换节日模板，默认 3
+	Presets  map[string]string `yaml:"presets"`  // 节日名 → templates 中的模板名
+	Extra    map[string]string `yaml:"extra"`    // 补充节日，日期 YYYY-MM-DD → 节日名
+}
+
+// BrandingConfig 品牌配置，发布时按分类或发布平台选择，分类优先
+type BrandingConfig struct {
+	Profiles   map[string]BrandingProfile `yaml:"profiles"`
+	Platforms  map[string]string          `yaml:"platforms"`  // 发布平台 → 品牌配置名
+	Categories map[string]string          `yaml:"categories"` // 分类 → 品牌配置名
+}
+
+// BrandingProfile 一套品牌元素：边框、Logo、标语
+type BrandingProfile struct {
+	Logo        string  `yaml:"logo" json:"logo"`                // PNG Logo 路径
+	LogoPercent int     `yaml:"logoPercent" json:"logo_percent"` // Logo 宽度占图片宽度的百分比，默认 15
+	Position    string  `yaml:"position" json:"position"`        // top-left, top-right, bottom-left, bottom-right（默认）
+	Tagline     string  `yaml:"tagline" json:"tagline"`          // 底部居中的标语
+	Font        string  `yaml:"font" json:"font"`                // 标语字体文件（ttf/otf），需支持中文
+	FontSize    float64 `yaml:"fontSize" json:"font_size"`       // 默认为图片宽度的 1/30
+	TextColor   string  `yaml:"textColor" json:"text_color"`     // #RRGGBB，默认白色
+	FrameColor  string  `yaml:"frameColor" json:"frame_color"`   // 边框颜色
+	FrameWidth  int     `yaml:"frameWidth" json:"frame_width"`   // 边框宽度（像素），0 不加边框
+}
+
+// NotificationConfig 站内通知
+type NotificationConfig struct {
+	Reviewers []string    `yaml:"reviewers"` // 批量、草稿等产生待审核内容时通知的审核人
+	Email     EmailConfig `yaml:"email"`     // 邮件审核链接
+}
+
+// ObservabilityConfig 可观测性
+type ObservabilityConfig struct {
+	Push      MetricsPushConfig `yaml:"push"`
+	Recording RecordingConfig   `yaml:"recording"`
+	Logging   LoggingConfig     `yaml:"logging"`
+	SLO       SLOConfig         `yaml:"slo"`
+	Alerts    AlertsConfig      `yaml:"alerts"`
+}
+
+// RecordingConfig 录制平台接口的请求和响应（密钥脱敏），排查问题时临时开启
+type RecordingConfig struct {
+	Enabled       bool `yaml:"enabled"`
+	RetentionDays int  `yaml:"retentionDays"` // 保留天数，默认 3
+	MaxBodyBytes  int  `yaml:"maxBodyBytes"`  // 请求/响应体截断长度，默认 64KB
+}
+
+// MetricsPushConfig 无法被 Prometheus 抓取的部署（如内网隔离）定期推送当天计数
+type MetricsPushConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	Mode     string `yaml:"mode"`     // pushgateway（默认）或 import（POST 文本格式）
+	URL      string `yaml:"url"`      // Pushgateway 地址，或 import 接口完整地址
+	Job      string `yaml:"job"`      // 默认 image-platform
+	Instance string `yaml:"instance"` // 实例标签
+	Interval int    `yaml:"interval"` // 推送间隔（秒），默认 60
+	Username string `yaml:"username"` // Basic Auth
+	Password string `yaml:"password"`
+}
+
+// TranslateConfig 提示词中英互译，默认使用 llm 配置的模型，也可使用机器翻译接口
+type TranslateConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	Provider string `yaml:"provider"` // llm（默认）、deepl、baidu
+	URL      string `yaml:"url"`      // 翻译接口地址，为空使用各服务的默认地址
+	AppID    string `yaml:"appId"`    // 百度翻译的 APP ID
+	EnvKey   string `yaml:"envKey"`
+	APIKey   string `yaml:"apiKey"` // DeepL 的 Auth Key 或百度翻译的密钥
+}
+
+// UpscaleConfig 图片放大
+type UpscaleConfig struct {
+	Provider     string  `yaml:"provider"`     // local（默认，本地插值）或 platforms 中支持放大的平台配置键，如 replicate
+	MaxScale     int     `yaml:"maxScale"`     // 最大放大倍数，默认 4
+	Model        string  `yaml:"model"`        // 平台上的放大模型，Replicate 为 owner/name 或 owner/name:version
+	PollInterval int     `yaml:"pollInterval"` // 放大任务的查询间隔（秒），为 0 使用平台配置
+	MaxWait      int     `yaml:"maxWait"`      // 放大任务的最长等待（秒），为 0 使用平台配置
+	CostPerImage float64 `yaml:"costPerImage"` // 平台放大每张的费用，本地放大不计费
+}
+
+// WebhookConfig 事件订阅方，Kafka 等可通过其 HTTP 网关（如 REST Proxy）接入
+type WebhookConfig struct {
+	URL    string   `yaml:"url"`
+	Secret string   `yaml:"secret"` // 用于 X-Signature 签名
+	Types  []string `yaml:"types"`  // 订阅的事件类型，为空订阅全部
+}
+
+// QuotaLimit 每日额度，0 表示不限制
+type QuotaLimit struct {
+	ImagesPerDay int     `yaml:"imagesPerDay" json:"images_per_day"`
+	CostPerDay   float64 `yaml:"costPerDay" json:"cost_per_day"`
 }
 
 // ========== 数据模型 ==========
 type ImageRecord struct {
-	ID           uint       `gorm:"primaryKey" json:"id"`
-	Name         string     `gorm:"size:255;not null" json:"name"`
-	Date         string     `gorm:"size:20;not null" json:"date"`
-	Path         string     `gorm:"size:512;not null" json:"path"`
-	Platform     string     `gorm:"size:50;not null" json:"platform"`
-	Model        string     `gorm:"size:100;not null" json:"model"`
-	Prompt       string     `gorm:"size:1000" json:"prompt"`
-	GeneratedAt  time.Time  `gorm:"not null" json:"generated_at"`
-	Status       string     `gorm:"size:20;default:'pending'" json:"status"`
-	Note         string     `gorm:"type:text" json:"note"`
-	ModeratedAt  *time.Time `json:"moderated_at"`
-	CreatedAt    time.Time  `json:"created_at"`
+	ID                uint                   `gorm:"primaryKey" json:"id"`
+	Name              string                 `gorm:"size:255;not null" json:"name"`
+	Date              string                 `gorm:"size:20;not null" json:"date"`
+	Path              string                 `gorm:"size:512;not null" json:"path"`
+	Platform          string                 `gorm:"size:50;not null" json:"platform"`
+	PlatformID        string                 `gorm:"size:50;index" json:"platform_id"` // 平台配置键，重试时使用
+	Model             string                 `gorm:"size:100;not null" json:"model"`
+	Prompt            string                 `gorm:"size:1000" json:"prompt"`
+	PromptLang        string                 `gorm:"size:10" json:"prompt_lang"`         // 原文语言 zh/en
+	PromptTranslated  string                 `gorm:"size:1000" json:"prompt_translated"` // 另一种语言的译文，开启扩写时为扩写结果的译文
+	PromptSent        bool                   `gorm:"default:false" json:"prompt_sent"`   // 发送给平台的是译文而不是原文
+	EnhancedPrompt    string                 `gorm:"type:text" json:"enhanced_prompt"`   // LLM 扩写后实际用于生成的提示词
+	NegativePrompt    string                 `gorm:"size:1000" json:"negative_prompt"`   // 反向提示词，OpenAI 不支持
+	Seed              *int64                 `json:"seed"`                               // 实际使用的 seed，可用于复现
+	GeneratedAt       time.Time              `gorm:"not null" json:"generated_at"`
+	Size              string                 `gorm:"size:20" json:"size"`
+	Status            string                 `gorm:"size:20;default:'pending'" json:"status"` // pending, approved, rejected, failed, loadtest, playground
+	Error             string                 `gorm:"type:text" json:"error"`                  // 生成失败时平台返回的错误
+	ErrorCode         string                 `gorm:"size:30;index" json:"error_code"`         // 错误分类，见 generr.go
+	Note              string                 `gorm:"type:text" json:"note"`
+	ModeratedAt       *time.Time             `json:"moderated_at"`
+	User              string                 `gorm:"size:100;index" json:"user"`
+	APIKey            string                 `gorm:"size:100;index" json:"api_key"` // API Key 名称
+	PolicyFlag        string                 `gorm:"size:255" json:"policy_flag"`   // 命中的敏感词
+	Category          string                 `gorm:"size:50;index" json:"category"`
+	AutoScore         *float64               `json:"auto_score"`                     // 自动审核得分 0-1
+	ConsistencyScore  *int                   `gorm:"index" json:"consistency_score"` // 视觉模型判断的提示词一致性 0-100
+	RequiredApprovals int                    `json:"required_approvals"`             // 需要的人工通过数，0/1 为单人审核
+	ExperimentID      *uint                  `gorm:"index" json:"experiment_id"`     // 所属对比实验
+	ComparisonID      *uint                  `gorm:"index" json:"comparison_id"`     // 所属全平台对比
+	DraftID           *uint                  `gorm:"index" json:"draft_id"`          // 来源草稿
+	BatchID           *uint                  `gorm:"index" json:"batch_id"`          // 所属组合批量
+	StoryID           *uint                  `gorm:"index" json:"story_id"`          // 所属故事
+	StoryPage         int                    `json:"story_page"`                     // 在故事中的页码，0 为封面
+	CalendarID        *uint                  `gorm:"index" json:"calendar_id"`       // 来源内容日历
+	ScheduleID        *uint                  `gorm:"index" json:"schedule_id"`       // 来源定时生成计划
+	TaskID            string                 `gorm:"size:64;index" json:"task_id"`   // 异步生成任务
+	SourceID          *uint                  `gorm:"index" json:"source_id"`         // 图生图等操作的原图
+	Operation         string                 `gorm:"size:20" json:"operation"`       // img2img、inpaint、upscale、regenerate、duplicate、control，文生图为空
+	ReferencePath     string                 `gorm:"size:500" json:"reference_path"` // 参考图引导的参考图
+	ControlMode       string                 `gorm:"size:20" json:"control_mode"`    // 参考图引导的控制模式 canny、pose、depth
+	Workspace         string                 `gorm:"size:100;index" json:"workspace"`
+	Cost              float64                `json:"cost"`
+	FileSize          int64                  `json:"file_size"` // 字节
+	ViewCount         int64                  `gorm:"default:0;index" json:"view_count"`
+	DownloadCount     int64                  `gorm:"default:0" json:"download_count"`
+	FallbackFrom      string                 `gorm:"size:50" json:"fallback_from"`      // 请求的平台失败后降级生成时，原请求的平台
+	Pinned            bool                   `gorm:"default:false;index" json:"pinned"` // 待审核列表置顶
+	PinnedAt          *time.Time             `json:"pinned_at"`
+	PlaygroundSession string                 `gorm:"size:64;index" json:"playground_session"`        // 试验场会话，status=playground 时有效
+	MimeType          string                 `gorm:"size:50" json:"mime_type"`                       // 按文件内容识别的格式，如 image/jpeg
+	Metadata          map[string]string      `gorm:"type:json;serializer:json" json:"metadata"`      // 自定义业务字段，见 metadata.go
+	ProviderMeta      map[string]interface{} `gorm:"type:json;serializer:json" json:"provider_meta"` // 平台返回的其他信息，见 internal/generator/image.go 的 providerMeta
+	CreatedAt         time.Time              `json:"created_at"`
 }
 
 func (ImageRecord) TableName() string {
@@ -128,26 +440,19 @@ func getOrCreateSettings() *UserSettings {
 // 获取所有可用平台（带模型列表）
 func getPlatformsInfo() []map[string]interface{} {
 	platforms := []map[string]interface{}{}
+	balances := getBalances()
 	for key, p := range cfg.Platforms {
 		if p.Enabled {
-			models := []string{}
-			if p.Model != "" {
-				models = append(models, p.Model)
-			}
-			switch key {
-			case "siliconflow":
-				models = []string{"", "black-forest-labs/FLUX.1-schnell", "black-forest-labs/FLUX.1-dev", "Kwai-Kolors/Kolors", "Tongyi-MAI/Z-Image-Turbo"}
-			case "modelscope":
-				models = []string{"", "Tongyi-MAI/Z-Image-Turbo", "Kwai-Kolors/Kolors"}
-			case "aliyun":
-				models = []string{"", "wanx-v1"}
-			}
+			models := staticModels(p)
 			platforms = append(platforms, map[string]interface{}{
 				"id":          key,
 				"name":        p.Name,
 				"description": p.Description,
-				"enabled":     p.Enabled && p.APIKey != "",
+				"enabled":     platformReady(p),
 				"models":      models,
+				"balance":     balances[key],
+				"draining":    isDraining(key),
+				"latency":     platformLatencyInfo(key),
 			})
 		}
 	}
@@ -161,6 +466,7 @@ var pubManager *publisher.Manager
 
 func main() {
 	configPath := flag.String("c", "config/config.yaml", "配置文件")
+	printAlertRules := flag.Bool("alert-rules", false, "按配置输出推荐的 Prometheus 告警规则后退出")
 	flag.Parse()
 	godotenv.Load("config/.env")
 
@@ -169,33 +475,123 @@ func main() {
 	if err != nil {
 		log.Fatalf("加载配置失败: %v", err)
 	}
+	if *printAlertRules {
+		out, err := renderAlertRules()
+		if err != nil {
+			log.Fatalf("生成告警规则失败: %v", err)
+		}
+		os.Stdout.Write(out)
+		return
+	}
+
+	if err := loadTimezone(cfg.Server.Timezone); err != nil {
+		log.Fatalf("加载时区失败: %v", err)
+	}
+	if err := validatePublishWindows(); err != nil {
+		log.Fatalf("发布时间窗口配置错误: %v", err)
+	}
+	if err := validatePathTemplate(); err != nil {
+		log.Fatalf("存储路径模板配置错误: %v", err)
+	}
+	if err := validateModeration(); err != nil {
+		log.Fatalf("自动审核配置错误: %v", err)
+	}
+	if err := validateFilenameStrategy(); err != nil {
+		log.Fatalf("文件名策略配置错误: %v", err)
+	}
+	if err := validatePresets(); err != nil {
+		log.Fatalf("尺寸预设配置错误: %v", err)
+	}
+	if err := validatePublishFormats(); err != nil {
+		log.Fatalf("发布图片格式配置错误: %v", err)
+	}
+	if err := validateDashboard(); err != nil {
+		log.Fatalf("首页看板配置错误: %v", err)
+	}
+	if err := validateWeeklySummary(); err != nil {
+		log.Fatalf("每周精选配置错误: %v", err)
+	}
+	if err := validateStyleDrift(); err != nil {
+		log.Fatalf("风格漂移配置错误: %v", err)
+	}
+	if err := validateTranslate(); err != nil {
+		log.Fatalf("提示词翻译配置错误: %v", err)
+	}
+	if err := validatePolicy(); err != nil {
+		log.Fatalf("内容策略配置错误: %v", err)
+	}
+	if err := validateCapabilities(); err != nil {
+		log.Fatalf("平台能力配置错误: %v", err)
+	}
+	if err := validateControlModels(); err != nil {
+		log.Fatalf("参考图引导配置错误: %v", err)
+	}
+	validateFallback()
 
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:3306)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+	// 数据库时间统一按 UTC 存取，展示和日期分桶按业务时区
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:3306)/%s?charset=utf8mb4&parseTime=True&loc=UTC",
 		cfg.Database.User, cfg.Database.Password, cfg.Database.Host, cfg.Database.DBName)
 
-	db, err = gorm.Open(mysql.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Info)})
+	db, err = gorm.Open(mysql.Open(dsn), &gorm.Config{
+		Logger:  logger.Default.LogMode(logger.Info),
+		NowFunc: func() time.Time { return time.Now().UTC() },
+	})
 	if err != nil {
 		log.Fatalf("连接数据库失败: %v", err)
 	}
 
-	db.AutoMigrate(&ImageRecord{}, &UserSettings{})
+	db.AutoMigrate(&ImageRecord{}, &UserSettings{}, &PolicyKeyword{}, &Category{}, &Experiment{}, &PublishJob{}, &WorkflowRun{}, &ImageReview{}, &Activity{}, &ShareLink{}, &OutboxEvent{}, &Draft{}, &DraftComment{}, &Batch{}, &CalendarEntry{}, &Notification{}, &ProviderCall{}, &PlatformDrain{}, &PublishRecord{}, &TaskRecord{}, &ProviderTask{}, &DeadLetter{}, &ImageTag{}, &CollectionImage{}, &Schedule{}, &ProcessingJob{}, &ApprovalLink{}, &DAMAsset{}, &WeeklySummary{}, &Comparison{}, &PolicyCandidate{}, &Story{}, &PublishPause{}, &StyleSnapshot{})
+	migrateErrorCodes()
 	os.MkdirAll(cfg.ImageGen.OutputDir, 0755)
 	setupLogging()
 
+	if err := initJobQueue(); err != nil {
+		log.Fatalf("初始化任务队列失败: %v", err)
+	}
+
 	// 初始化发布管理器
 	pubManager = initPublisher()
+	modManager = initModerators()
+	// 定时任务和发布 worker 启动后可能立即调用平台，调用名额要先于它们初始化
+	initGenerator()
+	initGenPool(cfg.ImageGen.MaxWorkers)
+	// 发布暂停状态要在发布 worker 取任务前加载
+	loadPublishPauses()
+	startPublishWorker()
+	go runPublishScheduler()
+	go runOutboxDispatcher()
+	go runCalendarScheduler()
+	go runWeeklySummaryScheduler()
+	go runStyleDriftScheduler()
+	go runScheduleRunner()
+	initPermalinks()
+	startTaskWorkers(cfg.ImageGen.MaxWorkers)
+	recoverTasks()
+	recoverProcessingJobs()
+	go runAccessFlusher()
+	loadDrains()
+	go runMetricsPusher()
+	go runCredentialChecker()
+	go runProviderCallPurger()
+	go runDAMSync()
+	go runPlaygroundCleaner()
+	go backfillFileSizes()
+	go backfillMimeTypes()
 
 	for key, p := range cfg.Platforms {
-		if p.Enabled && p.APIKey != "" {
+		if platformReady(p) {
 			log.Printf("已启用平台: %s - %s", key, p.Name)
 		}
 	}
 
 	gin.SetMode(gin.ReleaseMode)
-	r := gin.Default()
+	r := gin.New()
+	r.Use(gin.Recovery(), requestID(), accessLog())
+	r.Use(identify())
 	r.LoadHTMLGlob("web/templates/*")
 	r.Static("/static", "./web")
-	r.Static("/images", cfg.ImageGen.OutputDir) // 图片目录
+	r.GET("/images/*filepath", serveImage) // 图片目录，统计浏览和下载次数
+	r.HEAD("/images/*filepath", serveImage)
 
 	// 页面路由
 	r.GET("/", index)
@@ -203,20 +599,163 @@ func main() {
 	r.GET("/moderate/:id", moderatePage)
 	r.GET("/records", recordsPage)
 	r.GET("/gallery", galleryPage) // 当天图库
+	r.GET("/share/:token", sharedGallery) // 对外分享的只读图库
+	r.GET("/record/:id", recordPage)      // 单条生成记录的永久链接
+	r.GET("/approval/:token", approvalPage) // 邮件审核链接
+	r.POST("/approval/:token", approvalPage)
 
 	// API 路由
 	r.POST("/api/generate", handleGenerate)
+	r.POST("/api/generate/compare", createComparison) // 同一提示词在全部启用平台上对比生成
+	r.GET("/api/compare", listComparisons)
+	r.GET("/api/compare/:id", getComparison)
+	r.POST("/api/generate/img2img", handleImg2Img) // 图生图
+	r.POST("/api/generate/control", handleControlGenerate) // 参考图引导生成
 	r.GET("/api/images", listImages)
 	r.POST("/api/moderate", moderateImage)
 	r.GET("/api/records", listRecords)
 	r.DELETE("/api/images/:id", deleteImage)
+	r.PATCH("/api/images/:id/metadata", patchImageMetadata) // 修改自定义元数据，null 删除键
+	r.POST("/api/images/bulk-delete", adminAuth(), bulkDeleteImages) // 按条件批量删除，先预览再确认
+	r.POST("/api/images/bulk-update", adminAuth(), bulkUpdateImages) // 批量修改分类、标签、合集、置顶
+	r.POST("/api/dataset/export", adminAuth(), exportDataset) // 导出训练数据集
+	r.GET("/api/tags", listTags)
+	r.GET("/api/collections", listCollections)
+	r.GET("/api/images/:id/reviews", listImageReviews)
+	r.POST("/api/images/:id/retry", retryImage) // 重试生成失败的记录
+	r.POST("/api/images/:id/edit", editImage)   // 局部重绘
+	r.POST("/api/images/:id/upscale", upscaleHandler) // 放大
+	r.POST("/api/images/:id/consistency", scoreImageConsistency) // 提示词一致性评分
+	r.GET("/api/images/:id/dam", getImageDAM) // 素材库同步状态
+	r.POST("/api/images/:id/dam", adminAuth(), pushImageToDAM) // 推送到素材库，?force=1 覆盖素材库中的修改
+	r.POST("/api/images/:id/dam/resolve", adminAuth(), resolveDAMConflict) // 解决同步冲突
+	r.GET("/api/dam/assets", adminAuth(), listDAMAssets)
+	r.POST("/api/dam/sync", adminAuth(), syncDAMNow)
+	r.POST("/api/images/:id/email-approval", requestEmailApproval) // 发送邮件审核链接
+	r.GET("/api/images/:id/processing", listImageProcessing) // 处理记录
+	r.GET("/api/processing-jobs", listProcessingJobs)
+	r.POST("/api/processing-jobs/:id/rerun", rerunProcessingJob)
+	r.POST("/api/images/:id/regenerate", regenerateImage) // 同 seed 重新生成
+	r.POST("/api/images/:id/duplicate", duplicateImage) // 复制到其他工作区或合集
+	r.POST("/api/images/:id/pin", pinImage) // 待审核置顶
+	r.DELETE("/api/images/:id/pin", unpinImage)
+	r.GET("/api/images/:id/permalink", getPermalink)
+	r.GET("/api/tasks/:id", getTask)            // 异步生成任务
+	r.DELETE("/api/tasks/:id", cancelTask)      // 取消异步生成任务
+	r.GET("/api/storage/breakdown", adminAuth(), storageBreakdown) // 按日期、平台、状态的存储占用
+	r.GET("/api/generate/stream/:task_id", streamTask) // 异步生成任务进度推送（SSE）
+	r.GET("/api/notifications", listNotifications) // 站内通知
+	r.GET("/api/notifications/stream", streamNotifications)
+	r.POST("/api/notifications/read", markNotificationRead)
+	r.POST("/api/notifications/:id/read", markNotificationRead)
 	r.GET("/api/report", dailyReport)
+	r.GET("/api/report/style", getStyleDrift) // 与前一天的风格对比
+	r.GET("/api/dashboard", getDashboard) // 首页看板，?view= 指定视图
 	r.GET("/api/gallery", getGallery) // 当天图库 API
+	r.POST("/api/gallery/share", adminAuth(), createShareLink) // 生成分享链接
+	r.GET("/api/gallery/shares", adminAuth(), listShareLinks)
+	r.DELETE("/api/gallery/share/:id", adminAuth(), revokeShareLink)
 	r.POST("/api/publish", handlePublish) // 发布 API
+	r.POST("/api/publish/platforms/:id/test", testPublishCredentials) // 检测发布平台凭证
+	r.GET("/api/publish/jobs", listPublishJobs)                         // 定时发布队列
+	r.GET("/api/publish/windows", listPublishWindows)                   // 发布时间窗口
+	r.GET("/api/publish/records", listPublishRecords)                   // 发布记录
+	r.PUT("/api/publish/records/:id", updatePublishRecord)              // 修改已发布内容
+	r.DELETE("/api/publish/jobs/:id", cancelPublishJob)
+	r.GET("/api/workflows", listWorkflows) // 自动化流程
+	r.POST("/api/workflows/:name/run", runWorkflowHandler)
+	r.GET("/api/workflows/runs", listWorkflowRuns)
+	r.GET("/api/workflows/runs/:id", getWorkflowRun)
 	r.GET("/api/platforms", listPlatforms) // 平台列表
+	r.GET("/api/platforms/:id/models", listPlatformModels)
+	r.GET("/api/platforms/:id/capabilities", getPlatformCapabilities) // 支持的模型、尺寸和限制，带缓存
+	r.GET("/api/playground", listPlayground) // 试验场记录，?session= 按会话筛选
+	r.POST("/api/playground/:id/promote", promotePlayground) // 试验结果转为正式记录
+	r.GET("/api/presets", listPresets) // 比例预设，?platform= 为该平台换算后的尺寸
+	r.POST("/api/prompts/check", checkPrompt) // 生成前检查提示词，不生成
 	r.GET("/api/settings", getSettings)
 	r.GET("/api/fix-paths", fixImagePaths)
 	r.POST("/api/settings", updateSettings)
+	r.GET("/api/quota", getQuota) // 当前调用方额度
+	r.GET("/api/activity", listActivities) // 动态
+	r.GET("/api/drafts", listDrafts)       // 提示词草稿
+	r.POST("/api/drafts", createDraft)
+	r.GET("/api/drafts/:id", getDraft)
+	r.PUT("/api/drafts/:id", updateDraft)
+	r.DELETE("/api/drafts/:id", deleteDraft)
+	r.POST("/api/drafts/:id/comments", addDraftComment)
+	r.POST("/api/drafts/:id/promote", promoteDraft)
+	r.POST("/api/batches", createBatch) // 组合批量生成
+	r.GET("/api/batches", listBatches)
+	r.GET("/api/batches/:id", getBatch)
+	r.POST("/api/stories", createStory) // 故事模式：按大纲生成封面和内容页
+	r.GET("/api/stories", listStories)
+	r.GET("/api/stories/:id", getStory)
+	r.POST("/api/stories/:id/pages/:page/regenerate", regenerateStoryPage)
+	r.POST("/api/stories/:id/review", reviewStory)
+	r.POST("/api/stories/:id/publish", publishStory)
+	r.GET("/api/calendar", listCalendar) // 内容日历
+	r.GET("/api/holidays", listHolidays) // 节日与节气
+	r.POST("/api/templates/:id/preview", previewTemplate) // 模板预览
+	r.GET("/api/branding", listBrandingProfiles) // 品牌配置
+	r.GET("/api/images/:id/branded", previewBranding)
+	r.POST("/api/calendar", createCalendarEntry)
+	r.GET("/api/calendar/:id", getCalendarEntry)
+	r.PUT("/api/calendar/:id", updateCalendarEntry)
+	r.DELETE("/api/calendar/:id", deleteCalendarEntry)
+	r.POST("/api/calendar/:id/run", runCalendarEntryNow)
+	r.GET("/api/weekly-summaries", listWeeklySummaries) // 每周精选草稿
+	r.POST("/api/weekly-summaries/run", runWeeklySummaryNow) // 立即为上一周生成
+	r.GET("/api/weekly-summaries/:id", getWeeklySummary)
+	r.PUT("/api/weekly-summaries/:id", updateWeeklySummary)
+	r.POST("/api/weekly-summaries/:id/confirm", confirmWeeklySummary) // 确认后创建发布任务
+	r.POST("/api/weekly-summaries/:id/discard", discardWeeklySummary)
+	r.GET("/api/schedules", listSchedules) // 定时生成
+	r.POST("/api/schedules", createSchedule)
+	r.GET("/api/schedules/:id", getSchedule)
+	r.PUT("/api/schedules/:id", updateSchedule)
+	r.DELETE("/api/schedules/:id", deleteSchedule)
+	r.POST("/api/schedules/:id/run", runScheduleNow)
+	r.GET("/api/categories", listCategories)
+	r.POST("/api/categories", adminAuth(), createCategory)
+	r.PUT("/api/categories/:id", adminAuth(), updateCategory)
+	r.DELETE("/api/categories/:id", adminAuth(), deleteCategory)
+	r.POST("/api/experiments", createExperiment) // 多平台对比实验
+	r.GET("/api/experiments", listExperiments)
+	r.GET("/api/experiments/:id", getExperiment)
+
+	// 管理接口
+	admin := r.Group("/api/admin", adminAuth())
+	admin.POST("/loadtest", handleLoadTest) // 压测
+	admin.GET("/overview", adminOverview)    // 运维总览
+	admin.GET("/platforms/drains", listDrains) // 平台暂停
+	admin.POST("/platforms/:id/drain", drainPlatform)
+	admin.DELETE("/platforms/:id/drain", resumePlatform)
+	admin.GET("/publish/pauses", listPublishPauses) // 发布错误预算触发的暂停
+	admin.POST("/publish/pauses/:platform", pausePublishPlatform)
+	admin.DELETE("/publish/pauses/:platform", resumePublishPlatform)
+	admin.GET("/platforms/pauses", listProviderPauses) // 平台限流暂停
+	admin.DELETE("/platforms/:id/pause", resumeProviderPause)
+	admin.GET("/breakers", listBreakers) // 平台熔断状态
+	admin.POST("/breakers/:id/reset", resetBreaker)
+	admin.GET("/usage", usageReport)         // 用量与计费报表
+	admin.POST("/fix-dates", fixRecordDates) // 按业务时区修正历史日期
+	admin.GET("/metrics", metricsPreview)    // 推送的指标
+	admin.GET("/alert-rules", getAlertRules) // 推荐的 Prometheus 告警规则
+	admin.GET("/provider-calls", listProviderCalls) // 平台请求录制
+	admin.GET("/provider-calls/:id", getProviderCall)
+	admin.GET("/outbox", listOutboxEvents)   // 事件发件箱
+	admin.GET("/dead-letters", listDeadLetters) // 死信队列
+	admin.GET("/dead-letters/:id", getDeadLetter)
+	admin.POST("/dead-letters/:id/redrive", redriveDeadLetter)
+	admin.DELETE("/dead-letters/:id", discardDeadLetter)
+	admin.POST("/outbox/:id/retry", retryOutboxEvent)
+	admin.GET("/policy/keywords", listPolicyKeywords)
+	admin.POST("/policy/keywords", addPolicyKeyword)
+	admin.DELETE("/policy/keywords/:id", deletePolicyKeyword)
+	admin.GET("/policy/candidates", listPolicyCandidates) // 被平台拦截的提示词
+	admin.POST("/policy/candidates/:id/accept", acceptPolicyCandidate)
+	admin.POST("/policy/candidates/:id/dismiss", dismissPolicyCandidate)
 
 	log.Printf("🚀 图片平台启动于端口 %s", cfg.Server.Port)
 	r.Run(":" + cfg.Server.Port)
@@ -225,9 +764,9 @@ func main() {
 // ========== 页面处理 ==========
 func index(c *gin.Context) {
 	var pending, approved, rejected []ImageRecord
-	db.Where("status = ?", "pending").Limit(100).Find(&pending)
-	db.Where("status = ?", "approved").Limit(100).Find(&approved)
-	db.Where("status = ?", "rejected").Limit(100).Find(&rejected)
+	sortConsistency(c, orderPending(filterCategory(c, db).Where("status = ?", "pending"))).Order("generated_at DESC").Limit(100).Find(&pending)
+	filterCategory(c, db).Where("status = ?", "approved").Limit(100).Find(&approved)
+	filterCategory(c, db).Where("status = ?", "rejected").Limit(100).Find(&rejected)
 
 	// 添加ImageUrl字段
 	type ImageWithURL struct {
@@ -264,12 +803,18 @@ func moderatePage(c *gin.Context) {
 		return
 	}
 	imageUrl := "/images" + strings.TrimPrefix(record.Path, "/home/zhuyitao/generated_images")
-	c.HTML(http.StatusOK, "moderate.html", gin.H{"record": record, "imageUrl": imageUrl})
+	// 平台返回的其他信息格式化后展示，方便审核时查看改写后的提示词和审核标记
+	var providerMeta string
+	if len(record.ProviderMeta) > 0 {
+		data, _ := json.MarshalIndent(record.ProviderMeta, "", "  ")
+		providerMeta = string(data)
+	}
+	c.HTML(http.StatusOK, "moderate.html", gin.H{"record": record, "imageUrl": imageUrl, "providerMeta": providerMeta, "referenceUrl": imageURL(record.ReferencePath)})
 }
 
 func recordsPage(c *gin.Context) {
 	var records []ImageRecord
-	db.Order("generated_at DESC").Limit(100).Find(&records)
+	filterCategory(c, db).Order("generated_at DESC").Limit(100).Find(&records)
 	
 	type ImageWithURL struct {
 		ImageRecord
@@ -286,9 +831,9 @@ func recordsPage(c *gin.Context) {
 
 // ========== 当天图库页面 ==========
 func galleryPage(c *gin.Context) {
-	date := c.DefaultQuery("date", time.Now().Format("2006-01-02"))
+	date := c.DefaultQuery("date", today())
 	var records []ImageRecord
-	db.Where("date = ? AND status = ?", date, "approved").Order("generated_at DESC").Find(&records)
+	filterCategory(c, db).Where("date = ? AND status = ?", date, "approved").Order("generated_at DESC").Find(&records)
 	
 	type ImageWithURL struct {
 		ImageRecord
@@ -310,15 +855,42 @@ func galleryPage(c *gin.Context) {
 // ========== API 处理 ==========
 func handleGenerate(c *gin.Context) {
 	var req struct {
-		Prompt   string `json:"prompt" binding:"required"`
-		Platform string `json:"platform"` // 可选，未指定则使用用户设置
-		Size     string `json:"size"`      // 可选，如 "1920x1080"
-		Model    string `json:"model"`     // 可选，指定模型
+		Prompt         string `json:"prompt" binding:"required"`
+		Platform       string `json:"platform"`        // 可选，未指定则使用用户设置
+		Size           string `json:"size"`            // 可选，如 "1920x1080"，也可以是预设名
+		Preset         string `json:"preset"`          // 可选，比例预设 square、portrait_9x16、landscape_16x9、xiaohongshu_3x4 等，与 size 二选一
+		Model          string `json:"model"`           // 可选，指定模型
+		Category       string `json:"category"`        // 可选，分类
+		Sync           bool   `json:"sync"`            // 可选，true 时等待生成完成再返回
+		N              int    `json:"n"`               // 可选，一次生成的候选张数，默认 1
+		NegativePrompt string `json:"negative_prompt"` // 可选，不希望出现的内容
+		Seed           *int64 `json:"seed"`            // 可选，固定 seed 以复现构图
+		Enhance        bool   `json:"enhance"`         // 可选，生成前用 LLM 扩写提示词
+		CallbackURL    string `json:"callback_url"`    // 可选，异步任务结束时 POST 结果到该地址
+		Playground     bool   `json:"playground"`      // 可选，试验场生成，不进入审核队列和统计，到期自动删除
+		Session        string `json:"session"`         // 可选，试验场会话，用于分组查看
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(400, gin.H{"error": "请输入描述词: " + err.Error()})
 		return
 	}
+	if req.CallbackURL != "" {
+		if req.Sync {
+			c.JSON(400, gin.H{"error": "callback_url 只用于异步生成"})
+			return
+		}
+		if err := validateCallbackURL(req.CallbackURL); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.N <= 0 {
+		req.N = 1
+	}
+	if req.N > maxImagesPerRequest {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("n 最大为 %d", maxImagesPerRequest)})
+		return
+	}
 
 	// 如果未指定平台，使用用户默认设置
 	if req.Platform == "" {
@@ -336,36 +908,145 @@ func handleGenerate(c *gin.Context) {
 		return
 	}
 
-	// 生成图片
-	result := generateImage(req.Platform, req.Prompt, req.Size, req.Model)
+	if req.Preset != "" {
+		if req.Size != "" {
+			c.JSON(400, gin.H{"error": "size 和 preset 只能指定一个"})
+			return
+		}
+		if _, ok := platformPresets(cfg.Platforms[req.Platform])[req.Preset]; !ok {
+			c.JSON(400, gin.H{"error": "预设不存在: " + req.Preset})
+			return
+		}
+		req.Size = req.Preset
+	}
+	if err := validateSize(req.Platform, req.Size); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err := checkCapabilities(req.Platform, req.Model, req.Size, req.N, req.Prompt); err != nil {
+		c.JSON(400, gin.H{"error": err.Error(), "code": "unsupported"})
+		return
+	}
 
-	if result == nil {
-		c.JSON(500, gin.H{"error": "生成失败，请检查平台是否正确或API是否配置"})
+	if !categoryExists(req.Category) {
+		c.JSON(400, gin.H{"error": "分类不存在: " + req.Category})
+		return
+	}
+	if err := checkPlatformRouting(req.Platform); err != nil {
+		c.JSON(503, gin.H{"error": err.Error(), "code": ErrCodeDraining})
+		return
+	}
+	// 配置了降级平台时熔断的平台由降级平台接替
+	if err := checkBreaker(req.Platform); err != nil && len(fallbackChain(req.Platform, ImageRecord{})) == 1 {
+		c.JSON(503, gin.H{"error": err.Error(), "code": ErrCodeCircuitOpen})
 		return
 	}
 
-	genTime := time.Now()
-	record := ImageRecord{
-		Name:        result.Filename,
-		Date:        genTime.Format("2006-01-02"),
-		Path:        result.FilePath,
-		Platform:    result.Platform,
-		Model:       result.Model,
-		Prompt:      req.Prompt,
-		GeneratedAt: genTime,
-		Status:      "pending",
+	// 内容策略预检
+	verdict := checkPromptPolicy(c.Request.Context(), req.Prompt, req.Platform)
+	if verdict.Blocked {
+		c.JSON(422, verdict.response())
+		return
+	}
+
+	// 检查额度
+	user, apiKey := currentUser(c), currentAPIKey(c)
+	cost := cfg.Platforms[req.Platform].CostPerImage
+	if err := checkQuota(user, apiKey, req.N, cost*float64(req.N)); err != nil {
+		c.JSON(429, gin.H{"error": err.Error(), "code": "quota_exceeded"})
+		return
+	}
+
+	// 生成图片
+	base := ImageRecord{
+		User:           user,
+		APIKey:         apiKey,
+		Workspace:      currentWorkspace(c),
+		PolicyFlag:     verdict.Flag,
+		Category:       req.Category,
+		NegativePrompt: req.NegativePrompt,
+		Seed:           req.Seed,
+	}
+	if req.Playground {
+		base.Status = "playground"
+		base.PlaygroundSession = req.Session
+	}
+	if !req.Sync {
+		task := &GenerateTask{
+			Platform:    req.Platform,
+			Model:       req.Model,
+			Size:        req.Size,
+			Prompt:      req.Prompt,
+			N:           req.N,
+			Enhance:     req.Enhance,
+			User:        user,
+			CallbackURL: req.CallbackURL,
+			base:        base,
+		}
+		if !enqueueTask(task) {
+			c.JSON(503, gin.H{"error": "生成队列已满，请稍后重试", "code": "queue_full"})
+			return
+		}
+		c.JSON(202, gin.H{"message": "success", "task_id": task.ID, "status": task.Status})
+		return
 	}
-	db.Create(&record)
 
-	c.JSON(200, gin.H{"message": "success", "filePath": result.FilePath, "platform": result.Platform, "model": result.Model})
+	if req.Enhance {
+		base.EnhancedPrompt = enhanceOrOriginal(c.Request.Context(), req.Prompt)
+	}
+	records, err := generateAndSaveN(c.Request.Context(), req.Platform, req.Prompt, req.Size, req.Model, req.N, base)
+	if err != nil {
+		status := 502
+		if errorCode(err) == ErrCodeCircuitOpen {
+			status = 503
+		}
+		c.JSON(status, gin.H{"error": "生成失败: " + err.Error(), "code": "generation_failed", "error_code": errorCode(err)})
+		return
+	}
+	ids := make([]uint, len(records))
+	for i, r := range records {
+		ids[i] = r.ID
+	}
+	record := records[0]
+	c.JSON(200, gin.H{"message": "success", "id": record.ID, "ids": ids, "filePath": record.Path, "platform": record.Platform, "model": record.Model, "fallback_from": record.FallbackFrom, "images": withImageURLs(records)})
 }
 
 func listImages(c *gin.Context) {
 	var records []ImageRecord
-	query := db.Model(&ImageRecord{})
+	query := filterCategory(c, db.Model(&ImageRecord{}))
 	if s := c.DefaultQuery("status", "all"); s != "all" {
 		query = query.Where("status = ?", s)
+	} else {
+		query = query.Where("status <> ?", "playground")
+	}
+	if batchID := c.Query("batch_id"); batchID != "" {
+		query = query.Where("batch_id = ?", batchID)
+	}
+	if code := c.Query("error_code"); code != "" {
+		query = query.Where("error_code = ?", code)
+	}
+	if sourceID := c.Query("source_id"); sourceID != "" {
+		query = query.Where("source_id = ?", sourceID)
+	}
+	if tag := c.Query("tag"); tag != "" {
+		query = query.Where("id IN (?)", db.Model(&ImageTag{}).Select("image_id").Where("tag = ?", tag))
+	}
+	if collection := c.Query("collection"); collection != "" {
+		query = query.Where("id IN (?)", db.Model(&CollectionImage{}).Select("image_id").Where("collection = ?", collection))
+	}
+	// ?meta[campaign]=618&meta[designer]=li 按元数据筛选
+	query, err := filterMetadata(query, c.QueryMap("meta"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if maxScore := c.Query("max_consistency"); maxScore != "" {
+		query = query.Where("consistency_score <= ?", maxScore)
+	}
+	if c.Query("status") == "pending" {
+		query = orderPending(query)
 	}
+	query = sortConsistency(c, query)
 	query.Order("generated_at DESC").Limit(100).Find(&records)
 	
 	// 转换路径为URL
@@ -383,44 +1064,140 @@ func listImages(c *gin.Context) {
 
 func moderateImage(c *gin.Context) {
 	var req struct {
-		ID     uint   `json:"id" binding:"required"`
-		Status string `json:"status" binding:"required"`
-		Note   string `json:"note"`
+		ID       uint   `json:"id" binding:"required"`
+		Status   string `json:"status" binding:"required"`
+		Note     string `json:"note"`
+		Category string `json:"category"` // 可选，审核时设置分类
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
-	db.Model(&ImageRecord{}).Where("id = ?", req.ID).Updates(map[string]interface{}{
-		"status": req.Status, "note": req.Note, "moderated_at": time.Now()})
+	if !categoryExists(req.Category) {
+		c.JSON(400, gin.H{"error": "分类不存在: " + req.Category})
+		return
+	}
+
+	var record ImageRecord
+	if err := db.First(&record, req.ID).Error; err != nil {
+		c.JSON(404, gin.H{"error": "图片不存在"})
+		return
+	}
+
+	// 需要多人审核的图片，通过票数不足时只记录意见；按 API Key 或管理员令牌计票
+	reviewer, identity := currentUser(c), currentIdentity(c)
+	if req.Status == "approved" && record.RequiredApprovals > 1 && identity == "" {
+		c.JSON(401, gin.H{"error": "该图片需要多人审核，请通过 X-API-Key 或 X-Admin-Token 标识审核人"})
+		return
+	}
+	if reviewer == "" {
+		reviewer = identity
+	}
+	approvals, err := applyReview(&record, req.Status, req.Note, req.Category, reviewer, identity, "")
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	if approvals > 0 {
+		c.JSON(200, gin.H{"message": "已记录通过意见", "approvals": approvals, "required": record.RequiredApprovals})
+		return
+	}
 	c.JSON(200, gin.H{"message": "success"})
 }
 
+// applyReview 记录一次审核意见并更新图片状态，via 为审核方式（后台为空，email 为邮件链接）
+// identity 为审核人经过鉴权的身份，多人审核按它计票，为空的意见不计票
+// 需要多人审核且通过票数不足时只记录意见，返回当前的通过票数；状态已更新时返回 0
+func applyReview(record *ImageRecord, status, note, category, reviewer, identity, via string) (int64, error) {
+	db.Create(&ImageReview{ImageID: record.ID, Reviewer: reviewer, Identity: identity, Status: status, Note: note, Via: via})
+	if status == "approved" && record.RequiredApprovals > 1 {
+		if approvals := countApprovals(record.ID); approvals < int64(record.RequiredApprovals) {
+			if category != "" {
+				db.Model(&ImageRecord{}).Where("id = ?", record.ID).Update("category", category)
+			}
+			return approvals, nil
+		}
+	}
+
+	updates := map[string]interface{}{
+		"status": status, "note": note, "moderated_at": time.Now(), "pinned": false, "pinned_at": nil}
+	if category != "" {
+		updates["category"] = category
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&ImageRecord{}).Where("id = ?", record.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+		return emitEvent(tx, "image."+status, gin.H{"id": record.ID, "status": status, "note": note, "reviewer": reviewer, "via": via})
+	})
+	if err != nil {
+		return 0, err
+	}
+	detail := note
+	if via == "email" {
+		detail = strings.TrimSpace("邮件审核 " + note)
+	}
+	recordActivity(status, record.ID, reviewer, detail)
+	if status == "rejected" && record.User != reviewer {
+		notify(record.User, "image_rejected", fmt.Sprintf("图片 #%d 未通过审核", record.ID), note, record.ID, imageURL(record.Path))
+	}
+	resumeWorkflows(record.ID, status)
+	if status == "approved" {
+		queueDAMPush(*record)
+	}
+	return 0, nil
+}
+
 func listRecords(c *gin.Context) {
 	var records []ImageRecord
-	db.Order("generated_at DESC").Limit(100).Find(&records)
+	filterCategory(c, db).Order("generated_at DESC").Limit(100).Find(&records)
 	c.JSON(200, gin.H{"records": records, "total": len(records)})
 }
 
 func deleteImage(c *gin.Context) {
-	db.Delete(&ImageRecord{}, c.Param("id"))
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	var deleted int64
+	db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Delete(&ImageRecord{}, id)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		deleted = res.RowsAffected
+		if err := deleteImageLabels(tx, []uint{uint(id)}); err != nil {
+			return err
+		}
+		return emitEvent(tx, "image.deleted", gin.H{"id": id, "actor": currentUser(c)})
+	})
+	if deleted > 0 {
+		recordActivity("deleted", uint(id), currentUser(c), "")
+	}
 	c.JSON(200, gin.H{"message": "success"})
 }
 
 func dailyReport(c *gin.Context) {
-	date := c.DefaultQuery("date", time.Now().Format("2006-01-02"))
+	date := c.DefaultQuery("date", today())
 	var records []ImageRecord
-	db.Where("date = ?", date).Find(&records)
+	filterCategory(c, db).Where("date = ? AND status NOT IN ?", date, nonProductionStatuses).Find(&records)
 
-	approved, rejected, pending := 0, 0, 0
+	approved, rejected, pending, failed := 0, 0, 0, 0
 	platformStats := make(map[string]int)
+	categoryStats := make(map[string]int)
+	errorStats := make(map[string]int) // 失败按错误分类统计
+	withNegative := 0                   // 使用了反向提示词的记录数
 	for _, r := range records {
+		if r.NegativePrompt != "" {
+			withNegative++
+		}
 		switch r.Status {
 		case "approved": approved++
 		case "rejected": rejected++
+		case "failed":
+			failed++
+			errorStats[r.ErrorCode]++
 		default: pending++
 		}
 		platformStats[r.Platform]++
+		categoryStats[r.Category]++
 	}
 	c.JSON(200, gin.H{
 		"date":     date,
@@ -428,16 +1205,38 @@ func dailyReport(c *gin.Context) {
 		"approved": approved,
 		"rejected": rejected,
 		"pending":  pending,
+		"failed":   failed,
+		"error_stats":    errorStats,
+		"with_negative_prompt": withNegative,
 		"platform_stats": platformStats,
+		"category_stats": categoryStats,
+		"balances":       getBalances(),
 		"images":   records,
+		"style_drift":    styleDriftSection(date),
 	})
 }
 
 // ========== 图库 API ==========
 func getGallery(c *gin.Context) {
-	date := c.DefaultQuery("date", time.Now().Format("2006-01-02"))
+	date := c.DefaultQuery("date", today())
 	var records []ImageRecord
-	db.Where("date = ? AND status = ?", date, "approved").Order("generated_at DESC").Find(&records)
+	query := filterCategory(c, db).Where("status = ?", "approved")
+	switch c.Query("sort") {
+	case "views", "downloads":
+		// 按热度排序，未指定日期时统计全部图片
+		column := "view_count"
+		if c.Query("sort") == "downloads" {
+			column = "download_count"
+		}
+		if c.Query("date") == "" {
+			date = ""
+		} else {
+			query = query.Where("date = ?", date)
+		}
+		query.Order(column + " DESC, generated_at DESC").Limit(100).Find(&records)
+	default:
+		query.Where("date = ?", date).Order("generated_at DESC").Find(&records)
+	}
 	c.JSON(200, gin.H{"records": records, "total": len(records), "date": date})
 }
 
@@ -448,6 +1247,7 @@ func handlePublish(c *gin.Context) {
 		Platforms []string `json:"platforms"` // 发布到哪些平台，空表示所有
 		Title     string   `json:"title"`
 		Content   string   `json:"content"`
+		Branding  string   `json:"branding"` // 指定品牌配置，none 不加，为空按配置选择
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(400, gin.H{"error": err.Error()})
@@ -466,7 +1266,7 @@ func handlePublish(c *gin.Context) {
 		return
 	}
 
-	ctx := context.Background()
+	ctx := requestid.With(context.Background(), currentRequestID(c))
 	results := make(map[string]string)
 
 	// 确定要发布的平台
@@ -477,19 +1277,72 @@ func handlePublish(c *gin.Context) {
 		}
 	}
 
-	// 发布到各平台
+	// 发布到各平台，不在发布时段内的平台排队到下一个可发布时刻
+	now := time.Now()
 	for _, plat := range platformsToUse {
-		url, err := pubManager.Publish(publisher.PlatformType(plat), ctx, record.Path, req.Title, req.Content)
+		if next := nextPublishTime(plat, now); next.After(now) {
+			jobs, err := schedulePublish(record.ID, []string{plat}, req.Title, req.Content, next, nil)
+			if err != nil {
+				results[plat] = "失败: 排队失败: " + err.Error()
+			} else {
+				results[plat] = fmt.Sprintf("不在发布时段，已排队 #%d，%s 发布", jobs[0].ID, next.In(bizLoc).Format("2006-01-02 15:04"))
+			}
+			continue
+		}
+		if err := checkPublishPause(plat); err != nil {
+			results[plat] = "失败: " + err.Error()
+			continue
+		}
+		if verdict := checkPublishPolicy(record.Prompt+" "+req.Title+" "+req.Content, plat); verdict.Blocked {
+			results[plat] = "失败: " + verdict.Reason
+			continue
+		}
+		path, err := publishImagePath(&record, plat, req.Branding)
 		if err != nil {
+			results[plat] = "失败: 品牌处理失败: " + err.Error()
+			continue
+		}
+		url, err := pubManager.Publish(publisher.PlatformType(plat), ctx, path, req.Title, req.Content)
+		if err != nil {
+			notePublishFailure(plat, err)
 			results[plat] = "失败: " + err.Error()
+			recordActivity("publish_failed", record.ID, currentUser(c), plat+": "+err.Error())
+			notify(record.User, "publish_failed", fmt.Sprintf("图片 #%d 发布到 %s 失败", record.ID, plat), err.Error(), record.ID, "")
+			emitEvent(db, "image.publish_failed", gin.H{"id": record.ID, "platform": plat, "error": err.Error()})
 		} else {
 			results[plat] = url
+			recordPublished(record.ID, plat, url, req.Title, req.Content, currentUser(c), nil)
+			recordActivity("published", record.ID, currentUser(c), plat+": "+url)
+			emitEvent(db, "image.published", gin.H{"id": record.ID, "platform": plat, "url": url})
 		}
 	}
 
 	c.JSON(200, gin.H{"message": "success", "results": results})
 }
 
+// testPublishCredentials 检测发布平台的 Cookie/Token 是否仍然可用
+func testPublishCredentials(c *gin.Context) {
+	plat := c.Param("id")
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	account, err := pubManager.TestCredentials(ctx, publisher.PlatformType(plat))
+	recordCredentialCheck(plat, err)
+	result := gin.H{
+		"platform":   plat,
+		"ok":         err == nil,
+		"account":    account,
+		"latency_ms": time.Since(start).Milliseconds(),
+		"checked_at": time.Now(),
+	}
+	if err != nil {
+		log.Printf("[发布凭证] %s 检测失败: %v", plat, err)
+		result["error"] = err.Error()
+	}
+	c.JSON(200, result)
+}
+
 // ========== 平台列表 API ==========
 func listPlatforms(c *gin.Context) {
 	platforms := getPlatformsInfo()
@@ -517,7 +1370,7 @@ func updateSettings(c *gin.Context) {
 
 	settings := getOrCreateSettings()
 	if req.Platform != "" {
-		if p, ok := cfg.Platforms[req.Platform]; !ok || !p.Enabled || p.APIKey == "" {
+		if p, ok := cfg.Platforms[req.Platform]; !ok || !platformReady(p) {
 			c.JSON(400, gin.H{"error": "平台不可用或未配置"})
 			return
 		}
@@ -547,19 +1400,222 @@ func loadConfig(path string) (*Config, error) {
 	if c.ImageGen.Height == 0 {
 		c.ImageGen.Height = 2048
 	}
+	if c.ImageGen.MaxWorkers == 0 {
+		c.ImageGen.MaxWorkers = 5
+	}
+	if c.ImageGen.CapabilitiesTTL == 0 {
+		c.ImageGen.CapabilitiesTTL = 60
+	}
+	if c.Breaker.Threshold == 0 {
+		c.Breaker.Threshold = 5
+	}
+	if c.Breaker.Cooldown == 0 {
+		c.Breaker.Cooldown = 60
+	}
+	if c.Observability.SLO.Window == 0 {
+		c.Observability.SLO.Window = 60
+	}
+	if c.Observability.SLO.MinSamples == 0 {
+		c.Observability.SLO.MinSamples = 20
+	}
+	if c.Observability.Alerts.FailureRate == 0 {
+		c.Observability.Alerts.FailureRate = 0.2
+	}
+	if c.Observability.Alerts.MinImages == 0 {
+		c.Observability.Alerts.MinImages = 20
+	}
+	if c.Observability.Alerts.PendingReviews == 0 {
+		c.Observability.Alerts.PendingReviews = 200
+	}
+	if c.Observability.Alerts.For == "" {
+		c.Observability.Alerts.For = "15m"
+	}
+	if c.Observability.Alerts.CredentialCheck == 0 {
+		c.Observability.Alerts.CredentialCheck = 60
+	}
+	if c.Moderation.Threshold == 0 {
+		c.Moderation.Threshold = 0.5
+	}
+	for i := range c.Moderation.Providers {
+		if c.Moderation.Providers[i].Weight == 0 {
+			c.Moderation.Providers[i].Weight = 1
+		}
+		if c.Moderation.Providers[i].Threshold == 0 {
+			c.Moderation.Providers[i].Threshold = 0.5
+		}
+	}
+	if c.Notifications.Email.Port == 0 {
+		c.Notifications.Email.Port = 465
+	}
+	if c.Notifications.Email.LinkHours == 0 {
+		c.Notifications.Email.LinkHours = 72
+	}
+	if c.Notifications.Email.PasswordEnv != "" {
+		if password := os.Getenv(c.Notifications.Email.PasswordEnv); password != "" {
+			c.Notifications.Email.Password = password
+		}
+	}
+	if c.Consistency.Concurrency <= 0 {
+		c.Consistency.Concurrency = 2
+	}
+	if c.DAM.Type == "" {
+		c.DAM.Type = "api"
+	}
+	if c.DAM.SyncInterval <= 0 {
+		c.DAM.SyncInterval = 30
+	}
+	if c.Playground.TTLHours <= 0 {
+		c.Playground.TTLHours = 24
+	}
+	if c.WeeklySummary.Weekday == "" {
+		c.WeeklySummary.Weekday = "monday"
+	}
+	if c.WeeklySummary.RunAt == "" {
+		c.WeeklySummary.RunAt = "09:00"
+	}
+	if c.WeeklySummary.Count <= 0 {
+		c.WeeklySummary.Count = 9
+	}
+	if c.WeeklySummary.Size <= 0 {
+		c.WeeklySummary.Size = 1080
+	}
+	if c.StyleDrift.RunAt == "" {
+		c.StyleDrift.RunAt = "23:30"
+	}
+	if c.StyleDrift.Threshold == 0 {
+		c.StyleDrift.Threshold = 0.3
+	}
+	if c.QuotaBackoff.Cooldown == 0 {
+		c.QuotaBackoff.Cooldown = 60
+	}
+	if c.QuotaBackoff.MaxPause == 0 {
+		c.QuotaBackoff.MaxPause = 600
+	}
+	if c.ImageGen.MaxRetries == 0 {
+		c.ImageGen.MaxRetries = 3
+	}
+	if c.ImageGen.RetryDelay == 0 {
+		c.ImageGen.RetryDelay = 3
+	}
+	if c.Publish.MaxAttempts == 0 {
+		c.Publish.MaxAttempts = 3
+	}
+	if c.Publish.RetryDelay == 0 {
+		c.Publish.RetryDelay = 60
+	}
+	if c.Upscale.MaxScale == 0 {
+		c.Upscale.MaxScale = 4
+	}
+	if c.Observability.Recording.RetentionDays == 0 {
+		c.Observability.Recording.RetentionDays = 3
+	}
+	if c.Observability.Recording.MaxBodyBytes == 0 {
+		c.Observability.Recording.MaxBodyBytes = 64 << 10
+	}
+	if c.Observability.Logging.Access.SampleRate == 0 {
+		c.Observability.Logging.Access.SampleRate = 1
+	}
+	if c.Observability.Push.Interval == 0 {
+		c.Observability.Push.Interval = 60
+	}
+	if c.Observability.Push.Job == "" {
+		c.Observability.Push.Job = "image-platform"
+	}
+	if c.Holidays.LeadDays == 0 {
+		c.Holidays.LeadDays = 3
+	}
+	if c.Calendar.RunAt == "" {
+		c.Calendar.RunAt = "08:00"
+	}
+	if _, err := time.Parse("15:04", c.Calendar.RunAt); err != nil {
+		return nil, fmt.Errorf("calendar.runAt 格式应为 HH:MM: %s", c.Calendar.RunAt)
+	}
+	if c.Events.PollInterval == 0 {
+		c.Events.PollInterval = 5
+	}
+	if c.Events.MaxAttempts == 0 {
+		c.Events.MaxAttempts = 10
+	}
+	if token := os.Getenv("ADMIN_TOKEN"); token != "" {
+		c.Server.AdminToken = token
+	}
+	if secret := os.Getenv("PERMALINK_SECRET"); secret != "" {
+		c.Server.PermalinkSecret = secret
+	}
+	if c.LLM.EnvKey != "" {
+		if key := os.Getenv(c.LLM.EnvKey); key != "" {
+			c.LLM.APIKey = key
+		}
+	}
+	if c.Translate.EnvKey != "" {
+		if key := os.Getenv(c.Translate.EnvKey); key != "" {
+			c.Translate.APIKey = key
+		}
+	}
+	for i, k := range c.Auth.APIKeys {
+		if k.EnvKey != "" {
+			if key := os.Getenv(k.EnvKey); key != "" {
+				c.Auth.APIKeys[i].Key = key
+			}
+		}
+	}
 	for key, p := range c.Platforms {
 		if apiKey := os.Getenv(p.EnvKey); apiKey != "" {
 			p.APIKey, p.Enabled = apiKey, true
 		}
+		if p.AccessKeyEnv != "" {
+			p.AccessKey = os.Getenv(p.AccessKeyEnv)
+		}
+		if p.SecretKeyEnv != "" {
+			p.SecretKey = os.Getenv(p.SecretKeyEnv)
+		}
+		if p.Type == "" {
+			p.Type = key
+		}
+		if p.Type == "vertex" && p.CredentialsFile == "" {
+			p.CredentialsFile = os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+		}
 		c.Platforms[key] = p
 	}
 	return &c, nil
 }
 
+// imageURL 本地图片路径转换为 /images 下的访问地址
+func imageURL(path string) string {
+	if path == "" {
+		return "" // 生成失败的记录没有文件
+	}
+	return "/images" + strings.TrimPrefix(path, cfg.ImageGen.OutputDir)
+}
+
+// ImageWithURL 附带访问地址的图片记录
+type ImageWithURL struct {
+	ImageRecord
+	ImageURL string `json:"imageUrl"`
+}
+
+func withImageURLs(records []ImageRecord) []ImageWithURL {
+	result := make([]ImageWithURL, len(records))
+	for i, r := range records {
+		result[i].ImageRecord = r
+		result[i].ImageURL = imageURL(r.Path)
+	}
+	return result
+}
+
+// platformReady 平台已启用且配置了 API Key、服务账号密钥或签名用的 AK/SK（本地平台不需要）
+func platformReady(p PlatformConfig) bool {
+	caps := generator.CapabilitiesOf(p.Type)
+	if caps.Signed {
+		return p.Enabled && p.AccessKey != "" && p.SecretKey != ""
+	}
+	return p.Enabled && (p.APIKey != "" || p.CredentialsFile != "" || caps.Keyless)
+}
+
 func getEnabledPlatforms() map[string]PlatformConfig {
 	result := make(map[string]PlatformConfig)
 	for key, p := range cfg.Platforms {
-		if p.Enabled && p.APIKey != "" {
+		if platformReady(p) {
 			result[key] = p
 		}
 	}
@@ -570,7 +1626,7 @@ func setupLogging() {
 	os.MkdirAll(cfg.ImageGen.LogDir, 0755)
 	logFile := fmt.Sprintf("%s/app_%s.log", cfg.ImageGen.LogDir, time.Now().Format("20060102"))
 	f, _ := os.OpenFile(logFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
-	log.SetOutput(f)
+	initSlog(f)
 }
 
 // ========== 初始化发布管理器 ==========
@@ -596,275 +1652,229 @@ func initPublisher() *publisher.Manager {
 		mgr.Register(publisher.NewBilibili("", cfg.Publish.Bilibili.Cookie))
 	}
 
-	return mgr
-}
-
-// ========== 图片生成 ==========
-type GenerateResult struct {
-	Platform string
-	Model    string
-	Filename string
-	FilePath string
-	Success  bool
-}
-
-func generateImage(platform, prompt, size, model string) *GenerateResult {
-	p, ok := cfg.Platforms[platform]
-	if !ok || !p.Enabled {
-		return nil
-	}
-
-	// 如果指定了模型，覆盖默认模型
-	if model != "" {
-		p.Model = model
-	}
-
-	// 阿里云百炼是异步 API
-	if platform == "aliyun" {
-		return generateAliyunImage(p, prompt)
+	// 注册图床
+	if h := cfg.Publish.ImageHost; h.Enabled {
+		mgr.Register(publisher.NewImageHost(h.Provider, h.APIURL, h.Token, h.FileField, h.URLPath))
 	}
 
-	// 魔塔社区是异步 API，支持 size 参数
-	if platform == "modelscope" {
-		return generateModelScopeImage(p, prompt, size)
+	// 注册自定义平台
+	for _, cp := range cfg.Publish.Custom {
+		auth := cp.AuthHeader
+		if cp.AuthEnv != "" {
+			auth = os.Getenv(cp.AuthEnv)
+		}
+		mgr.Register(publisher.NewCustomPlatform(cp.Name, publisher.PlatformType(cp.Type), cp.APIURL, auth, cp.RefPath))
 	}
 
-	// 其他平台使用同步 API (SiliconFlow, OpenAI)
-	return generateSyncImage(p, prompt)
+	return mgr
 }
 
-// 同步图片生成 (SiliconFlow, OpenAI)
-func generateSyncImage(p PlatformConfig, prompt string) *GenerateResult {
-	client := &http.Client{Timeout: 120 * time.Second}
-	width, height := cfg.ImageGen.Width, cfg.ImageGen.Height
-	
-	// 如果高度是宽度的2倍（竖图），需要调整
-	size := fmt.Sprintf("%dx%d", width, height)
-	if height > width {
-		size = fmt.Sprintf("%dx%d", width/2, height)
-	}
-
-	reqBody, _ := json.Marshal(map[string]interface{}{
-		"model": p.Model, "prompt": prompt, "size": size, "n": 1,
-	})
-
-	apiURL := p.URL
-	if !strings.Contains(apiURL, "/images/generations") {
-		apiURL = apiURL + "/images/generations"
-	}
-
-	req, _ := http.NewRequest("POST", apiURL, bytes.NewReader(reqBody))
-	req.Header.Set("Authorization", "Bearer "+p.APIKey)
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := client.Do(req)
-	if err != nil || resp.StatusCode != 200 {
-		log.Printf("[%s] HTTP错误: %v", p.Name, err)
-		return nil
+// ========== 图片生成 ==========
+// newImageRecord 根据生成结果构造待审核记录（未入库）
+func newImageRecord(result *GenerateResult, prompt string) ImageRecord {
+	genTime := time.Now()
+	var fileSize int64
+	if fi, err := os.Stat(result.FilePath); err == nil {
+		fileSize = fi.Size()
+	}
+	return ImageRecord{
+		Name:         result.Filename,
+		Date:         bizDate(genTime),
+		Path:         result.FilePath,
+		Platform:     result.Platform,
+		Model:        result.Model,
+		Prompt:       prompt,
+		GeneratedAt:  genTime,
+		Status:       "pending",
+		FileSize:     fileSize,
+		MimeType:     result.MIMEType,
+		ProviderMeta: result.Meta,
 	}
-	defer resp.Body.Close()
+}
 
-	body, _ := io.ReadAll(resp.Body)
-	var result struct {
-		Data []struct{ URL string `json:"url"` } `json:"data"`
-	}
-	if err := json.Unmarshal(body, &result); err != nil || len(result.Data) == 0 {
-		log.Printf("[%s] 解析失败: %s", p.Name, string(body))
-		return nil
+// generateAndSave 检查额度、生成并入库，base 提供调用方、分类等上下文字段
+// 生成失败时保存 status=failed 的记录，可在失败列表中重试
+func generateAndSave(ctx context.Context, platform, prompt, size, model string, base ImageRecord) (*ImageRecord, error) {
+	records, err := generateAndSaveN(ctx, platform, prompt, size, model, 1, base)
+	if err != nil {
+		return nil, err
 	}
-
-	imageURL := result.Data[0].URL
-	return downloadAndSave(p, "siliconflow", imageURL)
+	return &records[0], nil
 }
 
-// 阿里云百炼异步图片生成
-func generateAliyunImage(p PlatformConfig, prompt string) *GenerateResult {
-	client := &http.Client{Timeout: 30 * time.Second}
-
-	// 步骤1: 创建任务
-	reqBody, _ := json.Marshal(map[string]interface{}{
-		"model": p.Model,
-		"input": map[string]string{
-			"prompt": prompt,
-		},
-		"parameters": map[string]interface{}{
-			"size": fmt.Sprintf("%d*%d", cfg.ImageGen.Width, cfg.ImageGen.Height),
-			"n":     1,
-		},
-	})
-
-	req, _ := http.NewRequest("POST", "https://dashscope.aliyuncs.com/api/v1/services/aigc/text2image/image-synthesis", bytes.NewReader(reqBody))
-	req.Header.Set("Authorization", "Bearer "+p.APIKey)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-DashScope-Async", "enable")
-
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Printf("[%s] 创建任务失败: %v", p.Name, err)
-		return nil
-	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-	var taskResp struct {
-		Output struct {
-			TaskID string `json:"task_id"`
-		} `json:"output"`
-	}
-	if err := json.Unmarshal(body, &taskResp); err != nil || taskResp.Output.TaskID == "" {
-		log.Printf("[%s] 解析任务ID失败: %s", p.Name, string(body))
-		return nil
-	}
-
-	taskID := taskResp.Output.TaskID
-	log.Printf("[%s] 任务创建成功: %s", p.Name, taskID)
-
-	// 步骤2: 轮询等待任务完成
-	maxRetries := 30
-	for i := 0; i < maxRetries; i++ {
-		time.Sleep(2 * time.Second)
-		
-		taskReq, _ := http.NewRequest("GET", "https://dashscope.aliyuncs.com/api/v1/tasks/"+taskID, nil)
-		taskReq.Header.Set("Authorization", "Bearer "+p.APIKey)
-		
-		taskResp, err := client.Do(taskReq)
-		if err != nil {
+// 单次请求最多生成的候选张数
+const maxImagesPerRequest = 10
+
+// generateAndSaveN 一次生成 n 张候选图，每张图片一条待审核记录
+// ctx 取消时停止生成，已取消的生成不记录失败
+func generateAndSaveN(ctx context.Context, platform, prompt, size, model string, n int, base ImageRecord) ([]ImageRecord, error) {
+	// 请求的平台失败时按 imageGen.fallback 依次换平台，全部失败才记录失败
+	var (
+		lastErr, genErr       error
+		failedOn, failedModel string
+	)
+	requested := size
+	for i, candidate := range fallbackChain(platform, base) {
+		// 预设按每个平台各自的尺寸换算，降级平台也使用同一比例
+		size = resolveSize(candidate, requested)
+		gctx := withGenContext(ctx, candidate, prompt, size, base)
+		if i > 0 {
+			// 指定的模型只对请求的平台有效，降级平台使用默认模型
+			log.Printf("🔀 [%s] 生成失败，降级到 %s: %v", platform, candidate, lastErr)
+			model = ""
+			base.FallbackFrom = platform
+		}
+		// 已入队的异步任务在平台暂停后继续执行
+		if base.TaskID == "" || i > 0 {
+			if err := checkPlatformRouting(candidate); err != nil {
+				lastErr = err
+				continue
+			}
+		}
+		// 熔断中直接跳过，不产生失败记录
+		if err := checkBreaker(candidate); err != nil {
+			lastErr = err
 			continue
 		}
-		
-		taskBody, _ := io.ReadAll(taskResp.Body)
-		taskResp.Body.Close()
-		
-		var statusResp struct {
-			Output struct {
-				TaskStatus string `json:"task_status"`
-				Results    []struct {
-					URL string `json:"url"`
-				} `json:"results"`
-			} `json:"output"`
+		// 限流暂停中：同步请求换平台，异步任务在调用平台前等待暂停结束
+		if base.TaskID == "" {
+			if err := checkProviderPause(candidate); err != nil {
+				lastErr = err
+				continue
+			}
 		}
-		json.Unmarshal(taskBody, &statusResp)
-		
-		if statusResp.Output.TaskStatus == "SUCCEEDED" && len(statusResp.Output.Results) > 0 {
-			return downloadAndSave(p, "aliyun", statusResp.Output.Results[0].URL)
-		} else if statusResp.Output.TaskStatus == "FAILED" {
-			log.Printf("[%s] 任务失败: %s", p.Name, string(taskBody))
-			return nil
+		cost := cfg.Platforms[candidate].CostPerImage
+		release, err := reserveQuota(base.User, base.APIKey, n, cost*float64(n))
+		if err != nil {
+			return nil, err
+		}
+		text := prompt
+		if base.EnhancedPrompt != "" {
+			text = base.EnhancedPrompt
+		}
+		send, lang, translated := localizePrompt(candidate, text)
+		base.PromptLang, base.PromptTranslated, base.PromptSent = lang, translated, send != text
+		opts := GenerateOptions{NegativePrompt: base.NegativePrompt, Seed: base.Seed, Progress: taskProgress(base.TaskID)}
+		results, err := generateImages(gctx, candidate, send, size, model, n, opts)
+		if err == nil {
+			records, err := saveGenerated(candidate, prompt, size, results, base)
+			release()
+			return records, err
+		}
+		release()
+		if errorCode(err) == ErrCodeCanceled {
+			return nil, err
+		}
+		lastErr, genErr, failedOn, failedModel = err, err, candidate, model
+		if !shouldFallback(err) {
+			break
 		}
 	}
-
-	log.Printf("[%s] 任务超时", p.Name)
-	return nil
-}
-
-// 魔塔社区异步图片生成
-func generateModelScopeImage(p PlatformConfig, prompt, size string) *GenerateResult {
-	client := &http.Client{Timeout: 30 * time.Second}
-
-	// 构建请求参数
-	reqParams := map[string]interface{}{
-		"model":  p.Model,
-		"prompt": prompt,
-	}
-	// 支持 size 参数（如 "1920x1080" 或 "2048x2048"）
-	if size != "" {
-		reqParams["size"] = size
-	}
-
-	// 步骤1: 创建任务
-	reqBody, _ := json.Marshal(reqParams)
-
-	req, _ := http.NewRequest("POST", p.URL+"/v1/images/generations", bytes.NewReader(reqBody))
-	req.Header.Set("Authorization", "Bearer "+p.APIKey)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-ModelScope-Async-Mode", "true")
-
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Printf("[%s] 创建任务失败: %v", p.Name, err)
-		return nil
-	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-	var taskResp struct {
-		TaskID     string `json:"task_id"`
-		TaskStatus string `json:"task_status"`
-	}
-	json.Unmarshal(body, &taskResp)
-
-	if taskResp.TaskID == "" {
-		log.Printf("[%s] 解析任务ID失败: %s", p.Name, string(body))
-		return nil
+	if genErr != nil {
+		recordGenerationFailure(failedOn, prompt, size, failedModel, base, genErr)
+		return nil, genErr
 	}
+	return nil, lastErr
+}
 
-	taskID := taskResp.TaskID
-	log.Printf("[%s] 任务创建成功: %s", p.Name, taskID)
-
-	// 步骤2: 轮询等待任务完成
-	maxRetries := 60 // ModelScope 可能需要更长时间
-	for i := 0; i < maxRetries; i++ {
-		time.Sleep(3 * time.Second)
-
-		taskReq, _ := http.NewRequest("GET", p.URL+"/v1/tasks/"+taskID, nil)
-		taskReq.Header.Set("Authorization", "Bearer "+p.APIKey)
-		taskReq.Header.Set("X-ModelScope-Task-Type", "image_generation")
-
-		taskResp, err := client.Do(taskReq)
-		if err != nil {
-			continue
+// saveGenerated 生成结果逐张入库为待审核记录，base.Status 为 playground 时入库为试验场记录
+func saveGenerated(platform, prompt, size string, results []*GenerateResult, base ImageRecord) ([]ImageRecord, error) {
+	cost := cfg.Platforms[platform].CostPerImage
+	records := make([]ImageRecord, 0, len(results))
+	for _, result := range results {
+		record := newImageRecord(result, prompt)
+		record.PlatformID = platform
+		record.Size = size
+		record.User = base.User
+		record.APIKey = base.APIKey
+		record.Workspace = base.Workspace
+		record.PolicyFlag = base.PolicyFlag
+		record.Category = base.Category
+		record.ExperimentID = base.ExperimentID
+		record.ComparisonID = base.ComparisonID
+		record.DraftID = base.DraftID
+		record.BatchID = base.BatchID
+		record.StoryID = base.StoryID
+		record.StoryPage = base.StoryPage
+		record.CalendarID = base.CalendarID
+		record.ScheduleID = base.ScheduleID
+		record.TaskID = base.TaskID
+		record.SourceID = base.SourceID
+		record.Operation = base.Operation
+		record.ReferencePath = base.ReferencePath
+		record.ControlMode = base.ControlMode
+		record.PromptLang = base.PromptLang
+		record.PromptTranslated = base.PromptTranslated
+		record.PromptSent = base.PromptSent
+		record.NegativePrompt = base.NegativePrompt
+		record.EnhancedPrompt = base.EnhancedPrompt
+		record.FallbackFrom = base.FallbackFrom
+		record.Seed = result.Seed
+		record.Cost = cost
+		if nonProduction(base.Status) {
+			record.Status = base.Status
+			record.PlaygroundSession = base.PlaygroundSession
 		}
-
-		taskBody, _ := io.ReadAll(taskResp.Body)
-		taskResp.Body.Close()
-
-		var statusResp struct {
-			TaskStatus  string   `json:"task_status"`
-			OutputImages []string `json:"output_images"`
+		if err := createImageRecord(&record); err != nil {
+			return records, err
 		}
-		json.Unmarshal(taskBody, &statusResp)
-
-		if statusResp.TaskStatus == "SUCCEED" && len(statusResp.OutputImages) > 0 {
-			return downloadAndSave(p, "modelscope", statusResp.OutputImages[0])
-		} else if statusResp.TaskStatus == "FAILED" {
-			log.Printf("[%s] 任务失败: %s", p.Name, string(taskBody))
-			return nil
+		if !nonProduction(record.Status) {
+			queueConsistency(record)
 		}
-		log.Printf("[%s] 任务状态: %s", p.Name, statusResp.TaskStatus)
+		records = append(records, record)
 	}
+	return records, nil
+}
 
-	log.Printf("[%s] 任务超时", p.Name)
-	return nil
+// GenerateOptions 文生图的可选参数，不支持的平台忽略
+type GenerateOptions struct {
+	NegativePrompt string
+	Seed           *int64       // 为空时支持 seed 的平台随机生成一个并记录
+	Progress       progressFunc // 异步平台的任务状态和下载进度，异步生成任务用于推送给前端
 }
 
-// 下载并保存图片
-func downloadAndSave(p PlatformConfig, platform, imageURL string) *GenerateResult {
-	now := time.Now()
-	dateDir := now.Format("2006-01-02")
-	dir := filepath.Join(cfg.ImageGen.OutputDir, dateDir, platform)
-	os.MkdirAll(dir, 0755)
+// progressFunc 上报生成进度，stage 为 submitted、pending、running、downloading，percent 为 0-100
+type progressFunc func(stage string, percent int)
 
-	filename := fmt.Sprintf("%s.png", now.Format("150405"))
-	path := filepath.Join(dir, filename)
+func (f progressFunc) report(stage string, percent int) {
+	if f != nil {
+		f(stage, percent)
+	}
+}
 
-	// 下载图片
-	imgResp, err := http.Get(imageURL)
+// platformType 平台配置键对应的平台类型
+func platformType(platform string) string {
+	return cfg.Platforms[platform].Type
+}
+
+// generateImage 调用平台生成一张图片，失败时返回平台的错误信息
+func generateImage(ctx context.Context, platform, prompt, size, model string, opts GenerateOptions) (*GenerateResult, error) {
+	results, err := generateImages(ctx, platform, prompt, size, model, 1, opts)
 	if err != nil {
-		log.Printf("[%s] 下载失败: %v", p.Name, err)
-		return nil
+		return nil, err
 	}
-	defer imgResp.Body.Read(make([]byte, 0))
-	data, _ := io.ReadAll(imgResp.Body)
-	os.WriteFile(path, data, 0644)
+	return results[0], nil
+}
 
-	log.Printf("[%s] 生成成功: %s", p.Name, path)
-	return &GenerateResult{
-		Platform: p.Name,
-		Model:    p.Model,
-		Filename: filename,
-		FilePath: path,
-		Success:  true,
-	}
+// generateImages 调用平台生成 n 张图片，部分成功时返回已生成的图片
+// ctx 取消时停止排队、轮询和下载，返回 canceled 错误
+func generateImages(ctx context.Context, platform, prompt, size, model string, n int, opts GenerateOptions) ([]*GenerateResult, error) {
+	p, ok := cfg.Platforms[platform]
+	if !ok || !p.Enabled {
+		return nil, genError(ErrCodeInvalid, "平台不可用: %s", platform)
+	}
+	out, err := generator.Generate(ctx, p.Type, generator.GenerateRequest{
+		Platform:       platform,
+		Config:         p.generatorConfig(),
+		Prompt:         prompt,
+		Size:           size,
+		Model:          model,
+		N:              n,
+		NegativePrompt: opts.NegativePrompt,
+		Seed:           opts.Seed,
+		Progress:       opts.Progress,
+	})
+	return out.Images, err
 }
 
 // ========== 修复图片路径 ==========
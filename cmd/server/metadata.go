@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ========== 自定义元数据 ==========
+
+// 记录上的业务字段（如 campaign=618、designer=li）存在 metadata JSON 列中，新增字段不需要改表
+const (
+	maxMetadataKeys  = 32
+	maxMetadataValue = 255
+)
+
+var metadataKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// validateMetadataKey 键只允许字母、数字、下划线和短横线，同时保证可以安全地拼进 JSON 路径
+func validateMetadataKey(key string) error {
+	if !metadataKeyPattern.MatchString(key) {
+		return fmt.Errorf("元数据键只能包含字母、数字、_ 和 -，最长 64 个字符: %q", key)
+	}
+	return nil
+}
+
+// metadataPath 键对应的 JSON 路径，键名加引号避免 - 被当作运算符
+func metadataPath(key string) string {
+	return `$."` + key + `"`
+}
+
+// filterMetadata 按元数据键值筛选，所有条件同时满足；值为空时只要求存在该键
+func filterMetadata(query *gorm.DB, meta map[string]string) (*gorm.DB, error) {
+	for key, value := range meta {
+		if err := validateMetadataKey(key); err != nil {
+			return nil, err
+		}
+		if value == "" {
+			query = query.Where("JSON_CONTAINS_PATH(metadata, 'one', ?)", metadataPath(key))
+		} else {
+			query = query.Where("JSON_UNQUOTE(JSON_EXTRACT(metadata, ?)) = ?", metadataPath(key), value)
+		}
+	}
+	return query, nil
+}
+
+// mergeMetadata 按 JSON Merge Patch 合并：值为 null 删除该键，其他覆盖或新增
+func mergeMetadata(current map[string]string, patch map[string]*string) (map[string]string, error) {
+	merged := make(map[string]string, len(current)+len(patch))
+	for k, v := range current {
+		merged[k] = v
+	}
+	for k, v := range patch {
+		if err := validateMetadataKey(k); err != nil {
+			return nil, err
+		}
+		if v == nil {
+			delete(merged, k)
+			continue
+		}
+		if utf8.RuneCountInString(*v) > maxMetadataValue {
+			return nil, fmt.Errorf("元数据 %s 的值最长 %d 个字符", k, maxMetadataValue)
+		}
+		merged[k] = *v
+	}
+	if len(merged) > maxMetadataKeys {
+		return nil, fmt.Errorf("每张图片最多 %d 个元数据键", maxMetadataKeys)
+	}
+	return merged, nil
+}
+
+// ========== 自定义元数据 API ==========
+
+// patchImageMetadata PATCH /api/images/:id/metadata，请求体为 {"campaign": "618", "designer": null}，null 表示删除
+func patchImageMetadata(c *gin.Context) {
+	var patch map[string]*string
+	if err := c.ShouldBindJSON(&patch); err != nil {
+		c.JSON(400, gin.H{"error": "元数据应为字符串键值对: " + err.Error()})
+		return
+	}
+
+	var record ImageRecord
+	var merged map[string]string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// 锁住记录，并发修改不同的键时不会互相覆盖
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&record, c.Param("id")).Error; err != nil {
+			return err
+		}
+		var err error
+		if merged, err = mergeMetadata(record.Metadata, patch); err != nil {
+			return err
+		}
+		data, _ := json.Marshal(merged)
+		return tx.Model(&record).Update("metadata", string(data)).Error
+	})
+	if err == gorm.ErrRecordNotFound {
+		c.JSON(404, gin.H{"error": "图片不存在"})
+		return
+	}
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	changed := make([]string, 0, len(patch))
+	for k := range patch {
+		changed = append(changed, k)
+	}
+	sort.Strings(changed)
+	recordActivity("metadata_updated", record.ID, currentUser(c), strings.Join(changed, ","))
+	c.JSON(200, gin.H{"message": "success", "metadata": merged})
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ========== 指标推送 ==========
+
+// metricsWriter 生成 Prometheus 文本格式
+type metricsWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *metricsWriter) gauge(name, help string) {
+	fmt.Fprintf(&w.buf, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+}
+
+func (w *metricsWriter) sample(name string, labels map[string]string, value float64) {
+	w.buf.WriteString(name)
+	if len(labels) > 0 {
+		keys := make([]string, 0, len(labels))
+		for k := range labels {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		pairs := make([]string, len(keys))
+		for i, k := range keys {
+			v := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(labels[k])
+			pairs[i] = fmt.Sprintf(`%s="%s"`, k, v)
+		}
+		w.buf.WriteString("{" + strings.Join(pairs, ",") + "}")
+	}
+	fmt.Fprintf(&w.buf, " %g\n", value)
+}
+
+// collectDailyMetrics 当天（业务时区）的生成、审核、成本和发布计数
+func collectDailyMetrics() string {
+	date := today()
+	w := &metricsWriter{}
+
+	var byStatus []struct {
+		Platform string
+		Status   string
+		Count    int64
+		Cost     float64
+	}
+	db.Model(&ImageRecord{}).
+		Select("platform, status, COUNT(*) AS count, COALESCE(SUM(cost), 0) AS cost").
+		Where("date = ? AND status NOT IN ?", date, nonProductionStatuses).
+		Group("platform, status").Scan(&byStatus)
+	w.gauge("image_platform_images_today", "当天生成的图片数，按平台和状态")
+	for _, r := range byStatus {
+		w.sample("image_platform_images_today", map[string]string{"platform": r.Platform, "status": r.Status}, float64(r.Count))
+	}
+	w.gauge("image_platform_cost_today", "当天生成成本（元），按平台")
+	costs := map[string]float64{}
+	for _, r := range byStatus {
+		costs[r.Platform] += r.Cost
+	}
+	for plat, cost := range costs {
+		w.sample("image_platform_cost_today", map[string]string{"platform": plat}, cost)
+	}
+
+	var byError []struct {
+		ErrorCode string
+		Count     int64
+	}
+	db.Model(&ImageRecord{}).Select("error_code, COUNT(*) AS count").
+		Where("date = ? AND status = ?", date, "failed").Group("error_code").Scan(&byError)
+	w.gauge("image_platform_failures_today", "当天生成失败数，按错误分类")
+	for _, r := range byError {
+		w.sample("image_platform_failures_today", map[string]string{"error_code": r.ErrorCode}, float64(r.Count))
+	}
+
+	start, _ := time.ParseInLocation("2006-01-02", date, bizLoc)
+	var byPublish []struct {
+		Platform string
+		Status   string
+		Count    int64
+	}
+	db.Model(&PublishJob{}).Select("platform, status, COUNT(*) AS count").
+		Where("finished_at >= ?", start).Group("platform, status").Scan(&byPublish)
+	w.gauge("image_platform_publish_jobs_today", "当天结束的定时发布任务数，按发布平台和状态")
+	for _, r := range byPublish {
+		w.sample("image_platform_publish_jobs_today", map[string]string{"platform": r.Platform, "status": r.Status}, float64(r.Count))
+	}
+
+	var pending int64
+	db.Model(&ImageRecord{}).Where("status = ?", "pending").Count(&pending)
+	w.gauge("image_platform_pending_reviews", "待审核图片总数")
+	w.sample("image_platform_pending_reviews", nil, float64(pending))
+
+	queued := jobQueue.Len(context.Background(), queueGenerate)
+	w.gauge("image_platform_task_queue_length", "排队中的异步生成任务数")
+	w.sample("image_platform_task_queue_length", nil, float64(queued))
+
+	names, statuses := credentialSnapshot()
+	if len(names) > 0 {
+		w.gauge("image_platform_publish_credentials_ok", "发布平台 Cookie/Token 最近一次检测是否可用，1 为可用")
+		for _, name := range names {
+			ok := 0.0
+			if statuses[name].OK {
+				ok = 1
+			}
+			w.sample("image_platform_publish_credentials_ok", map[string]string{"platform": name}, ok)
+		}
+		w.gauge("image_platform_publish_credentials_checked_timestamp", "发布平台凭证最近一次检测的时间（Unix 秒）")
+		for _, name := range names {
+			w.sample("image_platform_publish_credentials_checked_timestamp", map[string]string{"platform": name}, float64(statuses[name].CheckedAt.Unix()))
+		}
+	}
+
+	if pauses := publishPauseSnapshot(); len(pauses) > 0 {
+		w.gauge("image_platform_publish_paused", "暂停发布的平台，1 为暂停中，错误预算触发时 source 为 system")
+		for _, p := range pauses {
+			w.sample("image_platform_publish_paused", map[string]string{"platform": p.Platform, "source": p.CreatedBy}, 1)
+		}
+	}
+
+	return w.buf.String()
+}
+
+// pushMetrics 推送一次指标
+// pushgateway 模式 PUT 到 /metrics/job/<job>/instance/<instance>，会替换该分组下的全部指标
+// import 模式 POST 文本到 url，适用于 VictoriaMetrics /api/v1/import/prometheus 等兼容接口
+func pushMetrics() error {
+	pc := cfg.Observability.Push
+	body := collectDailyMetrics()
+	method, target := http.MethodPost, pc.URL
+	if pc.Mode == "" || pc.Mode == "pushgateway" {
+		method = http.MethodPut
+		target = strings.TrimRight(pc.URL, "/") + "/metrics/job/" + url.PathEscape(pc.Job)
+		if pc.Instance != "" {
+			target += "/instance/" + url.PathEscape(pc.Instance)
+		}
+	}
+	req, err := http.NewRequest(method, target, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	if pc.Username != "" {
+		req.SetBasicAuth(pc.Username, pc.Password)
+	}
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(msg))
+	}
+	return nil
+}
+
+// runMetricsPusher 按 observability.push.interval 定期推送
+func runMetricsPusher() {
+	if !cfg.Observability.Push.Enabled || cfg.Observability.Push.URL == "" {
+		return
+	}
+	log.Printf("📊 指标推送已开启: %s 每 %d 秒", cfg.Observability.Push.URL, cfg.Observability.Push.Interval)
+	ticker := time.NewTicker(time.Duration(cfg.Observability.Push.Interval) * time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := pushMetrics(); err != nil {
+			log.Printf("📊 指标推送失败: %v", err)
+		}
+	}
+}
+
+// ========== 指标 API ==========
+
+// metricsPreview GET /api/admin/metrics，返回将要推送的指标文本
+func metricsPreview(c *gin.Context) {
+	c.Data(200, "text/plain; version=0.0.4; charset=utf-8", []byte(collectDailyMetrics()))
+}
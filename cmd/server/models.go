@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ========== 平台模型列表 ==========
+
+// staticModels 内置的常用模型列表，平台不提供查询接口或查询失败时使用
+func staticModels(p PlatformConfig) []string {
+	models := []string{}
+	if p.Model != "" {
+		models = append(models, p.Model)
+	}
+	switch p.Type {
+	case "siliconflow":
+		models = []string{"", "black-forest-labs/FLUX.1-schnell", "black-forest-labs/FLUX.1-dev", "Kwai-Kolors/Kolors", "Tongyi-MAI/Z-Image-Turbo"}
+	case "modelscope":
+		models = []string{"", "Tongyi-MAI/Z-Image-Turbo", "Kwai-Kolors/Kolors"}
+	case "aliyun":
+		models = []string{"", "wanx-v1"}
+	}
+	return models
+}
+
+// fetchProviderModels 调用平台的模型列表接口（OpenAI 兼容的 GET /models）
+func fetchProviderModels(p PlatformConfig) ([]string, error) {
+	var apiURL string
+	switch p.Type {
+	case "siliconflow":
+		apiURL = strings.TrimSuffix(p.URL, "/") + "/models?type=image"
+	case "openai":
+		apiURL = strings.TrimSuffix(p.URL, "/") + "/models"
+	case "modelscope":
+		apiURL = strings.TrimSuffix(p.URL, "/") + "/v1/models"
+	default:
+		return nil, fmt.Errorf("平台不支持模型查询")
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	req, _ := http.NewRequest("GET", apiURL, nil)
+	req.Header.Set("Authorization", "Bearer "+p.APIKey)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %w", err)
+	}
+
+	models := make([]string, 0, len(result.Data))
+	for _, m := range result.Data {
+		// OpenAI 返回全部模型，只保留图片模型
+		if p.Type == "openai" && !strings.HasPrefix(m.ID, "dall-e") && !strings.HasPrefix(m.ID, "gpt-image") {
+			continue
+		}
+		models = append(models, m.ID)
+	}
+	return models, nil
+}
+
+// ========== 模型列表 API ==========
+
+// listPlatformModels GET /api/platforms/:id/models，只返回模型列表，完整的能力见 /api/platforms/:id/capabilities
+func listPlatformModels(c *gin.Context) {
+	key := c.Param("id")
+	p, ok := cfg.Platforms[key]
+	if !ok || !p.Enabled {
+		c.JSON(404, gin.H{"error": "平台不存在或未启用"})
+		return
+	}
+
+	// 与平台能力共用缓存，?refresh=true 时重新查询
+	caps := capabilities(key, c.Query("refresh") == "true")
+	c.JSON(200, gin.H{
+		"platform": key,
+		"default":  p.Model,
+		"source":   caps.ModelSource, // config: 配置, provider: 平台接口, static: 内置列表
+		"models":   caps.Models,
+	})
+}
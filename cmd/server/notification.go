@@ -0,0 +1,157 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ========== 站内通知 ==========
+
+// Notification 发给某个用户的通知
+type Notification struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	User      string     `gorm:"size:100;index;not null" json:"user"`
+	Type      string     `gorm:"size:30;index" json:"type"` // review_assigned, image_rejected, publish_failed, policy_blocked, publish_paused, style_drift
+	Title     string     `gorm:"size:255" json:"title"`
+	Body      string     `gorm:"type:text" json:"body"`
+	ImageID   uint       `json:"image_id"`
+	Link      string     `gorm:"size:255" json:"link"`
+	Read      bool       `gorm:"index" json:"read"`
+	CreatedAt time.Time  `json:"created_at"`
+	ReadAt    *time.Time `json:"read_at"`
+}
+
+func (Notification) TableName() string {
+	return "notifications"
+}
+
+// notifyHub 在线用户的 SSE 订阅
+var notifyHub = struct {
+	sync.Mutex
+	subs map[string]map[chan Notification]struct{}
+}{subs: map[string]map[chan Notification]struct{}{}}
+
+func subscribeNotifications(user string) chan Notification {
+	ch := make(chan Notification, 16)
+	notifyHub.Lock()
+	if notifyHub.subs[user] == nil {
+		notifyHub.subs[user] = map[chan Notification]struct{}{}
+	}
+	notifyHub.subs[user][ch] = struct{}{}
+	notifyHub.Unlock()
+	return ch
+}
+
+func unsubscribeNotifications(user string, ch chan Notification) {
+	notifyHub.Lock()
+	delete(notifyHub.subs[user], ch)
+	if len(notifyHub.subs[user]) == 0 {
+		delete(notifyHub.subs, user)
+	}
+	notifyHub.Unlock()
+}
+
+// notify 保存通知并推送给在线的订阅，用户为空时忽略
+func notify(user, kind, title, body string, imageID uint, link string) {
+	if user == "" {
+		return
+	}
+	n := Notification{User: user, Type: kind, Title: title, Body: body, ImageID: imageID, Link: link}
+	if err := db.Create(&n).Error; err != nil {
+		return
+	}
+	notifyHub.Lock()
+	for ch := range notifyHub.subs[user] {
+		select {
+		case ch <- n:
+		default: // 客户端消费过慢时丢弃，刷新后可从列表补齐
+		}
+	}
+	notifyHub.Unlock()
+}
+
+// notifyReviewers 通知审核人有新的待审核内容，reviewers 为空时使用 notifications.reviewers
+func notifyReviewers(reviewers []string, title, body, link string) {
+	if len(reviewers) == 0 {
+		reviewers = cfg.Notifications.Reviewers
+	}
+	for _, r := range reviewers {
+		notify(r, "review_assigned", title, body, 0, link)
+	}
+}
+
+// ========== 通知 API ==========
+
+// notificationUser 通知接口的用户，只接受经过 API Key 绑定的 X-User，未识别时返回 401
+// 不能通过参数指定用户，否则任何人都可以读取别人的通知
+func notificationUser(c *gin.Context) (string, bool) {
+	user := currentUser(c)
+	if user == "" {
+		c.JSON(401, gin.H{"error": "请通过 X-API-Key 和 X-User 标识用户"})
+		return "", false
+	}
+	return user, true
+}
+
+func listNotifications(c *gin.Context) {
+	user, ok := notificationUser(c)
+	if !ok {
+		return
+	}
+	var items []Notification
+	query := db.Where("user = ?", user)
+	if c.Query("unread") == "1" {
+		query = query.Where("`read` = ?", false)
+	}
+	query.Order("id DESC").Limit(100).Find(&items)
+	var unread int64
+	db.Model(&Notification{}).Where("user = ? AND `read` = ?", user, false).Count(&unread)
+	c.JSON(200, gin.H{"notifications": items, "unread": unread})
+}
+
+func markNotificationRead(c *gin.Context) {
+	user, ok := notificationUser(c)
+	if !ok {
+		return
+	}
+	query := db.Model(&Notification{}).Where("user = ? AND `read` = ?", user, false)
+	if id := c.Param("id"); id != "" {
+		query = query.Where("id = ?", id)
+	}
+	res := query.Updates(map[string]interface{}{"read": true, "read_at": time.Now()})
+	c.JSON(200, gin.H{"message": "success", "updated": res.RowsAffected})
+}
+
+// streamNotifications GET /api/notifications/stream，SSE 推送新通知，连接时先推送未读数
+func streamNotifications(c *gin.Context) {
+	user, ok := notificationUser(c)
+	if !ok {
+		return
+	}
+	ch := subscribeNotifications(user)
+	defer unsubscribeNotifications(user, ch)
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no") // 关闭 nginx 缓冲
+	var unread int64
+	db.Model(&Notification{}).Where("user = ? AND `read` = ?", user, false).Count(&unread)
+	c.SSEvent("unread", gin.H{"unread": unread})
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(25 * time.Second)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case n := <-ch:
+			c.SSEvent("notification", n)
+			c.Writer.Flush()
+		case <-heartbeat.C:
+			c.SSEvent("ping", time.Now().Unix())
+			c.Writer.Flush()
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ========== 事件发件箱 ==========
+
+// OutboxEvent 领域事件，与业务数据在同一事务中写入，由后台异步投递
+type OutboxEvent struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	Type          string     `gorm:"size:50;index;not null" json:"type"`
+	Payload       string     `gorm:"type:text" json:"payload"`
+	Status        string     `gorm:"size:20;index;default:'pending'" json:"status"` // pending, delivered, failed
+	Attempts      int        `json:"attempts"`
+	LastError     string     `gorm:"type:text" json:"last_error"`
+	NextAttemptAt time.Time  `gorm:"index" json:"next_attempt_at"`
+	TargetURL     string     `gorm:"size:512" json:"target_url,omitempty"` // 只投递到该地址（任务回调），不经订阅的 Webhook
+	CreatedAt     time.Time  `json:"created_at"`
+	DeliveredAt   *time.Time `json:"delivered_at"`
+}
+
+func (OutboxEvent) TableName() string {
+	return "outbox_events"
+}
+
+// emitEvent 在事务 tx 中写入事件，事务回滚时事件一并丢弃
+func emitEvent(tx *gorm.DB, kind string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&OutboxEvent{
+		Type:          kind,
+		Payload:       string(data),
+		Status:        "pending",
+		NextAttemptAt: time.Now(),
+	}).Error
+}
+
+// emitCallback 写入只投递到 url 的事件，与订阅的 Webhook 使用同样的重试
+func emitCallback(tx *gorm.DB, url, kind string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&OutboxEvent{
+		Type:          kind,
+		Payload:       string(data),
+		Status:        "pending",
+		NextAttemptAt: time.Now(),
+		TargetURL:     url,
+	}).Error
+}
+
+// runOutboxDispatcher 定期投递待发送事件
+func runOutboxDispatcher() {
+	interval := time.Duration(cfg.Events.PollInterval) * time.Second
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		dispatchOutbox()
+	}
+}
+
+func dispatchOutbox() {
+	var events []OutboxEvent
+	query := db.Where("status = ? AND next_attempt_at <= ?", "pending", time.Now())
+	// 没有订阅的 Webhook 时只投递任务回调，其余事件保持待投递
+	if len(cfg.Events.Webhooks) == 0 {
+		query = query.Where("target_url <> ''")
+	}
+	query.Order("id").Limit(100).Find(&events)
+	for _, ev := range events {
+		err := deliverEvent(ev)
+		if err == nil {
+			now := time.Now()
+			db.Model(&OutboxEvent{}).Where("id = ?", ev.ID).Updates(map[string]interface{}{
+				"status": "delivered", "attempts": ev.Attempts + 1, "delivered_at": now, "last_error": ""})
+			continue
+		}
+
+		attempts := ev.Attempts + 1
+		updates := map[string]interface{}{"attempts": attempts, "last_error": err.Error()}
+		if attempts >= cfg.Events.MaxAttempts {
+			updates["status"] = "failed"
+			log.Printf("📮 事件 #%d (%s) 投递失败，已放弃: %v", ev.ID, ev.Type, err)
+		} else {
+			// 指数退避：10s, 20s, 40s ... 最长 1 小时
+			backoff := min(10*time.Second<<min(attempts-1, 10), time.Hour)
+			updates["next_attempt_at"] = time.Now().Add(backoff)
+		}
+		db.Model(&OutboxEvent{}).Where("id = ?", ev.ID).Updates(updates)
+	}
+}
+
+// deliverEvent 投递到所有订阅该事件类型的 Webhook，任一失败则整体重试
+// 重试时已成功的目标会再次收到，接收方应按 X-Event-ID 去重
+func deliverEvent(ev OutboxEvent) error {
+	body, _ := json.Marshal(map[string]interface{}{
+		"id":         ev.ID,
+		"type":       ev.Type,
+		"created_at": ev.CreatedAt,
+		"data":       json.RawMessage(ev.Payload),
+	})
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	if ev.TargetURL != "" {
+		return postEvent(client, ev, ev.TargetURL, cfg.Events.CallbackSecret, body)
+	}
+	for _, hook := range cfg.Events.Webhooks {
+		if !hook.subscribes(ev.Type) {
+			continue
+		}
+		if err := postEvent(client, ev, hook.URL, hook.Secret, body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// postEvent 投递到一个地址，配置了 secret 时带 X-Signature 签名
+func postEvent(client *http.Client, ev OutboxEvent, url, secret string, body []byte) error {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%s: %w", url, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-ID", fmt.Sprint(ev.ID))
+	req.Header.Set("X-Event-Type", ev.Type)
+	if secret != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		req.Header.Set("X-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", url, err)
+	}
+	respBody, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s: HTTP %d %s", url, resp.StatusCode, string(respBody))
+	}
+	return nil
+}
+
+func (h WebhookConfig) subscribes(kind string) bool {
+	if len(h.Types) == 0 {
+		return true
+	}
+	for _, t := range h.Types {
+		if t == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// ========== 发件箱管理 API ==========
+func listOutboxEvents(c *gin.Context) {
+	var events []OutboxEvent
+	query := db.Model(&OutboxEvent{})
+	if s := c.Query("status"); s != "" {
+		query = query.Where("status = ?", s)
+	}
+	query.Order("id DESC").Limit(100).Find(&events)
+	c.JSON(200, gin.H{"events": events, "total": len(events)})
+}
+
+// retryOutboxEvent 将失败事件重新放回待投递
+func retryOutboxEvent(c *gin.Context) {
+	res := db.Model(&OutboxEvent{}).Where("id = ? AND status = ?", c.Param("id"), "failed").Updates(map[string]interface{}{
+		"status": "pending", "attempts": 0, "next_attempt_at": time.Now()})
+	if res.RowsAffected == 0 {
+		c.JSON(409, gin.H{"error": "事件不存在或未失败"})
+		return
+	}
+	c.JSON(200, gin.H{"message": "success"})
+}
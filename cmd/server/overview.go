@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"io/fs"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ========== 运维总览 ==========
+
+// 遍历图片目录较慢，磁盘占用缓存 5 分钟
+const storageTTL = 5 * time.Minute
+
+var (
+	storageMu      sync.Mutex
+	storageCache   gin.H
+	storageChecked time.Time
+)
+
+// storageUsage 图片目录的文件数和磁盘占用，以及数据库记录的图片大小合计
+func storageUsage() gin.H {
+	storageMu.Lock()
+	defer storageMu.Unlock()
+	if storageCache != nil && time.Since(storageChecked) < storageTTL {
+		return storageCache
+	}
+	var files, bytes int64
+	filepath.WalkDir(cfg.ImageGen.OutputDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			files++
+			bytes += info.Size()
+		}
+		return nil
+	})
+	var recorded int64
+	db.Model(&ImageRecord{}).Select("COALESCE(SUM(file_size), 0)").Scan(&recorded)
+	storageCache = gin.H{
+		"dir":            cfg.ImageGen.OutputDir,
+		"files":          files,
+		"bytes":          bytes,
+		"recorded_bytes": recorded,
+		"checked_at":     time.Now(),
+	}
+	storageChecked = time.Now()
+	return storageCache
+}
+
+// providerHealth 各已启用平台最近 24 小时的生成结果、最近一次失败和余额
+func providerHealth() gin.H {
+	since := time.Now().Add(-24 * time.Hour)
+	var rows []struct {
+		PlatformID string
+		Status     string
+		Count      int64
+	}
+	db.Model(&ImageRecord{}).Select("platform_id, status, COUNT(*) AS count").
+		Where("generated_at >= ? AND platform_id <> ''", since).Group("platform_id, status").Scan(&rows)
+	balances := getBalances()
+	breakers := breakerStates()
+
+	health := gin.H{}
+	for key, p := range getEnabledPlatforms() {
+		var succeeded, failed int64
+		for _, r := range rows {
+			if r.PlatformID != key {
+				continue
+			}
+			if r.Status == "failed" {
+				failed += r.Count
+			} else {
+				succeeded += r.Count
+			}
+		}
+		status := "ok"
+		if total := succeeded + failed; total > 0 && failed*2 >= total {
+			status = "degraded"
+		}
+		if succeeded == 0 && failed > 0 {
+			status = "down"
+		}
+		h := gin.H{"name": p.Name, "status": status, "succeeded_24h": succeeded, "failed_24h": failed}
+		var last ImageRecord
+		if db.Where("platform_id = ? AND status = ?", key, "failed").Order("id DESC").Limit(1).Find(&last).RowsAffected > 0 {
+			h["last_failure"] = gin.H{"id": last.ID, "error_code": last.ErrorCode, "error": last.Error, "at": last.GeneratedAt}
+		}
+		if b, ok := balances[key]; ok {
+			h["balance"] = b
+		}
+		if b, ok := breakers[key]; ok && b.State != "closed" {
+			h["status"] = "down"
+			h["breaker"] = b.State
+		}
+		health[key] = h
+	}
+	return health
+}
+
+// queueDepths 生成任务、审核、发布和事件投递的积压情况
+func queueDepths() gin.H {
+	running := 0
+	taskMu.Lock()
+	for _, t := range tasks {
+		if t.Status == "running" {
+			running++
+		}
+	}
+	taskMu.Unlock()
+
+	var pendingReview, publishPending, outboxPending, outboxFailed int64
+	db.Model(&ImageRecord{}).Where("status = ?", "pending").Count(&pendingReview)
+	db.Model(&PublishJob{}).Where("status = ?", "pending").Count(&publishPending)
+	db.Model(&OutboxEvent{}).Where("status = ?", "pending").Count(&outboxPending)
+	db.Model(&OutboxEvent{}).Where("status = ?", "failed").Count(&outboxFailed)
+	return gin.H{
+		"tasks_queued":    jobQueue.Len(context.Background(), queueGenerate),
+		"tasks_running":   running,
+		"gen_running":     genRunning.Load(), // 正在调用平台的生成
+		"gen_waiting":     genWaiting.Load(), // 等待并发名额的生成
+		"pending_review":  pendingReview,
+		"publish_pending": publishPending,
+		"outbox_pending":  outboxPending,
+		"outbox_failed":   outboxFailed,
+	}
+}
+
+// ========== 运维总览 API ==========
+
+// adminOverview GET /api/admin/overview，运维看板一次请求获取系统状态
+func adminOverview(c *gin.Context) {
+	var counts []struct {
+		Status string
+		Count  int64
+		Cost   float64
+	}
+	db.Model(&ImageRecord{}).Select("status, COUNT(*) AS count, COALESCE(SUM(cost), 0) AS cost").
+		Where("date = ? AND status NOT IN ?", today(), nonProductionStatuses).Group("status").Scan(&counts)
+	todayStats := gin.H{"total": 0, "cost": 0.0}
+	var total int64
+	var cost float64
+	for _, r := range counts {
+		todayStats[r.Status] = r.Count
+		total += r.Count
+		cost += r.Cost
+	}
+	todayStats["total"], todayStats["cost"] = total, cost
+
+	var failures []ImageRecord
+	db.Where("status = ?", "failed").Order("id DESC").Limit(10).Find(&failures)
+	var publishFailures []PublishJob
+	db.Where("status = ?", "failed").Order("finished_at DESC").Limit(10).Find(&publishFailures)
+	var upcoming []PublishJob
+	db.Where("status = ?", "pending").Order("scheduled_at").Limit(10).Find(&upcoming)
+
+	c.JSON(200, gin.H{
+		"date":               today(),
+		"queues":             queueDepths(),
+		"today":              todayStats,
+		"providers":          providerHealth(),
+		"storage":            storageUsage(),
+		"recent_failures":    failures,
+		"publish_failures":   publishFailures,
+		"upcoming_publishes": upcoming,
+		"generated_at":       time.Now(),
+	})
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ========== 生成记录永久链接 ==========
+
+// permalinkKey 签名永久链接的密钥：server.permalinkSecret > 管理令牌 > 启动时随机生成（重启后旧链接失效）
+var permalinkKey []byte
+
+func initPermalinks() {
+	switch {
+	case cfg.Server.PermalinkSecret != "":
+		permalinkKey = []byte(cfg.Server.PermalinkSecret)
+	case cfg.Server.AdminToken != "":
+		permalinkKey = []byte("permalink:" + cfg.Server.AdminToken)
+	default:
+		permalinkKey = []byte(newToken())
+		if !cfg.Server.PublicPermalinks {
+			log.Printf("⚠️ 未配置 server.permalinkSecret，记录链接在重启后失效")
+		}
+	}
+}
+
+// permalinkToken 记录链接的签名，同一记录的链接不变，无需入库
+func permalinkToken(id uint) string {
+	mac := hmac.New(sha256.New, permalinkKey)
+	mac.Write([]byte("record:" + strconv.FormatUint(uint64(id), 10)))
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// permalinkPath 记录页面的路径，开启 server.publicPermalinks 时不带签名
+func permalinkPath(id uint) string {
+	path := "/record/" + strconv.FormatUint(uint64(id), 10)
+	if cfg.Server.PublicPermalinks {
+		return path
+	}
+	return path + "?t=" + permalinkToken(id)
+}
+
+// ========== 永久链接 API ==========
+
+// getPermalink GET /api/images/:id/permalink
+func getPermalink(c *gin.Context) {
+	var record ImageRecord
+	if err := db.Select("id").First(&record, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{"error": "图片不存在"})
+		return
+	}
+	c.JSON(200, gin.H{"id": record.ID, "url": publicURL(c, permalinkPath(record.ID)), "public": cfg.Server.PublicPermalinks})
+}
+
+// recordPage GET /record/:id?t=，只读的生成记录页面，?format=json 返回 JSON
+func recordPage(c *gin.Context) {
+	notFound := func() {
+		if c.Query("format") == "json" {
+			c.JSON(404, gin.H{"error": "记录不存在或链接无效"})
+		} else {
+			c.String(http.StatusNotFound, "记录不存在或链接无效")
+		}
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		notFound()
+		return
+	}
+	if !cfg.Server.PublicPermalinks && !hmac.Equal([]byte(c.Query("t")), []byte(permalinkToken(uint(id)))) {
+		notFound()
+		return
+	}
+	var record ImageRecord
+	if err := db.First(&record, id).Error; err != nil {
+		notFound()
+		return
+	}
+
+	// 对外只暴露必要字段，不含用户、API Key 和审核备注
+	type receipt struct {
+		ID          uint      `json:"id"`
+		ImageURL    string    `json:"imageUrl,omitempty"`
+		Prompt      string    `json:"prompt"`
+		Platform    string    `json:"platform"`
+		Model       string    `json:"model"`
+		Size        string    `json:"size"`
+		Seed        *int64    `json:"seed,omitempty"`
+		Category    string    `json:"category,omitempty"`
+		Status      string    `json:"status"`
+		Error       string    `json:"error,omitempty"`
+		ErrorCode   string    `json:"error_code,omitempty"`
+		GeneratedAt time.Time `json:"generated_at"`
+	}
+	r := receipt{
+		ID: record.ID, Prompt: record.Prompt, Platform: record.Platform, Model: record.Model, Size: record.Size,
+		Seed: record.Seed, Category: record.Category, Status: record.Status, Error: record.Error,
+		ErrorCode: record.ErrorCode, GeneratedAt: record.GeneratedAt,
+	}
+	if record.Status != "failed" && record.Path != "" {
+		r.ImageURL = imageURL(record.Path)
+	}
+
+	if c.Query("format") == "json" {
+		c.JSON(200, r)
+		return
+	}
+	c.HTML(http.StatusOK, "record.html", gin.H{"record": r})
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ========== 待审核置顶 ==========
+
+// orderPending 待审核列表的排序：置顶的记录排在最前，先置顶的在前，之后按调用方的排序
+func orderPending(query *gorm.DB) *gorm.DB {
+	return query.Order("pinned DESC").Order("pinned_at")
+}
+
+// ========== 待审核置顶 API ==========
+
+// pinImage POST /api/images/:id/pin，只能置顶待审核的记录
+func pinImage(c *gin.Context) {
+	var record ImageRecord
+	if err := db.First(&record, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{"error": "图片不存在"})
+		return
+	}
+	if record.Status != "pending" {
+		c.JSON(400, gin.H{"error": "只能置顶待审核的图片"})
+		return
+	}
+	if !record.Pinned {
+		now := time.Now()
+		db.Model(&record).Updates(map[string]interface{}{"pinned": true, "pinned_at": now})
+		recordActivity("pinned", record.ID, currentUser(c), "")
+	}
+	c.JSON(200, gin.H{"message": "success"})
+}
+
+// unpinImage DELETE /api/images/:id/pin
+func unpinImage(c *gin.Context) {
+	var record ImageRecord
+	if err := db.First(&record, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{"error": "图片不存在"})
+		return
+	}
+	if record.Pinned {
+		db.Model(&record).Updates(map[string]interface{}{"pinned": false, "pinned_at": nil})
+		recordActivity("unpinned", record.ID, currentUser(c), "")
+	}
+	c.JSON(200, gin.H{"message": "success"})
+}
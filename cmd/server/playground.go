@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ========== 试验场 ==========
+
+// PlaygroundConfig 试验场生成：status=playground，单独目录保存，到期自动删除，不进入审核队列和统计
+type PlaygroundConfig struct {
+	OutputDir string `yaml:"outputDir"` // 默认 imageGen.outputDir/playground
+	TTLHours  int    `yaml:"ttlHours"`  // 保留小时数，默认 24
+}
+
+// nonProductionStatuses 不计入报表和统计的记录状态：压测和试验场
+var nonProductionStatuses = []string{"loadtest", "playground"}
+
+// nonProduction 记录是否为压测或试验场记录，这类记录不进入审核队列，不发出生成事件
+func nonProduction(status string) bool {
+	return status == "loadtest" || status == "playground"
+}
+
+// playgroundDir 试验场图片目录
+func playgroundDir() string {
+	if cfg.Playground.OutputDir != "" {
+		return cfg.Playground.OutputDir
+	}
+	return filepath.Join(cfg.ImageGen.OutputDir, "playground")
+}
+
+// playgroundPath 试验场记录的文件位置，按会话分目录，不使用路径模板
+func playgroundPath(record *ImageRecord) string {
+	return filepath.Join(playgroundDir(), pathSegment(record.PlaygroundSession), record.Name)
+}
+
+// runPlaygroundCleaner 每小时删除过期的试验场记录和图片
+func runPlaygroundCleaner() {
+	purgePlayground()
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for range ticker.C {
+		purgePlayground()
+	}
+}
+
+func purgePlayground() {
+	cutoff := time.Now().Add(-time.Duration(cfg.Playground.TTLHours) * time.Hour)
+	var records []ImageRecord
+	db.Select("id", "path").Where("status = ? AND generated_at < ?", "playground", cutoff).Find(&records)
+	if len(records) == 0 {
+		return
+	}
+	ids := make([]uint, len(records))
+	for i, r := range records {
+		ids[i] = r.ID
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id IN ? AND status = ?", ids, "playground").Delete(&ImageRecord{}).Error; err != nil {
+			return err
+		}
+		return deleteImageLabels(tx, ids)
+	})
+	if err != nil {
+		log.Printf("[试验场] 清理失败: %v", err)
+		return
+	}
+	for _, r := range records {
+		if r.Path != "" {
+			os.Remove(r.Path)
+		}
+	}
+	log.Printf("[试验场] 清理 %d 条过期记录", len(records))
+}
+
+// ========== 试验场 API ==========
+
+// listPlayground GET /api/playground?session=，当前调用方的试验场记录，未指定会话时返回全部会话
+func listPlayground(c *gin.Context) {
+	query := db.Where("status = ? AND user = ?", "playground", currentUser(c))
+	if session := c.Query("session"); session != "" {
+		query = query.Where("playground_session = ?", session)
+	}
+	var records []ImageRecord
+	query.Order("generated_at DESC").Limit(200).Find(&records)
+	// 到期时间为 generated_at 加 ttl_hours
+	c.JSON(200, gin.H{"records": withImageURLs(records), "total": len(records), "ttl_hours": cfg.Playground.TTLHours})
+}
+
+// promotePlayground POST /api/playground/:id/promote，把满意的试验结果转为正式记录进入审核队列，图片移出试验场目录
+func promotePlayground(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	var record ImageRecord
+	if err := db.Where("id = ? AND status = ?", id, "playground").First(&record).Error; err != nil {
+		c.JSON(404, gin.H{"error": "试验场记录不存在或已过期"})
+		return
+	}
+	if record.User != currentUser(c) {
+		c.JSON(403, gin.H{"error": "只能转正自己的试验场记录"})
+		return
+	}
+	old := record.Path
+	err := db.Transaction(func(tx *gorm.DB) error {
+		record.Status, record.PlaygroundSession = "pending", ""
+		// 按路径模板和文件名策略确定正式位置，都未配置时放回默认的日期目录
+		path := templatedPath(&record)
+		if path == "" {
+			name := recordFilename(&record)
+			if name == "" {
+				name = record.Name
+			}
+			path = filepath.Join(cfg.ImageGen.OutputDir, record.Date, name)
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("创建目录失败: %v", err)
+		}
+		moved, err := moveImageFile(old, path)
+		if err != nil {
+			return fmt.Errorf("移动图片失败: %v", err)
+		}
+		record.Path, record.Name = moved, filepath.Base(moved)
+		updates := map[string]interface{}{"status": "pending", "playground_session": "", "path": record.Path, "name": record.Name}
+		if err := tx.Model(&record).Updates(updates).Error; err != nil {
+			os.Rename(moved, old)
+			return err
+		}
+		return emitEvent(tx, "image.generated", record)
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	recordActivity("promoted", record.ID, currentUser(c), "试验场转正")
+	queueConsistency(record)
+	c.JSON(200, gin.H{"message": "success", "image": withImageURLs([]ImageRecord{record})[0]})
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ========== 内容策略 ==========
+
+// PolicyKeyword 数据库维护的敏感词，与配置文件中的词表合并使用
+type PolicyKeyword struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Keyword   string    `gorm:"size:100;uniqueIndex;not null" json:"keyword"`
+	Action    string    `gorm:"size:20;default:'reject'" json:"action"` // reject, flag
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (PolicyKeyword) TableName() string {
+	return "policy_keywords"
+}
+
+// policyVerdict 提示词检查结果
+type policyVerdict struct {
+	Blocked  bool   // 拒绝生成
+	Reason   string // 拒绝原因
+	Flag     string // 放行但标记的敏感词
+	Source   string // 拒绝依据：keyword 禁用词表，provider 生成平台词表，publish 发布平台词表，llm 大模型判断
+	Keyword  string // 命中的词
+	Platform string // 命中的生成平台或发布平台
+}
+
+// response 拒绝生成时返回给调用方的 422 内容
+func (v policyVerdict) response() gin.H {
+	h := gin.H{"error": "提示词不符合内容策略", "code": "prompt_blocked", "reason": v.Reason, "source": v.Source}
+	if v.Keyword != "" {
+		h["keyword"] = v.Keyword
+	}
+	if v.Platform != "" {
+		h["platform"] = v.Platform
+	}
+	return h
+}
+
+// validatePolicy 启动时检查按平台配置的词表，平台 ID 写错时词表不会生效
+func validatePolicy() error {
+	for plat := range cfg.Policy.Providers {
+		if _, ok := cfg.Platforms[plat]; !ok {
+			return fmt.Errorf("policy.providers 中的平台不存在: %s", plat)
+		}
+	}
+	return nil
+}
+
+// matchKeyword 返回 words 中第一个出现在 lower 中的词
+func matchKeyword(lower string, words []string) string {
+	for _, kw := range words {
+		if kw != "" && strings.Contains(lower, strings.ToLower(kw)) {
+			return kw
+		}
+	}
+	return ""
+}
+
+// checkPromptPolicy 生成前检查提示词，在调用平台之前拒绝大概率被平台拦截的提示词：
+// 依次匹配禁用词表和 platforms 各自的词表，再按需调用 LLM；发布平台的规则见 checkPublishPolicy
+func checkPromptPolicy(ctx context.Context, prompt string, platforms ...string) policyVerdict {
+	if !cfg.Policy.Enabled {
+		return policyVerdict{}
+	}
+
+	reject := append([]string{}, cfg.Policy.Keywords...)
+	flag := append([]string{}, cfg.Policy.Sensitive...)
+	var keywords []PolicyKeyword
+	db.Find(&keywords)
+	for _, k := range keywords {
+		if k.Action == "flag" {
+			flag = append(flag, k.Keyword)
+		} else {
+			reject = append(reject, k.Keyword)
+		}
+	}
+
+	lower := strings.ToLower(prompt)
+	if kw := matchKeyword(lower, reject); kw != "" {
+		return policyVerdict{Blocked: true, Reason: "包含禁用词: " + kw, Source: "keyword", Keyword: kw}
+	}
+	for _, plat := range platforms {
+		if kw := matchKeyword(lower, cfg.Policy.Providers[plat]); kw != "" {
+			return policyVerdict{Blocked: true, Reason: fmt.Sprintf("%s 会拒绝包含「%s」的提示词，请修改提示词或换平台", cfg.Platforms[plat].Name, kw),
+				Source: "provider", Keyword: kw, Platform: plat}
+		}
+	}
+
+	var verdict policyVerdict
+	var hits []string
+	for _, kw := range flag {
+		if kw != "" && strings.Contains(lower, strings.ToLower(kw)) {
+			hits = append(hits, kw)
+		}
+	}
+	verdict.Flag = strings.Join(hits, ",")
+
+	if cfg.Policy.LLMCheck {
+		if reason, ok := llmPolicyCheck(ctx, prompt, platforms); !ok {
+			return policyVerdict{Blocked: true, Reason: reason, Source: "llm"}
+		}
+	}
+	return verdict
+}
+
+// checkPublishPolicy 按发布平台的规则检查文本，只在请求指定了发布平台时使用
+func checkPublishPolicy(text string, targets ...string) policyVerdict {
+	if !cfg.Policy.Enabled {
+		return policyVerdict{}
+	}
+	lower := strings.ToLower(text)
+	for _, name := range targets {
+		if kw := matchKeyword(lower, cfg.Policy.Publish[name]); kw != "" {
+			return policyVerdict{Blocked: true, Reason: fmt.Sprintf("%s 的发布规则不允许「%s」", name, kw),
+				Source: "publish", Keyword: kw, Platform: name}
+		}
+	}
+	return policyVerdict{}
+}
+
+// llmPolicyCheck 让 LLM 判断提示词是否可能违规，调用失败时放行
+func llmPolicyCheck(ctx context.Context, prompt string, platforms []string) (string, bool) {
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	defer cancel()
+
+	var extra strings.Builder
+	if len(platforms) > 0 {
+		names := make([]string, len(platforms))
+		for i, plat := range platforms {
+			names[i] = cfg.Platforms[plat].Name
+		}
+		fmt.Fprintf(&extra, "\n图片将由 %s 生成，按这些服务的内容政策判断。", strings.Join(names, "、"))
+	}
+	if len(cfg.Policy.Rules) > 0 {
+		extra.WriteString("\n另外需遵守以下规则，违反任意一条也视为不安全：")
+		for _, rule := range cfg.Policy.Rules {
+			extra.WriteString("\n- " + rule)
+		}
+	}
+	question := fmt.Sprintf(`你是图片生成平台的内容审核员。判断下面的图片提示词是否涉及色情、暴力、政治敏感、侵权或其他可能被图片生成服务拒绝的内容。%s
+只回复一行：安全则回复 SAFE，不安全则回复 UNSAFE: 原因。
+
+提示词：%s`, extra.String(), prompt)
+
+	answer, err := callLLM(ctx, question)
+	if err != nil {
+		log.Printf("[内容策略] LLM 检查失败，已放行: %v", err)
+		return "", true
+	}
+	answer = strings.TrimSpace(answer)
+	if strings.HasPrefix(strings.ToUpper(answer), "UNSAFE") {
+		reason := strings.TrimSpace(strings.TrimLeft(answer[len("UNSAFE"):], ":： "))
+		if reason == "" {
+			reason = "LLM 判定不安全"
+		}
+		return reason, false
+	}
+	return "", true
+}
+
+// ========== 平台拦截的提示词 ==========
+
+// PolicyCandidate 被平台按内容策略拒绝的提示词，管理员确认后把其中的词加入敏感词表，之后在生成前就拦截
+type PolicyCandidate struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Prompt      string    `gorm:"size:1000;not null" json:"prompt"`
+	Platform    string    `gorm:"size:50" json:"platform"`
+	Reason      string    `gorm:"size:500" json:"reason"`      // 平台给出的原因
+	Suggestions string    `gorm:"size:255" json:"suggestions"` // LLM 推测的触发词，逗号分隔
+	Hits        int       `gorm:"default:1" json:"hits"`       // 同一提示词被拦截的次数
+	ImageID     uint      `json:"image_id"`                    // 最近一次的失败记录
+	User        string    `gorm:"size:100" json:"user"`
+	Status      string    `gorm:"size:20;default:'pending';index" json:"status"` // pending, accepted, dismissed
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func (PolicyCandidate) TableName() string {
+	return "policy_candidates"
+}
+
+// handlePolicyRejection 平台拦截提示词后通知请求人，并把提示词加入待确认列表
+func handlePolicyRejection(record *ImageRecord, reason string) {
+	notify(record.User, "policy_blocked", "提示词被平台拦截",
+		fmt.Sprintf("%s 拒绝了提示词「%s」: %s", record.Platform, truncateRunes(record.Prompt, 50), reason),
+		record.ID, fmt.Sprintf("/record/%d", record.ID))
+
+	reason = truncateRunes(reason, 500)
+	var candidate PolicyCandidate
+	err := db.Where("prompt = ? AND status = ?", record.Prompt, "pending").First(&candidate).Error
+	if err == nil {
+		db.Model(&candidate).Updates(map[string]interface{}{
+			"hits": gorm.Expr("hits + 1"), "reason": reason, "image_id": record.ID, "platform": record.PlatformID})
+		return
+	}
+	candidate = PolicyCandidate{Prompt: record.Prompt, Platform: record.PlatformID, Reason: reason, Hits: 1, ImageID: record.ID, User: record.User, Status: "pending"}
+	if err := db.Create(&candidate).Error; err != nil {
+		log.Printf("[内容策略] 保存被拦截的提示词失败: %v", err)
+		return
+	}
+	if cfg.LLM.URL != "" {
+		go suggestPolicyKeywords(candidate)
+	}
+}
+
+// suggestPolicyKeywords 让 LLM 从提示词中找出可能触发拦截的词，只保留原文中出现的词
+func suggestPolicyKeywords(candidate PolicyCandidate) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	answer, err := callLLM(ctx, fmt.Sprintf(`下面的图片提示词被图片生成平台以内容策略为由拒绝，平台给出的原因是：%s
+找出提示词中最可能触发拦截的词语，最多 3 个，必须是提示词中原样出现的词，用英文逗号分隔，只输出词语。
+
+提示词：%s`, candidate.Reason, candidate.Prompt))
+	if err != nil {
+		log.Printf("[内容策略] 推测触发词失败: %v", err)
+		return
+	}
+	var words []string
+	for _, w := range strings.FieldsFunc(answer, func(r rune) bool { return r == ',' || r == '，' || r == '、' || r == '\n' }) {
+		w = strings.TrimSpace(w)
+		if w != "" && strings.Contains(strings.ToLower(candidate.Prompt), strings.ToLower(w)) {
+			words = append(words, w)
+		}
+	}
+	if len(words) > 0 {
+		db.Model(&candidate).Update("suggestions", truncateRunes(strings.Join(words, ","), 255))
+	}
+}
+
+// truncateRunes 按字符截断
+func truncateRunes(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n])
+}
+
+// ========== 提示词预检 API ==========
+
+// checkPrompt POST /api/prompts/check，只做生成前检查，不生成；platform 为空时只检查通用规则，publish 指定时同时检查这些发布平台的规则
+func checkPrompt(c *gin.Context) {
+	var req struct {
+		Prompt   string   `json:"prompt" binding:"required"`
+		Platform string   `json:"platform"`
+		Publish  []string `json:"publish"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	var platforms []string
+	if req.Platform != "" {
+		if _, ok := cfg.Platforms[req.Platform]; !ok {
+			c.JSON(400, gin.H{"error": "平台不存在: " + req.Platform})
+			return
+		}
+		platforms = []string{req.Platform}
+	}
+	verdict := checkPublishPolicy(req.Prompt, req.Publish...)
+	if !verdict.Blocked {
+		verdict = checkPromptPolicy(c.Request.Context(), req.Prompt, platforms...)
+	}
+	if verdict.Blocked {
+		h := verdict.response()
+		h["allowed"] = false
+		c.JSON(200, h)
+		return
+	}
+	c.JSON(200, gin.H{"allowed": true, "flag": verdict.Flag, "enabled": cfg.Policy.Enabled})
+}
+
+// ========== 敏感词管理 API ==========
+
+func listPolicyKeywords(c *gin.Context) {
+	var keywords []PolicyKeyword
+	db.Order("id DESC").Find(&keywords)
+	c.JSON(200, gin.H{
+		"keywords":  keywords,
+		"config":    cfg.Policy.Keywords,
+		"sensitive": cfg.Policy.Sensitive,
+	})
+}
+
+func addPolicyKeyword(c *gin.Context) {
+	var req struct {
+		Keyword string `json:"keyword" binding:"required"`
+		Action  string `json:"action"` // reject（默认）, flag
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Action == "" {
+		req.Action = "reject"
+	}
+	if req.Action != "reject" && req.Action != "flag" {
+		c.JSON(400, gin.H{"error": "action 仅支持 reject 或 flag"})
+		return
+	}
+	kw := PolicyKeyword{Keyword: strings.TrimSpace(req.Keyword), Action: req.Action}
+	if err := db.Create(&kw).Error; err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, kw)
+}
+
+func deletePolicyKeyword(c *gin.Context) {
+	db.Delete(&PolicyKeyword{}, c.Param("id"))
+	c.JSON(200, gin.H{"message": "success"})
+}
+
+// listPolicyCandidates GET /api/admin/policy/candidates?status=，被平台拦截的提示词，默认只列出待确认的
+func listPolicyCandidates(c *gin.Context) {
+	status := c.DefaultQuery("status", "pending")
+	var candidates []PolicyCandidate
+	db.Where("status = ?", status).Order("hits DESC, updated_at DESC").Limit(200).Find(&candidates)
+	c.JSON(200, gin.H{"candidates": candidates, "total": len(candidates)})
+}
+
+// acceptPolicyCandidate POST /api/admin/policy/candidates/:id/accept，把选定的词加入敏感词表，
+// keywords 为空时使用 LLM 推测的触发词
+func acceptPolicyCandidate(c *gin.Context) {
+	var req struct {
+		Keywords []string `json:"keywords"`
+		Action   string   `json:"action"` // reject（默认）, flag
+	}
+	c.ShouldBindJSON(&req)
+	if req.Action == "" {
+		req.Action = "reject"
+	}
+	if req.Action != "reject" && req.Action != "flag" {
+		c.JSON(400, gin.H{"error": "action 仅支持 reject 或 flag"})
+		return
+	}
+	var candidate PolicyCandidate
+	if err := db.First(&candidate, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{"error": "记录不存在"})
+		return
+	}
+	if candidate.Status != "pending" {
+		c.JSON(400, gin.H{"error": "已处理过的记录"})
+		return
+	}
+	if len(req.Keywords) == 0 && candidate.Suggestions != "" {
+		req.Keywords = strings.Split(candidate.Suggestions, ",")
+	}
+	var keywords []PolicyKeyword
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, kw := range req.Keywords {
+			if kw = strings.TrimSpace(kw); kw == "" {
+				continue
+			}
+			k := PolicyKeyword{Keyword: kw, Action: req.Action}
+			if err := tx.Where(PolicyKeyword{Keyword: kw}).FirstOrCreate(&k).Error; err != nil {
+				return err
+			}
+			keywords = append(keywords, k)
+		}
+		if len(keywords) == 0 {
+			return fmt.Errorf("请指定要加入词表的词")
+		}
+		return tx.Model(&candidate).Update("status", "accepted").Error
+	})
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"message": "success", "keywords": keywords})
+}
+
+// dismissPolicyCandidate POST /api/admin/policy/candidates/:id/dismiss，误拦截或无法提取词语时忽略
+func dismissPolicyCandidate(c *gin.Context) {
+	res := db.Model(&PolicyCandidate{}).Where("id = ? AND status = ?", c.Param("id"), "pending").Update("status", "dismissed")
+	if res.RowsAffected == 0 {
+		c.JSON(404, gin.H{"error": "记录不存在或已处理"})
+		return
+	}
+	c.JSON(200, gin.H{"message": "success"})
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// ========== 生成并发控制 ==========
+
+// 所有请求共用的平台调用名额，数量为 imageGen.maxWorkers，超出时排队等待
+var (
+	genSlots   chan struct{}
+	genRunning atomic.Int64
+	genWaiting atomic.Int64
+)
+
+func initGenPool(n int) {
+	genSlots = make(chan struct{}, n)
+}
+
+// acquireGenSlot 占用一个平台调用名额，返回释放函数；排队时 ctx 取消则放弃
+// 只在实际调用平台的最内层使用，嵌套调用会在名额用尽时互相等待
+func acquireGenSlot(ctx context.Context, platform string, progress progressFunc) (func(), error) {
+	select {
+	case genSlots <- struct{}{}:
+	default:
+		waiting := genWaiting.Add(1)
+		log.Printf("[%s] 生成并发已满，排队等待（%d 个等待中）", platform, waiting)
+		progress.report("waiting", 10)
+		select {
+		case genSlots <- struct{}{}:
+			genWaiting.Add(-1)
+		case <-ctx.Done():
+			genWaiting.Add(-1)
+			return nil, genError(ErrCodeCanceled, "生成已取消")
+		}
+	}
+	genRunning.Add(1)
+	return func() {
+		genRunning.Add(-1)
+		<-genSlots
+	}, nil
+}
+
+// acquireProvider 调用平台前检查熔断并占用并发名额，返回的 release 记录调用结果并释放名额
+// 有任意一张图片生成成功即视为平台正常，成功调用的耗时计入延迟统计
+func acquireProvider(ctx context.Context, platform string, progress progressFunc) (release func(n int, err error), err error) {
+	if err := waitProviderPause(ctx, platform, progress); err != nil {
+		return nil, err
+	}
+	done, err := acquireBreaker(platform)
+	if err != nil {
+		return nil, err
+	}
+	free, err := acquireGenSlot(ctx, platform, progress)
+	if err != nil {
+		done(err)
+		return nil, err
+	}
+	start := time.Now()
+	return func(n int, err error) {
+		free()
+		if n > 0 {
+			err = nil
+			recordLatency(platform, time.Since(start))
+		}
+		pauseProvider(platform, err)
+		done(err)
+	}, nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ========== 处理任务记录 ==========
+
+// ProcessingJob 图片的一次处理（放大、加水印等），记录状态和耗时
+// 失败或被重启中断的任务可以按原参数重新执行
+type ProcessingJob struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	ImageID    uint       `gorm:"index" json:"image_id"`       // 被处理的图片
+	Step       string     `gorm:"size:30;index" json:"step"`   // upscale, watermark, transcode
+	Params     string     `gorm:"type:text" json:"params"`     // 处理参数 JSON，重新执行时使用
+	Status     string     `gorm:"size:20;index" json:"status"` // running, succeeded, failed, interrupted
+	Output     string     `gorm:"size:500" json:"output"`      // 输出文件路径
+	Error      string     `gorm:"type:text" json:"error"`
+	DurationMs int64      `json:"duration_ms"`
+	User       string     `gorm:"size:100" json:"user"`
+	APIKey     string     `gorm:"size:100" json:"-"`            // 重新执行时按原 API Key 计算配额
+	Worker     string     `gorm:"size:100;index" json:"worker"` // 执行处理的实例
+	CreatedAt  time.Time  `gorm:"index" json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
+
+func (ProcessingJob) TableName() string {
+	return "processing_jobs"
+}
+
+// processingSteps 各处理步骤按任务记录的参数重新执行，返回输出文件路径
+var processingSteps = map[string]func(ctx context.Context, job *ProcessingJob, record *ImageRecord) (string, error){
+	"upscale":   rerunUpscale,
+	"watermark": rerunWatermark,
+	"transcode": rerunTranscode,
+}
+
+// startProcessing 记录开始处理，入库失败时返回 nil，nil 的方法均为空操作
+func startProcessing(imageID uint, step string, params interface{}, user, apiKey string) *ProcessingJob {
+	data, _ := json.Marshal(params)
+	job := &ProcessingJob{
+		ImageID: imageID,
+		Step:    step,
+		Params:  string(data),
+		Status:  "running",
+		User:    user,
+		APIKey:  apiKey,
+		Worker:  instanceID,
+	}
+	if err := db.Create(job).Error; err != nil {
+		log.Printf("[处理] 记录 %s 任务失败: %v", step, err)
+		return nil
+	}
+	return job
+}
+
+// finish 记录处理结果和耗时
+func (j *ProcessingJob) finish(output string, err error) {
+	if j == nil {
+		return
+	}
+	now := time.Now()
+	updates := map[string]interface{}{
+		"status":      "succeeded",
+		"output":      output,
+		"duration_ms": now.Sub(j.CreatedAt).Milliseconds(),
+		"finished_at": now,
+	}
+	if err != nil {
+		updates["status"] = "failed"
+		updates["error"] = err.Error()
+	}
+	db.Model(j).Updates(updates)
+}
+
+// recoverProcessingJobs 启动时把上次未结束的处理标记为 interrupted，共享队列时只处理本实例的任务
+func recoverProcessingJobs() {
+	query := db.Model(&ProcessingJob{}).Where("status = ?", "running")
+	if !jobQueue.Local() {
+		query = query.Where("worker = ?", instanceID)
+	}
+	now := time.Now()
+	result := query.Updates(map[string]interface{}{"status": "interrupted", "error": "服务重启，处理中断", "finished_at": now})
+	if result.RowsAffected > 0 {
+		log.Printf("🧵 %d 个处理任务因重启中断，可重新执行", result.RowsAffected)
+	}
+}
+
+// ========== 处理任务 API ==========
+
+// listImageProcessing GET /api/images/:id/processing，图片的全部处理记录
+func listImageProcessing(c *gin.Context) {
+	var jobs []ProcessingJob
+	db.Where("image_id = ?", c.Param("id")).Order("id DESC").Find(&jobs)
+	c.JSON(200, gin.H{"jobs": jobs, "total": len(jobs)})
+}
+
+// listProcessingJobs GET /api/processing-jobs?status=failed&step=upscale&unresolved=1&page=1&page_size=50
+// unresolved=1 只返回之后没有以相同参数成功处理过的失败/中断任务，即处理不完整的图片
+func listProcessingJobs(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 200 {
+		pageSize = 50
+	}
+
+	query := db.Model(&ProcessingJob{})
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if step := c.Query("step"); step != "" {
+		query = query.Where("step = ?", step)
+	}
+	if c.Query("unresolved") == "1" {
+		query = query.Where("status IN ?", []string{"failed", "interrupted"}).
+			Where("NOT EXISTS (SELECT 1 FROM processing_jobs p WHERE p.image_id = processing_jobs.image_id AND p.step = processing_jobs.step AND p.params = processing_jobs.params AND p.status = ? AND p.id > processing_jobs.id)", "succeeded")
+	}
+
+	var total int64
+	query.Count(&total)
+	var jobs []ProcessingJob
+	query.Order("id DESC").Limit(pageSize).Offset((page - 1) * pageSize).Find(&jobs)
+
+	c.JSON(200, gin.H{
+		"jobs":      jobs,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// rerunProcessingJob POST /api/processing-jobs/:id/rerun，按原参数重新执行失败或中断的处理，结果为一条新的处理记录
+func rerunProcessingJob(c *gin.Context) {
+	var job ProcessingJob
+	if err := db.First(&job, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{"error": "处理任务不存在"})
+		return
+	}
+	if job.Status != "failed" && job.Status != "interrupted" {
+		c.JSON(400, gin.H{"error": "只能重新执行失败或中断的处理"})
+		return
+	}
+	run, ok := processingSteps[job.Step]
+	if !ok {
+		c.JSON(400, gin.H{"error": "不支持重新执行的处理步骤: " + job.Step})
+		return
+	}
+	var record ImageRecord
+	if err := db.First(&record, job.ImageID).Error; err != nil {
+		c.JSON(404, gin.H{"error": "图片不存在"})
+		return
+	}
+
+	output, err := run(c.Request.Context(), &job, &record)
+	if err != nil {
+		c.JSON(502, gin.H{"error": "处理失败: " + err.Error(), "error_code": errorCode(err)})
+		return
+	}
+	c.JSON(200, gin.H{"message": "success", "image_id": record.ID, "step": job.Step, "output": output})
+}
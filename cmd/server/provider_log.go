@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"image-platform/internal/requestid"
+)
+
+// ========== 平台请求录制 ==========
+
+// ProviderCall 一次平台接口调用，密钥已脱敏，用于排查偶发的解析失败等问题
+type ProviderCall struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	Platform       string    `gorm:"size:50;index" json:"platform"`
+	Method         string    `gorm:"size:10" json:"method"`
+	URL            string    `gorm:"size:1000" json:"url"`
+	RequestHeaders string    `gorm:"type:text" json:"request_headers"`
+	RequestBody    string    `gorm:"type:mediumtext" json:"request_body"`
+	Status         int       `gorm:"index" json:"status"`
+	ResponseBody   string    `gorm:"type:mediumtext" json:"response_body"`
+	Error          string    `gorm:"type:text" json:"error"`
+	DurationMs     int64     `json:"duration_ms"`
+	CreatedAt      time.Time `gorm:"index" json:"created_at"`
+}
+
+func (ProviderCall) TableName() string {
+	return "provider_calls"
+}
+
+// providerClient 平台接口使用的 HTTP 客户端，请求带上 X-Request-ID，开启录制时记录请求和响应
+func providerClient(platform string, timeout time.Duration) *http.Client {
+	var next http.RoundTripper = http.DefaultTransport
+	if cfg.Observability.Recording.Enabled {
+		next = &recordingTransport{platform: platform, next: next}
+	}
+	return &http.Client{Timeout: timeout, Transport: &requestid.Transport{Next: next}}
+}
+
+type recordingTransport struct {
+	platform string
+	next     http.RoundTripper
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	call := ProviderCall{
+		Platform:       t.platform,
+		Method:         req.Method,
+		URL:            redactURL(req.URL),
+		RequestHeaders: redactHeaders(req.Header),
+	}
+	if req.Body != nil {
+		data, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(data))
+		call.RequestBody = redactBody(req.Header.Get("Content-Type"), data)
+	}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	call.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		call.Error = err.Error()
+	} else {
+		call.Status = resp.StatusCode
+		data, readErr := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(data))
+		if readErr != nil {
+			call.Error = readErr.Error()
+		}
+		call.ResponseBody = redactBody(resp.Header.Get("Content-Type"), data)
+	}
+	if err := db.Create(&call).Error; err != nil {
+		log.Printf("[录制] 保存平台请求失败: %v", err)
+	}
+	return resp, err
+}
+
+var (
+	// JSON 中的密钥字段
+	secretFieldRe = regexp.MustCompile(`(?i)("[a-z_]*(?:key|token|secret|password|signature)[a-z_]*"\s*:\s*)"[^"]*"`)
+	// data URI 中的图片内容只保留长度
+	dataURIRe = regexp.MustCompile(`(data:[a-z/+.-]+;base64,)[A-Za-z0-9+/=]+`)
+)
+
+// redactHeaders 鉴权相关请求头替换为 ***
+func redactHeaders(h http.Header) string {
+	var b strings.Builder
+	for name, values := range h {
+		value := strings.Join(values, ", ")
+		switch strings.ToLower(name) {
+		case "authorization", "cookie", "x-api-key", "api-key":
+			value = "***"
+		}
+		b.WriteString(name + ": " + value + "\n")
+	}
+	return b.String()
+}
+
+// redactURL 去掉查询参数中的密钥
+func redactURL(u *url.URL) string {
+	q := u.Query()
+	for name := range q {
+		lower := strings.ToLower(name)
+		if strings.Contains(lower, "key") || strings.Contains(lower, "token") || strings.Contains(lower, "signature") {
+			q.Set(name, "***")
+		}
+	}
+	redacted := *u
+	redacted.RawQuery = q.Encode()
+	return redacted.String()
+}
+
+// redactBody 脱敏并截断请求/响应体，图片等二进制内容只记录长度
+func redactBody(contentType string, data []byte) string {
+	if len(data) == 0 {
+		return ""
+	}
+	ct := strings.ToLower(contentType)
+	if strings.HasPrefix(ct, "image/") || strings.HasPrefix(ct, "multipart/") || strings.HasPrefix(ct, "application/octet-stream") {
+		return "<" + ct + " " + strconv.Itoa(len(data)) + " bytes>"
+	}
+	body := secretFieldRe.ReplaceAllString(string(data), `$1"***"`)
+	body = dataURIRe.ReplaceAllStringFunc(body, func(m string) string {
+		prefix := dataURIRe.FindStringSubmatch(m)[1]
+		return prefix + "<" + strconv.Itoa(len(m)-len(prefix)) + " bytes>"
+	})
+	if limit := cfg.Observability.Recording.MaxBodyBytes; len(body) > limit {
+		body = body[:limit] + "...<truncated>"
+	}
+	return body
+}
+
+// runProviderCallPurger 每小时清理超过保留天数的录制
+func runProviderCallPurger() {
+	if !cfg.Observability.Recording.Enabled {
+		return
+	}
+	purgeProviderCalls()
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for range ticker.C {
+		purgeProviderCalls()
+	}
+}
+
+func purgeProviderCalls() {
+	cutoff := time.Now().AddDate(0, 0, -cfg.Observability.Recording.RetentionDays)
+	if res := db.Where("created_at < ?", cutoff).Delete(&ProviderCall{}); res.RowsAffected > 0 {
+		log.Printf("[录制] 清理 %d 条过期平台请求", res.RowsAffected)
+	}
+}
+
+// ========== 平台请求录制 API ==========
+
+// listProviderCalls GET /api/admin/provider-calls?platform=aliyun&failed=1&q=解析&page=1
+// 列表不返回请求和响应体，详情见 /provider-calls/:id
+func listProviderCalls(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+	query := db.Model(&ProviderCall{})
+	if platform := c.Query("platform"); platform != "" {
+		query = query.Where("platform = ?", platform)
+	}
+	if c.Query("failed") == "1" {
+		query = query.Where("(status = 0 OR status >= 400 OR error <> '')")
+	}
+	if q := c.Query("q"); q != "" {
+		query = query.Where("response_body LIKE ?", "%"+q+"%")
+	}
+	var total int64
+	query.Count(&total)
+	var calls []ProviderCall
+	query.Select("id, platform, method, url, status, error, duration_ms, created_at").
+		Order("id DESC").Offset((page - 1) * 50).Limit(50).Find(&calls)
+	c.JSON(200, gin.H{"calls": calls, "total": total, "page": page, "enabled": cfg.Observability.Recording.Enabled})
+}
+
+func getProviderCall(c *gin.Context) {
+	var call ProviderCall
+	if err := db.First(&call, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{"error": "记录不存在"})
+		return
+	}
+	c.JSON(200, call)
+}
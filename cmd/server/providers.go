@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	"image-platform/internal/generator"
+)
+
+// ========== 生成平台 ==========
+
+// GenerateResult 已保存到本地的生成结果
+type GenerateResult = generator.Image
+
+// generatorConfig 平台配置中调用平台需要的部分，随生成请求传给 internal/generator
+func (p PlatformConfig) generatorConfig() generator.Config {
+	return generator.Config{
+		Name:            p.Name,
+		Type:            p.Type,
+		APIKey:          p.APIKey,
+		URL:             p.URL,
+		Model:           p.Model,
+		EditModel:       p.EditModel,
+		Workflow:        p.Workflow,
+		CredentialsFile: p.CredentialsFile,
+		Project:         p.Project,
+		Region:          p.Region,
+		Watermark:       p.Watermark,
+		PollInterval:    p.PollInterval,
+		MaxWait:         p.MaxWait,
+		LatencyMs:       p.LatencyMs,
+		ResponseFormat:  p.ResponseFormat,
+		AccessKey:       p.AccessKey,
+		SecretKey:       p.SecretKey,
+	}
+}
+
+// initGenerator 把服务端的请求日志、图片保存、平台槽位和任务记录提供给各平台实现，在 instanceID 确定后调用
+func initGenerator() {
+	generator.Setup(generator.Env{
+		Width:      cfg.ImageGen.Width,
+		Height:     cfg.ImageGen.Height,
+		MaxRetries: cfg.ImageGen.MaxRetries,
+		RetryDelay: time.Duration(cfg.ImageGen.RetryDelay) * time.Second,
+		ClientID:   instanceID,
+		Client:     providerClient,
+		SaveImage: func(platform string, data []byte, idx int, ext string) (string, error) {
+			now := time.Now()
+			// 同名文件已存在时追加序号，不会覆盖同一秒内完成的其他图片
+			return writeImageFile(filepath.Join(cfg.ImageGen.OutputDir, bizDate(now), platform), newImageFilename(now, idx, ext), data)
+		},
+		// 经过限流暂停、熔断和平台并发槽位后才调用平台
+		Acquire: func(ctx context.Context, req generator.GenerateRequest) (context.Context, func(n int, err error), error) {
+			ctx = withGenSeed(ctx, req.Seed)
+			release, err := acquireProvider(ctx, req.Platform, progressFunc(req.Progress))
+			return ctx, release, err
+		},
+		Journal: func(ctx context.Context, provider, taskID string) generator.Journal {
+			if pt := journalProviderTask(ctx, provider, taskID); pt != nil {
+				return pt
+			}
+			return nil
+		},
+		OnRetryAfter: noteRetryAfter,
+	})
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ========== 发布错误预算 ==========
+
+// PublishBudgetConfig 发布平台的错误预算：一小时内发布失败（含重试）达到预算后自动暂停该平台的发布并告警，
+// 避免持续请求正在拒绝我们的平台导致账号被封
+type PublishBudgetConfig struct {
+	MaxFailures int            `yaml:"maxFailures"` // 每小时最多失败次数，0 为不限制
+	Platforms   map[string]int `yaml:"platforms"`   // 按发布平台覆盖 maxFailures，0 为该平台不限制
+	Pause       int            `yaml:"pause"`       // 自动暂停的时长（分钟），0 为暂停到手动恢复
+	Notify      []string       `yaml:"notify"`      // 暂停时通知的用户，为空使用 notifications.reviewers
+}
+
+// PublishPause 暂停发布的平台，暂停期间定时发布任务保持排队，直接发布返回失败
+type PublishPause struct {
+	Platform  string     `gorm:"primaryKey;size:50" json:"platform"`
+	Reason    string     `gorm:"type:text" json:"reason"`
+	Failures  int        `json:"failures"`                   // 触发暂停时一小时内的失败次数，手动暂停为 0
+	Until     *time.Time `json:"until"`                      // 自动恢复时间，为空时需手动恢复
+	CreatedBy string     `gorm:"size:100" json:"created_by"` // 错误预算触发时为 system
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func (PublishPause) TableName() string {
+	return "publish_pauses"
+}
+
+var (
+	publishPauseMu  sync.Mutex
+	publishPauses   = make(map[string]PublishPause)
+	publishFailures = make(map[string][]time.Time) // 按发布平台记录最近一小时的失败时间
+)
+
+// loadPublishPauses 启动时加载暂停状态，重启后仍然生效
+func loadPublishPauses() {
+	var list []PublishPause
+	db.Find(&list)
+	publishPauseMu.Lock()
+	for _, p := range list {
+		publishPauses[p.Platform] = p
+	}
+	publishPauseMu.Unlock()
+	if len(list) > 0 {
+		log.Printf("⏸️ %d 个发布平台处于暂停状态", len(list))
+	}
+}
+
+// publishBudget 平台每小时的失败预算，0 为不限制
+func publishBudget(platform string) int {
+	if n, ok := cfg.Publish.ErrorBudget.Platforms[platform]; ok {
+		return n
+	}
+	return cfg.Publish.ErrorBudget.MaxFailures
+}
+
+// publishPaused 平台当前的暂停状态，自动暂停到期后恢复
+func publishPaused(platform string) (PublishPause, bool) {
+	publishPauseMu.Lock()
+	p, ok := publishPauses[platform]
+	expired := ok && p.Until != nil && time.Now().After(*p.Until)
+	if expired {
+		delete(publishPauses, platform)
+		delete(publishFailures, platform)
+	}
+	publishPauseMu.Unlock()
+	if expired {
+		db.Delete(&PublishPause{}, "platform = ?", platform)
+		log.Printf("▶️ 发布平台 %s 暂停到期，恢复发布", platform)
+		return PublishPause{}, false
+	}
+	return p, ok
+}
+
+// checkPublishPause 发布前检查平台是否暂停
+func checkPublishPause(platform string) error {
+	p, ok := publishPaused(platform)
+	if !ok {
+		return nil
+	}
+	if p.Until != nil {
+		return fmt.Errorf("发布平台 %s 已暂停到 %s: %s", platform, p.Until.In(bizLoc).Format("2006-01-02 15:04"), p.Reason)
+	}
+	return fmt.Errorf("发布平台 %s 已暂停，需手动恢复: %s", platform, p.Reason)
+}
+
+// notePublishFailure 记录一次平台返回的发布失败，一小时内的失败次数达到预算时暂停该平台
+// 图片不存在、品牌处理失败等与平台无关的失败不计入
+func notePublishFailure(platform string, err error) {
+	budget := publishBudget(platform)
+	if budget <= 0 {
+		return
+	}
+	now := time.Now()
+	publishPauseMu.Lock()
+	recent := publishFailures[platform][:0]
+	for _, t := range publishFailures[platform] {
+		if now.Sub(t) < time.Hour {
+			recent = append(recent, t)
+		}
+	}
+	recent = append(recent, now)
+	publishFailures[platform] = recent
+	_, paused := publishPauses[platform]
+	publishPauseMu.Unlock()
+	if paused || len(recent) < budget {
+		return
+	}
+
+	p := PublishPause{
+		Platform:  platform,
+		Reason:    fmt.Sprintf("1 小时内发布失败 %d 次，最近一次: %v", len(recent), err),
+		Failures:  len(recent),
+		CreatedBy: "system",
+		CreatedAt: now,
+	}
+	if minutes := cfg.Publish.ErrorBudget.Pause; minutes > 0 {
+		until := now.Add(time.Duration(minutes) * time.Minute)
+		p.Until = &until
+	}
+	pausePublishing(p)
+
+	users := cfg.Publish.ErrorBudget.Notify
+	if len(users) == 0 {
+		users = cfg.Notifications.Reviewers
+	}
+	for _, u := range users {
+		notify(u, "publish_paused", fmt.Sprintf("发布平台 %s 失败过多，已自动暂停发布", platform), p.Reason, 0, "/api/admin/publish/pauses")
+	}
+	emitEvent(db, "publish.paused", gin.H{"platform": platform, "failures": p.Failures, "until": p.Until, "error": err.Error()})
+}
+
+// pausePublishing 保存暂停状态
+func pausePublishing(p PublishPause) error {
+	if err := db.Save(&p).Error; err != nil {
+		return err
+	}
+	publishPauseMu.Lock()
+	publishPauses[p.Platform] = p
+	publishPauseMu.Unlock()
+	log.Printf("⏸️ 发布平台 %s 暂停发布: %s", p.Platform, p.Reason)
+	return nil
+}
+
+// publishPauseSnapshot 按平台排序的暂停状态，指标推送使用
+func publishPauseSnapshot() []PublishPause {
+	publishPauseMu.Lock()
+	list := make([]PublishPause, 0, len(publishPauses))
+	for _, p := range publishPauses {
+		list = append(list, p)
+	}
+	publishPauseMu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Platform < list[j].Platform })
+	return list
+}
+
+// ========== 发布错误预算 API ==========
+
+// listPublishPauses GET /api/admin/publish/pauses，暂停中的平台和各平台最近一小时的失败次数
+func listPublishPauses(c *gin.Context) {
+	now := time.Now()
+	for _, p := range publishPauseSnapshot() {
+		publishPaused(p.Platform) // 清理已到期的暂停
+	}
+	failures := gin.H{}
+	publishPauseMu.Lock()
+	for platform, times := range publishFailures {
+		n := 0
+		for _, t := range times {
+			if now.Sub(t) < time.Hour {
+				n++
+			}
+		}
+		failures[platform] = gin.H{"failures": n, "budget": publishBudget(platform)}
+	}
+	publishPauseMu.Unlock()
+	c.JSON(200, gin.H{"pauses": publishPauseSnapshot(), "failures": failures})
+}
+
+// pausePublishPlatform POST /api/admin/publish/pauses/:platform，手动暂停发布，需手动恢复
+func pausePublishPlatform(c *gin.Context) {
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	c.ShouldBindJSON(&req)
+	p := PublishPause{Platform: c.Param("platform"), Reason: req.Reason, CreatedBy: currentUser(c), CreatedAt: time.Now()}
+	if err := pausePublishing(p); err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"message": "success", "pause": p})
+}
+
+// resumePublishPlatform DELETE /api/admin/publish/pauses/:platform，恢复发布并清空失败计数
+func resumePublishPlatform(c *gin.Context) {
+	platform := c.Param("platform")
+	db.Delete(&PublishPause{}, "platform = ?", platform)
+	publishPauseMu.Lock()
+	delete(publishPauses, platform)
+	delete(publishFailures, platform)
+	publishPauseMu.Unlock()
+	log.Printf("▶️ 发布平台 %s 恢复发布", platform)
+	c.JSON(200, gin.H{"message": "success"})
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"image-platform/internal/publisher"
+)
+
+// ========== 发布图片格式 ==========
+
+// PublishFormatConfig 发布平台使用的图片格式，如微博用 JPEG q85、小红书用 PNG
+type PublishFormatConfig struct {
+	Format  string `yaml:"format"`  // png、jpeg，original 为原样发送
+	Quality int    `yaml:"quality"` // jpeg 质量 1-100，默认 85
+}
+
+// publishFormat 发布平台要求的图片格式：publish.formats 优先，其次发布平台声明的格式；都没有时 ok 为 false
+func publishFormat(platform string) (PublishFormatConfig, bool) {
+	f, ok := cfg.Publish.Formats[platform]
+	if !ok && pubManager != nil {
+		var pf publisher.ImageFormat
+		if pf, ok = pubManager.PreferredFormat(publisher.PlatformType(platform)); ok {
+			f = PublishFormatConfig{Format: pf.Format, Quality: pf.Quality}
+		}
+	}
+	if !ok || f.Format == "" || f.Format == "original" {
+		return PublishFormatConfig{}, false
+	}
+	if f.Format == "jpg" {
+		f.Format = "jpeg"
+	}
+	if f.Format == "jpeg" && f.Quality == 0 {
+		f.Quality = 85
+	}
+	return f, true
+}
+
+// validatePublishFormats 启动时检查 publish.formats
+func validatePublishFormats() error {
+	for platform, f := range cfg.Publish.Formats {
+		switch f.Format {
+		case "png", "jpeg", "jpg", "original":
+		default:
+			return fmt.Errorf("%s: 不支持的格式 %q，可选 png、jpeg、original", platform, f.Format)
+		}
+		if f.Quality < 0 || f.Quality > 100 {
+			return fmt.Errorf("%s: quality 取值范围 1-100", platform)
+		}
+	}
+	return nil
+}
+
+// formatVariant 转码结果的目录名，如 png、jpeg-q85
+func formatVariant(f PublishFormatConfig) string {
+	if f.Format == "jpeg" {
+		return fmt.Sprintf("jpeg-q%d", f.Quality)
+	}
+	return f.Format
+}
+
+// transcodeForPublish 把发布用的图片（原图或品牌处理后的副本）转为平台要求的格式，
+// 输出到 transcoded/<品牌配置>/<格式>/，已生成过且比源文件新时直接复用；源文件已是 PNG 且要求 PNG 时不转码
+func transcodeForPublish(record *ImageRecord, src, branding string, f PublishFormatConfig) (string, error) {
+	ext := strings.ToLower(filepath.Ext(src))
+	if f.Format == "png" && ext == ".png" {
+		return src, nil
+	}
+	if branding == "" {
+		branding = "original"
+	}
+	outExt := map[string]string{"png": ".png", "jpeg": ".jpg"}[f.Format]
+	out := filepath.Join(cfg.ImageGen.OutputDir, "transcoded", branding, formatVariant(f), fmt.Sprintf("%d%s", record.ID, outExt))
+	if s, err := os.Stat(src); err == nil {
+		if dst, err := os.Stat(out); err == nil && dst.ModTime().After(s.ModTime()) {
+			return out, nil
+		}
+	}
+
+	job := startProcessing(record.ID, "transcode", gin.H{"format": f.Format, "quality": f.Quality, "branding": branding}, "", "")
+	if err := encodeImageFile(src, out, f); err != nil {
+		job.finish("", err)
+		return "", err
+	}
+	job.finish(out, nil)
+	return out, nil
+}
+
+// encodeImageFile 按格式重新编码，JPEG 不支持透明，透明区域铺白底；失败时不留下不完整的文件
+func encodeImageFile(src, out string, f PublishFormatConfig) error {
+	img, err := loadImage(src)
+	if err != nil {
+		return fmt.Errorf("读取图片失败: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(out), 0755); err != nil {
+		return err
+	}
+	tmp := out + ".tmp"
+	w, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if f.Format == "jpeg" {
+		canvas := image.NewRGBA(img.Bounds())
+		draw.Draw(canvas, canvas.Bounds(), &image.Uniform{C: color.White}, image.Point{}, draw.Src)
+		draw.Draw(canvas, canvas.Bounds(), img, img.Bounds().Min, draw.Over)
+		err = jpeg.Encode(w, canvas, &jpeg.Options{Quality: f.Quality})
+	} else {
+		err = png.Encode(w, img)
+	}
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("编码 %s 失败: %w", f.Format, err)
+	}
+	return os.Rename(tmp, out)
+}
+
+// rerunTranscode 按处理记录的格式参数重新转码
+func rerunTranscode(ctx context.Context, job *ProcessingJob, record *ImageRecord) (string, error) {
+	var params struct {
+		Format   string `json:"format"`
+		Quality  int    `json:"quality"`
+		Branding string `json:"branding"`
+	}
+	if err := json.Unmarshal([]byte(job.Params), &params); err != nil || params.Format == "" {
+		return "", genError(ErrCodeInvalid, "处理参数无效: %s", job.Params)
+	}
+	src := record.Path
+	if params.Branding != "original" {
+		var err error
+		if src, err = applyBranding(record, params.Branding); err != nil {
+			return "", err
+		}
+	}
+	return transcodeForPublish(record, src, params.Branding, PublishFormatConfig{Format: params.Format, Quality: params.Quality})
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"image-platform/internal/publisher"
+)
+
+// ========== 定时发布队列 ==========
+
+// PublishJob 待发布任务，到达 ScheduledAt 后由调度器执行
+type PublishJob struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	ImageID       uint       `gorm:"index;not null" json:"image_id"`
+	Platform      string     `gorm:"size:50;not null" json:"platform"`
+	Title         string     `gorm:"size:255" json:"title"`
+	Content       string     `gorm:"type:text" json:"content"`
+	ScheduledAt   time.Time  `gorm:"index" json:"scheduled_at"`
+	Status        string     `gorm:"size:20;default:'pending';index" json:"status"` // pending, running, succeeded, failed, canceled
+	Result        string     `gorm:"type:text" json:"result"`
+	Attempts      int        `json:"attempts"`                // 已执行次数，失败后按 publish.retryDelay 退避重试
+	Errors        string     `gorm:"type:text" json:"errors"` // 每次失败的时间和错误，一行一次
+	WorkflowRunID *uint      `gorm:"index" json:"workflow_run_id"`
+	CreatedAt     time.Time  `json:"created_at"`
+	FinishedAt    *time.Time `json:"finished_at"`
+}
+
+func (PublishJob) TableName() string {
+	return "publish_jobs"
+}
+
+// nextSlot 解析 HH:MM，返回下一次到达该时间的时刻；为空时立即
+// now 应为业务时区时间，HH:MM 按 now 所在时区解释
+func nextSlot(at string, now time.Time) (time.Time, error) {
+	if at == "" {
+		return now, nil
+	}
+	t, err := time.Parse("15:04", at)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("发布时间格式应为 HH:MM: %s", at)
+	}
+	slot := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, now.Location())
+	if slot.Before(now) {
+		slot = slot.AddDate(0, 0, 1)
+	}
+	return slot, nil
+}
+
+// schedulePublish 为每个平台创建一条定时发布任务，时间不在平台发布时段内时顺延
+func schedulePublish(imageID uint, platforms []string, title, content string, at time.Time, runID *uint) ([]PublishJob, error) {
+	jobs := make([]PublishJob, 0, len(platforms))
+	for _, plat := range platforms {
+		job := PublishJob{
+			ImageID:       imageID,
+			Platform:      plat,
+			Title:         title,
+			Content:       content,
+			ScheduledAt:   nextPublishTime(plat, at),
+			Status:        "pending",
+			WorkflowRunID: runID,
+		}
+		if err := db.Create(&job).Error; err != nil {
+			return jobs, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// runPublishScheduler 每 30 秒检查一次到期的发布任务
+func runPublishScheduler() {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		runDuePublishJobs()
+	}
+}
+
+func runDuePublishJobs() {
+	var jobs []PublishJob
+	db.Where("status = ? AND scheduled_at <= ?", "pending", time.Now()).Order("scheduled_at").Find(&jobs)
+	now := time.Now()
+	for _, job := range jobs {
+		// 发布时段或禁发时间可能在排队后修改，到期时再检查一次，不在时段内顺延到下一个可发布时刻
+		if next := nextPublishTime(job.Platform, now); next.After(now) {
+			db.Model(&PublishJob{}).Where("id = ? AND status = ?", job.ID, "pending").Update("scheduled_at", next)
+			log.Printf("📤 定时发布 #%d [%s] 不在发布时段，顺延到 %s", job.ID, job.Platform, next.Format("2006-01-02 15:04"))
+			continue
+		}
+		// 平台因错误预算用尽等原因暂停发布时保持排队，恢复后按原顺序执行
+		if _, paused := publishPaused(job.Platform); paused {
+			continue
+		}
+		// 抢占任务，避免重复执行
+		res := db.Model(&PublishJob{}).Where("id = ? AND status = ?", job.ID, "pending").Update("status", "running")
+		if res.RowsAffected == 0 {
+			continue
+		}
+		// 共享队列时由任意实例的发布 worker 执行
+		if err := jobQueue.Push(context.Background(), queuePublish, strconv.FormatUint(uint64(job.ID), 10)); err != nil {
+			log.Printf("📤 定时发布 #%d 入队失败，下次检查时重试: %v", job.ID, err)
+			db.Model(&PublishJob{}).Where("id = ?", job.ID).Update("status", "pending")
+		}
+	}
+}
+
+// startPublishWorker 启动发布 worker，依次执行已抢占的发布任务
+func startPublishWorker() {
+	go func() {
+		for {
+			id, err := jobQueue.Pop(context.Background(), queuePublish)
+			if err != nil {
+				log.Printf("📤 读取发布队列失败: %v", err)
+				time.Sleep(time.Second)
+				continue
+			}
+			var job PublishJob
+			if err := db.First(&job, "id = ? AND status = ?", id, "running").Error; err != nil {
+				continue
+			}
+			executePublishJob(job)
+		}
+	}()
+}
+
+func executePublishJob(job PublishJob) {
+	// 同一批到期的任务中，前面的任务可能已用尽错误预算，放回队列等平台恢复
+	if _, paused := publishPaused(job.Platform); paused {
+		db.Model(&PublishJob{}).Where("id = ?", job.ID).Update("status", "pending")
+		return
+	}
+	status, result := "succeeded", ""
+	retry := false // 图片不存在、未审核等情况重试也不会成功
+	var record ImageRecord
+	if err := db.First(&record, job.ImageID).Error; err != nil {
+		status, result = "failed", "图片不存在"
+	} else if record.Status != "approved" {
+		status, result = "failed", "图片未审核通过"
+	} else if path, err := publishImagePath(&record, job.Platform, ""); err != nil {
+		status, result = "failed", "品牌处理失败: "+err.Error()
+	} else {
+		ctx, cancel := context.WithTimeout(jobContext("publish", job.ID), 5*time.Minute)
+		url, err := pubManager.Publish(publisher.PlatformType(job.Platform), ctx, path, job.Title, job.Content)
+		cancel()
+		if err != nil {
+			status, result, retry = "failed", err.Error(), true
+			notePublishFailure(job.Platform, err)
+		} else {
+			result = url
+		}
+	}
+
+	job.Attempts++
+	if status == "failed" {
+		job.Errors = appendHistory(job.Errors, result)
+		// 平台发布失败时退避重试，重试用尽后进入死信队列
+		if retry && job.Attempts < cfg.Publish.MaxAttempts {
+			next := time.Now().Add(time.Duration(cfg.Publish.RetryDelay) * time.Second << (job.Attempts - 1))
+			db.Model(&PublishJob{}).Where("id = ?", job.ID).Updates(map[string]interface{}{
+				"status": "pending", "result": result, "attempts": job.Attempts, "errors": job.Errors, "scheduled_at": next})
+			log.Printf("📤 定时发布 #%d [%s] 第 %d 次失败，%s 重试: %s", job.ID, job.Platform, job.Attempts, next.Format("15:04:05"), result)
+			return
+		}
+		deadLetter("publish", strconv.FormatUint(uint64(job.ID), 10), job, result, "", job.Attempts, job.Errors)
+	}
+
+	log.Printf("📤 定时发布 #%d [%s] 图片 %d: %s %s", job.ID, job.Platform, job.ImageID, status, result)
+	if status == "succeeded" {
+		recordPublished(job.ImageID, job.Platform, result, job.Title, job.Content, "system", &job.ID)
+		recordActivity("published", job.ImageID, "system", job.Platform+": "+result)
+	} else {
+		recordActivity("publish_failed", job.ImageID, "system", job.Platform+": "+result)
+		notify(record.User, "publish_failed", fmt.Sprintf("图片 #%d 定时发布到 %s 失败", job.ImageID, job.Platform), result, job.ImageID, "")
+	}
+	now := time.Now()
+	db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&PublishJob{}).Where("id = ?", job.ID).Updates(map[string]interface{}{
+			"status": status, "result": result, "attempts": job.Attempts, "errors": job.Errors, "finished_at": now}).Error; err != nil {
+			return err
+		}
+		kind := "image.published"
+		if status != "succeeded" {
+			kind = "image.publish_failed"
+		}
+		return emitEvent(tx, kind, gin.H{"id": job.ImageID, "platform": job.Platform, "job_id": job.ID, "result": result})
+	})
+	if job.WorkflowRunID != nil {
+		onPublishJobFinished(*job.WorkflowRunID)
+	}
+}
+
+// ========== 发布队列 API ==========
+func listPublishJobs(c *gin.Context) {
+	var jobs []PublishJob
+	query := db.Model(&PublishJob{})
+	if s := c.Query("status"); s != "" {
+		query = query.Where("status IN ?", strings.Split(s, ","))
+	}
+	query.Order("scheduled_at DESC").Limit(100).Find(&jobs)
+	c.JSON(200, gin.H{"jobs": jobs, "total": len(jobs)})
+}
+
+func cancelPublishJob(c *gin.Context) {
+	res := db.Model(&PublishJob{}).Where("id = ? AND status = ?", c.Param("id"), "pending").Update("status", "canceled")
+	if res.RowsAffected == 0 {
+		c.JSON(409, gin.H{"error": "任务不存在或已执行"})
+		return
+	}
+	c.JSON(200, gin.H{"message": "success"})
+}
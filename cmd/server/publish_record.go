@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"image-platform/internal/publisher"
+)
+
+// ========== 发布记录 ==========
+
+// PublishRecord 一次成功的发布，PostRef 为平台返回的内容标识，修改已发布内容时使用
+type PublishRecord struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	ImageID     uint       `gorm:"index;not null" json:"image_id"` // 当前发布的图片，替换图片后更新
+	Platform    string     `gorm:"size:50;index" json:"platform"`
+	PostRef     string     `gorm:"size:500" json:"post_ref"`
+	Title       string     `gorm:"size:255" json:"title"`
+	Content     string     `gorm:"type:text" json:"content"`
+	JobID       *uint      `gorm:"index" json:"job_id"` // 定时发布任务
+	User        string     `gorm:"size:100" json:"user"`
+	Revision    int        `gorm:"default:0" json:"revision"` // 发布后修改的次数
+	PublishedAt time.Time  `gorm:"index" json:"published_at"`
+	EditedAt    *time.Time `json:"edited_at"`
+	EditedBy    string     `gorm:"size:100" json:"edited_by"`
+}
+
+func (PublishRecord) TableName() string {
+	return "publish_records"
+}
+
+// recordPublished 保存发布记录，失败只记日志，不影响发布结果
+func recordPublished(imageID uint, platform, postRef, title, content, user string, jobID *uint) {
+	rec := PublishRecord{
+		ImageID:     imageID,
+		Platform:    platform,
+		PostRef:     postRef,
+		Title:       title,
+		Content:     content,
+		JobID:       jobID,
+		User:        user,
+		PublishedAt: time.Now(),
+	}
+	if err := db.Create(&rec).Error; err != nil {
+		log.Printf("保存发布记录失败: %v", err)
+	}
+}
+
+// ========== 发布记录 API ==========
+
+// listPublishRecords GET /api/publish/records?image_id=12&platform=xiaohongshu
+func listPublishRecords(c *gin.Context) {
+	query := db.Model(&PublishRecord{})
+	if id := c.Query("image_id"); id != "" {
+		query = query.Where("image_id = ?", id)
+	}
+	if platform := c.Query("platform"); platform != "" {
+		query = query.Where("platform = ?", platform)
+	}
+	var records []PublishRecord
+	query.Order("id DESC").Limit(100).Find(&records)
+	result := make([]gin.H, len(records))
+	for i, r := range records {
+		result[i] = gin.H{"record": r, "editable": pubManager.CanUpdate(publisher.PlatformType(r.Platform))}
+	}
+	c.JSON(200, gin.H{"records": result, "total": len(records)})
+}
+
+// updatePublishRecord PUT /api/publish/records/:id，修改已发布内容的标题、正文或替换图片
+// 只支持允许编辑的平台；未传的字段保持不变
+func updatePublishRecord(c *gin.Context) {
+	var rec PublishRecord
+	if err := db.First(&rec, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{"error": "发布记录不存在"})
+		return
+	}
+	var req struct {
+		ImageID  uint    `json:"image_id"` // 替换为另一张审核通过的图片，如修正后的重绘结果
+		Title    *string `json:"title"`
+		Content  *string `json:"content"`
+		Branding string  `json:"branding"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if req.ImageID == 0 && req.Title == nil && req.Content == nil {
+		c.JSON(400, gin.H{"error": "请指定 image_id、title 或 content"})
+		return
+	}
+	if !pubManager.CanUpdate(publisher.PlatformType(rec.Platform)) {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("平台 %s 不支持修改已发布内容", rec.Platform)})
+		return
+	}
+
+	title, content := rec.Title, rec.Content
+	if req.Title != nil {
+		title = *req.Title
+	}
+	if req.Content != nil {
+		content = *req.Content
+	}
+	imageID, imgPath := rec.ImageID, ""
+	if req.ImageID != 0 {
+		var record ImageRecord
+		if err := db.First(&record, req.ImageID).Error; err != nil {
+			c.JSON(404, gin.H{"error": "图片不存在"})
+			return
+		}
+		if record.Status != "approved" {
+			c.JSON(400, gin.H{"error": "只能发布审核通过的图片"})
+			return
+		}
+		path, err := publishImagePath(&record, rec.Platform, req.Branding)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "品牌处理失败: " + err.Error()})
+			return
+		}
+		imageID, imgPath = record.ID, path
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Minute)
+	defer cancel()
+	user := currentUser(c)
+	ref, err := pubManager.UpdatePost(publisher.PlatformType(rec.Platform), ctx, rec.PostRef, imgPath, title, content)
+	if err != nil {
+		recordActivity("publish_update_failed", rec.ImageID, user, rec.Platform+": "+err.Error())
+		c.JSON(502, gin.H{"error": "修改失败: " + err.Error()})
+		return
+	}
+
+	now := time.Now()
+	var changed []string
+	if imageID != rec.ImageID {
+		changed = append(changed, fmt.Sprintf("图片 #%d → #%d", rec.ImageID, imageID))
+	}
+	if title != rec.Title {
+		changed = append(changed, "标题")
+	}
+	if content != rec.Content {
+		changed = append(changed, "正文")
+	}
+	if len(changed) == 0 {
+		changed = append(changed, "重新提交")
+	}
+	db.Model(&rec).Updates(map[string]interface{}{
+		"image_id":  imageID,
+		"post_ref":  ref,
+		"title":     title,
+		"content":   content,
+		"revision":  rec.Revision + 1,
+		"edited_at": now,
+		"edited_by": user,
+	})
+	recordActivity("publish_updated", imageID, user, rec.Platform+": 修改"+strings.Join(changed, "、"))
+	emitEvent(db, "image.publish_updated", gin.H{"id": imageID, "platform": rec.Platform, "record_id": rec.ID, "post_ref": ref})
+	db.First(&rec, rec.ID)
+	c.JSON(200, gin.H{"message": "success", "record": rec})
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ========== 发布时间窗口 ==========
+
+// PublishWindowConfig 发布平台允许发布的时段和禁止发布的时间
+type PublishWindowConfig struct {
+	Allowed   []string `yaml:"allowed"`   // 每天允许的时段 HH:MM-HH:MM，可跨零点，为空表示全天
+	Blackouts []string `yaml:"blackouts"` // 禁发时间：2026-10-01、2026-10-01~2026-10-07 或 2026-10-01 12:00-14:00
+}
+
+// clockRange 一天内的时段，单位为分钟，end <= start 表示跨零点
+type clockRange struct{ start, end int }
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("时间格式应为 HH:MM: %s", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func parseClockRange(s string) (clockRange, error) {
+	parts := strings.SplitN(s, "-", 2)
+	if len(parts) != 2 {
+		return clockRange{}, fmt.Errorf("时段格式应为 HH:MM-HH:MM: %s", s)
+	}
+	start, err := parseClock(parts[0])
+	if err != nil {
+		return clockRange{}, err
+	}
+	end, err := parseClock(parts[1])
+	if err != nil {
+		return clockRange{}, err
+	}
+	return clockRange{start, end}, nil
+}
+
+// at 时段在 day 这一天的起止时刻
+func (r clockRange) at(day time.Time) (time.Time, time.Time) {
+	midnight := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	start := midnight.Add(time.Duration(r.start) * time.Minute)
+	end := midnight.Add(time.Duration(r.end) * time.Minute)
+	if r.end <= r.start {
+		end = end.AddDate(0, 0, 1)
+	}
+	return start, end
+}
+
+// parseBlackout 解析禁发时间为 [start, end) 区间，日期按业务时区
+func parseBlackout(s string) (time.Time, time.Time, error) {
+	s = strings.TrimSpace(s)
+	day := func(v string) (time.Time, error) {
+		return time.ParseInLocation("2006-01-02", strings.TrimSpace(v), bizLoc)
+	}
+	if from, to, ok := strings.Cut(s, "~"); ok {
+		start, err1 := day(from)
+		end, err2 := day(to)
+		if err1 != nil || err2 != nil || end.Before(start) {
+			return time.Time{}, time.Time{}, fmt.Errorf("无效的禁发日期范围: %s", s)
+		}
+		return start, end.AddDate(0, 0, 1), nil
+	}
+	if date, clock, ok := strings.Cut(s, " "); ok {
+		d, err := day(date)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("无效的禁发日期: %s", s)
+		}
+		r, err := parseClockRange(clock)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		start, end := r.at(d)
+		return start, end, nil
+	}
+	d, err := day(s)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("无效的禁发日期: %s", s)
+	}
+	return d, d.AddDate(0, 0, 1), nil
+}
+
+// validatePublishWindows 启动时检查配置，避免发布任务因格式错误被无限推迟
+func validatePublishWindows() error {
+	for plat, w := range cfg.Publish.Windows {
+		for _, s := range w.Allowed {
+			if _, err := parseClockRange(s); err != nil {
+				return fmt.Errorf("publish.windows.%s: %w", plat, err)
+			}
+		}
+		for _, s := range w.Blackouts {
+			if _, _, err := parseBlackout(s); err != nil {
+				return fmt.Errorf("publish.windows.%s: %w", plat, err)
+			}
+		}
+	}
+	return nil
+}
+
+// nextPublishTime 返回 t 之后（含 t）该平台最早可以发布的时刻
+func nextPublishTime(platform string, t time.Time) time.Time {
+	w, ok := cfg.Publish.Windows[platform]
+	if !ok {
+		return t
+	}
+	t = t.In(bizLoc)
+	// 禁发时间和允许时段交替推进，一年内找不到可用时刻说明配置有误，不再推迟
+	for i := 0; i < 1000; i++ {
+		moved := false
+		for _, s := range w.Blackouts {
+			start, end, err := parseBlackout(s)
+			if err == nil && !t.Before(start) && t.Before(end) {
+				t, moved = end, true
+			}
+		}
+		if next := nextAllowed(w.Allowed, t); !next.Equal(t) {
+			t, moved = next, true
+		}
+		if !moved {
+			return t
+		}
+	}
+	return t
+}
+
+// nextAllowed t 所在或之后最近的允许时段的开始时刻，t 已在时段内时返回 t
+func nextAllowed(allowed []string, t time.Time) time.Time {
+	if len(allowed) == 0 {
+		return t
+	}
+	var best time.Time
+	// 从前一天开始检查，覆盖跨零点的时段
+	for d := -1; d <= 1; d++ {
+		day := t.AddDate(0, 0, d)
+		for _, s := range allowed {
+			r, err := parseClockRange(s)
+			if err != nil {
+				continue
+			}
+			start, end := r.at(day)
+			if !t.Before(start) && t.Before(end) {
+				return t
+			}
+			if start.After(t) && (best.IsZero() || start.Before(best)) {
+				best = start
+			}
+		}
+	}
+	if best.IsZero() {
+		return t
+	}
+	return best
+}
+
+// ========== 发布时间窗口 API ==========
+
+// listPublishWindows GET /api/publish/windows，各平台的发布时段和下一次可发布时间
+func listPublishWindows(c *gin.Context) {
+	now := bizNow()
+	result := gin.H{}
+	for plat, w := range cfg.Publish.Windows {
+		next := nextPublishTime(plat, now)
+		result[plat] = gin.H{
+			"allowed":   w.Allowed,
+			"blackouts": w.Blackouts,
+			"open":      !next.After(now),
+			"next_slot": next,
+		}
+	}
+	c.JSON(200, gin.H{"windows": result, "now": now})
+}
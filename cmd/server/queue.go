@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ========== 任务队列后端 ==========
+
+// QueueConfig 生成和发布任务的队列：memory 为进程内队列（默认），redis 供多个实例共享任务
+type QueueConfig struct {
+	Backend    string `yaml:"backend"`    // memory, redis
+	InstanceID string `yaml:"instanceId"` // 实例标识，重启后恢复本实例执行中的任务，默认主机名，需保持不变
+	Redis      struct {
+		Addr        string `yaml:"addr"`
+		PasswordEnv string `yaml:"passwordEnv"` // 密码所在的环境变量
+		DB          int    `yaml:"db"`
+		Prefix      string `yaml:"prefix"` // 键前缀，多个环境共用一个 Redis 时区分，默认 image-platform
+	} `yaml:"redis"`
+}
+
+// 队列和广播主题
+const (
+	queueGenerate = "generate"
+	queuePublish  = "publish"
+	topicCancel   = "cancel" // 取消生成任务，由正在执行的实例处理
+)
+
+// 进程内队列的容量
+const memoryQueueSize = 1000
+
+var errQueueFull = errors.New("队列已满")
+
+// JobQueue 任务队列，队列中只放任务 ID，任务内容和状态以数据库为准
+type JobQueue interface {
+	Push(ctx context.Context, queue, id string) error
+	// Pop 阻塞到取出一个任务 ID
+	Pop(ctx context.Context, queue string) (string, error)
+	Len(ctx context.Context, queue string) int
+	// Broadcast 通知所有实例，Listen 在本实例处理通知
+	Broadcast(ctx context.Context, topic, msg string) error
+	Listen(topic string, fn func(msg string))
+	// Local 任务是否只在本进程执行
+	Local() bool
+}
+
+var (
+	jobQueue   JobQueue
+	instanceID string
+)
+
+// initJobQueue 按配置创建队列后端，Redis 连接失败时启动失败
+func initJobQueue() error {
+	instanceID = cfg.Queue.InstanceID
+	if instanceID == "" {
+		instanceID, _ = os.Hostname()
+	}
+	switch cfg.Queue.Backend {
+	case "", "memory":
+		jobQueue = newMemoryQueue()
+		return nil
+	case "redis":
+		q, err := newRedisQueue()
+		if err != nil {
+			return err
+		}
+		jobQueue = q
+		log.Printf("📮 使用 Redis 任务队列 %s（实例 %s）", cfg.Queue.Redis.Addr, instanceID)
+		return nil
+	}
+	return fmt.Errorf("不支持的队列后端: %s", cfg.Queue.Backend)
+}
+
+// ========== 进程内队列 ==========
+
+type memoryQueue struct {
+	mu        sync.Mutex
+	queues    map[string]chan string
+	listeners map[string][]func(string)
+}
+
+func newMemoryQueue() *memoryQueue {
+	return &memoryQueue{queues: make(map[string]chan string), listeners: make(map[string][]func(string))}
+}
+
+func (q *memoryQueue) queue(name string) chan string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	ch, ok := q.queues[name]
+	if !ok {
+		ch = make(chan string, memoryQueueSize)
+		q.queues[name] = ch
+	}
+	return ch
+}
+
+func (q *memoryQueue) Push(ctx context.Context, queue, id string) error {
+	select {
+	case q.queue(queue) <- id:
+		return nil
+	default:
+		return errQueueFull
+	}
+}
+
+func (q *memoryQueue) Pop(ctx context.Context, queue string) (string, error) {
+	select {
+	case id := <-q.queue(queue):
+		return id, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func (q *memoryQueue) Len(ctx context.Context, queue string) int {
+	return len(q.queue(queue))
+}
+
+func (q *memoryQueue) Broadcast(ctx context.Context, topic, msg string) error {
+	q.mu.Lock()
+	fns := q.listeners[topic]
+	q.mu.Unlock()
+	for _, fn := range fns {
+		fn(msg)
+	}
+	return nil
+}
+
+func (q *memoryQueue) Listen(topic string, fn func(msg string)) {
+	q.mu.Lock()
+	q.listeners[topic] = append(q.listeners[topic], fn)
+	q.mu.Unlock()
+}
+
+func (q *memoryQueue) Local() bool {
+	return true
+}
+
+// ========== Redis 队列 ==========
+
+// redisQueue 每个队列是一个 Redis 列表，LPUSH 入队、BRPOP 出队；广播使用 Pub/Sub
+// 实例在取出任务后、写入执行状态前退出时，该任务会丢失，可通过死信队列或重新提交补救
+type redisQueue struct {
+	client *redis.Client
+	prefix string
+}
+
+func newRedisQueue() (*redisQueue, error) {
+	rc := cfg.Queue.Redis
+	client := redis.NewClient(&redis.Options{Addr: rc.Addr, Password: os.Getenv(rc.PasswordEnv), DB: rc.DB})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		return nil, fmt.Errorf("连接 Redis 失败: %v", err)
+	}
+	prefix := rc.Prefix
+	if prefix == "" {
+		prefix = "image-platform"
+	}
+	return &redisQueue{client: client, prefix: prefix}, nil
+}
+
+func (q *redisQueue) key(name string) string {
+	return q.prefix + ":" + name
+}
+
+func (q *redisQueue) Push(ctx context.Context, queue, id string) error {
+	return q.client.LPush(ctx, q.key(queue), id).Err()
+}
+
+func (q *redisQueue) Pop(ctx context.Context, queue string) (string, error) {
+	for {
+		// 定期超时返回，ctx 取消后能及时退出
+		res, err := q.client.BRPop(ctx, 5*time.Second, q.key(queue)).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return res[1], nil
+	}
+}
+
+func (q *redisQueue) Len(ctx context.Context, queue string) int {
+	n, _ := q.client.LLen(ctx, q.key(queue)).Result()
+	return int(n)
+}
+
+func (q *redisQueue) Broadcast(ctx context.Context, topic, msg string) error {
+	return q.client.Publish(ctx, q.key(topic), msg).Err()
+}
+
+func (q *redisQueue) Listen(topic string, fn func(msg string)) {
+	sub := q.client.Subscribe(context.Background(), q.key(topic))
+	go func() {
+		for msg := range sub.Channel() {
+			fn(msg.Payload)
+		}
+	}()
+}
+
+func (q *redisQueue) Local() bool {
+	return false
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ========== 生成额度 ==========
+
+// quotaUsage 某个调用方当天的用量
+type quotaUsage struct {
+	Images int64   `json:"images"`
+	Cost   float64 `json:"cost"`
+}
+
+// anonymousBucket 未携带 X-User 和 X-API-Key 的调用共用的额度，使用默认额度
+const anonymousBucket = "anonymous"
+
+// quotaBucket 一次生成需要扣减的一份额度：用户、API Key 或匿名
+type quotaBucket struct {
+	Key    string // 预占用量的键
+	Column string // 生成记录中对应的列，匿名为空
+	Name   string
+	Limit  QuotaLimit
+}
+
+// limitFor 查找用户或 API Key 的额度，未单独配置时使用默认额度
+func limitFor(overrides map[string]QuotaLimit, name string) QuotaLimit {
+	if l, ok := overrides[name]; ok {
+		return l
+	}
+	return cfg.Quota.Default
+}
+
+// systemUsers 定时生成、日历、周报和压测等内部任务入库时使用的用户名
+// 这些任务不携带 API Key，不使用默认额度；需要限制时在 quota.users 中单独配置
+var systemUsers = map[string]bool{"schedule": true, "calendar": true, "weekly": true, loadTestUser: true}
+
+// userLimit 用户的额度，内部任务未单独配置时不限制
+func userLimit(user, apiKey string) QuotaLimit {
+	if apiKey == "" && systemUsers[user] {
+		return cfg.Quota.Users[user]
+	}
+	return limitFor(cfg.Quota.Users, user)
+}
+
+// quotaBuckets 调用方需要检查的额度，既没有用户也没有 API Key 时计入匿名额度
+func quotaBuckets(user, apiKey string) []quotaBucket {
+	if user == "" && apiKey == "" {
+		return []quotaBucket{{Key: anonymousBucket, Name: anonymousBucket, Limit: cfg.Quota.Default}}
+	}
+	var buckets []quotaBucket
+	if user != "" {
+		buckets = append(buckets, quotaBucket{Key: "user:" + user, Column: "user", Name: user, Limit: userLimit(user, apiKey)})
+	}
+	if apiKey != "" {
+		buckets = append(buckets, quotaBucket{Key: "api_key:" + apiKey, Column: "api_key", Name: apiKey, Limit: limitFor(cfg.Quota.APIKeys, apiKey)})
+	}
+	return buckets
+}
+
+// usageToday 统计当天某列（user / api_key）等于 name 的生成量
+func usageToday(column, name string) quotaUsage {
+	var u quotaUsage
+	db.Model(&ImageRecord{}).
+		Where(column+" = ? AND date = ? AND status <> ?", name, today(), "failed").
+		Select("COUNT(*) AS images, COALESCE(SUM(cost), 0) AS cost").
+		Scan(&u)
+	return u
+}
+
+// anonymousUsageToday 统计当天匿名调用的生成量
+func anonymousUsageToday() quotaUsage {
+	var u quotaUsage
+	db.Model(&ImageRecord{}).
+		Where("user = ? AND api_key = ? AND date = ? AND status <> ?", "", "", today(), "failed").
+		Select("COUNT(*) AS images, COALESCE(SUM(cost), 0) AS cost").
+		Scan(&u)
+	return u
+}
+
+// used 当天已入库的用量加上生成中预占的用量，调用方需持有 quotaMu
+func (b quotaBucket) used() quotaUsage {
+	var u quotaUsage
+	if b.Column == "" {
+		u = anonymousUsageToday()
+	} else {
+		u = usageToday(b.Column, b.Name)
+	}
+	r := quotaReserved[b.Key]
+	u.Images += r.Images
+	u.Cost += r.Cost
+	return u
+}
+
+// exceededError 超出该份额度时返回的错误
+func (b quotaBucket) exceededError() error {
+	switch b.Column {
+	case "user":
+		return genError(ErrCodeQuota, "用户 %s 今日生成额度已用完", b.Name)
+	case "api_key":
+		return genError(ErrCodeQuota, "API Key %s 今日生成额度已用完", b.Name)
+	}
+	return genError(ErrCodeQuota, "匿名调用今日生成额度已用完，请使用 API Key 调用")
+}
+
+// exceeds 判断再生成 images 张（总成本 cost）是否超出额度
+func exceeds(limit QuotaLimit, used quotaUsage, images int, cost float64) bool {
+	if limit.ImagesPerDay > 0 && used.Images+int64(images) > int64(limit.ImagesPerDay) {
+		return true
+	}
+	if limit.CostPerDay > 0 && used.Cost+cost > limit.CostPerDay {
+		return true
+	}
+	return false
+}
+
+var (
+	quotaMu sync.Mutex
+	// quotaReserved 已通过检查、还在生成中的用量，生成结果入库后释放
+	// 并发请求检查额度时计入这部分用量，避免同时通过检查后一起超出额度
+	quotaReserved = make(map[string]quotaUsage)
+)
+
+// checkQuota 异步生成入队前检查用户和 API Key 的当日额度，images 为本次生成张数，cost 为本次总成本
+// 只做提前拒绝，实际生成时由 reserveQuota 预占
+func checkQuota(user, apiKey string, images int, cost float64) error {
+	if !cfg.Quota.Enabled {
+		return nil
+	}
+	quotaMu.Lock()
+	defer quotaMu.Unlock()
+	for _, b := range quotaBuckets(user, apiKey) {
+		if exceeds(b.Limit, b.used(), images, cost) {
+			return b.exceededError()
+		}
+	}
+	return nil
+}
+
+// reserveQuota 检查额度并预占本次生成的用量，返回的 release 须在生成结果入库（或生成失败）后调用
+func reserveQuota(user, apiKey string, images int, cost float64) (release func(), err error) {
+	if !cfg.Quota.Enabled {
+		return func() {}, nil
+	}
+	quotaMu.Lock()
+	defer quotaMu.Unlock()
+	buckets := quotaBuckets(user, apiKey)
+	for _, b := range buckets {
+		if exceeds(b.Limit, b.used(), images, cost) {
+			return nil, b.exceededError()
+		}
+	}
+	for _, b := range buckets {
+		r := quotaReserved[b.Key]
+		r.Images += int64(images)
+		r.Cost += cost
+		quotaReserved[b.Key] = r
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			quotaMu.Lock()
+			defer quotaMu.Unlock()
+			for _, b := range buckets {
+				r := quotaReserved[b.Key]
+				r.Images -= int64(images)
+				r.Cost -= cost
+				if r.Images <= 0 {
+					delete(quotaReserved, b.Key)
+				} else {
+					quotaReserved[b.Key] = r
+				}
+			}
+		})
+	}, nil
+}
+
+// ========== 额度查询 API ==========
+func getQuota(c *gin.Context) {
+	describe := func(limit QuotaLimit, used quotaUsage) gin.H {
+		h := gin.H{"limit": limit, "used": used}
+		remaining := gin.H{}
+		if limit.ImagesPerDay > 0 {
+			remaining["images"] = max(int64(limit.ImagesPerDay)-used.Images, 0)
+		}
+		if limit.CostPerDay > 0 {
+			remaining["cost"] = max(limit.CostPerDay-used.Cost, 0)
+		}
+		h["remaining"] = remaining
+		return h
+	}
+
+	result := gin.H{
+		"enabled": cfg.Quota.Enabled,
+		"date":    today(),
+	}
+	if user := currentUser(c); user != "" {
+		result["user"] = gin.H{"name": user, "quota": describe(userLimit(user, currentAPIKey(c)), usageToday("user", user))}
+	}
+	if apiKey := currentAPIKey(c); apiKey != "" {
+		result["api_key"] = gin.H{"name": apiKey, "quota": describe(limitFor(cfg.Quota.APIKeys, apiKey), usageToday("api_key", apiKey))}
+	}
+	if currentUser(c) == "" && currentAPIKey(c) == "" {
+		result["anonymous"] = gin.H{"quota": describe(cfg.Quota.Default, anonymousUsageToday())}
+	}
+	c.JSON(200, result)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+
+	"image-platform/internal/generator"
+)
+
+// ========== 同 seed 重新生成 ==========
+
+// regenerateImage POST /api/images/:id/regenerate，用原图的提示词和 seed 重新生成，常用于换尺寸复现构图
+// 结果为新的待审核记录，source_id 指向原图
+func regenerateImage(c *gin.Context) {
+	var record ImageRecord
+	if err := db.First(&record, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{"error": "图片不存在"})
+		return
+	}
+	if record.Seed == nil {
+		c.JSON(400, gin.H{"error": "原图未记录 seed，无法复现"})
+		return
+	}
+	var req struct {
+		Size     string `json:"size"`     // 新尺寸，为空沿用原尺寸
+		Platform string `json:"platform"` // 为空沿用原平台，换平台后构图不保证一致
+		Model    string `json:"model"`    // 为空时同平台沿用原模型
+	}
+	c.ShouldBindJSON(&req)
+	if req.Size == "" {
+		req.Size = record.Size
+	}
+	if req.Platform == "" {
+		req.Platform = record.PlatformID
+	}
+	if req.Model == "" && req.Platform == record.PlatformID {
+		req.Model = record.Model
+	}
+	if !generator.CapabilitiesOf(platformType(req.Platform)).Seed {
+		c.JSON(400, gin.H{"error": "平台不支持 seed: " + req.Platform})
+		return
+	}
+
+	base := ImageRecord{
+		User:           currentUser(c),
+		APIKey:         currentAPIKey(c),
+		Workspace:      currentWorkspace(c),
+		PolicyFlag:     record.PolicyFlag,
+		Category:       record.Category,
+		NegativePrompt: record.NegativePrompt,
+		Seed:           record.Seed,
+		SourceID:       &record.ID,
+		Operation:      "regenerate",
+	}
+	saved, err := generateAndSave(c.Request.Context(), req.Platform, record.Prompt, req.Size, req.Model, base)
+	if err != nil {
+		status, code := 502, "generation_failed"
+		switch errorCode(err) {
+		case ErrCodeQuota:
+			status, code = 429, "quota_exceeded"
+		case ErrCodeDraining:
+			status, code = 503, ErrCodeDraining
+		case ErrCodeCircuitOpen:
+			status, code = 503, ErrCodeCircuitOpen
+		}
+		c.JSON(status, gin.H{"error": "生成失败: " + err.Error(), "code": code, "error_code": errorCode(err)})
+		return
+	}
+	recordActivity("regenerated", record.ID, currentUser(c), fmt.Sprintf("seed %d 尺寸 %s 生成 #%d", *record.Seed, req.Size, saved.ID))
+	c.JSON(200, gin.H{"message": "success", "id": saved.ID, "source_id": record.ID, "seed": saved.Seed, "record": saved, "url": imageURL(saved.Path)})
+}
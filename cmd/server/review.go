@@ -0,0 +1,51 @@
+package main
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ========== 审核意见 ==========
+
+// ImageReview 每一次人工审核操作，多人审核时用于统计通过票数
+type ImageReview struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	ImageID   uint      `gorm:"index;not null" json:"image_id"`
+	Reviewer  string    `gorm:"size:100" json:"reviewer"`
+	Identity  string    `gorm:"size:100;index" json:"identity"` // 审核人经过鉴权的身份（API Key、管理员令牌或邮件链接），多人审核按它计票
+	Status    string    `gorm:"size:20" json:"status"`
+	Note      string    `gorm:"type:text" json:"note"`
+	Via       string    `gorm:"size:20" json:"via"` // 审核方式：后台为空，email 为邮件链接
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (ImageReview) TableName() string {
+	return "image_reviews"
+}
+
+// countApprovals 统计不同审核身份的通过票数，X-User 可以随意填写，不作为计票依据
+func countApprovals(imageID uint) int64 {
+	var count int64
+	db.Model(&ImageReview{}).
+		Where("image_id = ? AND status = ? AND identity <> ''", imageID, "approved").
+		Distinct("identity").
+		Count(&count)
+	return count
+}
+
+// ========== 审核意见 API ==========
+func listImageReviews(c *gin.Context) {
+	var record ImageRecord
+	if err := db.First(&record, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{"error": "图片不存在"})
+		return
+	}
+	var reviews []ImageReview
+	db.Where("image_id = ?", record.ID).Order("id").Find(&reviews)
+	c.JSON(200, gin.H{
+		"reviews":   reviews,
+		"approvals": countApprovals(record.ID),
+		"required":  max(record.RequiredApprovals, 1),
+	})
+}
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ========== 定时生成 ==========
+
+// Schedule 按 cron 表达式周期执行的生成计划，每次把 prompts 中的提示词各生成 count 张，进入待审核
+type Schedule struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	Name          string     `gorm:"size:100;not null" json:"name"`
+	Cron          string     `gorm:"size:100;not null" json:"cron"` // 分 时 日 月 周，按业务时区计算，如 "0 8 * * *"
+	Prompts       string     `gorm:"type:text" json:"-"`            // 提示词列表（JSON）
+	PromptList    []string   `gorm:"-" json:"prompts"`
+	Platform      string     `gorm:"size:50" json:"platform"` // 为空使用默认平台
+	Model         string     `gorm:"size:100" json:"model"`
+	Size          string     `gorm:"size:20" json:"size"`
+	Category      string     `gorm:"size:50" json:"category"`
+	Count         int        `gorm:"default:1" json:"count"` // 每个提示词生成的张数
+	Enabled       bool       `gorm:"index" json:"enabled"`
+	NextRunAt     *time.Time `gorm:"index" json:"next_run_at"`
+	LastRunAt     *time.Time `json:"last_run_at"`
+	LastStatus    string     `gorm:"size:20" json:"last_status"` // running, done, failed
+	LastGenerated int        `json:"last_generated"`
+	LastFailed    int        `json:"last_failed"`
+	CreatedBy     string     `gorm:"size:100" json:"created_by"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+func (Schedule) TableName() string {
+	return "schedules"
+}
+
+// loadPrompts 解析入库的提示词列表
+func (s *Schedule) loadPrompts() {
+	json.Unmarshal([]byte(s.Prompts), &s.PromptList)
+}
+
+// ========== cron 表达式 ==========
+
+// cronSpec 解析后的 cron 表达式，每个字段为允许的取值集合
+type cronSpec struct {
+	minute, hour, dom, month, dow map[int]bool
+	domAny, dowAny                bool
+}
+
+// parseCron 解析 5 段 cron 表达式，支持 *、列表、范围和步长，如 "*/30 8-18 * * 1-5"
+func parseCron(expr string) (*cronSpec, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron 表达式应为 5 段（分 时 日 月 周）: %s", expr)
+	}
+	bounds := [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	sets := make([]map[int]bool, 5)
+	for i, f := range fields {
+		set, err := parseCronField(f, bounds[i][0], bounds[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("cron 表达式第 %d 段无效 %q: %v", i+1, f, err)
+		}
+		sets[i] = set
+	}
+	// 周日可写作 0 或 7
+	if sets[4][7] {
+		sets[4][0] = true
+	}
+	return &cronSpec{
+		minute: sets[0], hour: sets[1], dom: sets[2], month: sets[3], dow: sets[4],
+		domAny: fields[2] == "*", dowAny: fields[4] == "*",
+	}, nil
+}
+
+func parseCronField(field string, lo, hi int) (map[int]bool, error) {
+	set := map[int]bool{}
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("步长无效")
+			}
+			step, part = n, part[:i]
+		}
+		from, to := lo, hi
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if from, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, fmt.Errorf("取值无效")
+			}
+			to = from
+			if len(bounds) == 2 {
+				if to, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, fmt.Errorf("取值无效")
+				}
+			}
+		}
+		if from < lo || to > hi || from > to {
+			return nil, fmt.Errorf("取值超出范围 %d-%d", lo, hi)
+		}
+		for v := from; v <= to; v += step {
+			set[v] = true
+		}
+	}
+	return set, nil
+}
+
+// matchDay 日和周都指定时满足其一即可，与标准 cron 一致
+func (s *cronSpec) matchDay(t time.Time) bool {
+	dom, dow := s.dom[t.Day()], s.dow[int(t.Weekday())]
+	switch {
+	case s.domAny && s.dowAny:
+		return true
+	case s.domAny:
+		return dow
+	case s.dowAny:
+		return dom
+	}
+	return dom || dow
+}
+
+// next 严格晚于 after 的下一次执行时间（业务时区），一年内没有匹配时返回零值
+func (s *cronSpec) next(after time.Time) time.Time {
+	t := after.In(bizLoc).Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(1, 0, 0)
+	for t.Before(limit) {
+		if !s.month[int(t.Month())] || !s.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, bizLoc)
+			continue
+		}
+		if !s.hour[t.Hour()] {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, bizLoc)
+			continue
+		}
+		if s.minute[t.Minute()] {
+			return t
+		}
+		t = t.Add(time.Minute)
+	}
+	return time.Time{}
+}
+
+// nextRun 计算计划的下一次执行时间
+func nextRun(expr string, after time.Time) (*time.Time, error) {
+	spec, err := parseCron(expr)
+	if err != nil {
+		return nil, err
+	}
+	next := spec.next(after)
+	if next.IsZero() {
+		return nil, fmt.Errorf("cron 表达式在一年内没有执行时间: %s", expr)
+	}
+	return &next, nil
+}
+
+// ========== 定时生成调度 ==========
+
+// runScheduleRunner 每分钟检查一次到期的生成计划
+func runScheduleRunner() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		var due []Schedule
+		db.Where("enabled = ? AND next_run_at <= ?", true, time.Now()).Find(&due)
+		for i := range due {
+			s := &due[i]
+			next, err := nextRun(s.Cron, time.Now())
+			if err != nil {
+				log.Printf("⏰ 计划 #%d cron 无效，已停用: %v", s.ID, err)
+				db.Model(&Schedule{}).Where("id = ?", s.ID).Updates(map[string]interface{}{"enabled": false, "next_run_at": nil})
+				continue
+			}
+			// 多实例部署时只有把 next_run_at 推进成功的实例执行；停机期间错过的多次只补执行一次
+			res := db.Model(&Schedule{}).Where("id = ? AND next_run_at = ?", s.ID, s.NextRunAt).Update("next_run_at", next)
+			if res.Error != nil || res.RowsAffected == 0 {
+				continue
+			}
+			go runSchedule(s)
+		}
+	}
+}
+
+// runSchedule 执行一次计划，逐个提示词生成并入库为待审核记录
+func runSchedule(s *Schedule) {
+	s.loadPrompts()
+	now := time.Now()
+	db.Model(&Schedule{}).Where("id = ?", s.ID).Updates(map[string]interface{}{"last_status": "running", "last_run_at": now})
+
+	platform := s.Platform
+	if platform == "" {
+		platform = getOrCreateSettings().Platform
+	}
+	base := ImageRecord{User: "schedule", Category: s.Category, ScheduleID: &s.ID}
+	var (
+		mu     sync.Mutex
+		ids    []uint
+		failed int
+		wg     sync.WaitGroup
+		sem    = make(chan struct{}, cfg.ImageGen.MaxWorkers)
+	)
+	for _, prompt := range s.PromptList {
+		if verdict := checkPromptPolicy(context.Background(), prompt, platform); verdict.Blocked {
+			log.Printf("⏰ 计划 #%d 提示词不符合内容策略，跳过: %s", s.ID, verdict.Reason)
+			mu.Lock()
+			failed += s.Count
+			mu.Unlock()
+			continue
+		}
+		for i := 0; i < s.Count; i++ {
+			wg.Add(1)
+			go func(prompt string) {
+				defer wg.Done()
+				sem <- struct{}{}
+				defer func() { <-sem }()
+				record, err := generateAndSave(jobContext("schedule", s.ID), platform, prompt, s.Size, s.Model, base)
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					log.Printf("⏰ 计划 #%d 生成失败: %v", s.ID, err)
+					failed++
+					return
+				}
+				ids = append(ids, record.ID)
+			}(prompt)
+		}
+	}
+	wg.Wait()
+
+	status := "done"
+	if len(ids) == 0 {
+		status = "failed"
+	}
+	db.Model(&Schedule{}).Where("id = ?", s.ID).Updates(map[string]interface{}{
+		"last_status": status, "last_generated": len(ids), "last_failed": failed})
+	log.Printf("⏰ 计划 #%d「%s」执行完成: 生成 %d 张，失败 %d 张", s.ID, s.Name, len(ids), failed)
+	if len(ids) > 0 {
+		emitEvent(db, "schedule.generated", gin.H{"schedule_id": s.ID, "name": s.Name, "image_ids": ids, "failed": failed})
+	}
+}
+
+// ========== 定时生成 API ==========
+
+// scheduleRequest 创建和修改计划的请求体
+type scheduleRequest struct {
+	Name     string   `json:"name" binding:"required"`
+	Cron     string   `json:"cron" binding:"required"`
+	Prompts  []string `json:"prompts" binding:"required"`
+	Platform string   `json:"platform"`
+	Model    string   `json:"model"`
+	Size     string   `json:"size"`
+	Category string   `json:"category"`
+	Count    int      `json:"count"`
+	Enabled  *bool    `json:"enabled"`
+}
+
+// validate 校验请求，返回错误信息
+func (req *scheduleRequest) validate() string {
+	if _, err := parseCron(req.Cron); err != nil {
+		return err.Error()
+	}
+	prompts := req.Prompts[:0]
+	for _, p := range req.Prompts {
+		if p = strings.TrimSpace(p); p != "" {
+			prompts = append(prompts, p)
+		}
+	}
+	req.Prompts = prompts
+	if len(req.Prompts) == 0 || len(req.Prompts) > 20 {
+		return "prompts 应为 1-20 个提示词"
+	}
+	if req.Count <= 0 {
+		req.Count = 1
+	}
+	if req.Count > 10 {
+		return "count 最大为 10"
+	}
+	if req.Platform != "" {
+		if p, ok := cfg.Platforms[req.Platform]; !ok || !p.Enabled {
+			return "平台不可用: " + req.Platform
+		}
+	}
+	if !categoryExists(req.Category) {
+		return "分类不存在: " + req.Category
+	}
+	return ""
+}
+
+// applyTo 把请求写入计划并重新计算下一次执行时间
+func (req *scheduleRequest) applyTo(s *Schedule) error {
+	prompts, _ := json.Marshal(req.Prompts)
+	s.Name, s.Cron, s.Prompts, s.PromptList = req.Name, req.Cron, string(prompts), req.Prompts
+	s.Platform, s.Model, s.Size, s.Category, s.Count = req.Platform, req.Model, req.Size, req.Category, req.Count
+	if req.Enabled != nil {
+		s.Enabled = *req.Enabled
+	}
+	s.NextRunAt = nil
+	if s.Enabled {
+		next, err := nextRun(s.Cron, time.Now())
+		if err != nil {
+			return err
+		}
+		s.NextRunAt = next
+	}
+	return nil
+}
+
+// createSchedule POST /api/schedules
+func createSchedule(c *gin.Context) {
+	var req scheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		c.JSON(400, gin.H{"error": msg})
+		return
+	}
+	s := Schedule{Enabled: true, CreatedBy: currentUser(c)}
+	if err := req.applyTo(&s); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err := db.Create(&s).Error; err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, s)
+}
+
+// listSchedules GET /api/schedules
+func listSchedules(c *gin.Context) {
+	var schedules []Schedule
+	db.Order("id").Find(&schedules)
+	for i := range schedules {
+		schedules[i].loadPrompts()
+	}
+	c.JSON(200, gin.H{"schedules": schedules, "total": len(schedules)})
+}
+
+// getSchedule GET /api/schedules/:id，计划详情及最近生成的图片
+func getSchedule(c *gin.Context) {
+	var s Schedule
+	if err := db.First(&s, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{"error": "计划不存在"})
+		return
+	}
+	s.loadPrompts()
+	var records []ImageRecord
+	db.Where("schedule_id = ?", s.ID).Order("generated_at DESC").Limit(50).Find(&records)
+	c.JSON(200, gin.H{"schedule": s, "records": withImageURLs(records)})
+}
+
+// updateSchedule PUT /api/schedules/:id
+func updateSchedule(c *gin.Context) {
+	var s Schedule
+	if err := db.First(&s, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{"error": "计划不存在"})
+		return
+	}
+	var req scheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		c.JSON(400, gin.H{"error": msg})
+		return
+	}
+	if err := req.applyTo(&s); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	db.Save(&s)
+	c.JSON(200, s)
+}
+
+func deleteSchedule(c *gin.Context) {
+	db.Delete(&Schedule{}, c.Param("id"))
+	c.JSON(200, gin.H{"message": "success"})
+}
+
+// runScheduleNow POST /api/schedules/:id/run，立即执行一次，不影响下一次执行时间
+func runScheduleNow(c *gin.Context) {
+	var s Schedule
+	if err := db.First(&s, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{"error": "计划不存在"})
+		return
+	}
+	if s.LastStatus == "running" {
+		c.JSON(409, gin.H{"error": "计划正在执行"})
+		return
+	}
+	go runSchedule(&s)
+	c.JSON(200, gin.H{"message": "success", "schedule_id": s.ID})
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ========== 图库分享链接 ==========
+
+// ShareLink 只读图库分享链接，凭 Token 访问某天审核通过的图片
+type ShareLink struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Token     string    `gorm:"size:64;uniqueIndex;not null" json:"-"` // 只在创建时通过 url 返回一次
+	Date      string    `gorm:"size:20;not null" json:"date"`
+	Category  string    `gorm:"size:50" json:"category"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedBy string    `gorm:"size:100" json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (ShareLink) TableName() string {
+	return "share_links"
+}
+
+func newToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// publicURL 拼接对外访问地址，优先使用配置的 server.publicUrl
+func publicURL(c *gin.Context, path string) string {
+	if cfg.Server.PublicURL != "" {
+		return cfg.Server.PublicURL + path
+	}
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host + path
+}
+
+// shareCreator 分享链接的创建人，未携带 X-User 时记为 admin
+func shareCreator(c *gin.Context) string {
+	if user := currentUser(c); user != "" {
+		return user
+	}
+	return "admin"
+}
+
+// createShareLink POST /api/gallery/share?date=2026-02-20&hours=72
+func createShareLink(c *gin.Context) {
+	date := c.DefaultQuery("date", today())
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		c.JSON(400, gin.H{"error": "date 格式应为 YYYY-MM-DD"})
+		return
+	}
+	hours, _ := strconv.Atoi(c.DefaultQuery("hours", "72"))
+	if hours <= 0 || hours > 24*30 {
+		c.JSON(400, gin.H{"error": "hours 取值范围 1-720"})
+		return
+	}
+
+	link := ShareLink{
+		Token:     newToken(),
+		Date:      date,
+		Category:  c.Query("category"),
+		ExpiresAt: time.Now().Add(time.Duration(hours) * time.Hour),
+		CreatedBy: shareCreator(c),
+	}
+	if err := db.Create(&link).Error; err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{
+		"url":        publicURL(c, "/share/"+link.Token),
+		"json_url":   publicURL(c, "/share/"+link.Token+"?format=json"),
+		"expires_at": link.ExpiresAt,
+		"link":       link,
+	})
+}
+
+// listShareLinks GET /api/gallery/shares，未过期的分享链接，不返回 Token
+func listShareLinks(c *gin.Context) {
+	var links []ShareLink
+	db.Where("expires_at > ?", time.Now()).Order("id DESC").Find(&links)
+	c.JSON(200, gin.H{"links": links, "total": len(links)})
+}
+
+// revokeShareLink DELETE /api/gallery/share/:id，按列表中的 id 撤销
+func revokeShareLink(c *gin.Context) {
+	res := db.Delete(&ShareLink{}, c.Param("id"))
+	if res.RowsAffected == 0 {
+		c.JSON(404, gin.H{"error": "分享链接不存在"})
+		return
+	}
+	c.JSON(200, gin.H{"message": "success"})
+}
+
+// sharedGallery 分享页，?format=json 返回 JSON
+func sharedGallery(c *gin.Context) {
+	var link ShareLink
+	if err := db.Where("token = ?", c.Param("token")).First(&link).Error; err != nil || time.Now().After(link.ExpiresAt) {
+		if c.Query("format") == "json" {
+			c.JSON(404, gin.H{"error": "链接不存在或已过期"})
+		} else {
+			c.String(http.StatusNotFound, "链接不存在或已过期")
+		}
+		return
+	}
+
+	var records []ImageRecord
+	query := db.Where("date = ? AND status = ?", link.Date, "approved")
+	if link.Category != "" {
+		query = query.Where("category = ?", link.Category)
+	}
+	query.Order("generated_at DESC").Find(&records)
+
+	// 对外只暴露必要字段
+	type sharedImage struct {
+		ID          uint      `json:"id"`
+		ImageURL    string    `json:"imageUrl"`
+		Prompt      string    `json:"prompt"`
+		Category    string    `json:"category"`
+		GeneratedAt time.Time `json:"generated_at"`
+	}
+	images := make([]sharedImage, len(records))
+	for i, r := range records {
+		images[i] = sharedImage{
+			ID:          r.ID,
+			ImageURL:    imageURL(r.Path),
+			Prompt:      r.Prompt,
+			Category:    r.Category,
+			GeneratedAt: r.GeneratedAt,
+		}
+	}
+
+	if c.Query("format") == "json" {
+		c.JSON(200, gin.H{"date": link.Date, "category": link.Category, "images": images, "total": len(images), "expires_at": link.ExpiresAt})
+		return
+	}
+	c.HTML(http.StatusOK, "share.html", gin.H{
+		"date":      link.Date,
+		"category":  link.Category,
+		"images":    images,
+		"total":     len(images),
+		"expiresAt": link.ExpiresAt,
+	})
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ========== 平台延迟 SLO ==========
+
+// SLOConfig 平台生成延迟的 SLO，窗口内 p95 超过目标时发出 provider.slo_breached 事件，恢复后发出 provider.slo_recovered
+// 延迟统计总是开启，只有告警需要配置
+type SLOConfig struct {
+	Enabled    bool           `yaml:"enabled"`
+	P95Ms      int            `yaml:"p95Ms"`      // 默认 p95 目标（毫秒），0 为不告警
+	Platforms  map[string]int `yaml:"platforms"`  // 按平台覆盖 p95 目标，如本地显卡、Midjourney 明显慢于其他平台
+	Window     int            `yaml:"window"`     // 判断窗口（分钟），默认 60
+	MinSamples int            `yaml:"minSamples"` // 窗口内样本数少于该值时不判断，默认 20
+}
+
+// latencyWindows /api/platforms 展示的滚动窗口
+var latencyWindows = []struct {
+	Name string
+	D    time.Duration
+}{{"5m", 5 * time.Minute}, {"1h", time.Hour}}
+
+// 每个平台最多保留的样本数，超出时丢弃最早的
+const maxLatencySamples = 10000
+
+type latencySample struct {
+	at time.Time
+	d  time.Duration
+}
+
+// platformLatency 单个平台的延迟样本和 SLO 状态
+type platformLatency struct {
+	samples   []latencySample // 按时间顺序
+	breached  bool
+	checkedAt time.Time
+}
+
+var (
+	latencyMu sync.Mutex
+	latencies = make(map[string]*platformLatency)
+)
+
+// latencyRetention 样本保留时长，覆盖展示窗口和 SLO 窗口
+func latencyRetention() time.Duration {
+	return max(time.Hour, time.Duration(cfg.Observability.SLO.Window)*time.Minute)
+}
+
+// recordLatency 记录一次成功调用平台的耗时（不含排队），并按需检查 SLO
+func recordLatency(platform string, d time.Duration) {
+	now := time.Now()
+	latencyMu.Lock()
+	pl, ok := latencies[platform]
+	if !ok {
+		pl = &platformLatency{}
+		latencies[platform] = pl
+	}
+	pl.samples = append(pl.samples, latencySample{at: now, d: d})
+	// 丢弃过期和超出数量的样本
+	cutoff := now.Add(-latencyRetention())
+	drop := sort.Search(len(pl.samples), func(i int) bool { return pl.samples[i].at.After(cutoff) })
+	drop = max(drop, len(pl.samples)-maxLatencySamples)
+	if drop > 0 {
+		pl.samples = append(pl.samples[:0], pl.samples[drop:]...)
+	}
+
+	// 每分钟最多检查一次，避免每次调用都排序
+	var event string
+	var payload gin.H
+	if target := sloTarget(platform); target > 0 && now.Sub(pl.checkedAt) >= time.Minute {
+		pl.checkedAt = now
+		sc := cfg.Observability.SLO
+		stats := pl.stats(now, time.Duration(sc.Window)*time.Minute)
+		if stats.Samples >= sc.MinSamples {
+			breached := stats.P95Ms > float64(target)
+			if breached != pl.breached {
+				pl.breached = breached
+				event = "provider.slo_recovered"
+				if breached {
+					event = "provider.slo_breached"
+				}
+				payload = gin.H{"platform": platform, "p50_ms": stats.P50Ms, "p95_ms": stats.P95Ms, "target_p95_ms": target,
+					"window_minutes": sc.Window, "samples": stats.Samples}
+			}
+		}
+	}
+	latencyMu.Unlock()
+
+	if event != "" {
+		if event == "provider.slo_breached" {
+			log.Printf("🐢 [%s] 近 %d 分钟 p95 延迟 %.0fms，超过 SLO %dms", platform, payload["window_minutes"], payload["p95_ms"], payload["target_p95_ms"])
+		} else {
+			log.Printf("🐢 [%s] p95 延迟恢复到 %.0fms", platform, payload["p95_ms"])
+		}
+		emitEvent(db, event, payload)
+	}
+}
+
+// sloTarget 平台的 p95 目标（毫秒），未开启或未配置时为 0
+func sloTarget(platform string) int {
+	sc := cfg.Observability.SLO
+	if !sc.Enabled {
+		return 0
+	}
+	if t, ok := sc.Platforms[platform]; ok {
+		return t
+	}
+	return sc.P95Ms
+}
+
+// latencyStats 窗口内的延迟分位数
+type latencyStats struct {
+	Samples int     `json:"samples"`
+	P50Ms   float64 `json:"p50_ms"`
+	P95Ms   float64 `json:"p95_ms"`
+}
+
+// stats 最近 window 内样本的 p50/p95（最近秩法），调用方持有 latencyMu
+func (pl *platformLatency) stats(now time.Time, window time.Duration) latencyStats {
+	cutoff := now.Add(-window)
+	start := sort.Search(len(pl.samples), func(i int) bool { return pl.samples[i].at.After(cutoff) })
+	ds := make([]time.Duration, 0, len(pl.samples)-start)
+	for _, s := range pl.samples[start:] {
+		ds = append(ds, s.d)
+	}
+	if len(ds) == 0 {
+		return latencyStats{}
+	}
+	sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+	pct := func(p int) float64 {
+		d := ds[(len(ds)*p+99)/100-1]
+		return float64(d.Milliseconds())
+	}
+	return latencyStats{Samples: len(ds), P50Ms: pct(50), P95Ms: pct(95)}
+}
+
+// platformLatencyInfo 平台在各展示窗口的延迟和 SLO 状态，用于 /api/platforms
+func platformLatencyInfo(platform string) gin.H {
+	now := time.Now()
+	latencyMu.Lock()
+	defer latencyMu.Unlock()
+	windows := gin.H{}
+	pl, ok := latencies[platform]
+	for _, w := range latencyWindows {
+		if ok {
+			windows[w.Name] = pl.stats(now, w.D)
+		} else {
+			windows[w.Name] = latencyStats{}
+		}
+	}
+	info := gin.H{"windows": windows}
+	if target := sloTarget(platform); target > 0 {
+		info["slo"] = gin.H{"target_p95_ms": target, "window_minutes": cfg.Observability.SLO.Window, "breached": ok && pl.breached}
+	}
+	return info
+}
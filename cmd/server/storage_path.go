@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ========== 存储路径模板 ==========
+
+// imageGen.pathTemplate 中可用的变量，{{record_id}} 在记录入库后才确定，所以文件先按默认目录保存，入库时再移动
+var pathVars = map[string]func(r *ImageRecord) string{
+	"workspace": func(r *ImageRecord) string { return r.Workspace },
+	"user":      func(r *ImageRecord) string { return r.User },
+	"category":  func(r *ImageRecord) string { return r.Category },
+	"date":      func(r *ImageRecord) string { return r.Date },
+	"platform":  func(r *ImageRecord) string { return r.PlatformID },
+	"operation": func(r *ImageRecord) string { return r.Operation },
+	"record_id": func(r *ImageRecord) string { return strconv.FormatUint(uint64(r.ID), 10) },
+	"name":      func(r *ImageRecord) string { return strings.TrimSuffix(r.Name, filepath.Ext(r.Name)) },
+	"ext":       func(r *ImageRecord) string { return strings.TrimPrefix(filepath.Ext(r.Path), ".") },
+}
+
+var pathVarPattern = regexp.MustCompile(`\{\{\s*(\w+)\s*\}\}`)
+
+// validatePathTemplate 启动时检查路径模板：必须是相对路径，变量都已知，且包含 record_id 或 name 保证文件名不重复
+func validatePathTemplate() error {
+	tmpl := cfg.ImageGen.PathTemplate
+	if tmpl == "" {
+		return nil
+	}
+	if filepath.IsAbs(tmpl) {
+		return fmt.Errorf("pathTemplate 应为相对 outputDir 的路径: %s", tmpl)
+	}
+	unique := false
+	for _, m := range pathVarPattern.FindAllStringSubmatch(tmpl, -1) {
+		if _, ok := pathVars[m[1]]; !ok {
+			return fmt.Errorf("pathTemplate 中的变量不存在: %s", m[1])
+		}
+		if m[1] == "record_id" || m[1] == "name" {
+			unique = true
+		}
+	}
+	if !unique {
+		return fmt.Errorf("pathTemplate 需要包含 {{record_id}} 或 {{name}}")
+	}
+	return nil
+}
+
+// pathSegment 变量值作为路径的一段，去掉分隔符和 ..，避免写到 outputDir 之外
+func pathSegment(value string) string {
+	value = strings.NewReplacer("/", "_", "\\", "_", "..", "_").Replace(strings.TrimSpace(value))
+	if value == "" {
+		return "default"
+	}
+	return value
+}
+
+// templatedPath 按路径模板计算记录的文件位置，未配置模板时返回空
+func templatedPath(record *ImageRecord) string {
+	if cfg.ImageGen.PathTemplate == "" {
+		return ""
+	}
+	rel := pathVarPattern.ReplaceAllStringFunc(cfg.ImageGen.PathTemplate, func(s string) string {
+		return pathSegment(pathVars[pathVarPattern.FindStringSubmatch(s)[1]](record))
+	})
+	return filepath.Join(cfg.ImageGen.OutputDir, filepath.Clean("/"+rel))
+}
+
+// relocateImage 入库后把图片移动到模板路径（或按 record_id、prompt 文件名策略改名）并更新记录，返回撤销移动的函数
+// 目标文件已存在时追加序号，不会覆盖其他记录的图片
+func relocateImage(tx *gorm.DB, record *ImageRecord) (undo func(), err error) {
+	undo = func() {}
+	if record.Path == "" {
+		return undo, nil
+	}
+	path := templatedPath(record)
+	if record.Status == "playground" {
+		path = playgroundPath(record)
+	} else if path == "" {
+		if name := recordFilename(record); name != "" {
+			path = filepath.Join(filepath.Dir(record.Path), name)
+		}
+	}
+	if path == "" || path == record.Path {
+		return undo, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return undo, fmt.Errorf("创建目录失败: %v", err)
+	}
+	if path, err = moveImageFile(record.Path, path); err != nil {
+		return undo, fmt.Errorf("移动图片失败: %v", err)
+	}
+	old := record.Path
+	if err := tx.Model(record).Updates(map[string]interface{}{"path": path, "name": filepath.Base(path)}).Error; err != nil {
+		os.Rename(path, old)
+		return undo, err
+	}
+	oldName := record.Name
+	record.Path, record.Name = path, filepath.Base(path)
+	return func() {
+		os.Rename(path, old)
+		record.Path, record.Name = old, oldName
+	}, nil
+}
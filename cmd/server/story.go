@@ -0,0 +1,480 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"image-platform/internal/publisher"
+	"image-platform/internal/requestid"
+)
+
+// ========== 故事模式 ==========
+
+// Story 按大纲生成的一组有顺序的图片（封面 + 内容页），整组审核、作为一篇多图内容发布
+// 各页使用同一平台、模型、尺寸和 seed，并附加统一的风格描述，尽量保持画面一致
+type Story struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	Title      string     `gorm:"size:255;not null" json:"title"`
+	Outline    string     `gorm:"type:text;not null" json:"-"` // 各页提示词和配文 JSON，第一页为封面
+	Style      string     `gorm:"size:500" json:"style"`       // 附加到每页提示词后的风格描述
+	Platform   string     `gorm:"size:50" json:"platform"`
+	Model      string     `gorm:"size:100" json:"model"`
+	Size       string     `gorm:"size:20" json:"size"`
+	Seed       *int64     `json:"seed"`  // 为空时使用封面实际的 seed
+	Pages      int        `json:"pages"` // 含封面的总页数
+	Failed     int        `json:"failed"`
+	Status     string     `gorm:"size:20;default:'generating';index" json:"status"` // generating, ready, approved, rejected, published
+	User       string     `gorm:"size:100;index" json:"user"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
+
+func (Story) TableName() string {
+	return "stories"
+}
+
+// storyPage 大纲中的一页，Caption 为发布时该页的配文
+type storyPage struct {
+	Prompt  string `json:"prompt"`
+	Caption string `json:"caption"`
+}
+
+// 小红书单篇笔记最多 18 张图片
+const maxStoryPages = 18
+
+func (s *Story) outline() []storyPage {
+	var pages []storyPage
+	json.Unmarshal([]byte(s.Outline), &pages)
+	return pages
+}
+
+// pagePrompt 第 page 页实际使用的提示词
+func (s *Story) pagePrompt(page int) string {
+	pages := s.outline()
+	if page < 0 || page >= len(pages) {
+		return ""
+	}
+	if s.Style == "" {
+		return pages[page].Prompt
+	}
+	return pages[page].Prompt + ", " + s.Style
+}
+
+// storyBase 故事各页共用的记录字段
+func storyBase(story *Story, base ImageRecord, page int) ImageRecord {
+	base.StoryID = &story.ID
+	base.StoryPage = page
+	base.Seed = story.Seed
+	return base
+}
+
+// runStory 先生成封面，未指定 seed 时把封面的 seed 用于其余各页，其余页并发生成
+func runStory(story Story, base ImageRecord) {
+	log.Printf("📖 故事 #%d 开始: %d 页", story.ID, story.Pages)
+	ctx := jobContext("story", story.ID)
+	failed := 0
+
+	cover, err := generateAndSave(ctx, story.Platform, story.pagePrompt(0), story.Size, story.Model, storyBase(&story, base, 0))
+	if err != nil {
+		log.Printf("📖 故事 #%d 封面生成失败: %v", story.ID, err)
+		failed++
+	} else if story.Seed == nil && cover.Seed != nil {
+		story.Seed = cover.Seed
+		db.Model(&Story{}).Where("id = ?", story.ID).Update("seed", *cover.Seed)
+	}
+
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, cfg.ImageGen.MaxWorkers)
+	)
+	for page := 1; page < story.Pages; page++ {
+		wg.Add(1)
+		go func(page int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			if _, err := generateAndSave(ctx, story.Platform, story.pagePrompt(page), story.Size, story.Model, storyBase(&story, base, page)); err != nil {
+				log.Printf("📖 故事 #%d 第 %d 页生成失败: %v", story.ID, page, err)
+				mu.Lock()
+				failed++
+				mu.Unlock()
+			}
+		}(page)
+	}
+	wg.Wait()
+
+	now := time.Now()
+	db.Model(&Story{}).Where("id = ?", story.ID).Updates(map[string]interface{}{
+		"status": "ready", "failed": failed, "finished_at": now})
+	log.Printf("📖 故事 #%d 完成，失败 %d", story.ID, failed)
+	if failed < story.Pages {
+		notifyReviewers(nil, fmt.Sprintf("故事「%s」已生成，待审核", story.Title), fmt.Sprintf("共 %d 页，失败 %d 页", story.Pages, failed), fmt.Sprintf("/api/stories/%d", story.ID))
+	}
+}
+
+// storyImages 各页当前的图片：每页最近生成的未失败记录，重新生成后以新图片为准
+func storyImages(storyID uint) map[int]ImageRecord {
+	var records []ImageRecord
+	db.Where("story_id = ? AND status <> ?", storyID, "failed").Order("generated_at").Find(&records)
+	current := make(map[int]ImageRecord, len(records))
+	for _, r := range records {
+		current[r.StoryPage] = r
+	}
+	return current
+}
+
+// storyContent 未指定正文时用各页配文拼成发布正文
+func storyContent(pages []storyPage) string {
+	var lines []string
+	for _, p := range pages {
+		if p.Caption != "" {
+			lines = append(lines, p.Caption)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ========== 故事 API ==========
+
+// createStory POST /api/stories，按大纲在后台生成封面和各内容页
+func createStory(c *gin.Context) {
+	var req struct {
+		Title          string      `json:"title" binding:"required"`
+		Cover          storyPage   `json:"cover"` // 封面
+		Pages          []storyPage `json:"pages"` // 内容页，按顺序
+		Style          string      `json:"style"` // 统一的风格描述，附加到每页提示词后
+		Platform       string      `json:"platform"`
+		Model          string      `json:"model"`
+		Size           string      `json:"size"`
+		Seed           *int64      `json:"seed"`
+		NegativePrompt string      `json:"negative_prompt"`
+		Category       string      `json:"category"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	pages := append([]storyPage{req.Cover}, req.Pages...)
+	if len(req.Pages) == 0 || len(pages) > maxStoryPages {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("内容页数应为 1-%d", maxStoryPages-1)})
+		return
+	}
+	for i, p := range pages {
+		if strings.TrimSpace(p.Prompt) == "" {
+			c.JSON(400, gin.H{"error": fmt.Sprintf("第 %d 页缺少提示词", i)})
+			return
+		}
+	}
+
+	if req.Platform == "" {
+		req.Platform = getOrCreateSettings().Platform
+	}
+	if p, ok := cfg.Platforms[req.Platform]; !ok || !p.Enabled {
+		c.JSON(400, gin.H{"error": "平台不可用: " + req.Platform})
+		return
+	}
+	if !categoryExists(req.Category) {
+		c.JSON(400, gin.H{"error": "分类不存在: " + req.Category})
+		return
+	}
+	flags := ""
+	for i, p := range pages {
+		prompt := p.Prompt
+		if req.Style != "" {
+			prompt += ", " + req.Style
+		}
+		if err := checkCapabilities(req.Platform, req.Model, req.Size, 1, prompt); err != nil {
+			c.JSON(400, gin.H{"error": err.Error(), "code": "unsupported", "page": i})
+			return
+		}
+		verdict := checkPromptPolicy(c.Request.Context(), p.Prompt+" "+req.Style, req.Platform)
+		if verdict.Blocked {
+			resp := verdict.response()
+			resp["page"] = i
+			c.JSON(422, resp)
+			return
+		}
+		if verdict.Flag != "" {
+			flags = verdict.Flag
+		}
+	}
+	user, apiKey := currentUser(c), currentAPIKey(c)
+	if err := checkQuota(user, apiKey, len(pages), cfg.Platforms[req.Platform].CostPerImage*float64(len(pages))); err != nil {
+		c.JSON(429, gin.H{"error": err.Error(), "code": "quota_exceeded"})
+		return
+	}
+
+	outline, _ := json.Marshal(pages)
+	story := Story{
+		Title:    req.Title,
+		Outline:  string(outline),
+		Style:    req.Style,
+		Platform: req.Platform,
+		Model:    req.Model,
+		Size:     req.Size,
+		Seed:     req.Seed,
+		Pages:    len(pages),
+		Status:   "generating",
+		User:     user,
+	}
+	if err := db.Create(&story).Error; err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	base := ImageRecord{
+		User:           user,
+		APIKey:         apiKey,
+		Workspace:      currentWorkspace(c),
+		PolicyFlag:     flags,
+		Category:       req.Category,
+		NegativePrompt: req.NegativePrompt,
+	}
+	go runStory(story, base)
+
+	c.JSON(200, gin.H{"message": "success", "story_id": story.ID, "pages": story.Pages})
+}
+
+func listStories(c *gin.Context) {
+	var stories []Story
+	query := db.Model(&Story{})
+	if s := c.Query("status"); s != "" {
+		query = query.Where("status = ?", s)
+	}
+	query.Order("id DESC").Limit(100).Find(&stories)
+	c.JSON(200, gin.H{"stories": stories, "total": len(stories)})
+}
+
+// getStory GET /api/stories/:id，按页返回大纲和当前图片，缺图的页 image 为空
+func getStory(c *gin.Context) {
+	var story Story
+	if err := db.First(&story, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{"error": "故事不存在"})
+		return
+	}
+	current := storyImages(story.ID)
+	stats := map[string]int{}
+	pages := make([]gin.H, 0, story.Pages)
+	for i, p := range story.outline() {
+		page := gin.H{"page": i, "prompt": p.Prompt, "caption": p.Caption, "image": nil}
+		if r, ok := current[i]; ok {
+			page["image"] = withImageURLs([]ImageRecord{r})[0]
+			stats[r.Status]++
+		} else {
+			stats["missing"]++
+		}
+		pages = append(pages, page)
+	}
+	c.JSON(200, gin.H{"story": story, "pages": pages, "stats": stats})
+}
+
+// regenerateStoryPage POST /api/stories/:id/pages/:page/regenerate，后台重新生成一页，新图片替换该页当前的图片
+func regenerateStoryPage(c *gin.Context) {
+	var story Story
+	if err := db.First(&story, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{"error": "故事不存在"})
+		return
+	}
+	page, err := strconv.Atoi(c.Param("page"))
+	if err != nil || page < 0 || page >= story.Pages {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("页码应为 0-%d", story.Pages-1)})
+		return
+	}
+	switch story.Status {
+	case "generating":
+		c.JSON(400, gin.H{"error": "故事生成中"})
+		return
+	case "published":
+		c.JSON(400, gin.H{"error": "故事已发布"})
+		return
+	}
+	user, apiKey := currentUser(c), currentAPIKey(c)
+	if err := checkQuota(user, apiKey, 1, cfg.Platforms[story.Platform].CostPerImage); err != nil {
+		c.JSON(429, gin.H{"error": err.Error(), "code": "quota_exceeded"})
+		return
+	}
+	// 沿用封面记录的分类、反向提示词等字段
+	var first ImageRecord
+	db.Where("story_id = ?", story.ID).Order("id").Limit(1).Find(&first)
+	base := ImageRecord{
+		User:           user,
+		APIKey:         apiKey,
+		Workspace:      currentWorkspace(c),
+		PolicyFlag:     first.PolicyFlag,
+		Category:       first.Category,
+		NegativePrompt: first.NegativePrompt,
+	}
+	db.Model(&story).Update("status", "ready")
+
+	go func() {
+		if _, err := generateAndSave(jobContext("story", story.ID), story.Platform, story.pagePrompt(page), story.Size, story.Model, storyBase(&story, base, page)); err != nil {
+			log.Printf("📖 故事 #%d 第 %d 页重新生成失败: %v", story.ID, page, err)
+		}
+	}()
+	c.JSON(200, gin.H{"message": "success", "story_id": story.ID, "page": page})
+}
+
+// reviewStory POST /api/stories/:id/review，整组审核：对各页当前待审核的图片应用同一审核结果
+func reviewStory(c *gin.Context) {
+	var req struct {
+		Status string `json:"status" binding:"required"` // approved, rejected
+		Note   string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Status != "approved" && req.Status != "rejected" {
+		c.JSON(400, gin.H{"error": "status 仅支持 approved 或 rejected"})
+		return
+	}
+	var story Story
+	if err := db.First(&story, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{"error": "故事不存在"})
+		return
+	}
+	current := storyImages(story.ID)
+	if req.Status == "approved" && len(current) < story.Pages {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("还有 %d 页没有图片，请先重新生成", story.Pages-len(current))})
+		return
+	}
+
+	reviewer, identity := currentUser(c), currentIdentity(c)
+	if reviewer == "" {
+		reviewer = identity
+	}
+	results := make(map[int]string, len(current))
+	settled := true
+	for page, r := range current {
+		if r.Status != "pending" {
+			results[page] = r.Status
+			settled = settled && r.Status == req.Status
+			continue
+		}
+		approvals, err := applyReview(&r, req.Status, req.Note, "", reviewer, identity, "")
+		switch {
+		case err != nil:
+			results[page] = "失败: " + err.Error()
+			settled = false
+		case approvals > 0:
+			results[page] = fmt.Sprintf("已记录通过意见 %d/%d", approvals, r.RequiredApprovals)
+			settled = false
+		default:
+			results[page] = req.Status
+		}
+	}
+	if settled {
+		db.Model(&story).Update("status", req.Status)
+		story.Status = req.Status
+	}
+	c.JSON(200, gin.H{"message": "success", "status": story.Status, "results": results})
+}
+
+// publishStory POST /api/stories/:id/publish，各页图片全部审核通过后，按页码顺序作为一篇多图内容发布
+// 只发布到支持多图的平台，不在发布时段内的平台不排队，返回下一个可发布时刻
+func publishStory(c *gin.Context) {
+	var req struct {
+		Platforms []string `json:"platforms"` // 为空时发布到全部支持多图的平台
+		Title     string   `json:"title"`     // 为空时使用故事标题
+		Content   string   `json:"content"`   // 为空时用各页配文拼成
+		Branding  string   `json:"branding"`
+	}
+	c.ShouldBindJSON(&req)
+	var story Story
+	if err := db.First(&story, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{"error": "故事不存在"})
+		return
+	}
+	current := storyImages(story.ID)
+	records := make([]ImageRecord, 0, story.Pages)
+	for page := 0; page < story.Pages; page++ {
+		r, ok := current[page]
+		if !ok || r.Status != "approved" {
+			c.JSON(400, gin.H{"error": fmt.Sprintf("第 %d 页的图片未审核通过", page)})
+			return
+		}
+		records = append(records, r)
+	}
+	if req.Title == "" {
+		req.Title = story.Title
+	}
+	if req.Content == "" {
+		req.Content = storyContent(story.outline())
+	}
+
+	platformsToUse := req.Platforms
+	if len(platformsToUse) == 0 {
+		for _, p := range pubManager.List() {
+			if pubManager.CanPublishImages(p.Type()) {
+				platformsToUse = append(platformsToUse, string(p.Type()))
+			}
+		}
+		sort.Strings(platformsToUse)
+	}
+	if len(platformsToUse) == 0 {
+		c.JSON(400, gin.H{"error": "没有支持多图发布的平台"})
+		return
+	}
+
+	ctx := requestid.With(context.Background(), currentRequestID(c))
+	user, cover := currentUser(c), records[0]
+	results := make(map[string]string)
+	published := false
+	now := time.Now()
+	for _, plat := range platformsToUse {
+		if next := nextPublishTime(plat, now); next.After(now) {
+			results[plat] = fmt.Sprintf("失败: 不在发布时段，%s 后可发布", next.In(bizLoc).Format("2006-01-02 15:04"))
+			continue
+		}
+		if err := checkPublishPause(plat); err != nil {
+			results[plat] = "失败: " + err.Error()
+			continue
+		}
+		if verdict := checkPublishPolicy(req.Title+" "+req.Content+" "+story.Outline, plat); verdict.Blocked {
+			results[plat] = "失败: " + verdict.Reason
+			continue
+		}
+		paths := make([]string, 0, len(records))
+		for i := range records {
+			path, err := publishImagePath(&records[i], plat, req.Branding)
+			if err != nil {
+				results[plat] = fmt.Sprintf("失败: 第 %d 页品牌处理失败: %v", i, err)
+				break
+			}
+			paths = append(paths, path)
+		}
+		if len(paths) < len(records) {
+			continue
+		}
+		url, err := pubManager.PublishImages(publisher.PlatformType(plat), ctx, paths, req.Title, req.Content)
+		if err != nil {
+			notePublishFailure(plat, err)
+			results[plat] = "失败: " + err.Error()
+			recordActivity("publish_failed", cover.ID, user, fmt.Sprintf("%s: 故事 #%d: %v", plat, story.ID, err))
+			notify(story.User, "publish_failed", fmt.Sprintf("故事「%s」发布到 %s 失败", story.Title, plat), err.Error(), cover.ID, "")
+			emitEvent(db, "story.publish_failed", gin.H{"id": story.ID, "platform": plat, "error": err.Error()})
+			continue
+		}
+		results[plat] = url
+		published = true
+		// 发布记录挂在封面上
+		recordPublished(cover.ID, plat, url, req.Title, req.Content, user, nil)
+		recordActivity("published", cover.ID, user, fmt.Sprintf("%s: 故事 #%d（%d 张）: %s", plat, story.ID, len(paths), url))
+		emitEvent(db, "story.published", gin.H{"id": story.ID, "platform": plat, "url": url, "images": len(paths)})
+	}
+	if published {
+		db.Model(&story).Update("status", "published")
+	}
+
+	c.JSON(200, gin.H{"message": "success", "results": results})
+}
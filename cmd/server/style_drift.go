@@ -0,0 +1,391 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/image/draw"
+)
+
+// ========== 风格漂移 ==========
+
+// StyleDriftConfig 每天对比当天与前一天审核通过图片的色彩分布、平均得分和模型占比，编辑可在日报中尽早发现风格漂移
+type StyleDriftConfig struct {
+	Enabled   bool     `yaml:"enabled"`   // 开启后每天 runAt 对比并在漂移过大时通知，日报中的对比不受影响
+	RunAt     string   `yaml:"runAt"`     // 对比时间 HH:MM（业务时区），默认 23:30
+	Threshold float64  `yaml:"threshold"` // 漂移度 0-1，达到该值时通知，默认 0.3
+	Notify    []string `yaml:"notify"`    // 漂移过大时通知的用户，为空使用 notifications.reviewers
+}
+
+// StyleSnapshot 一天审核通过图片的风格统计，当天的快照在通过数变化后重新计算
+type StyleSnapshot struct {
+	ID             uint               `gorm:"primaryKey" json:"id"`
+	Date           string             `gorm:"size:20;uniqueIndex;not null" json:"date"`
+	Images         int                `json:"images"`                                     // 审核通过的图片数
+	Analyzed       int                `json:"analyzed"`                                   // 成功读取色彩的图片数
+	Palette        map[string]float64 `gorm:"type:json;serializer:json" json:"palette"`   // 色系 → 像素占比，各图片等权
+	Brightness     float64            `json:"brightness"`                                 // 平均亮度 0-1
+	Saturation     float64            `json:"saturation"`                                 // 平均饱和度 0-1
+	AvgScore       *float64           `json:"avg_score"`                                  // 自动审核平均得分，没有得分时为空
+	AvgConsistency *float64           `json:"avg_consistency"`                            // 提示词一致性平均分
+	ModelMix       map[string]float64 `gorm:"type:json;serializer:json" json:"model_mix"` // 模型 → 图片占比
+	ComparedAt     *time.Time         `json:"compared_at"`                                // 定时对比的时间，每天只通知一次
+	CreatedAt      time.Time          `json:"created_at"`
+	UpdatedAt      time.Time          `json:"updated_at"`
+}
+
+func (StyleSnapshot) TableName() string {
+	return "style_snapshots"
+}
+
+// styleDrift 当天相对前一天的变化，占比的变化为百分点（0-1）
+type styleDrift struct {
+	Date           string             `json:"date"`
+	Previous       string             `json:"previous"`
+	Images         [2]int             `json:"images"` // 当天、前一天的通过数
+	Palette        map[string]float64 `json:"palette"`
+	PaletteShift   float64            `json:"palette_shift"` // 色彩分布的总变差距离 0-1
+	Brightness     float64            `json:"brightness"`
+	Saturation     float64            `json:"saturation"`
+	AvgScore       *float64           `json:"avg_score"` // 任意一天没有得分时为空
+	AvgConsistency *float64           `json:"avg_consistency"`
+	ModelMix       map[string]float64 `json:"model_mix"`
+	ModelShift     float64            `json:"model_shift"` // 模型占比的总变差距离 0-1
+	Drift          float64            `json:"drift"`       // 色彩和模型变化中较大的一项
+	Drifted        bool               `json:"drifted"`     // 达到 styleDrift.threshold
+	Highlights     []string           `json:"highlights"`  // 变化最大的几项，日报中直接展示
+}
+
+// 色系按 HSV 划分，低亮度为黑、低饱和度为白或灰
+var paletteHues = []struct {
+	Name string
+	Max  float64 // 色相上限（度）
+}{
+	{"red", 15}, {"orange", 45}, {"yellow", 70}, {"green", 160}, {"cyan", 200},
+	{"blue", 260}, {"purple", 300}, {"magenta", 345}, {"red", 360},
+}
+
+var paletteNames = map[string]string{
+	"red": "红", "orange": "橙", "yellow": "黄", "green": "绿", "cyan": "青", "blue": "蓝",
+	"purple": "紫", "magenta": "品红", "black": "黑", "white": "白", "gray": "灰",
+}
+
+// paletteBucket 像素所属的色系
+func paletteBucket(h, s, v float64) string {
+	switch {
+	case v < 0.2:
+		return "black"
+	case s < 0.15 && v > 0.85:
+		return "white"
+	case s < 0.15:
+		return "gray"
+	}
+	for _, b := range paletteHues {
+		if h < b.Max {
+			return b.Name
+		}
+	}
+	return "red"
+}
+
+// rgbToHSV r、g、b 为 0-1，返回色相（度）、饱和度、亮度
+func rgbToHSV(r, g, b float64) (h, s, v float64) {
+	maxC, minC := math.Max(r, math.Max(g, b)), math.Min(r, math.Min(g, b))
+	v, delta := maxC, maxC-minC
+	if maxC > 0 {
+		s = delta / maxC
+	}
+	switch {
+	case delta == 0:
+		h = 0
+	case maxC == r:
+		h = 60 * math.Mod((g-b)/delta, 6)
+	case maxC == g:
+		h = 60 * ((b-r)/delta + 2)
+	default:
+		h = 60 * ((r-g)/delta + 4)
+	}
+	if h < 0 {
+		h += 360
+	}
+	return h, s, v
+}
+
+// imagePalette 把图片缩小到 64x64 后统计各色系的像素占比、平均亮度和饱和度
+func imagePalette(path string) (map[string]float64, float64, float64, error) {
+	img, err := loadImage(path)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	small := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	draw.ApproxBiLinear.Scale(small, small.Bounds(), img, img.Bounds(), draw.Src, nil)
+	palette := map[string]float64{}
+	var brightness, saturation float64
+	pixels := float64(64 * 64)
+	for i := 0; i+3 < len(small.Pix); i += 4 {
+		h, s, v := rgbToHSV(float64(small.Pix[i])/255, float64(small.Pix[i+1])/255, float64(small.Pix[i+2])/255)
+		palette[paletteBucket(h, s, v)] += 1 / pixels
+		brightness += v / pixels
+		saturation += s / pixels
+	}
+	return palette, brightness, saturation, nil
+}
+
+// analyzeStyle 统计一天审核通过的图片，拼图等非生成的记录不计入
+func analyzeStyle(date string) *StyleSnapshot {
+	var records []ImageRecord
+	db.Where("date = ? AND status = ? AND operation <> ?", date, "approved", "collage").Find(&records)
+	snap := &StyleSnapshot{Date: date, Images: len(records), Palette: map[string]float64{}, ModelMix: map[string]float64{}}
+	var scoreSum, consistencySum float64
+	var scored, consistent int
+	for _, r := range records {
+		model := r.Model
+		if model == "" {
+			model = r.Platform
+		}
+		snap.ModelMix[model] += 1 / float64(len(records))
+		if r.AutoScore != nil {
+			scoreSum += *r.AutoScore
+			scored++
+		}
+		if r.ConsistencyScore != nil {
+			consistencySum += float64(*r.ConsistencyScore)
+			consistent++
+		}
+		palette, brightness, saturation, err := imagePalette(r.Path)
+		if err != nil {
+			log.Printf("🎨 读取图片 #%d 色彩失败: %v", r.ID, err)
+			continue
+		}
+		snap.Analyzed++
+		for k, v := range palette {
+			snap.Palette[k] += v
+		}
+		snap.Brightness += brightness
+		snap.Saturation += saturation
+	}
+	if snap.Analyzed > 0 {
+		n := float64(snap.Analyzed)
+		for k := range snap.Palette {
+			snap.Palette[k] = round4(snap.Palette[k] / n)
+		}
+		snap.Brightness, snap.Saturation = round4(snap.Brightness/n), round4(snap.Saturation/n)
+	}
+	for k, v := range snap.ModelMix {
+		snap.ModelMix[k] = round4(v)
+	}
+	if scored > 0 {
+		avg := round4(scoreSum / float64(scored))
+		snap.AvgScore = &avg
+	}
+	if consistent > 0 {
+		avg := round4(consistencySum / float64(consistent))
+		snap.AvgConsistency = &avg
+	}
+	return snap
+}
+
+func round4(v float64) float64 {
+	return math.Round(v*10000) / 10000
+}
+
+// styleSnapshot 读取一天的快照，没有快照、通过数有变化或 refresh 时重新统计
+func styleSnapshot(date string, refresh bool) *StyleSnapshot {
+	var snap StyleSnapshot
+	found := db.Where("date = ?", date).First(&snap).Error == nil
+	if found && !refresh {
+		var approved int64
+		db.Model(&ImageRecord{}).Where("date = ? AND status = ? AND operation <> ?", date, "approved", "collage").Count(&approved)
+		if int(approved) == snap.Images {
+			return &snap
+		}
+	}
+	fresh := analyzeStyle(date)
+	if found {
+		fresh.ID, fresh.ComparedAt, fresh.CreatedAt = snap.ID, snap.ComparedAt, snap.CreatedAt
+	}
+	if err := db.Save(fresh).Error; err != nil {
+		log.Printf("🎨 保存 %s 的风格快照失败: %v", date, err)
+	}
+	return fresh
+}
+
+// compareStyle date 与前一天的风格对比
+func compareStyle(date string, refresh bool) (*styleDrift, error) {
+	day, err := time.ParseInLocation("2006-01-02", date, bizLoc)
+	if err != nil {
+		return nil, fmt.Errorf("日期格式应为 YYYY-MM-DD: %s", date)
+	}
+	prevDate := day.AddDate(0, 0, -1).Format("2006-01-02")
+	cur, prev := styleSnapshot(date, refresh), styleSnapshot(prevDate, refresh)
+
+	d := &styleDrift{
+		Date:       date,
+		Previous:   prevDate,
+		Images:     [2]int{cur.Images, prev.Images},
+		Palette:    mapDelta(cur.Palette, prev.Palette),
+		Brightness: round4(cur.Brightness - prev.Brightness),
+		Saturation: round4(cur.Saturation - prev.Saturation),
+		ModelMix:   mapDelta(cur.ModelMix, prev.ModelMix),
+		Highlights: []string{},
+	}
+	if cur.AvgScore != nil && prev.AvgScore != nil {
+		delta := round4(*cur.AvgScore - *prev.AvgScore)
+		d.AvgScore = &delta
+	}
+	if cur.AvgConsistency != nil && prev.AvgConsistency != nil {
+		delta := round4(*cur.AvgConsistency - *prev.AvgConsistency)
+		d.AvgConsistency = &delta
+	}
+	// 任意一天没有可分析的图片时无从比较，漂移度为 0
+	if cur.Analyzed > 0 && prev.Analyzed > 0 {
+		d.PaletteShift = totalVariation(d.Palette)
+	}
+	if cur.Images > 0 && prev.Images > 0 {
+		d.ModelShift = totalVariation(d.ModelMix)
+	}
+	d.Drift = math.Max(d.PaletteShift, d.ModelShift)
+	d.Drifted = d.Drift >= cfg.StyleDrift.Threshold
+
+	if k, v := largestChange(d.Palette); k != "" && math.Abs(v) >= 0.05 {
+		d.Highlights = append(d.Highlights, fmt.Sprintf("%s色占比%s %.0f 个百分点", paletteNames[k], upDown(v), math.Abs(v)*100))
+	}
+	if math.Abs(d.Brightness) >= 0.05 {
+		d.Highlights = append(d.Highlights, fmt.Sprintf("平均亮度%s %.0f%%", upDown(d.Brightness), math.Abs(d.Brightness)*100))
+	}
+	if k, v := largestChange(d.ModelMix); k != "" && math.Abs(v) >= 0.1 {
+		d.Highlights = append(d.Highlights, fmt.Sprintf("模型 %s 占比%s %.0f 个百分点", k, upDown(v), math.Abs(v)*100))
+	}
+	if d.AvgScore != nil && math.Abs(*d.AvgScore) >= 0.05 {
+		d.Highlights = append(d.Highlights, fmt.Sprintf("自动审核平均分%s %.2f", upDown(*d.AvgScore), math.Abs(*d.AvgScore)))
+	}
+	return d, nil
+}
+
+// mapDelta 两组占比逐项相减，只在一边出现的项按 0 计
+func mapDelta(cur, prev map[string]float64) map[string]float64 {
+	delta := map[string]float64{}
+	for k, v := range cur {
+		delta[k] = round4(v - prev[k])
+	}
+	for k, v := range prev {
+		if _, ok := cur[k]; !ok {
+			delta[k] = round4(-v)
+		}
+	}
+	return delta
+}
+
+// totalVariation 两个分布的总变差距离：变化量绝对值之和的一半
+func totalVariation(delta map[string]float64) float64 {
+	var sum float64
+	for _, v := range delta {
+		sum += math.Abs(v)
+	}
+	return round4(sum / 2)
+}
+
+func largestChange(delta map[string]float64) (string, float64) {
+	keys := make([]string, 0, len(delta))
+	for k := range delta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var best string
+	for _, k := range keys {
+		if best == "" || math.Abs(delta[k]) > math.Abs(delta[best]) {
+			best = k
+		}
+	}
+	return best, delta[best]
+}
+
+func upDown(v float64) string {
+	if v >= 0 {
+		return "上升"
+	}
+	return "下降"
+}
+
+// styleDriftSection 日报中的风格对比，日期有误时返回错误信息
+func styleDriftSection(date string) interface{} {
+	d, err := compareStyle(date, false)
+	if err != nil {
+		return gin.H{"error": err.Error()}
+	}
+	return d
+}
+
+// validateStyleDrift 启动时检查对比时间和阈值
+func validateStyleDrift() error {
+	if _, err := time.Parse("15:04", cfg.StyleDrift.RunAt); err != nil {
+		return fmt.Errorf("runAt 格式应为 HH:MM: %s", cfg.StyleDrift.RunAt)
+	}
+	if cfg.StyleDrift.Threshold <= 0 || cfg.StyleDrift.Threshold > 1 {
+		return fmt.Errorf("threshold 取值范围 0-1: %g", cfg.StyleDrift.Threshold)
+	}
+	return nil
+}
+
+// runStyleDriftScheduler 每分钟检查一次，到达 runAt 后对比当天与前一天，漂移过大时通知
+// 快照的 compared_at 保证每天只通知一次，多实例部署时由条件更新抢占
+func runStyleDriftScheduler() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		now := bizNow()
+		if !cfg.StyleDrift.Enabled || !reachedRunAt(now, cfg.StyleDrift.RunAt) {
+			continue
+		}
+		date := now.Format("2006-01-02")
+		var n int64
+		if db.Model(&StyleSnapshot{}).Where("date = ? AND compared_at IS NOT NULL", date).Count(&n); n > 0 {
+			continue
+		}
+		d, err := compareStyle(date, false)
+		if err != nil {
+			log.Printf("🎨 风格对比 %s 失败: %v", date, err)
+			continue
+		}
+		res := db.Model(&StyleSnapshot{}).Where("date = ? AND compared_at IS NULL", date).Update("compared_at", time.Now())
+		if res.RowsAffected == 0 {
+			continue
+		}
+		log.Printf("🎨 风格对比 %s：漂移度 %.2f（色彩 %.2f，模型 %.2f）", date, d.Drift, d.PaletteShift, d.ModelShift)
+		if !d.Drifted {
+			continue
+		}
+		users := cfg.StyleDrift.Notify
+		if len(users) == 0 {
+			users = cfg.Notifications.Reviewers
+		}
+		body := fmt.Sprintf("漂移度 %.2f", d.Drift)
+		for _, h := range d.Highlights {
+			body += "；" + h
+		}
+		for _, u := range users {
+			notify(u, "style_drift", fmt.Sprintf("%s 通过图片的风格与前一天差异较大", date), body, 0, "/api/report/style?date="+date)
+		}
+		emitEvent(db, "style.drifted", gin.H{"date": date, "drift": d.Drift, "palette_shift": d.PaletteShift, "model_shift": d.ModelShift, "highlights": d.Highlights})
+	}
+}
+
+// ========== 风格漂移 API ==========
+
+// getStyleDrift GET /api/report/style?date=&refresh=true，date 与前一天的风格对比及两天的快照，refresh 时重新统计
+func getStyleDrift(c *gin.Context) {
+	date := c.DefaultQuery("date", today())
+	d, err := compareStyle(date, c.Query("refresh") == "true")
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	var snapshots []StyleSnapshot
+	db.Where("date IN ?", []string{d.Date, d.Previous}).Order("date DESC").Find(&snapshots)
+	c.JSON(200, gin.H{"drift": d, "snapshots": snapshots})
+}
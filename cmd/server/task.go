@@ -0,0 +1,512 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"image-platform/internal/requestid"
+)
+
+// ========== 异步生成任务 ==========
+
+// GenerateTask 一次异步生成，完成后关联生成的图片记录
+type GenerateTask struct {
+	ID          string     `json:"task_id"`
+	Status      string     `json:"status"`          // queued, running, succeeded, failed, canceled
+	Progress    int        `json:"progress"`        // 0-100
+	Stage       string     `json:"stage,omitempty"` // 平台任务阶段：submitted, pending, running, downloading
+	Platform    string     `json:"platform"`
+	Model       string     `json:"model"`
+	Size        string     `json:"size"`
+	Prompt      string     `json:"prompt"`
+	N           int        `json:"n"`
+	Enhance     bool       `json:"enhance"`
+	ImageID     uint       `json:"image_id,omitempty"` // 第一张图片
+	ImageURL    string     `json:"image_url,omitempty"`
+	ImageIDs    []uint     `json:"image_ids,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	ErrorCode   string     `json:"error_code,omitempty"`
+	User        string     `json:"user"`
+	CreatedAt   time.Time  `json:"created_at"`
+	StartedAt   *time.Time `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at"`
+	CanceledBy  string     `json:"canceled_by,omitempty"`
+	CallbackURL string     `json:"callback_url,omitempty"` // 任务结束时 POST 结果的地址
+
+	base     ImageRecord
+	ctx      context.Context
+	cancel   context.CancelFunc
+	attempts int // 开始执行的次数，见 TaskRecord
+}
+
+// 已结束的任务在内存中保留的时长，之后只能通过图片记录的 task_id 查询
+const taskRetention = time.Hour
+
+var (
+	taskMu   sync.Mutex
+	tasks    = make(map[string]*GenerateTask)       // 本实例创建或执行中的任务
+	taskSubs = make(map[string][]chan GenerateTask) // 订阅任务状态变化的 SSE 连接
+)
+
+// startTaskWorkers 启动生成 worker，数量为 imageGen.maxWorkers
+func startTaskWorkers(n int) {
+	for i := 0; i < n; i++ {
+		go func() {
+			for {
+				id, err := jobQueue.Pop(context.Background(), queueGenerate)
+				if err != nil {
+					log.Printf("🧵 读取生成队列失败: %v", err)
+					time.Sleep(time.Second)
+					continue
+				}
+				if task := claimTask(id); task != nil {
+					runTask(task)
+				}
+			}
+		}()
+	}
+	jobQueue.Listen(topicCancel, cancelRunningTask)
+	go func() {
+		ticker := time.NewTicker(10 * time.Minute)
+		defer ticker.Stop()
+		for range ticker.C {
+			pruneTasks()
+		}
+	}()
+}
+
+// enqueueTask 任务入队，队列已满时返回 false
+func enqueueTask(task *GenerateTask) bool {
+	task.ID = newToken()
+	task.Status = "queued"
+	task.CreatedAt = time.Now()
+	task.base.TaskID = task.ID
+	task.ctx, task.cancel = context.WithCancel(requestid.With(context.Background(), task.ID))
+	// 共享队列的任务可能由其他实例执行，由执行的实例从任务表加载
+	if jobQueue.Local() {
+		taskMu.Lock()
+		tasks[task.ID] = task
+		taskMu.Unlock()
+	}
+	// 先入库再入队，避免 worker 写入的状态被覆盖
+	persistTask(task)
+	if err := jobQueue.Push(context.Background(), queueGenerate, task.ID); err != nil {
+		log.Printf("🧵 任务 %s 入队失败: %v", task.ID, err)
+		taskMu.Lock()
+		delete(tasks, task.ID)
+		taskMu.Unlock()
+		task.cancel()
+		db.Delete(&TaskRecord{ID: task.ID})
+		return false
+	}
+	if !jobQueue.Local() {
+		task.cancel()
+	}
+	return true
+}
+
+// claimTask 取出的任务 ID 对应的任务，本实例没有时从任务表加载，已不在排队的返回 nil
+func claimTask(id string) *GenerateTask {
+	taskMu.Lock()
+	task, ok := tasks[id]
+	taskMu.Unlock()
+	if ok {
+		return task
+	}
+	var rec TaskRecord
+	if err := db.First(&rec, "id = ?", id).Error; err != nil || rec.Status != "queued" {
+		return nil
+	}
+	task = taskFromRecord(rec)
+	taskMu.Lock()
+	tasks[id] = task
+	taskMu.Unlock()
+	return task
+}
+
+// updateTask 加锁修改任务，查询接口读取的是副本，修改后推送给订阅者
+func updateTask(task *GenerateTask, fn func(t *GenerateTask)) {
+	taskMu.Lock()
+	fn(task)
+	for _, ch := range taskSubs[task.ID] {
+		// 订阅者处理不过来时丢弃中间状态，只要最终状态能送达
+		select {
+		case ch <- *task:
+		default:
+		}
+	}
+	taskMu.Unlock()
+}
+
+// subscribeTask 订阅任务状态变化，返回当前状态和取消订阅函数
+func subscribeTask(id string) (GenerateTask, <-chan GenerateTask, func(), bool) {
+	taskMu.Lock()
+	defer taskMu.Unlock()
+	task, ok := tasks[id]
+	if !ok {
+		return GenerateTask{}, nil, nil, false
+	}
+	ch := make(chan GenerateTask, 16)
+	taskSubs[id] = append(taskSubs[id], ch)
+	cancel := func() {
+		taskMu.Lock()
+		defer taskMu.Unlock()
+		subs := taskSubs[id]
+		for i, c := range subs {
+			if c == ch {
+				subs = append(subs[:i], subs[i+1:]...)
+				break
+			}
+		}
+		if len(subs) == 0 {
+			delete(taskSubs, id)
+		} else {
+			taskSubs[id] = subs
+		}
+	}
+	return *task, ch, cancel, true
+}
+
+// taskProgress 平台进度回调，更新异步任务的阶段和进度，进度只增不减
+func taskProgress(id string) progressFunc {
+	if id == "" {
+		return nil
+	}
+	taskMu.Lock()
+	task, ok := tasks[id]
+	taskMu.Unlock()
+	if !ok {
+		return nil
+	}
+	return func(stage string, percent int) {
+		updateTask(task, func(t *GenerateTask) {
+			t.Stage = stage
+			if percent > t.Progress {
+				t.Progress = min(percent, 99)
+			}
+		})
+	}
+}
+
+func runTask(task *GenerateTask) {
+	defer task.cancel()
+	// 排队中已取消的任务不再执行
+	started := false
+	updateTask(task, func(t *GenerateTask) {
+		if t.Status != "queued" {
+			return
+		}
+		now := time.Now()
+		t.Status = "running"
+		t.Progress = 10
+		t.StartedAt = &now
+		t.attempts++
+		started = true
+	})
+	if !started {
+		return
+	}
+	persistTask(task)
+
+	if task.Enhance {
+		enhanced := enhanceOrOriginal(task.ctx, task.Prompt)
+		updateTask(task, func(t *GenerateTask) { t.base.EnhancedPrompt = enhanced })
+	}
+
+	records, err := generateAndSaveN(task.ctx, task.Platform, task.Prompt, task.Size, task.Model, max(task.N, 1), task.base)
+	if err == nil && len(records) == 0 {
+		err = genError(ErrCodeUnknown, "没有生成图片")
+	}
+	finishTask(task, records, err)
+}
+
+// finishTask 记录任务结果并通知订阅者
+func finishTask(task *GenerateTask, records []ImageRecord, err error) {
+	updateTask(task, func(t *GenerateTask) {
+		now := time.Now()
+		t.FinishedAt = &now
+		t.Progress = 100
+		t.Stage = ""
+		if errorCode(err) == ErrCodeCanceled {
+			t.Status = "canceled"
+			t.Error = "任务已取消"
+			t.ErrorCode = ErrCodeCanceled
+			return
+		}
+		if err != nil {
+			t.Status = "failed"
+			t.Error = err.Error()
+			t.ErrorCode = errorCode(err)
+			return
+		}
+		t.Status = "succeeded"
+		t.ImageID = records[0].ID
+		t.ImageURL = imageURL(records[0].Path)
+		t.Model = records[0].Model
+		for _, r := range records {
+			t.ImageIDs = append(t.ImageIDs, r.ID)
+		}
+	})
+	persistTask(task)
+	taskMu.Lock()
+	snapshot := *task
+	taskMu.Unlock()
+	taskCallback(snapshot)
+	if err != nil {
+		log.Printf("🧵 任务 %s 失败: %v", task.ID, err)
+	}
+	// 取消的任务不进入死信队列
+	if err != nil && errorCode(err) != ErrCodeCanceled {
+		var rec TaskRecord
+		if db.First(&rec, "id = ?", task.ID).Error == nil {
+			deadLetter("generation", task.ID, rec, err.Error(), errorCode(err), rec.Attempts, appendHistory("", err.Error()))
+		}
+	}
+}
+
+func pruneTasks() {
+	taskMu.Lock()
+	for id, t := range tasks {
+		if t.FinishedAt != nil && time.Since(*t.FinishedAt) > taskRetention {
+			delete(tasks, id)
+		}
+	}
+	taskMu.Unlock()
+	purgeTaskRecords()
+}
+
+// ========== 任务 API ==========
+
+// getTask GET /api/tasks/:id，内存中已清理的任务从任务表或图片记录中还原结果
+func getTask(c *gin.Context) {
+	id := c.Param("id")
+	taskMu.Lock()
+	task, ok := tasks[id]
+	var snapshot GenerateTask
+	if ok {
+		snapshot = *task
+	}
+	taskMu.Unlock()
+	if ok {
+		c.JSON(200, snapshot)
+		return
+	}
+
+	finished, ok := finishedTask(id)
+	if !ok {
+		c.JSON(404, gin.H{"error": "任务不存在"})
+		return
+	}
+	c.JSON(200, finished)
+}
+
+// cancelTask DELETE /api/tasks/:id，取消排队中或生成中的任务
+// 生成中的任务停止轮询和下载，已生成的图片仍会入库；只有任务的创建者或管理员可以取消
+func cancelTask(c *gin.Context) {
+	taskMu.Lock()
+	task, ok := tasks[c.Param("id")]
+	taskMu.Unlock()
+	user := currentUser(c)
+	admin := isAdmin(c)
+	if !ok {
+		if !jobQueue.Local() {
+			cancelRemoteTask(c, user, admin)
+			return
+		}
+		c.JSON(404, gin.H{"error": "任务不存在或已结束"})
+		return
+	}
+	if task.User != "" && task.User != user && !admin {
+		c.JSON(403, gin.H{"error": "只能取消自己的任务"})
+		return
+	}
+
+	var status string
+	updateTask(task, func(t *GenerateTask) {
+		status = t.Status
+		switch t.Status {
+		case "queued":
+			// 排队中的任务直接结束，worker 取到后跳过
+			now := time.Now()
+			t.Status, t.Error, t.ErrorCode, t.FinishedAt = "canceled", "任务已取消", ErrCodeCanceled, &now
+			t.CanceledBy = user
+		case "running":
+			t.CanceledBy = user
+		}
+	})
+	switch status {
+	case "queued", "running":
+		task.cancel()
+		if status == "queued" {
+			persistTask(task)
+			taskMu.Lock()
+			snapshot := *task
+			taskMu.Unlock()
+			taskCallback(snapshot)
+		}
+		log.Printf("🧵 任务 %s 已取消（%s）", task.ID, user)
+		c.JSON(200, gin.H{"message": "success", "status": "canceled"})
+	default:
+		c.JSON(409, gin.H{"error": "任务已结束", "status": status})
+	}
+}
+
+// cancelRemoteTask 共享队列时取消不在本实例的任务：排队中的直接在任务表中结束，执行中的通知执行的实例
+func cancelRemoteTask(c *gin.Context, user string, isAdmin bool) {
+	var rec TaskRecord
+	if err := db.First(&rec, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{"error": "任务不存在或已结束"})
+		return
+	}
+	if rec.User != "" && rec.User != user && !isAdmin {
+		c.JSON(403, gin.H{"error": "只能取消自己的任务"})
+		return
+	}
+	switch rec.Status {
+	case "queued":
+		now := time.Now()
+		res := db.Model(&TaskRecord{}).Where("id = ? AND status = ?", rec.ID, "queued").Updates(map[string]interface{}{
+			"status": "canceled", "error": "任务已取消", "error_code": ErrCodeCanceled, "finished_at": now})
+		if res.RowsAffected > 0 {
+			rec.Status, rec.Error, rec.ErrorCode = "canceled", "任务已取消", ErrCodeCanceled
+			canceled := taskFromRecord(rec)
+			canceled.cancel()
+			taskCallback(*canceled)
+			break
+		}
+		// 刚被其他实例取出执行，按执行中处理
+		fallthrough
+	case "running":
+		msg, _ := json.Marshal(gin.H{"id": rec.ID, "user": user})
+		if err := jobQueue.Broadcast(c.Request.Context(), topicCancel, string(msg)); err != nil {
+			c.JSON(500, gin.H{"error": "通知执行实例失败: " + err.Error()})
+			return
+		}
+	default:
+		c.JSON(409, gin.H{"error": "任务已结束", "status": rec.Status})
+		return
+	}
+	log.Printf("🧵 任务 %s 已取消（%s）", rec.ID, user)
+	c.JSON(200, gin.H{"message": "success", "status": "canceled"})
+}
+
+// cancelRunningTask 处理其他实例转来的取消通知，只取消本实例正在执行的任务
+func cancelRunningTask(msg string) {
+	var req struct {
+		ID   string `json:"id"`
+		User string `json:"user"`
+	}
+	if json.Unmarshal([]byte(msg), &req) != nil {
+		return
+	}
+	taskMu.Lock()
+	task, ok := tasks[req.ID]
+	taskMu.Unlock()
+	if !ok {
+		return
+	}
+	running := false
+	updateTask(task, func(t *GenerateTask) {
+		if t.Status == "running" {
+			t.CanceledBy, running = req.User, true
+		}
+	})
+	if running {
+		task.cancel()
+		log.Printf("🧵 任务 %s 已按通知取消（%s）", task.ID, req.User)
+	}
+}
+
+// streamTask GET /api/generate/stream/:task_id，用 SSE 推送任务状态变化，任务结束后关闭连接
+// 事件 status 的数据与 /api/tasks/:id 相同
+func streamTask(c *gin.Context) {
+	id := c.Param("task_id")
+	snapshot, updates, cancel, ok := subscribeTask(id)
+	if !ok {
+		finished, ok := finishedTask(id)
+		if !ok {
+			c.JSON(404, gin.H{"error": "任务不存在"})
+			return
+		}
+		c.SSEvent("status", finished)
+		return
+	}
+	defer cancel()
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no") // 关闭 Nginx 缓冲
+	c.SSEvent("status", snapshot)
+	c.Writer.Flush()
+	if snapshot.FinishedAt != nil {
+		return
+	}
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case t := <-updates:
+			c.SSEvent("status", t)
+			return t.FinishedAt == nil
+		case <-heartbeat.C:
+			c.SSEvent("ping", time.Now().Unix())
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+// finishedTask 从任务表或图片记录还原已清理出内存的任务
+func finishedTask(id string) (GenerateTask, bool) {
+	var rec TaskRecord
+	if err := db.First(&rec, "id = ?", id).Error; err == nil {
+		task := taskFromRecord(rec)
+		task.cancel()
+		task.Progress = 100
+		if len(task.ImageIDs) > 0 {
+			var first ImageRecord
+			if db.Select("id", "path").First(&first, task.ImageIDs[0]).Error == nil {
+				task.ImageID, task.ImageURL = first.ID, imageURL(first.Path)
+			}
+		}
+		return *task, true
+	}
+	var records []ImageRecord
+	db.Where("task_id = ?", id).Order("id").Find(&records)
+	if len(records) == 0 {
+		return GenerateTask{}, false
+	}
+	record := records[0]
+	ids := make([]uint, len(records))
+	for i, r := range records {
+		ids[i] = r.ID
+	}
+	status := "succeeded"
+	if record.Status == "failed" {
+		status = "failed"
+	}
+	return GenerateTask{
+		ID:         id,
+		Status:     status,
+		Progress:   100,
+		Platform:   record.PlatformID,
+		Model:      record.Model,
+		Size:       record.Size,
+		Prompt:     record.Prompt,
+		ImageID:    record.ID,
+		ImageURL:   imageURL(record.Path),
+		ImageIDs:   ids,
+		N:          len(records),
+		Error:      record.Error,
+		ErrorCode:  record.ErrorCode,
+		User:       record.User,
+		CreatedAt:  record.CreatedAt,
+		FinishedAt: &record.GeneratedAt,
+	}, true
+}
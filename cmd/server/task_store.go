@@ -0,0 +1,344 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"image-platform/internal/generator"
+	"image-platform/internal/requestid"
+)
+
+// ========== 任务持久化 ==========
+
+// TaskRecord 异步生成任务的持久化状态，只在状态变化时写入，服务重启后据此恢复排队和生成中的任务
+type TaskRecord struct {
+	ID          string     `gorm:"primaryKey;size:64" json:"task_id"`
+	Status      string     `gorm:"size:20;index" json:"status"` // queued, running, succeeded, failed, canceled
+	Platform    string     `gorm:"size:50" json:"platform"`
+	Model       string     `gorm:"size:100" json:"model"`
+	Size        string     `gorm:"size:20" json:"size"`
+	Prompt      string     `gorm:"size:1000" json:"prompt"`
+	N           int        `json:"n"`
+	Enhance     bool       `json:"enhance"`
+	User        string     `gorm:"size:100" json:"user"`
+	Base        string     `gorm:"type:text" json:"-"` // 生成记录的上下文字段（ImageRecord JSON）
+	ImageIDs    string     `gorm:"size:255" json:"image_ids"`
+	Error       string     `gorm:"type:text" json:"error"`
+	ErrorCode   string     `gorm:"size:30" json:"error_code"`
+	Attempts    int        `json:"attempts"`                     // 开始执行的次数，重启后重新执行会增加
+	Worker      string     `gorm:"size:100;index" json:"worker"` // 最近写入状态的实例，共享队列时重启只恢复本实例执行中的任务
+	CallbackURL string     `gorm:"size:512" json:"callback_url"`
+	CreatedAt   time.Time  `json:"created_at"`
+	StartedAt   *time.Time `json:"started_at"`
+	FinishedAt  *time.Time `gorm:"index" json:"finished_at"`
+}
+
+func (TaskRecord) TableName() string {
+	return "generate_tasks"
+}
+
+// ProviderTask 已在平台创建、正在轮询的异步任务（百炼、魔塔）
+// 创建成功后立即入库，服务重启时仍为 polling 的任务继续轮询并保存结果
+type ProviderTask struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	TaskID         string     `gorm:"size:64;index" json:"task_id"` // 所属异步生成任务，同步请求为空
+	Provider       string     `gorm:"size:20" json:"provider"`      // aliyun, modelscope，决定如何轮询
+	Platform       string     `gorm:"size:50" json:"platform"`      // 平台配置键
+	ProviderTaskID string     `gorm:"size:100;index" json:"provider_task_id"`
+	State          string     `gorm:"size:20;index" json:"state"` // polling, succeeded, failed, canceled
+	Attempts       int        `json:"attempts"`                   // 已轮询次数
+	Resumes        int        `json:"resumes"`                    // 重启后恢复轮询的次数
+	Prompt         string     `gorm:"size:1000" json:"prompt"`
+	Size           string     `gorm:"size:20" json:"size"`
+	Seed           *int64     `json:"seed"`
+	Base           string     `gorm:"type:text" json:"-"`
+	Error          string     `gorm:"type:text" json:"error"`
+	Worker         string     `gorm:"size:100;index" json:"worker"` // 创建平台任务的实例
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	FinishedAt     *time.Time `json:"finished_at"`
+}
+
+func (ProviderTask) TableName() string {
+	return "provider_tasks"
+}
+
+// 重启后恢复轮询的次数上限，超过后视为丢失，避免异常任务每次启动都被重试
+const maxProviderResumes = 3
+
+// 任务重新执行的次数上限
+const maxTaskAttempts = 3
+
+// genContext 本次生成的上下文，随 ctx 传到平台调用，用于记录平台任务
+type genContext struct {
+	TaskID   string
+	Platform string
+	Prompt   string
+	Size     string
+	Seed     *int64
+	Base     ImageRecord
+}
+
+type genContextKey struct{}
+
+// withGenContext 把生成上下文放入 ctx，创建平台任务时据此入库
+func withGenContext(ctx context.Context, platform, prompt, size string, base ImageRecord) context.Context {
+	return context.WithValue(ctx, genContextKey{}, &genContext{TaskID: base.TaskID, Platform: platform, Prompt: prompt, Size: size, Base: base})
+}
+
+// withGenSeed 记录单次平台请求使用的 seed，恢复后的记录仍可复现
+func withGenSeed(ctx context.Context, seed *int64) context.Context {
+	gc, ok := ctx.Value(genContextKey{}).(*genContext)
+	if !ok {
+		return ctx
+	}
+	one := *gc
+	one.Seed = seed
+	return context.WithValue(ctx, genContextKey{}, &one)
+}
+
+// journalProviderTask 记录新创建的平台任务，ctx 中没有生成上下文时返回 nil，nil 的方法均为空操作
+func journalProviderTask(ctx context.Context, provider, providerTaskID string) *ProviderTask {
+	gc, ok := ctx.Value(genContextKey{}).(*genContext)
+	if !ok {
+		return nil
+	}
+	base, _ := json.Marshal(gc.Base)
+	pt := &ProviderTask{
+		TaskID:         gc.TaskID,
+		Provider:       provider,
+		Platform:       gc.Platform,
+		ProviderTaskID: providerTaskID,
+		State:          "polling",
+		Prompt:         gc.Prompt,
+		Size:           gc.Size,
+		Seed:           gc.Seed,
+		Base:           string(base),
+		Worker:         instanceID,
+	}
+	if err := db.Create(pt).Error; err != nil {
+		log.Printf("[%s] 记录平台任务失败: %v", provider, err)
+		return nil
+	}
+	return pt
+}
+
+// Poll 每次查询任务状态前记录查询次数
+func (pt *ProviderTask) Poll() {
+	if pt == nil {
+		return
+	}
+	pt.Attempts++
+	db.Model(pt).Update("attempts", pt.Attempts)
+}
+
+// Finish 记录平台任务的结果；进程退出时来不及记录的任务保持 polling，启动后继续轮询
+func (pt *ProviderTask) Finish(n int, err error) {
+	if pt == nil {
+		return
+	}
+	state := "succeeded"
+	switch {
+	case n > 0:
+	case errorCode(err) == ErrCodeCanceled:
+		state = "canceled"
+	default:
+		state = "failed"
+	}
+	now := time.Now()
+	updates := map[string]interface{}{"state": state, "finished_at": now}
+	if err != nil {
+		updates["error"] = err.Error()
+	}
+	db.Model(pt).Updates(updates)
+}
+
+// ========== 任务状态写入 ==========
+
+// persistTask 保存任务当前状态，在入队、开始、结束时调用
+func persistTask(task *GenerateTask) {
+	taskMu.Lock()
+	t := *task
+	taskMu.Unlock()
+	base, _ := json.Marshal(t.base)
+	ids := make([]string, len(t.ImageIDs))
+	for i, id := range t.ImageIDs {
+		ids[i] = strconv.FormatUint(uint64(id), 10)
+	}
+	rec := TaskRecord{
+		ID: t.ID, Status: t.Status, Platform: t.Platform, Model: t.Model, Size: t.Size, Prompt: t.Prompt,
+		N: t.N, Enhance: t.Enhance, User: t.User, Base: string(base), ImageIDs: strings.Join(ids, ","),
+		Error: t.Error, ErrorCode: t.ErrorCode, Attempts: t.attempts, Worker: instanceID, CallbackURL: t.CallbackURL,
+		CreatedAt: t.CreatedAt, StartedAt: t.StartedAt, FinishedAt: t.FinishedAt,
+	}
+	// 状态未变化时 MySQL 的 UPDATE 影响行数为 0，Save 会误判为不存在再插入，这里直接用 upsert
+	if err := db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&rec).Error; err != nil {
+		log.Printf("🧵 保存任务 %s 状态失败: %v", t.ID, err)
+	}
+}
+
+// taskFromRecord 从持久化状态还原内存中的任务
+func taskFromRecord(rec TaskRecord) *GenerateTask {
+	task := &GenerateTask{
+		ID: rec.ID, Status: rec.Status, Platform: rec.Platform, Model: rec.Model, Size: rec.Size,
+		Prompt: rec.Prompt, N: rec.N, Enhance: rec.Enhance, User: rec.User, Error: rec.Error,
+		ErrorCode: rec.ErrorCode, CreatedAt: rec.CreatedAt, StartedAt: rec.StartedAt, FinishedAt: rec.FinishedAt,
+		CallbackURL: rec.CallbackURL, attempts: rec.Attempts,
+	}
+	json.Unmarshal([]byte(rec.Base), &task.base)
+	task.base.TaskID = rec.ID
+	for _, s := range strings.Split(rec.ImageIDs, ",") {
+		if id, err := strconv.ParseUint(s, 10, 64); err == nil {
+			task.ImageIDs = append(task.ImageIDs, uint(id))
+		}
+	}
+	task.ctx, task.cancel = context.WithCancel(requestid.With(context.Background(), task.ID))
+	return task
+}
+
+// ========== 重启恢复 ==========
+
+// recoverTasks 启动时恢复上次未完成的任务：
+// 仍在轮询的平台任务继续轮询；排队中的任务重新入队；
+// 生成中但没有在途平台任务的，已有图片则视为完成，否则重新执行
+func recoverTasks() {
+	// 共享队列时排队中的任务仍在队列中，其他实例的任务由其他实例恢复
+	pollQuery := db.Where("state = ?", "polling")
+	pendingQuery := db.Where("status IN ?", []string{"queued", "running"})
+	if !jobQueue.Local() {
+		pollQuery = pollQuery.Where("worker = ?", instanceID)
+		pendingQuery = db.Where("status = ? AND worker = ?", "running", instanceID)
+	}
+	var polling []ProviderTask
+	pollQuery.Order("id").Find(&polling)
+	resuming := map[string]bool{}
+	for _, pt := range polling {
+		if pt.TaskID != "" {
+			resuming[pt.TaskID] = true
+		}
+	}
+
+	var pending []TaskRecord
+	pendingQuery.Order("created_at").Find(&pending)
+	for _, rec := range pending {
+		task := taskFromRecord(rec)
+		taskMu.Lock()
+		tasks[task.ID] = task
+		taskMu.Unlock()
+
+		switch {
+		case resuming[task.ID]:
+			// 由平台任务恢复完成后结束
+		case rec.Status == "running" && countTaskImages(task.ID) > 0:
+			finishRecoveredTask(task)
+		case task.attempts >= maxTaskAttempts:
+			finishTask(task, nil, genError(ErrCodeUnknown, "任务多次中断，已放弃"))
+		default:
+			task.Status = "queued"
+			persistTask(task)
+			if !jobQueue.Local() {
+				taskMu.Lock()
+				delete(tasks, task.ID)
+				taskMu.Unlock()
+			}
+			if err := jobQueue.Push(context.Background(), queueGenerate, task.ID); err != nil {
+				finishTask(task, nil, genError(ErrCodeUnknown, "任务未能重新入队: %v", err))
+			}
+		}
+	}
+	if len(polling) > 0 || len(pending) > 0 {
+		log.Printf("🧵 恢复 %d 个平台任务、%d 个异步任务", len(polling), len(pending))
+	}
+
+	for _, pt := range polling {
+		go resumeProviderTask(pt)
+	}
+}
+
+// resumeProviderTask 继续轮询重启前创建的平台任务，完成后保存图片记录
+func resumeProviderTask(pt ProviderTask) {
+	db.Model(&pt).Update("resumes", gorm.Expr("resumes + 1"))
+	pt.Resumes++
+
+	var base ImageRecord
+	json.Unmarshal([]byte(pt.Base), &base)
+	// 所属任务仍可通过 DELETE /api/tasks/:id 取消
+	ctx := requestid.With(context.Background(), pt.TaskID)
+	taskMu.Lock()
+	if task, ok := tasks[pt.TaskID]; ok {
+		ctx = task.ctx
+	}
+	taskMu.Unlock()
+	p, ok := cfg.Platforms[pt.Platform]
+	var (
+		results []*GenerateResult
+		err     error
+	)
+	switch {
+	case !ok:
+		err = genError(ErrCodeInvalid, "平台不存在: %s", pt.Platform)
+	case pt.Resumes > maxProviderResumes:
+		err = genError(ErrCodeUnknown, "平台任务多次恢复失败，已放弃")
+	default:
+		results, err = generator.Resume(ctx, pt.Provider, p.generatorConfig(), pt.ProviderTaskID, taskProgress(pt.TaskID), &pt)
+	}
+	pt.Finish(len(results), err)
+
+	if len(results) > 0 {
+		for _, r := range results {
+			r.Seed = pt.Seed
+		}
+		saveGenerated(pt.Platform, pt.Prompt, pt.Size, results, base)
+		log.Printf("🧵 平台任务 %s 已恢复，保存 %d 张图片", pt.ProviderTaskID, len(results))
+	} else if errorCode(err) != ErrCodeCanceled {
+		recordGenerationFailure(pt.Platform, pt.Prompt, pt.Size, "", base, err)
+		log.Printf("🧵 平台任务 %s 恢复失败: %v", pt.ProviderTaskID, err)
+	}
+
+	if pt.TaskID == "" {
+		return
+	}
+	var remaining int64
+	db.Model(&ProviderTask{}).Where("task_id = ? AND state = ?", pt.TaskID, "polling").Count(&remaining)
+	taskMu.Lock()
+	task, ok := tasks[pt.TaskID]
+	taskMu.Unlock()
+	if remaining == 0 && ok && task.FinishedAt == nil {
+		finishRecoveredTask(task)
+	}
+}
+
+func countTaskImages(taskID string) int64 {
+	var n int64
+	db.Model(&ImageRecord{}).Where("task_id = ? AND status <> ?", taskID, "failed").Count(&n)
+	return n
+}
+
+// finishRecoveredTask 按任务已保存的图片记录结束恢复的任务
+func finishRecoveredTask(task *GenerateTask) {
+	var records []ImageRecord
+	db.Where("task_id = ? AND status <> ?", task.ID, "failed").Order("id").Find(&records)
+	if len(records) == 0 {
+		err := genError(ErrCodeUnknown, "服务重启，任务未生成图片")
+		if task.ctx.Err() != nil {
+			err = genError(ErrCodeCanceled, "任务已取消")
+		}
+		finishTask(task, nil, err)
+		return
+	}
+	finishTask(task, records, nil)
+}
+
+// purgeTaskRecords 清理已结束超过 30 天的任务和平台任务记录
+func purgeTaskRecords() {
+	before := time.Now().AddDate(0, 0, -30)
+	db.Where("finished_at < ?", before).Delete(&TaskRecord{})
+	db.Where("finished_at < ?", before).Delete(&ProviderTask{})
+}
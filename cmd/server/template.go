@@ -0,0 +1,131 @@
+package main
+
+import (
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ========== 模板 ==========
+
+// renderTemplate 渲染 text/template，缺失的变量渲染为空；节日按今天计算
+func renderTemplate(text string, data interface{}) (string, error) {
+	return renderTemplateAt(text, data, bizNow())
+}
+
+// renderTemplateAt 按指定日期渲染，模板中可用 {{holiday}}（临近的节日）和 {{solar_term}}（当前节气）
+func renderTemplateAt(text string, data interface{}, at time.Time) (string, error) {
+	if text == "" {
+		return "", nil
+	}
+	funcs := template.FuncMap{
+		"holiday": func() string {
+			name, _ := upcomingHoliday(at)
+			return name
+		},
+		"solar_term": func() string { return currentSolarTerm(at) },
+	}
+	tpl, err := template.New("").Option("missingkey=zero").Funcs(funcs).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	if err := tpl.Execute(&sb, data); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// publishTemplateData 发布模板可用的变量
+func publishTemplateData(record *ImageRecord) map[string]interface{} {
+	return map[string]interface{}{
+		"ID":       record.ID,
+		"Prompt":   record.Prompt,
+		"Category": record.Category,
+		"Date":     record.Date,
+		"Platform": record.Platform,
+		"Model":    record.Model,
+		"Note":     record.Note,
+	}
+}
+
+// renderPublishText 用模板生成发布标题和正文，模板不存在时返回空
+func renderPublishText(name string, record *ImageRecord) (string, string, error) {
+	t, ok := cfg.Templates[name]
+	if !ok {
+		return "", "", nil
+	}
+	data := publishTemplateData(record)
+	title, err := renderTemplate(t.Title, data)
+	if err != nil {
+		return "", "", err
+	}
+	content, err := renderTemplate(t.Content, data)
+	if err != nil {
+		return "", "", err
+	}
+	return title, content, nil
+}
+
+// ========== 模板预览 API ==========
+
+// previewTemplate POST /api/templates/:id/preview，用示例变量渲染模板，不生成图片
+// image_id 指定时以该图片的发布变量为基础；template 可临时覆盖配置中的模板文本，便于调试
+func previewTemplate(c *gin.Context) {
+	var req struct {
+		Variables map[string]interface{} `json:"variables"`
+		ImageID   uint                   `json:"image_id"`
+		Date      string                 `json:"date"` // 按该日期计算 holiday / solar_term，默认今天
+		Template  *TemplateConfig        `json:"template"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	t, ok := cfg.Templates[c.Param("id")]
+	if req.Template != nil {
+		t, ok = *req.Template, true
+	}
+	if !ok {
+		c.JSON(404, gin.H{"error": "模板不存在"})
+		return
+	}
+	at := bizNow()
+	if req.Date != "" {
+		d, err := time.ParseInLocation("2006-01-02", req.Date, bizLoc)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "date 格式应为 YYYY-MM-DD"})
+			return
+		}
+		at = d
+	}
+
+	data := map[string]interface{}{}
+	if req.ImageID != 0 {
+		var record ImageRecord
+		if err := db.First(&record, req.ImageID).Error; err != nil {
+			c.JSON(404, gin.H{"error": "图片不存在"})
+			return
+		}
+		data = publishTemplateData(&record)
+	}
+	for k, v := range req.Variables {
+		data[k] = v
+	}
+
+	result := gin.H{"variables": data}
+	for field, text := range map[string]string{"prompt": t.Prompt, "title": t.Title, "content": t.Content} {
+		if text == "" {
+			continue
+		}
+		rendered, err := renderTemplateAt(text, data, at)
+		if err != nil {
+			c.JSON(400, gin.H{"error": field + ": " + err.Error(), "field": field})
+			return
+		}
+		result[field] = rendered
+	}
+	c.JSON(200, result)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ========== 业务时区 ==========
+
+// bizLoc 业务时区，“今天”、日期分桶和定时任务均按该时区计算；数据库时间统一存 UTC
+var bizLoc = time.Local
+
+func loadTimezone(name string) error {
+	if name == "" {
+		return nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return fmt.Errorf("无效的时区 %s: %w", name, err)
+	}
+	bizLoc = loc
+	return nil
+}
+
+// bizNow 业务时区的当前时间
+func bizNow() time.Time {
+	return time.Now().In(bizLoc)
+}
+
+// bizDate 时间在业务时区下的日期
+func bizDate(t time.Time) string {
+	return t.In(bizLoc).Format("2006-01-02")
+}
+
+// today 业务时区的今天
+func today() string {
+	return bizDate(time.Now())
+}
+
+// fixRecordDates 按业务时区重新计算历史记录的日期列，用于修改时区后修正旧数据
+func fixRecordDates(c *gin.Context) {
+	var records []ImageRecord
+	db.Select("id", "date", "generated_at").Find(&records)
+	fixed := 0
+	for _, r := range records {
+		if date := bizDate(r.GeneratedAt); date != r.Date {
+			db.Model(&ImageRecord{}).Where("id = ?", r.ID).Update("date", date)
+			fixed++
+		}
+	}
+	c.JSON(200, gin.H{"message": fmt.Sprintf("已修正 %d 条记录日期", fixed), "timezone": bizLoc.String()})
+}
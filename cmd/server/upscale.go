@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/image/draw"
+
+	"image-platform/internal/generator"
+)
+
+// ========== 图片放大 ==========
+
+// upscaleImage 按配置的方式放大图片，返回放大后的文件
+func upscaleImage(ctx context.Context, record *ImageRecord, scale int) (*GenerateResult, error) {
+	if cfg.Upscale.Provider == "" || cfg.Upscale.Provider == "local" {
+		return upscaleLocal(record, scale)
+	}
+	return upscalePlatform(ctx, record, scale)
+}
+
+// saveUpscaled 保存放大结果：<日期>/upscale/<记录ID>_<原文件名>_x<倍数>.png，重复放大同一张图时追加序号
+func saveUpscaled(record *ImageRecord, scale int, data []byte) (string, string, error) {
+	dir := filepath.Join(cfg.ImageGen.OutputDir, bizDate(time.Now()), "upscale")
+	filename := fmt.Sprintf("%d_%s_x%d.png", record.ID, strings.TrimSuffix(record.Name, filepath.Ext(record.Name)), scale)
+	path, err := writeImageFile(dir, filename, data)
+	if err != nil {
+		return "", "", err
+	}
+	return filepath.Base(path), path, nil
+}
+
+// upscaleLocal 本地插值放大，不依赖外部服务，细节不如模型放大
+func upscaleLocal(record *ImageRecord, scale int) (*GenerateResult, error) {
+	src, err := loadImage(record.Path)
+	if err != nil {
+		return nil, fmt.Errorf("读取原图失败: %w", err)
+	}
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx()*scale, b.Dy()*scale))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, b, draw.Src, nil)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, dst); err != nil {
+		return nil, fmt.Errorf("编码失败: %v", err)
+	}
+	filename, path, err := saveUpscaled(record, scale, buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return &GenerateResult{Platform: "本地放大", Model: "catmull-rom", Filename: filename, FilePath: path, Success: true}, nil
+}
+
+// upscalePlatform 通过 internal/generator 调用 upscale.provider 指定的平台放大，与生成共用平台的密钥、并发槽位、熔断和任务轮询
+func upscalePlatform(ctx context.Context, record *ImageRecord, scale int) (*GenerateResult, error) {
+	platform := cfg.Upscale.Provider
+	p, ok := cfg.Platforms[platform]
+	if !ok {
+		return nil, genError(ErrCodeInvalid, "未知的放大方式: %s", platform)
+	}
+	if cfg.Upscale.Model == "" {
+		return nil, genError(ErrCodeInvalid, "未配置放大模型 upscale.model")
+	}
+	src, err := sourceFromRecord(record.ID)
+	if err != nil {
+		return nil, err
+	}
+	gc := p.generatorConfig()
+	if cfg.Upscale.PollInterval > 0 {
+		gc.PollInterval = cfg.Upscale.PollInterval
+	}
+	if cfg.Upscale.MaxWait > 0 {
+		gc.MaxWait = cfg.Upscale.MaxWait
+	}
+	out, err := generator.Generate(ctx, p.Type, generator.GenerateRequest{
+		Platform:  platform,
+		Config:    gc,
+		Operation: generator.OpUpscale,
+		Model:     cfg.Upscale.Model,
+		N:         1,
+		Source:    src.generatorImage(),
+		Scale:     scale,
+	})
+	if len(out.Images) == 0 {
+		if err == nil {
+			err = genError(ErrCodeMalformed, "平台没有返回放大结果")
+		}
+		return nil, err
+	}
+	// 平台结果保存在平台目录下，改按原图命名保存到 upscale 目录
+	result := out.Images[0]
+	data, err := os.ReadFile(result.FilePath)
+	if err != nil {
+		return nil, fmt.Errorf("读取放大结果失败: %v", err)
+	}
+	filename, path, err := saveUpscaled(record, scale, data)
+	if err != nil {
+		return nil, err
+	}
+	os.Remove(result.FilePath)
+	result.Filename, result.FilePath = filename, path
+	return result, nil
+}
+
+// ========== 放大 API ==========
+
+// upscaleHandler POST /api/images/:id/upscale，放大已审核通过的图片，结果为新记录
+func upscaleHandler(c *gin.Context) {
+	var record ImageRecord
+	if err := db.First(&record, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{"error": "图片不存在"})
+		return
+	}
+	if record.Status != "approved" {
+		c.JSON(400, gin.H{"error": "只能放大审核通过的图片"})
+		return
+	}
+	var req struct {
+		Scale int `json:"scale"` // 放大倍数，默认 2
+	}
+	c.ShouldBindJSON(&req)
+	if req.Scale == 0 {
+		req.Scale = 2
+	}
+	if req.Scale < 2 || req.Scale > cfg.Upscale.MaxScale {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("scale 取值范围 2-%d", cfg.Upscale.MaxScale)})
+		return
+	}
+
+	user, apiKey := currentUser(c), currentAPIKey(c)
+	release, err := reserveQuota(user, apiKey, 1, upscaleCost())
+	if err != nil {
+		c.JSON(429, gin.H{"error": err.Error(), "code": "quota_exceeded"})
+		return
+	}
+	defer release()
+
+	upscaled, err := upscaleRecord(c.Request.Context(), &record, req.Scale, user, apiKey)
+	if err != nil {
+		c.JSON(502, gin.H{"error": "放大失败: " + err.Error(), "code": "upscale_failed", "error_code": errorCode(err)})
+		return
+	}
+	c.JSON(200, gin.H{"message": "success", "id": upscaled.ID, "source_id": record.ID, "record": upscaled, "url": imageURL(upscaled.Path)})
+}
+
+// upscaleCost 放大一张图片的费用，本地放大不计费
+func upscaleCost() float64 {
+	if cfg.Upscale.Provider == "" || cfg.Upscale.Provider == "local" {
+		return 0
+	}
+	return cfg.Upscale.CostPerImage
+}
+
+// upscaleRecord 放大图片并保存为新记录，放大过程记录为处理任务
+// 放大不改变内容，新记录直接为已通过状态
+func upscaleRecord(ctx context.Context, record *ImageRecord, scale int, user, apiKey string) (*ImageRecord, error) {
+	job := startProcessing(record.ID, "upscale", gin.H{"scale": scale}, user, apiKey)
+	result, err := upscaleImage(ctx, record, scale)
+	if err != nil {
+		job.finish("", err)
+		return nil, err
+	}
+	upscaled := newImageRecord(result, record.Prompt)
+	upscaled.User = user
+	upscaled.APIKey = apiKey
+	upscaled.Workspace = record.Workspace
+	upscaled.Category = record.Category
+	upscaled.SourceID = &record.ID
+	upscaled.Operation = "upscale"
+	upscaled.Cost = upscaleCost()
+	if f, err := os.Open(result.FilePath); err == nil {
+		if conf, _, err := image.DecodeConfig(f); err == nil {
+			upscaled.Size = fmt.Sprintf("%dx%d", conf.Width, conf.Height)
+		}
+		f.Close()
+	}
+	now := time.Now()
+	upscaled.Status = "approved"
+	upscaled.ModeratedAt = &now
+	upscaled.Note = fmt.Sprintf("由 #%d 放大 %d 倍", record.ID, scale)
+	if err := createImageRecord(&upscaled); err != nil {
+		job.finish("", err)
+		return nil, err
+	}
+	job.finish(upscaled.Path, nil)
+	recordActivity("upscaled", record.ID, user, fmt.Sprintf("放大 %d 倍生成 #%d", scale, upscaled.ID))
+	return &upscaled, nil
+}
+
+// rerunUpscale 按处理记录的倍数重新放大
+func rerunUpscale(ctx context.Context, job *ProcessingJob, record *ImageRecord) (string, error) {
+	var params struct {
+		Scale int `json:"scale"`
+	}
+	if err := json.Unmarshal([]byte(job.Params), &params); err != nil || params.Scale < 2 {
+		return "", genError(ErrCodeInvalid, "处理参数无效: %s", job.Params)
+	}
+	release, err := reserveQuota(job.User, job.APIKey, 1, upscaleCost())
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	upscaled, err := upscaleRecord(ctx, record, params.Scale, job.User, job.APIKey)
+	if err != nil {
+		return "", err
+	}
+	return upscaled.Path, nil
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"log"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/image/draw"
+)
+
+// ========== 每周精选 ==========
+
+// WeeklySummaryConfig 每周精选：选出上周得分最高的已通过图片，拼图并由 LLM 写文案，生成发布草稿等人工确认
+type WeeklySummaryConfig struct {
+	Enabled   bool     `yaml:"enabled"`
+	Weekday   string   `yaml:"weekday"`   // 生成日 monday..sunday，默认 monday
+	RunAt     string   `yaml:"runAt"`     // 生成时间 HH:MM（业务时区），默认 09:00
+	Count     int      `yaml:"count"`     // 入选张数，默认 9，拼图按最接近的正方形网格排列
+	Size      int      `yaml:"size"`      // 拼图边长（像素），默认 1080
+	Platforms []string `yaml:"platforms"` // 确认后发布到的平台，为空时确认时指定
+	Reviewers []string `yaml:"reviewers"` // 草稿生成后通知的确认人，为空通知 notifications.reviewers
+}
+
+// WeeklySummary 一周的精选草稿，确认后按平台创建定时发布任务
+type WeeklySummary struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	Week        string     `gorm:"size:10;uniqueIndex;not null" json:"week"` // ISO 周，如 2026-W41
+	From        string     `gorm:"size:20" json:"from"`
+	To          string     `gorm:"size:20" json:"to"`
+	Status      string     `gorm:"size:20;index" json:"status"` // running, draft, confirmed, discarded, failed
+	ImageIDs    string     `gorm:"size:255" json:"image_ids"`   // 入选图片，按得分从高到低，逗号分隔
+	CollageID   *uint      `json:"collage_id"`                  // 拼图的图片记录
+	Title       string     `gorm:"size:255" json:"title"`
+	Content     string     `gorm:"type:text" json:"content"`
+	Platforms   string     `gorm:"size:255" json:"platforms"` // 发布平台，逗号分隔
+	JobIDs      string     `gorm:"size:255" json:"job_ids"`   // 确认后创建的发布任务
+	Error       string     `gorm:"type:text" json:"error"`
+	ConfirmedBy string     `gorm:"size:100" json:"confirmed_by"`
+	ConfirmedAt *time.Time `json:"confirmed_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+func (WeeklySummary) TableName() string {
+	return "weekly_summaries"
+}
+
+// weeklyScore 入选排序：浏览、下载代表互动，自动审核和一致性得分代表质量
+const weeklyScore = "view_count + 5 * download_count + 50 * COALESCE(auto_score, 0) + COALESCE(consistency_score, 0) / 2"
+
+var errWeeklyExists = errors.New("该周的精选已生成")
+
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "monday": time.Monday, "tuesday": time.Tuesday, "wednesday": time.Wednesday,
+	"thursday": time.Thursday, "friday": time.Friday, "saturday": time.Saturday,
+}
+
+// validateWeeklySummary 启动时检查生成日和时间
+func validateWeeklySummary() error {
+	if _, ok := weekdays[strings.ToLower(cfg.WeeklySummary.Weekday)]; !ok {
+		return fmt.Errorf("weekday 应为 monday..sunday: %s", cfg.WeeklySummary.Weekday)
+	}
+	if _, err := time.Parse("15:04", cfg.WeeklySummary.RunAt); err != nil {
+		return fmt.Errorf("runAt 格式应为 HH:MM: %s", cfg.WeeklySummary.RunAt)
+	}
+	return nil
+}
+
+// lastWeek now 所在周的上一周（周一到周日）的 ISO 周和起止日期
+func lastWeek(now time.Time) (week, from, to string) {
+	offset := (int(now.Weekday()) + 6) % 7 // 距本周一的天数
+	start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).AddDate(0, 0, -offset-7)
+	y, w := start.ISOWeek()
+	return fmt.Sprintf("%d-W%02d", y, w), start.Format("2006-01-02"), start.AddDate(0, 0, 6).Format("2006-01-02")
+}
+
+// runWeeklySummaryScheduler 每分钟检查一次，到达生成日的 runAt 后为上一周生成精选草稿
+func runWeeklySummaryScheduler() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		now := bizNow()
+		if !cfg.WeeklySummary.Enabled || now.Weekday() != weekdays[strings.ToLower(cfg.WeeklySummary.Weekday)] || !reachedRunAt(now, cfg.WeeklySummary.RunAt) {
+			continue
+		}
+		week, _, _ := lastWeek(now)
+		var n int64
+		if db.Model(&WeeklySummary{}).Where("week = ?", week).Count(&n); n > 0 {
+			continue
+		}
+		if _, err := createWeeklySummary(context.Background(), now); err != nil && err != errWeeklyExists {
+			log.Printf("📰 每周精选 %s 生成失败: %v", week, err)
+		}
+	}
+}
+
+// createWeeklySummary 为 now 的上一周生成精选草稿；同一周只生成一次，多实例部署时由唯一索引保证
+func createWeeklySummary(ctx context.Context, now time.Time) (*WeeklySummary, error) {
+	week, from, to := lastWeek(now)
+	s := WeeklySummary{Week: week, From: from, To: to, Status: "running", Platforms: strings.Join(cfg.WeeklySummary.Platforms, ",")}
+	if err := db.Create(&s).Error; err != nil {
+		var n int64
+		if db.Model(&WeeklySummary{}).Where("week = ?", week).Count(&n); n > 0 {
+			return nil, errWeeklyExists
+		}
+		return nil, err
+	}
+	if err := composeWeeklySummary(ctx, &s); err != nil {
+		s.Status, s.Error = "failed", err.Error()
+		db.Model(&s).Updates(map[string]interface{}{"status": s.Status, "error": s.Error})
+		return &s, err
+	}
+	db.Save(&s)
+	log.Printf("📰 每周精选 %s 草稿已生成：%d 张，拼图 #%d", s.Week, len(strings.Split(s.ImageIDs, ",")), *s.CollageID)
+	notifyReviewers(cfg.WeeklySummary.Reviewers, fmt.Sprintf("每周精选 %s 待确认发布", s.Week), s.Title, fmt.Sprintf("/api/weekly-summaries/%d", s.ID))
+	emitEvent(db, "weekly_summary.drafted", gin.H{"id": s.ID, "week": s.Week, "collage_id": s.CollageID, "title": s.Title})
+	return &s, nil
+}
+
+// composeWeeklySummary 选图、拼图、写文案，成功后 s 为 draft 状态
+func composeWeeklySummary(ctx context.Context, s *WeeklySummary) error {
+	var top []ImageRecord
+	db.Where("status = ? AND date BETWEEN ? AND ? AND operation <> ?", "approved", s.From, s.To, "collage").
+		Order(weeklyScore + " DESC").Order("id").Limit(cfg.WeeklySummary.Count).Find(&top)
+	if len(top) == 0 {
+		return fmt.Errorf("%s 至 %s 没有审核通过的图片", s.From, s.To)
+	}
+
+	collage, err := buildCollage(s, top)
+	if err != nil {
+		return err
+	}
+	ids := make([]string, len(top))
+	for i, r := range top {
+		ids[i] = strconv.FormatUint(uint64(r.ID), 10)
+	}
+	s.ImageIDs = strings.Join(ids, ",")
+	s.CollageID = &collage.ID
+	s.Title, s.Content = weeklySummaryText(ctx, s, top)
+	s.Status = "draft"
+	return nil
+}
+
+// buildCollage 按网格拼接入选图片，每张居中裁成正方形；拼图以已通过的记录入库，可以直接发布
+func buildCollage(s *WeeklySummary, top []ImageRecord) (*ImageRecord, error) {
+	cols := int(math.Ceil(math.Sqrt(float64(len(top)))))
+	rows := (len(top) + cols - 1) / cols
+	cell := cfg.WeeklySummary.Size / cols
+	canvas := image.NewRGBA(image.Rect(0, 0, cell*cols, cell*rows))
+	draw.Draw(canvas, canvas.Bounds(), &image.Uniform{C: color.White}, image.Point{}, draw.Src)
+	for i, r := range top {
+		img, err := loadImage(r.Path)
+		if err != nil {
+			return nil, fmt.Errorf("读取图片 #%d 失败: %v", r.ID, err)
+		}
+		b := img.Bounds()
+		side := min(b.Dx(), b.Dy())
+		crop := image.Rect(b.Min.X+(b.Dx()-side)/2, b.Min.Y+(b.Dy()-side)/2, 0, 0)
+		crop.Max = crop.Min.Add(image.Pt(side, side))
+		x, y := (i%cols)*cell, (i/cols)*cell
+		draw.CatmullRom.Scale(canvas, image.Rect(x, y, x+cell, y+cell), img, crop, draw.Src, nil)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, canvas); err != nil {
+		return nil, fmt.Errorf("编码拼图失败: %v", err)
+	}
+	now := time.Now()
+	path, err := writeImageFile(filepath.Join(cfg.ImageGen.OutputDir, bizDate(now), "weekly"), s.Week+".png", buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	record := ImageRecord{
+		Name:        filepath.Base(path),
+		Date:        bizDate(now),
+		Path:        path,
+		Platform:    "collage",
+		Model:       "collage",
+		Prompt:      fmt.Sprintf("每周精选 %s（%s 至 %s）", s.Week, s.From, s.To),
+		GeneratedAt: now,
+		Size:        fmt.Sprintf("%dx%d", canvas.Bounds().Dx(), canvas.Bounds().Dy()),
+		Status:      "approved",
+		ModeratedAt: &now,
+		Note:        "每周精选拼图，由入选的已通过图片组成",
+		User:        "weekly",
+		Operation:   "collage",
+		FileSize:    int64(buf.Len()),
+		MimeType:    "image/png",
+	}
+	if err := createImageRecord(&record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// weeklySummaryText LLM 根据入选图片的提示词写标题和正文，未配置或失败时使用模板文案
+func weeklySummaryText(ctx context.Context, s *WeeklySummary, top []ImageRecord) (title, content string) {
+	var prompts strings.Builder
+	for i, r := range top {
+		fmt.Fprintf(&prompts, "%d. %s\n", i+1, r.Prompt)
+	}
+	reply, err := callLLM(ctx, fmt.Sprintf(`下面是本周（%s 至 %s）精选的 %d 张 AI 生成图片的描述词：
+%s
+请为这组图片写一篇社交媒体周报：第一行是不超过 20 字的标题，之后是 150 字以内的正文，不要使用 Markdown。`, s.From, s.To, len(top), prompts.String()))
+	if err == nil {
+		if title, content, ok := strings.Cut(strings.TrimSpace(reply), "\n"); ok && strings.TrimSpace(content) != "" {
+			return strings.Trim(strings.TrimSpace(title), "《》#* "), strings.TrimSpace(content)
+		}
+	}
+	if err != nil {
+		log.Printf("📰 每周精选 %s 文案生成失败，使用模板: %v", s.Week, err)
+	}
+	return fmt.Sprintf("本周精选 %s", s.Week), fmt.Sprintf("%s 至 %s 的 %d 张精选作品：\n%s", s.From, s.To, len(top), prompts.String())
+}
+
+// ========== 每周精选 API ==========
+
+// listWeeklySummaries GET /api/weekly-summaries?status=draft
+func listWeeklySummaries(c *gin.Context) {
+	query := db.Model(&WeeklySummary{})
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var summaries []WeeklySummary
+	query.Order("week DESC").Limit(52).Find(&summaries)
+	c.JSON(200, gin.H{"summaries": summaries, "total": len(summaries)})
+}
+
+// getWeeklySummary GET /api/weekly-summaries/:id，附带拼图和入选图片
+func getWeeklySummary(c *gin.Context) {
+	var s WeeklySummary
+	if err := db.First(&s, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{"error": "每周精选不存在"})
+		return
+	}
+	var images []ImageRecord
+	if s.ImageIDs != "" {
+		db.Where("id IN ?", strings.Split(s.ImageIDs, ",")).Find(&images)
+	}
+	h := gin.H{"summary": s, "images": withImageURLs(images)}
+	if s.CollageID != nil {
+		var collage ImageRecord
+		if db.First(&collage, *s.CollageID).Error == nil {
+			h["collage"] = withImageURLs([]ImageRecord{collage})[0]
+		}
+	}
+	c.JSON(200, h)
+}
+
+// runWeeklySummaryNow POST /api/weekly-summaries/run，立即为上一周生成草稿；上次生成失败的重新生成，已有草稿时返回 409
+func runWeeklySummaryNow(c *gin.Context) {
+	now := bizNow()
+	week, _, _ := lastWeek(now)
+	db.Where("week = ? AND status = ?", week, "failed").Delete(&WeeklySummary{})
+	s, err := createWeeklySummary(c.Request.Context(), now)
+	if err == errWeeklyExists {
+		c.JSON(409, gin.H{"error": "上一周的精选已生成"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error(), "summary": s})
+		return
+	}
+	c.JSON(200, gin.H{"message": "success", "summary": s})
+}
+
+// updateWeeklySummary PUT /api/weekly-summaries/:id，确认前修改标题、正文和发布平台
+func updateWeeklySummary(c *gin.Context) {
+	var req struct {
+		Title     *string  `json:"title"`
+		Content   *string  `json:"content"`
+		Platforms []string `json:"platforms"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	updates := map[string]interface{}{}
+	if req.Title != nil {
+		updates["title"] = *req.Title
+	}
+	if req.Content != nil {
+		updates["content"] = *req.Content
+	}
+	if req.Platforms != nil {
+		updates["platforms"] = strings.Join(req.Platforms, ",")
+	}
+	if len(updates) == 0 {
+		c.JSON(400, gin.H{"error": "没有要修改的字段"})
+		return
+	}
+	res := db.Model(&WeeklySummary{}).Where("id = ? AND status = ?", c.Param("id"), "draft").Updates(updates)
+	if res.RowsAffected == 0 {
+		c.JSON(409, gin.H{"error": "草稿不存在或已确认"})
+		return
+	}
+	c.JSON(200, gin.H{"message": "success"})
+}
+
+// confirmWeeklySummary POST /api/weekly-summaries/:id/confirm，人工确认后为拼图创建发布任务
+// at 为 HH:MM 时排到下一个该时刻，为空立即发布；不在平台发布时段内时顺延
+func confirmWeeklySummary(c *gin.Context) {
+	var req struct {
+		At string `json:"at"`
+	}
+	c.ShouldBindJSON(&req)
+	at, err := nextSlot(req.At, bizNow())
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	var s WeeklySummary
+	if err := db.First(&s, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{"error": "每周精选不存在"})
+		return
+	}
+	if s.Platforms == "" {
+		c.JSON(400, gin.H{"error": "请先指定发布平台"})
+		return
+	}
+	// 抢占草稿，避免重复确认
+	now := time.Now()
+	user := currentUser(c)
+	res := db.Model(&WeeklySummary{}).Where("id = ? AND status = ?", s.ID, "draft").
+		Updates(map[string]interface{}{"status": "confirmed", "confirmed_by": user, "confirmed_at": now})
+	if res.RowsAffected == 0 {
+		c.JSON(409, gin.H{"error": "草稿不存在或已确认"})
+		return
+	}
+	jobs, err := schedulePublish(*s.CollageID, strings.Split(s.Platforms, ","), s.Title, s.Content, at, nil)
+	ids := make([]string, len(jobs))
+	for i, j := range jobs {
+		ids[i] = strconv.FormatUint(uint64(j.ID), 10)
+	}
+	db.Model(&WeeklySummary{}).Where("id = ?", s.ID).Update("job_ids", strings.Join(ids, ","))
+	if err != nil {
+		c.JSON(500, gin.H{"error": "创建发布任务失败: " + err.Error(), "jobs": jobs})
+		return
+	}
+	recordActivity("weekly_confirmed", *s.CollageID, user, fmt.Sprintf("每周精选 %s 发布到 %s", s.Week, s.Platforms))
+	c.JSON(200, gin.H{"message": "success", "jobs": jobs})
+}
+
+// discardWeeklySummary POST /api/weekly-summaries/:id/discard，放弃草稿，拼图记录保留
+func discardWeeklySummary(c *gin.Context) {
+	res := db.Model(&WeeklySummary{}).Where("id = ? AND status = ?", c.Param("id"), "draft").Update("status", "discarded")
+	if res.RowsAffected == 0 {
+		c.JSON(409, gin.H{"error": "草稿不存在或已确认"})
+		return
+	}
+	c.JSON(200, gin.H{"message": "success"})
+}
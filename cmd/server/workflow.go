@@ -0,0 +1,344 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ========== 自动化流程 ==========
+
+// WorkflowRun 一次流程执行，Steps 记录每一步的结果
+type WorkflowRun struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	Workflow   string     `gorm:"size:100;index;not null" json:"workflow"`
+	Prompt     string     `gorm:"size:1000" json:"prompt"`
+	Status     string     `gorm:"size:20;index" json:"status"` // running, waiting_review, publishing, succeeded, rejected, failed
+	ImageID    *uint      `gorm:"index" json:"image_id"`
+	Steps      string     `gorm:"type:text" json:"-"`
+	Error      string     `gorm:"type:text" json:"error"`
+	User       string     `gorm:"size:100" json:"user"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
+
+func (WorkflowRun) TableName() string {
+	return "workflow_runs"
+}
+
+// WorkflowStep 流程中单个步骤的结果
+type WorkflowStep struct {
+	Name   string    `json:"name"`   // generate, auto_moderate, approve, schedule_publish, publish
+	Status string    `json:"status"` // succeeded, failed, skipped, waiting
+	Detail string    `json:"detail"`
+	At     time.Time `json:"at"`
+}
+
+func (r *WorkflowRun) steps() []WorkflowStep {
+	var steps []WorkflowStep
+	if r.Steps != "" {
+		json.Unmarshal([]byte(r.Steps), &steps)
+	}
+	return steps
+}
+
+// addStep 追加步骤并持久化
+func (r *WorkflowRun) addStep(name, status, detail string) {
+	steps := append(r.steps(), WorkflowStep{Name: name, Status: status, Detail: detail, At: time.Now()})
+	data, _ := json.Marshal(steps)
+	r.Steps = string(data)
+	db.Model(&WorkflowRun{}).Where("id = ?", r.ID).Update("steps", r.Steps)
+}
+
+// setStatus 更新状态，终态时记录结束时间
+func (r *WorkflowRun) setStatus(status, errMsg string) {
+	r.Status = status
+	r.Error = errMsg
+	updates := map[string]interface{}{"status": status, "error": errMsg}
+	switch status {
+	case "succeeded", "rejected", "failed":
+		now := time.Now()
+		r.FinishedAt = &now
+		updates["finished_at"] = now
+	}
+	db.Model(&WorkflowRun{}).Where("id = ?", r.ID).Updates(updates)
+}
+
+// runWorkflow 执行生成和自动审核，通过后进入发布步骤
+func runWorkflow(run *WorkflowRun, wf WorkflowConfig, base ImageRecord) {
+	log.Printf("⚙️ 流程 %s #%d 开始", run.Workflow, run.ID)
+
+	// 生成
+	base.Category = wf.Category
+	saved, err := generateAndSave(jobContext("workflow", run.ID), wf.Platform, run.Prompt, wf.Size, wf.Model, base)
+	if err != nil {
+		run.addStep("generate", "failed", err.Error())
+		run.setStatus("failed", err.Error())
+		return
+	}
+	record := *saved
+	run.ImageID = &record.ID
+	db.Model(&WorkflowRun{}).Where("id = ?", run.ID).Update("image_id", record.ID)
+	run.addStep("generate", "succeeded", fmt.Sprintf("图片 #%d %s", record.ID, record.Path))
+
+	// 自动审核
+	autoPassed := true
+	if wf.AutoModerate {
+		verdict, err := autoModerate(context.Background(), &record)
+		if err != nil {
+			run.addStep("auto_moderate", "failed", err.Error())
+		} else {
+			autoPassed = verdict.Passed
+			run.addStep("auto_moderate", "succeeded", fmt.Sprintf("得分 %.2f: %s", verdict.Score, verdict.Reason()))
+		}
+	} else {
+		run.addStep("auto_moderate", "skipped", "未开启自动审核")
+	}
+
+	// 审核关卡：命中后必须人工审核，由审核接口按票数放行
+	if gates, approvals := matchGates(wf.Gates, &record); len(gates) > 0 {
+		db.Model(&ImageRecord{}).Where("id = ?", record.ID).Update("required_approvals", approvals)
+		run.addStep("gate", "succeeded", fmt.Sprintf("命中关卡 %s，需要 %d 人审核通过", strings.Join(gates, ","), approvals))
+		run.addStep("approve", "waiting", "等待人工审核")
+		run.setStatus("waiting_review", "")
+		return
+	}
+
+	if record.AutoScore == nil {
+		run.addStep("approve", "waiting", "无自动审核得分，等待人工审核")
+		run.setStatus("waiting_review", "")
+		return
+	}
+	if !autoPassed {
+		run.addStep("approve", "waiting", "自动审核未通过，等待人工审核")
+		run.setStatus("waiting_review", "")
+		return
+	}
+	score := *record.AutoScore
+	if wf.AutoApproveThreshold <= 0 || score < wf.AutoApproveThreshold {
+		run.addStep("approve", "waiting", fmt.Sprintf("得分低于阈值 %.2f，等待人工审核", wf.AutoApproveThreshold))
+		run.setStatus("waiting_review", "")
+		return
+	}
+	now := time.Now()
+	note := fmt.Sprintf("流程 %s 自动通过 (得分 %.2f)", run.Workflow, score)
+	db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&ImageRecord{}).Where("id = ?", record.ID).Updates(map[string]interface{}{
+			"status": "approved", "note": note, "moderated_at": now}).Error; err != nil {
+			return err
+		}
+		return emitEvent(tx, "image.approved", gin.H{"id": record.ID, "status": "approved", "note": note, "reviewer": "workflow:" + run.Workflow})
+	})
+	record.Status = "approved"
+	recordActivity("approved", record.ID, "workflow:"+run.Workflow, note)
+	run.addStep("approve", "succeeded", note)
+
+	schedulePublishStep(run, wf, &record)
+}
+
+// matchGates 返回命中的关卡名称及所需的最大通过人数
+func matchGates(gates []WorkflowGate, record *ImageRecord) ([]string, int) {
+	var names []string
+	approvals := 0
+	for i, g := range gates {
+		hit := false
+		if g.MinScore > 0 && (record.AutoScore == nil || *record.AutoScore < g.MinScore) {
+			hit = true
+		}
+		for _, cat := range g.Categories {
+			if record.Category == cat {
+				hit = true
+			}
+		}
+		for _, kw := range g.Keywords {
+			if kw != "" && strings.Contains(record.Prompt, kw) {
+				hit = true
+			}
+		}
+		if !hit {
+			continue
+		}
+		name := g.Name
+		if name == "" {
+			name = fmt.Sprintf("gate-%d", i+1)
+		}
+		names = append(names, name)
+		approvals = max(approvals, g.Approvals, 1)
+	}
+	return names, approvals
+}
+
+// schedulePublishStep 按流程配置创建定时发布任务
+func schedulePublishStep(run *WorkflowRun, wf WorkflowConfig, record *ImageRecord) {
+	if wf.Publish == nil || len(wf.Publish.Platforms) == 0 {
+		run.addStep("schedule_publish", "skipped", "未配置发布")
+		run.setStatus("succeeded", "")
+		return
+	}
+
+	title, content, err := renderPublishText(wf.Publish.Template, record)
+	if err != nil {
+		run.addStep("schedule_publish", "failed", "渲染模板失败: "+err.Error())
+		run.setStatus("failed", err.Error())
+		return
+	}
+	at, err := nextSlot(wf.Publish.At, bizNow())
+	if err != nil {
+		run.addStep("schedule_publish", "failed", err.Error())
+		run.setStatus("failed", err.Error())
+		return
+	}
+	if _, err := schedulePublish(record.ID, wf.Publish.Platforms, title, content, at, &run.ID); err != nil {
+		run.addStep("schedule_publish", "failed", err.Error())
+		run.setStatus("failed", err.Error())
+		return
+	}
+	run.addStep("schedule_publish", "succeeded", fmt.Sprintf("%v 于 %s 发布", wf.Publish.Platforms, at.Format("2006-01-02 15:04")))
+	run.setStatus("publishing", "")
+}
+
+// resumeWorkflows 人工审核后继续等待中的流程
+func resumeWorkflows(imageID uint, status string) {
+	var runs []WorkflowRun
+	db.Where("image_id = ? AND status = ?", imageID, "waiting_review").Find(&runs)
+	for i := range runs {
+		run := &runs[i]
+		wf, ok := cfg.Workflows[run.Workflow]
+		if !ok {
+			run.setStatus("failed", "流程配置已删除")
+			continue
+		}
+		switch status {
+		case "approved":
+			var record ImageRecord
+			if err := db.First(&record, imageID).Error; err != nil {
+				run.setStatus("failed", "图片不存在")
+				continue
+			}
+			run.addStep("approve", "succeeded", "人工审核通过")
+			schedulePublishStep(run, wf, &record)
+		case "rejected":
+			run.addStep("approve", "failed", "人工审核拒绝")
+			run.setStatus("rejected", "")
+		}
+	}
+}
+
+// onPublishJobFinished 流程的所有发布任务结束后更新流程状态
+func onPublishJobFinished(runID uint) {
+	var run WorkflowRun
+	if err := db.First(&run, runID).Error; err != nil || run.Status != "publishing" {
+		return
+	}
+	var jobs []PublishJob
+	db.Where("workflow_run_id = ?", runID).Find(&jobs)
+	failed := 0
+	for _, job := range jobs {
+		switch job.Status {
+		case "pending", "running":
+			return
+		case "failed":
+			failed++
+			run.addStep("publish", "failed", fmt.Sprintf("%s: %s", job.Platform, job.Result))
+		default:
+			run.addStep("publish", job.Status, fmt.Sprintf("%s: %s", job.Platform, job.Result))
+		}
+	}
+	if failed > 0 {
+		run.setStatus("failed", fmt.Sprintf("%d 个平台发布失败", failed))
+		return
+	}
+	run.setStatus("succeeded", "")
+}
+
+// ========== 流程 API ==========
+func listWorkflows(c *gin.Context) {
+	names := make([]string, 0, len(cfg.Workflows))
+	for name := range cfg.Workflows {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	workflows := make([]gin.H, len(names))
+	for i, name := range names {
+		workflows[i] = gin.H{"name": name, "config": cfg.Workflows[name]}
+	}
+	c.JSON(200, gin.H{"workflows": workflows})
+}
+
+func runWorkflowHandler(c *gin.Context) {
+	name := c.Param("name")
+	wf, ok := cfg.Workflows[name]
+	if !ok {
+		c.JSON(404, gin.H{"error": "流程不存在"})
+		return
+	}
+	var req struct {
+		Prompt string `json:"prompt" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if p, ok := cfg.Platforms[wf.Platform]; !ok || !p.Enabled {
+		c.JSON(400, gin.H{"error": "流程配置的平台不可用: " + wf.Platform})
+		return
+	}
+	verdict := checkPromptPolicy(c.Request.Context(), req.Prompt, wf.Platform)
+	if !verdict.Blocked && wf.Publish != nil {
+		// 流程会自动发布，提前按发布平台的规则检查
+		if v := checkPublishPolicy(req.Prompt, wf.Publish.Platforms...); v.Blocked {
+			verdict = v
+		}
+	}
+	if verdict.Blocked {
+		c.JSON(422, verdict.response())
+		return
+	}
+
+	run := WorkflowRun{Workflow: name, Prompt: req.Prompt, Status: "running", User: currentUser(c)}
+	if err := db.Create(&run).Error; err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	base := ImageRecord{
+		User:       currentUser(c),
+		APIKey:     currentAPIKey(c),
+		Workspace:  currentWorkspace(c),
+		PolicyFlag: verdict.Flag,
+	}
+	go runWorkflow(&run, wf, base)
+
+	c.JSON(200, gin.H{"message": "success", "run_id": run.ID})
+}
+
+func listWorkflowRuns(c *gin.Context) {
+	var runs []WorkflowRun
+	query := db.Model(&WorkflowRun{})
+	if name := c.Query("workflow"); name != "" {
+		query = query.Where("workflow = ?", name)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	query.Order("id DESC").Limit(100).Find(&runs)
+	c.JSON(200, gin.H{"runs": runs, "total": len(runs)})
+}
+
+func getWorkflowRun(c *gin.Context) {
+	var run WorkflowRun
+	if err := db.First(&run, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{"error": "流程记录不存在"})
+		return
+	}
+	var jobs []PublishJob
+	db.Where("workflow_run_id = ?", run.ID).Find(&jobs)
+	c.JSON(200, gin.H{"run": run, "steps": run.steps(), "publish_jobs": jobs})
+}
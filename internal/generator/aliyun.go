@@ -0,0 +1,180 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// ========== 阿里云百炼 ==========
+
+func init() {
+	// 百炼是异步 API，图生图和局部重绘使用通用图像编辑，参考图引导使用涂鸦作画（只支持 canny）
+	register("aliyun", Capabilities{
+		Seed: true, Img2Img: true, Inpaint: true, Control: true, SourceURL: true,
+		ControlModels: map[string]string{"canny": "wanx-sketch-to-image-lite"},
+	}, generateAliyun)
+	resumers["aliyun"] = pollAliyunTask
+}
+
+func generateAliyun(ctx context.Context, req GenerateRequest) ([]*Image, error) {
+	p := req.Config
+	switch req.Operation {
+	case OpImg2Img:
+		// description_edit 按指令修改原图
+		srcURL, err := req.Source.url()
+		if err != nil {
+			return nil, err
+		}
+		reqBody, _ := json.Marshal(map[string]interface{}{
+			"model": p.Model,
+			"input": map[string]string{
+				"function":       "description_edit",
+				"prompt":         req.Prompt,
+				"base_image_url": srcURL,
+			},
+			"parameters": map[string]interface{}{"n": req.N, "strength": req.Strength},
+		})
+		return submitAliyunTask(ctx, p, "image2image", reqBody, req.Progress)
+	case OpInpaint:
+		// description_edit_with_mask 只重绘遮罩白色区域
+		srcURL, err := req.Source.url()
+		if err != nil {
+			return nil, err
+		}
+		maskURL, err := req.Mask.url()
+		if err != nil {
+			return nil, err
+		}
+		reqBody, _ := json.Marshal(map[string]interface{}{
+			"model": p.Model,
+			"input": map[string]string{
+				"function":       "description_edit_with_mask",
+				"prompt":         req.Prompt,
+				"base_image_url": srcURL,
+				"mask_image_url": maskURL,
+			},
+			"parameters": map[string]interface{}{"n": 1},
+		})
+		return submitAliyunTask(ctx, p, "image2image", reqBody, req.Progress)
+	case OpControl:
+		// 涂鸦作画，sketch_weight 0-10 为线稿的约束程度
+		g := req.Control
+		sketchURL, err := g.Image.url()
+		if err != nil {
+			return nil, err
+		}
+		params := map[string]interface{}{"n": req.N, "sketch_weight": int(g.Strength * 10), "style": "<auto>"}
+		if req.Size != "" {
+			params["size"] = providerSize(p, req.Size)
+		}
+		reqBody, _ := json.Marshal(map[string]interface{}{
+			"model":      g.Model,
+			"input":      map[string]string{"sketch_image_url": sketchURL, "prompt": req.Prompt},
+			"parameters": params,
+		})
+		return submitAliyunTask(ctx, p, "image2image", reqBody, req.Progress)
+	}
+	return generateAliyunImage(ctx, p, req.Prompt, req.Size, req.N, req.NegativePrompt, req.Seed, req.Progress)
+}
+
+// generateAliyunImage 文生图，size 为空时使用 Env 的尺寸，百炼格式为 宽*高
+func generateAliyunImage(ctx context.Context, p Config, prompt, size string, n int, negative string, seed *int64, prog progress) ([]*Image, error) {
+	if size == "" {
+		size = defaultSize()
+	}
+	input := map[string]string{"prompt": prompt}
+	if negative != "" {
+		input["negative_prompt"] = negative
+	}
+	parameters := map[string]interface{}{
+		"size": providerSize(p, size),
+		"n":    n,
+	}
+	if seed != nil {
+		parameters["seed"] = *seed
+	}
+
+	// 步骤1: 创建任务
+	reqBody, _ := json.Marshal(map[string]interface{}{
+		"model":      p.Model,
+		"input":      input,
+		"parameters": parameters,
+	})
+
+	return submitAliyunTask(ctx, p, "text2image", reqBody, prog)
+}
+
+// submitAliyunTask 创建百炼异步任务并轮询结果，service 为 text2image / image2image
+func submitAliyunTask(ctx context.Context, p Config, service string, reqBody []byte, prog progress) ([]*Image, error) {
+	c := client(p.Name, 30*time.Second)
+
+	req, _ := http.NewRequestWithContext(ctx, "POST", "https://dashscope.aliyuncs.com/api/v1/services/aigc/"+service+"/image-synthesis", bytes.NewReader(reqBody))
+	req.Header.Set("Authorization", "Bearer "+p.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-DashScope-Async", "enable")
+
+	resp, body, err := DoWithRetry(c, req)
+	if err != nil {
+		return nil, RequestError("创建任务失败", err)
+	}
+	var taskResp struct {
+		Output struct {
+			TaskID string `json:"task_id"`
+		} `json:"output"`
+	}
+	if err := json.Unmarshal(body, &taskResp); err != nil || taskResp.Output.TaskID == "" {
+		return nil, ResponseError("解析任务ID失败", resp.StatusCode, body)
+	}
+
+	taskID := taskResp.Output.TaskID
+	log.Printf("[%s] 任务创建成功: %s", p.Name, taskID)
+	prog.report("submitted", 15)
+
+	// 步骤2: 轮询等待任务完成，记录平台任务 ID，服务重启后可继续轮询
+	j := journal(ctx, "aliyun", taskID)
+	results, err := pollAliyunTask(ctx, p, taskID, prog, j)
+	j.Finish(len(results), err)
+	return results, err
+}
+
+// pollAliyunTask 轮询百炼任务直到完成并下载结果，默认每 2 秒查询一次，最长等待 1 分钟
+func pollAliyunTask(ctx context.Context, p Config, taskID string, prog progress, j Journal) ([]*Image, error) {
+	var (
+		urls []string
+		meta map[string]interface{}
+	)
+	poller := newPoller(p, taskID, 2*time.Second, time.Minute, prog, j)
+	poller.Fetch = pollGet(client(p.Name, 30*time.Second), "https://dashscope.aliyuncs.com/api/v1/tasks/"+taskID, bearerAuth(p.APIKey))
+	poller.Parse = func(body []byte) (pollStatus, error) {
+		var statusResp struct {
+			Output struct {
+				TaskStatus string `json:"task_status"`
+				Results    []struct {
+					URL string `json:"url"`
+				} `json:"results"`
+			} `json:"output"`
+		}
+		json.Unmarshal(body, &statusResp)
+		switch {
+		case statusResp.Output.TaskStatus == "SUCCEEDED" && len(statusResp.Output.Results) > 0:
+			for _, r := range statusResp.Output.Results {
+				urls = append(urls, r.URL)
+			}
+			// 包含每张图片的 actual_prompt（开启 prompt_extend 时改写后的提示词）和 usage
+			meta = providerMeta(body)
+			return pollStatus{Done: true}, nil
+		case statusResp.Output.TaskStatus == "FAILED":
+			return pollStatus{}, TaskFailedError(body)
+		}
+		return pollStatus{Stage: taskStage(statusResp.Output.TaskStatus)}, nil
+	}
+	if err := poller.Wait(ctx); err != nil {
+		return nil, err
+	}
+	results, err := downloadAll(ctx, p, "aliyun", urls, prog)
+	return attachMeta(results, meta), err
+}
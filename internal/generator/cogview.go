@@ -0,0 +1,109 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ========== 智谱 CogView ==========
+
+func init() {
+	// 智谱 CogView 一次只出一张
+	register("cogview", Capabilities{}, func(ctx context.Context, req GenerateRequest) ([]*Image, error) {
+		return repeatGenerate(ctx, req.N, func() (*Image, error) { return generateCogViewImage(ctx, req) })
+	})
+}
+
+// cogviewSizes cogview-3 系列支持的固定尺寸，尺寸换算为宽高比最接近的一个
+var cogviewSizes = []string{"1024:1024", "768:1344", "864:1152", "1344:768", "1152:864", "1440:720", "720:1440"}
+
+// cogviewSize cogview-4 支持 512-2048 之间、16 的倍数的任意宽高，其他模型取最接近的固定尺寸
+func cogviewSize(model string, width, height int) string {
+	if strings.HasPrefix(model, "cogview-4") {
+		clamp := func(v int) int { return min(max(v/16*16, 512), 2048) }
+		return fmt.Sprintf("%dx%d", clamp(width), clamp(height))
+	}
+	return strings.Replace(nearestAspectRatio(width, height, cogviewSizes), ":", "x", 1)
+}
+
+// cogviewError 智谱的错误码在响应体的 error.code 中：1301 内容安全，1113 欠费，1302/1303/1305 限流，1000-1004 鉴权
+func cogviewError(status int, body []byte) error {
+	var resp struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	json.Unmarshal(body, &resp)
+	switch code := resp.Error.Code; code {
+	case "1301":
+		return policyError(resp.Error.Message)
+	case "1113", "1302", "1303", "1305":
+		return Errorf(ErrCodeProviderQuota, "额度不足或限流 (%s): %s", code, resp.Error.Message)
+	case "1000", "1001", "1002", "1003", "1004":
+		return Errorf(ErrCodeAuth, "鉴权失败 (%s): %s", code, resp.Error.Message)
+	}
+	return ResponseError("请求失败", status, body)
+}
+
+// generateCogViewImage 调用智谱 /images/generations，一次只出一张图片，不支持反向提示词和 seed
+// apiKey 为智谱开放平台的 API Key（id.secret 格式），直接作为 Bearer 令牌
+func generateCogViewImage(ctx context.Context, req GenerateRequest) (*Image, error) {
+	p, prompt := req.Config, req.Prompt
+	width, height, err := localSize(req.Size)
+	if err != nil {
+		return nil, err
+	}
+	model := p.Model
+	if model == "" {
+		model = "cogview-3-plus"
+	}
+	if req.NegativePrompt != "" {
+		// 不支持反向提示词，以文字形式附在提示词后
+		prompt += "。画面中不要出现：" + req.NegativePrompt
+	}
+	reqBody, _ := json.Marshal(map[string]interface{}{
+		"model":  model,
+		"prompt": prompt,
+		"size":   cogviewSize(model, width, height),
+	})
+
+	base := strings.TrimSuffix(p.URL, "/")
+	if base == "" {
+		base = "https://open.bigmodel.cn/api/paas/v4"
+	}
+	httpReq, _ := http.NewRequestWithContext(ctx, "POST", base+"/images/generations", bytes.NewReader(reqBody))
+	httpReq.Header.Set("Authorization", "Bearer "+p.APIKey)
+	httpReq.Header.Set("Content-Type", "application/json")
+	prog := progress(req.Progress)
+	prog.report("running", 20)
+
+	resp, body, err := DoWithRetry(client(p.Name, 120*time.Second), httpReq)
+	if err != nil {
+		return nil, RequestError("HTTP错误", err)
+	}
+	if resp.StatusCode != 200 {
+		return nil, cogviewError(resp.StatusCode, body)
+	}
+	var result struct {
+		Data []struct {
+			URL string `json:"url"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil || len(result.Data) == 0 || result.Data[0].URL == "" {
+		return nil, ResponseError("解析失败", resp.StatusCode, body)
+	}
+	prog.report("downloading", 80)
+	r, err := downloadAndSave(ctx, p, "cogview", result.Data[0].URL, 0)
+	if err != nil {
+		return nil, err
+	}
+	// 包含 content_filter 审核结果
+	r.Meta = providerMeta(body)
+	return r, nil
+}
@@ -0,0 +1,329 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ========== 本地 Stable Diffusion (ComfyUI / A1111 WebUI) ==========
+
+func init() {
+	// 本地 ComfyUI，提交工作流后轮询 history；内置工作流的 ControlNet 使用 SD1.5 的控制模型
+	register("comfyui", Capabilities{
+		Seed: true, Keyless: true, Control: true,
+		ControlModels: map[string]string{
+			"canny": "control_v11p_sd15_canny.pth",
+			"pose":  "control_v11p_sd15_openpose.pth",
+			"depth": "control_v11f1p_sd15_depth.pth",
+		},
+	}, generateComfyUIImage)
+	resumers["comfyui"] = pollComfyUITask
+	// 本地 Stable Diffusion WebUI (A1111)，同步返回 base64 图片
+	register("sdwebui", Capabilities{Seed: true, Keyless: true}, generateSDWebUIImage)
+}
+
+// defaultComfyWorkflow 内置的 ComfyUI 文生图工作流（API 格式），与 ComfyUI 默认工作流一致
+// 占位符：{{prompt}} {{negative_prompt}} {{model}} 在字符串内替换，"{{seed}}" "{{width}}" "{{height}}" "{{batch}}" 替换为数字
+// 参考图引导时自定义工作流另有 {{control_image}} {{control_model}} 和 "{{control_strength}}"，内置工作流自动加入 ControlNet 节点
+const defaultComfyWorkflow = `{
+  "3": {"class_type": "KSampler", "inputs": {"seed": "{{seed}}", "steps": 20, "cfg": 7, "sampler_name": "euler", "scheduler": "normal", "denoise": 1, "model": ["4", 0], "positive": ["6", 0], "negative": ["7", 0], "latent_image": ["5", 0]}},
+  "4": {"class_type": "CheckpointLoaderSimple", "inputs": {"ckpt_name": "{{model}}"}},
+  "5": {"class_type": "EmptyLatentImage", "inputs": {"width": "{{width}}", "height": "{{height}}", "batch_size": "{{batch}}"}},
+  "6": {"class_type": "CLIPTextEncode", "inputs": {"text": "{{prompt}}", "clip": ["4", 1]}},
+  "7": {"class_type": "CLIPTextEncode", "inputs": {"text": "{{negative_prompt}}", "clip": ["4", 1]}},
+  "8": {"class_type": "VAEDecode", "inputs": {"samples": ["3", 0], "vae": ["4", 2]}},
+  "9": {"class_type": "SaveImage", "inputs": {"filename_prefix": "image-platform", "images": ["8", 0]}}
+}`
+
+// setLocalAuth 本地服务一般不需要鉴权；apiKey 为 user:pass 时使用 Basic 认证（A1111 --api-auth），否则作为 Bearer 令牌（反向代理）
+func setLocalAuth(req *http.Request, p Config) {
+	if p.APIKey == "" {
+		return
+	}
+	if user, pass, ok := strings.Cut(p.APIKey, ":"); ok {
+		req.SetBasicAuth(user, pass)
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+p.APIKey)
+}
+
+// ========== ComfyUI ==========
+
+// comfyWorkflow 读取平台配置的工作流并填入本次生成的参数，uploaded 为参考图上传到 ComfyUI 后的文件名
+func comfyWorkflow(req GenerateRequest, width, height int, uploaded string) (map[string]interface{}, error) {
+	p := req.Config
+	text := defaultComfyWorkflow
+	if p.Workflow != "" {
+		data, err := os.ReadFile(p.Workflow)
+		if err != nil {
+			return nil, Errorf(ErrCodeInvalid, "读取 ComfyUI 工作流失败: %v", err)
+		}
+		text = string(data)
+	}
+	var seed int64
+	if req.Seed != nil {
+		seed = *req.Seed
+	}
+	quote := func(s string) string {
+		b, _ := json.Marshal(s)
+		return string(b[1 : len(b)-1])
+	}
+	replacements := []string{
+		`"{{seed}}"`, strconv.FormatInt(seed, 10),
+		`"{{width}}"`, strconv.Itoa(width),
+		`"{{height}}"`, strconv.Itoa(height),
+		`"{{batch}}"`, strconv.Itoa(req.N),
+		"{{prompt}}", quote(req.Prompt),
+		"{{negative_prompt}}", quote(req.NegativePrompt),
+		"{{model}}", quote(p.Model),
+	}
+	if g := req.Control; g != nil {
+		replacements = append(replacements,
+			"{{control_image}}", quote(uploaded),
+			"{{control_model}}", quote(g.Model),
+			`"{{control_strength}}"`, strconv.FormatFloat(g.Strength, 'f', -1, 64),
+		)
+	}
+	text = strings.NewReplacer(replacements...).Replace(text)
+
+	var workflow map[string]interface{}
+	if err := json.Unmarshal([]byte(text), &workflow); err != nil {
+		return nil, Errorf(ErrCodeInvalid, "ComfyUI 工作流格式错误: %v", err)
+	}
+	if req.Control != nil && p.Workflow == "" {
+		addComfyControlNodes(workflow, req.Control, uploaded)
+	}
+	return workflow, nil
+}
+
+// generateComfyUIImage 向 ComfyUI 提交工作流（POST /prompt），轮询 /history 后通过 /view 下载输出图片
+// 参考图引导时先上传参考图，内置工作流的 ControlNet 与底模配合使用，模型仍为底模
+func generateComfyUIImage(ctx context.Context, req GenerateRequest) ([]*Image, error) {
+	p := req.Config
+	width, height, err := localSize(req.Size)
+	if err != nil {
+		return nil, err
+	}
+	var uploaded string
+	if req.Control != nil {
+		if uploaded, err = uploadComfyImage(ctx, p, req.Control.Image); err != nil {
+			return nil, err
+		}
+	}
+	workflow, err := comfyWorkflow(req, width, height, uploaded)
+	if err != nil {
+		return nil, err
+	}
+
+	reqBody, _ := json.Marshal(map[string]interface{}{"prompt": workflow, "client_id": "image-platform-" + env.ClientID})
+	httpReq, _ := http.NewRequestWithContext(ctx, "POST", strings.TrimSuffix(p.URL, "/")+"/prompt", bytes.NewReader(reqBody))
+	httpReq.Header.Set("Content-Type", "application/json")
+	setLocalAuth(httpReq, p)
+
+	resp, body, err := DoWithRetry(client(p.Name, 30*time.Second), httpReq)
+	if err != nil {
+		return nil, RequestError("提交工作流失败", err)
+	}
+	if resp.StatusCode != 200 {
+		return nil, ResponseError("提交工作流失败", resp.StatusCode, body)
+	}
+	var submitResp struct {
+		PromptID string `json:"prompt_id"`
+	}
+	json.Unmarshal(body, &submitResp)
+	if submitResp.PromptID == "" {
+		return nil, ResponseError("解析任务ID失败", resp.StatusCode, body)
+	}
+	log.Printf("[%s] 工作流已提交: %s", p.Name, submitResp.PromptID)
+	prog := progress(req.Progress)
+	prog.report("submitted", 15)
+
+	// 记录平台任务 ID，服务重启后可继续轮询
+	j := journal(ctx, "comfyui", submitResp.PromptID)
+	results, err := pollComfyUITask(ctx, p, submitResp.PromptID, prog, j)
+	j.Finish(len(results), err)
+	return results, err
+}
+
+// pollComfyUITask 轮询 ComfyUI 的 /history/{prompt_id} 直到工作流执行完成并下载全部输出图片
+// 本地显卡排队时间不确定，默认最长等待 10 分钟
+func pollComfyUITask(ctx context.Context, p Config, promptID string, prog progress, j Journal) ([]*Image, error) {
+	base := strings.TrimSuffix(p.URL, "/")
+	var urls []string
+	poller := newPoller(p, promptID, 2*time.Second, 10*time.Minute, prog, j)
+	poller.Fetch = pollGet(client(p.Name, 30*time.Second), base+"/history/"+promptID, func(req *http.Request) { setLocalAuth(req, p) })
+	poller.Parse = func(body []byte) (pollStatus, error) {
+		// 工作流还在排队或执行时 history 中没有该 prompt_id
+		var history map[string]struct {
+			Outputs map[string]struct {
+				Images []struct {
+					Filename  string `json:"filename"`
+					Subfolder string `json:"subfolder"`
+					Type      string `json:"type"`
+				} `json:"images"`
+			} `json:"outputs"`
+			Status struct {
+				StatusStr string `json:"status_str"`
+				Completed bool   `json:"completed"`
+			} `json:"status"`
+		}
+		json.Unmarshal(body, &history)
+		entry, ok := history[promptID]
+		if !ok {
+			return pollStatus{Stage: "pending"}, nil
+		}
+		if entry.Status.StatusStr == "error" {
+			return pollStatus{}, TaskFailedError(body)
+		}
+		if !entry.Status.Completed {
+			return pollStatus{Stage: "running"}, nil
+		}
+		for _, out := range entry.Outputs {
+			for _, img := range out.Images {
+				// 只取 SaveImage 的输出，跳过预览节点的临时图片
+				if img.Type != "output" {
+					continue
+				}
+				q := url.Values{"filename": {img.Filename}, "subfolder": {img.Subfolder}, "type": {img.Type}}
+				urls = append(urls, base+"/view?"+q.Encode())
+			}
+		}
+		if len(urls) == 0 {
+			return pollStatus{}, Errorf(ErrCodeMalformed, "ComfyUI 工作流没有输出图片，请检查是否包含 SaveImage 节点")
+		}
+		return pollStatus{Done: true}, nil
+	}
+	if err := poller.Wait(ctx); err != nil {
+		return nil, err
+	}
+	return downloadAll(ctx, p, "comfyui", urls, prog)
+}
+
+// uploadComfyImage 把参考图上传到 ComfyUI 的 input 目录（POST /upload/image），返回 LoadImage 节点使用的文件名
+func uploadComfyImage(ctx context.Context, p Config, img *SourceImage) (string, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	part, _ := w.CreateFormFile("image", "image-platform-"+img.Name)
+	part.Write(img.Data)
+	w.WriteField("overwrite", "true")
+	w.Close()
+
+	req, _ := http.NewRequestWithContext(ctx, "POST", strings.TrimSuffix(p.URL, "/")+"/upload/image", &buf)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	setLocalAuth(req, p)
+	resp, body, err := DoWithRetry(client(p.Name, 60*time.Second), req)
+	if err != nil {
+		return "", RequestError("上传参考图失败", err)
+	}
+	if resp.StatusCode != 200 {
+		return "", ResponseError("上传参考图失败", resp.StatusCode, body)
+	}
+	var uploaded struct {
+		Name      string `json:"name"`
+		Subfolder string `json:"subfolder"`
+	}
+	if json.Unmarshal(body, &uploaded) != nil || uploaded.Name == "" {
+		return "", ResponseError("上传参考图失败", resp.StatusCode, body)
+	}
+	if uploaded.Subfolder != "" {
+		return uploaded.Subfolder + "/" + uploaded.Name, nil
+	}
+	return uploaded.Name, nil
+}
+
+// addComfyControlNodes 在内置工作流的正反向提示词和采样器之间加入 ControlNet
+// canny 模式先对参考图做边缘检测，pose、depth 模式的参考图应为姿态图、深度图
+func addComfyControlNodes(workflow map[string]interface{}, g *Control, uploaded string) {
+	image := []interface{}{"10", 0}
+	workflow["10"] = map[string]interface{}{"class_type": "LoadImage", "inputs": map[string]interface{}{"image": uploaded}}
+	workflow["11"] = map[string]interface{}{"class_type": "ControlNetLoader", "inputs": map[string]interface{}{"control_net_name": g.Model}}
+	if g.Mode == "canny" {
+		workflow["12"] = map[string]interface{}{"class_type": "Canny", "inputs": map[string]interface{}{"image": image, "low_threshold": 0.4, "high_threshold": 0.8}}
+		image = []interface{}{"12", 0}
+	}
+	workflow["13"] = map[string]interface{}{"class_type": "ControlNetApplyAdvanced", "inputs": map[string]interface{}{
+		"positive": []interface{}{"6", 0}, "negative": []interface{}{"7", 0}, "control_net": []interface{}{"11", 0},
+		"image": image, "strength": g.Strength, "start_percent": 0, "end_percent": 1,
+	}}
+	if sampler, ok := workflow["3"].(map[string]interface{}); ok {
+		if inputs, ok := sampler["inputs"].(map[string]interface{}); ok {
+			inputs["positive"] = []interface{}{"13", 0}
+			inputs["negative"] = []interface{}{"13", 1}
+		}
+	}
+}
+
+// ========== Stable Diffusion WebUI (A1111) ==========
+
+// generateSDWebUIImage 调用 A1111 WebUI 的 /sdapi/v1/txt2img（需以 --api 启动），返回 base64 编码的图片
+func generateSDWebUIImage(ctx context.Context, req GenerateRequest) ([]*Image, error) {
+	p := req.Config
+	width, height, err := localSize(req.Size)
+	if err != nil {
+		return nil, err
+	}
+	params := map[string]interface{}{
+		"prompt": req.Prompt, "width": width, "height": height, "batch_size": req.N,
+	}
+	if req.NegativePrompt != "" {
+		params["negative_prompt"] = req.NegativePrompt
+	}
+	if req.Seed != nil {
+		params["seed"] = *req.Seed
+	}
+	if p.Model != "" {
+		// 按需切换模型，不改变 WebUI 的全局设置
+		params["override_settings"] = map[string]interface{}{"sd_model_checkpoint": p.Model}
+		params["override_settings_restore_afterwards"] = true
+	}
+	reqBody, _ := json.Marshal(params)
+
+	httpReq, _ := http.NewRequestWithContext(ctx, "POST", strings.TrimSuffix(p.URL, "/")+"/sdapi/v1/txt2img", bytes.NewReader(reqBody))
+	httpReq.Header.Set("Content-Type", "application/json")
+	setLocalAuth(httpReq, p)
+	progress(req.Progress).report("running", 20)
+
+	// 本地出图是同步的，超时按最慢的显卡放宽
+	resp, body, err := DoWithRetry(client(p.Name, 600*time.Second), httpReq)
+	if err != nil {
+		return nil, RequestError("HTTP错误", err)
+	}
+	if resp.StatusCode != 200 {
+		return nil, ResponseError("请求失败", resp.StatusCode, body)
+	}
+	var result struct {
+		Images []string `json:"images"`
+		Info   string   `json:"info"` // JSON 字符串，包含 all_seeds、sampler_name 等实际参数
+	}
+	if err := json.Unmarshal(body, &result); err != nil || len(result.Images) == 0 {
+		return nil, ResponseError("解析失败", resp.StatusCode, body)
+	}
+
+	var (
+		results []*Image
+		lastErr error
+	)
+	for i, encoded := range result.Images {
+		data, err := decodeBase64Image(encoded)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		r, err := saveImageData(p, "sdwebui", data, i)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		results = append(results, r)
+	}
+	return attachMeta(results, providerMeta([]byte(result.Info))), lastErr
+}
@@ -0,0 +1,131 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ========== 火山方舟豆包 Seedream ==========
+
+func init() {
+	// 火山方舟豆包 Seedream 一次只出一张，支持 seed
+	register("doubao", Capabilities{Seed: true}, func(ctx context.Context, req GenerateRequest) ([]*Image, error) {
+		return repeatGenerate(ctx, req.N, func() (*Image, error) { return generateDoubaoImage(ctx, req) })
+	})
+}
+
+// doubaoSize Seedream 3.0 的宽高在 512-2048 之间；4.0 要求总像素不少于 1280x720、单边不超过 4096，不足时等比放大
+func doubaoSize(model string, width, height int) string {
+	if strings.Contains(model, "seedream-4") {
+		if area := width * height; area < 1280*720 {
+			scale := math.Sqrt(float64(1280*720) / float64(area))
+			width, height = int(math.Ceil(float64(width)*scale)), int(math.Ceil(float64(height)*scale))
+		}
+		return fmt.Sprintf("%dx%d", min(width, 4096), min(height, 4096))
+	}
+	return fmt.Sprintf("%dx%d", min(max(width, 512), 2048), min(max(height, 512), 2048))
+}
+
+// doubaoError 方舟的错误在响应体的 error.code 中，按错误码分类
+func doubaoError(status int, body []byte) error {
+	var resp struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	json.Unmarshal(body, &resp)
+	code, message := resp.Error.Code, resp.Error.Message
+	switch {
+	case strings.Contains(code, "SensitiveContentDetected"):
+		return policyError(code + " " + message)
+	case strings.HasPrefix(code, "Authentication"), strings.HasPrefix(code, "AccessDenied"):
+		return Errorf(ErrCodeAuth, "鉴权失败: %s %s", code, message)
+	case strings.HasPrefix(code, "RateLimitExceeded"), strings.HasPrefix(code, "QuotaExceeded"),
+		strings.HasPrefix(code, "AccountOverdue"), code == "ServerOverloaded":
+		return Errorf(ErrCodeProviderQuota, "限流或额度不足: %s %s", code, message)
+	case strings.HasPrefix(code, "InvalidParameter"), strings.HasPrefix(code, "MissingParameter"):
+		return Errorf(ErrCodeInvalid, "参数错误: %s %s", code, message)
+	}
+	return ResponseError("请求失败", status, body)
+}
+
+// generateDoubaoImage 调用火山方舟 /images/generations 生成一张图片，apiKey 为方舟的 API Key
+// model 为推理接入点 ID 或模型 ID（如 doubao-seedream-3-0-t2i-250415），不支持反向提示词
+func generateDoubaoImage(ctx context.Context, req GenerateRequest) (*Image, error) {
+	p := req.Config
+	width, height, err := localSize(req.Size)
+	if err != nil {
+		return nil, err
+	}
+	model := p.Model
+	if model == "" {
+		model = "doubao-seedream-3-0-t2i-250415"
+	}
+	params := map[string]interface{}{
+		"model":           model,
+		"prompt":          req.Prompt,
+		"size":            doubaoSize(model, width, height),
+		"response_format": "b64_json",
+		"watermark":       p.Watermark,
+	}
+	if req.Seed != nil {
+		params["seed"] = *req.Seed
+	}
+	reqBody, _ := json.Marshal(params)
+
+	base := strings.TrimSuffix(p.URL, "/")
+	if base == "" {
+		base = "https://ark.cn-beijing.volces.com/api/v3"
+	}
+	httpReq, _ := http.NewRequestWithContext(ctx, "POST", base+"/images/generations", bytes.NewReader(reqBody))
+	httpReq.Header.Set("Authorization", "Bearer "+p.APIKey)
+	httpReq.Header.Set("Content-Type", "application/json")
+	prog := progress(req.Progress)
+	prog.report("running", 20)
+
+	resp, body, err := DoWithRetry(client(p.Name, 120*time.Second), httpReq)
+	if err != nil {
+		return nil, RequestError("HTTP错误", err)
+	}
+	if resp.StatusCode != 200 {
+		return nil, doubaoError(resp.StatusCode, body)
+	}
+	// 按 response_format 返回 b64_json 或 url（24 小时内有效），两种都兼容
+	var result struct {
+		Data []struct {
+			URL     string `json:"url"`
+			B64JSON string `json:"b64_json"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil || len(result.Data) == 0 {
+		return nil, ResponseError("解析失败", resp.StatusCode, body)
+	}
+	img := result.Data[0]
+	var r *Image
+	switch {
+	case img.B64JSON != "":
+		var data []byte
+		if data, err = decodeBase64Image(img.B64JSON); err != nil {
+			return nil, err
+		}
+		r, err = saveImageData(p, "doubao", data, 0)
+	case img.URL != "":
+		prog.report("downloading", 80)
+		r, err = downloadAndSave(ctx, p, "doubao", img.URL, 0)
+	default:
+		return nil, ResponseError("解析失败", resp.StatusCode, body)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// 包含实际的 model、输出 size 和 usage
+	r.Meta = providerMeta(body)
+	return r, nil
+}
@@ -0,0 +1,88 @@
+package generator
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Config 平台配置中调用平台需要的部分，由服务端按平台配置键随请求传入
+type Config struct {
+	Name            string // 平台显示名，用于日志和生成结果
+	Type            string
+	APIKey          string
+	URL             string
+	Model           string
+	EditModel       string // 图生图、局部重绘使用的模型，为空使用 Model
+	Workflow        string // ComfyUI API 格式的工作流文件，为空使用内置的文生图工作流
+	CredentialsFile string // Vertex AI 服务账号 JSON 密钥文件
+	Project         string // Vertex AI 项目 ID，为空使用服务账号所属项目
+	Region          string // Vertex AI、混元的区域
+	Watermark       bool   // 是否保留平台的"AI 生成"水印（豆包）
+	PollInterval    int    // 异步任务的查询间隔（秒），为 0 使用平台默认值
+	MaxWait         int    // 异步任务的最长等待（秒），为 0 使用平台默认值
+	ResponseFormat  string // OpenAI 兼容接口的 response_format，为空不传
+	AccessKey       string // 签名调用使用的 AccessKey/SecretKey（混元）
+	SecretKey       string
+	LatencyMs       int // 模拟平台每张图片的延迟（毫秒），用于压测
+}
+
+// Journal 已在平台创建的异步任务的记录，服务重启后据此继续轮询
+type Journal interface {
+	Poll()                   // 每次查询任务状态前调用
+	Finish(n int, err error) // 任务结束，n 为成功的张数
+}
+
+type nopJournal struct{}
+
+func (nopJournal) Poll()             {}
+func (nopJournal) Finish(int, error) {}
+
+// Env 服务端提供给平台实现的运行环境，启动时通过 Setup 设置，为空的函数使用默认行为
+type Env struct {
+	Width, Height int           // 未指定尺寸时的宽高
+	MaxRetries    int           // 可重试的请求错误最多重试的次数
+	RetryDelay    time.Duration // 首次重试前的等待，之后按指数退避
+	ClientID      string        // 本实例的标识，提交 ComfyUI 工作流时使用
+
+	// Client 调用平台接口的 HTTP 客户端，name 为平台显示名；默认为只设置超时的客户端
+	Client func(name string, timeout time.Duration) *http.Client
+	// SaveImage 把图片保存到 platform 目录，idx 为同一次生成中的序号，返回文件路径；必须设置
+	SaveImage func(platform string, data []byte, idx int, ext string) (string, error)
+	// Acquire 每次调用平台实现前占用平台，返回传给实现的 ctx 和记录调用结果的 release
+	Acquire func(ctx context.Context, req GenerateRequest) (context.Context, func(n int, err error), error)
+	// Journal 记录新创建的异步任务，返回 nil 时不记录
+	Journal func(ctx context.Context, provider, taskID string) Journal
+	// OnRetryAfter 请求重试用尽后调用，可据此记录限流响应的 Retry-After，resp 可能为空
+	OnRetryAfter func(req *http.Request, resp *http.Response)
+}
+
+var env = Env{Width: 1024, Height: 1024}
+
+// Setup 设置运行环境，在调用任何平台之前调用一次
+func Setup(e Env) {
+	env = e
+}
+
+func client(name string, timeout time.Duration) *http.Client {
+	if env.Client != nil {
+		return env.Client(name, timeout)
+	}
+	return &http.Client{Timeout: timeout}
+}
+
+func acquire(ctx context.Context, req GenerateRequest) (context.Context, func(n int, err error), error) {
+	if env.Acquire != nil {
+		return env.Acquire(ctx, req)
+	}
+	return ctx, func(int, error) {}, nil
+}
+
+func journal(ctx context.Context, provider, taskID string) Journal {
+	if env.Journal != nil {
+		if j := env.Journal(ctx, provider, taskID); j != nil {
+			return j
+		}
+	}
+	return nopJournal{}
+}
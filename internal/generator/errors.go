@@ -0,0 +1,192 @@
+package generator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// 生成错误码，保存在失败记录和任务上，供重试和告警区分处理
+const (
+	ErrCodeAuth          = "auth"               // 密钥无效或过期
+	ErrCodeProviderQuota = "provider_quota"     // 平台欠费、额度用尽或限流
+	ErrCodePolicyBlocked = "policy_blocked"     // 平台内容策略拦截提示词或生成结果
+	ErrCodeTimeout       = "timeout"            // 请求或任务超时
+	ErrCodeMalformed     = "malformed_response" // 响应无法解析
+	ErrCodeUnavailable   = "unavailable"        // 网络错误或平台 5xx
+	ErrCodeInvalid       = "invalid_request"    // 参数错误
+	ErrCodeQuota         = "quota_exceeded"     // 本平台的生成额度用完
+	ErrCodeDraining      = "platform_draining"  // 平台已暂停接收新任务
+	ErrCodeCircuitOpen   = "circuit_open"       // 平台连续失败已熔断
+	ErrCodeCanceled      = "canceled"           // 任务被取消
+	ErrCodeUnknown       = "unknown"
+)
+
+// GenerationError 带错误码的生成错误
+type GenerationError struct {
+	Code    string
+	Message string
+	Reason  string // 内容策略拦截时平台给出的原因
+}
+
+func (e *GenerationError) Error() string {
+	return e.Message
+}
+
+// Errorf 带错误码的错误
+func Errorf(code, format string, args ...interface{}) error {
+	return &GenerationError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// policyError 平台按内容策略拒绝时的错误，reason 为平台给出的原因
+func policyError(reason string) error {
+	return &GenerationError{Code: ErrCodePolicyBlocked, Message: "内容审核拦截: " + reason, Reason: reason}
+}
+
+// PolicyReason 内容策略拦截的原因，其他错误为空
+func PolicyReason(err error) string {
+	var ge *GenerationError
+	if errors.As(err, &ge) && ge.Code == ErrCodePolicyBlocked {
+		if ge.Reason != "" {
+			return ge.Reason
+		}
+		return ge.Message
+	}
+	return ""
+}
+
+// ErrorCode 取错误码，未分类的错误为 unknown
+func ErrorCode(err error) string {
+	var ge *GenerationError
+	if errors.As(err, &ge) {
+		return ge.Code
+	}
+	return ErrCodeUnknown
+}
+
+// Retryable 相同参数重试是否可能成功；密钥、内容和参数问题需要先修改配置或提示词
+func Retryable(code string) bool {
+	switch code {
+	case ErrCodeAuth, ErrCodePolicyBlocked, ErrCodeInvalid:
+		return false
+	}
+	return true
+}
+
+// 响应内容中的关键字，按顺序匹配
+var errorKeywords = []struct {
+	code     string
+	keywords []string
+}{
+	{ErrCodePolicyBlocked, []string{"datainspectionfailed", "content policy", "content_policy", "sensitive", "inappropriate", "safety", "moderation", "违规", "敏感", "不合规"}},
+	{ErrCodeAuth, []string{"invalidapikey", "invalid api key", "invalid_api_key", "unauthorized", "authentication", "access denied", "鉴权", "令牌"}},
+	{ErrCodeProviderQuota, []string{"arrearage", "quota", "insufficient", "balance", "throttling", "rate limit", "too many requests", "欠费", "余额不足", "限流"}},
+}
+
+// classifyBody 按响应内容判断错误类型，无法判断时返回空
+func classifyBody(body string) string {
+	lower := strings.ToLower(body)
+	for _, k := range errorKeywords {
+		for _, kw := range k.keywords {
+			if strings.Contains(lower, kw) {
+				return k.code
+			}
+		}
+	}
+	return ""
+}
+
+// RequestError 请求未得到响应时的错误
+func RequestError(msg string, err error) error {
+	if errors.Is(err, context.Canceled) {
+		return Errorf(ErrCodeCanceled, "%s: 已取消", msg)
+	}
+	var ne net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &ne) && ne.Timeout()) {
+		return Errorf(ErrCodeTimeout, "%s: %v", msg, err)
+	}
+	return Errorf(ErrCodeUnavailable, "%s: %v", msg, err)
+}
+
+// ResponseError 按 HTTP 状态码和响应内容分类，2xx 且无法识别时视为响应格式错误
+func ResponseError(msg string, status int, body []byte) error {
+	code := classifyBody(string(body))
+	if code == "" {
+		switch {
+		case status == 401 || status == 403:
+			code = ErrCodeAuth
+		case status == 402 || status == 429:
+			code = ErrCodeProviderQuota
+		case status == 408 || status == 504:
+			code = ErrCodeTimeout
+		case status >= 500:
+			code = ErrCodeUnavailable
+		case status >= 400:
+			code = ErrCodeInvalid
+		default:
+			code = ErrCodeMalformed
+		}
+	}
+	err := Errorf(code, "%s (HTTP %d): %s", msg, status, string(body))
+	if code == ErrCodePolicyBlocked {
+		err.(*GenerationError).Reason = providerReason(body)
+	}
+	return err
+}
+
+// TaskFailedError 异步任务失败，按平台返回的错误信息分类
+func TaskFailedError(body []byte) error {
+	code := classifyBody(string(body))
+	if code == "" {
+		code = ErrCodeUnknown
+	}
+	err := Errorf(code, "任务失败: %s", string(body))
+	if code == ErrCodePolicyBlocked {
+		err.(*GenerationError).Reason = providerReason(body)
+	}
+	return err
+}
+
+// 平台错误响应中表示原因的字段，按顺序查找
+var reasonFields = []string{"message", "Message", "msg", "error_msg", "errorMessage", "failReason", "detail", "reason"}
+
+// providerReason 从平台的错误响应中取出原因，不是 JSON 或找不到时取响应开头
+func providerReason(body []byte) string {
+	var v interface{}
+	if json.Unmarshal(body, &v) == nil {
+		if reason := findReason(v); reason != "" {
+			return reason
+		}
+	}
+	reason := []rune(strings.TrimSpace(string(body)))
+	if len(reason) > 200 {
+		reason = reason[:200]
+	}
+	return string(reason)
+}
+
+func findReason(v interface{}) string {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for _, k := range reasonFields {
+			if s, ok := v[k].(string); ok && s != "" {
+				return s
+			}
+		}
+		for _, child := range v {
+			if reason := findReason(child); reason != "" {
+				return reason
+			}
+		}
+	case []interface{}:
+		for _, child := range v {
+			if reason := findReason(child); reason != "" {
+				return reason
+			}
+		}
+	}
+	return ""
+}
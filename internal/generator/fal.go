@@ -0,0 +1,170 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ========== fal.ai ==========
+
+func init() {
+	// fal.ai 队列接口，提交后轮询状态和结果
+	register("fal", Capabilities{Seed: true}, generateFalImage)
+	resumers["fal"] = pollFalTask
+}
+
+// falResult 队列任务完成后的结果，开启安全检查时命中的图片会被替换为黑图
+type falResult struct {
+	Images []struct {
+		URL string `json:"url"`
+	} `json:"images"`
+	HasNSFWConcepts []bool `json:"has_nsfw_concepts"`
+}
+
+func falBase(p Config) string {
+	if p.URL == "" {
+		return "https://queue.fal.run"
+	}
+	return strings.TrimSuffix(p.URL, "/")
+}
+
+// falModel 模型 ID，默认 fal-ai/flux/schnell
+func falModel(p Config) string {
+	if p.Model == "" {
+		return "fal-ai/flux/schnell"
+	}
+	return p.Model
+}
+
+// falApp 查询状态和结果使用应用 ID（模型 ID 的前两段），如 fal-ai/flux/dev 为 fal-ai/flux
+func falApp(model string) string {
+	parts := strings.SplitN(model, "/", 3)
+	if len(parts) < 2 {
+		return model
+	}
+	return parts[0] + "/" + parts[1]
+}
+
+// falRequest 发送带 Key 鉴权的请求
+func falRequest(ctx context.Context, c *http.Client, p Config, method, url string, payload []byte) (*http.Response, []byte, error) {
+	req, _ := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(payload))
+	req.Header.Set("Authorization", "Key "+p.APIKey)
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return DoWithRetry(c, req)
+}
+
+// generateFalImage 提交 fal.ai 队列任务并轮询结果，model 为 fal-ai/flux/dev、fal-ai/flux/schnell 等
+// FLUX 不支持反向提示词；安全检查默认开启，全部图片被拦截时按内容审核错误处理
+func generateFalImage(ctx context.Context, req GenerateRequest) ([]*Image, error) {
+	p := req.Config
+	width, height, err := localSize(req.Size)
+	if err != nil {
+		return nil, err
+	}
+	input := map[string]interface{}{
+		"prompt":                req.Prompt,
+		"image_size":            map[string]int{"width": width, "height": height},
+		"num_images":            min(req.N, 4),
+		"enable_safety_checker": true,
+	}
+	if req.Seed != nil {
+		input["seed"] = *req.Seed
+	}
+	payload, _ := json.Marshal(input)
+
+	resp, body, err := falRequest(ctx, client(p.Name, 30*time.Second), p, "POST", falBase(p)+"/"+falModel(p), payload)
+	if err != nil {
+		return nil, RequestError("创建任务失败", err)
+	}
+	var submitted struct {
+		RequestID string `json:"request_id"`
+	}
+	if resp.StatusCode >= 300 || json.Unmarshal(body, &submitted) != nil || submitted.RequestID == "" {
+		return nil, ResponseError("创建任务失败", resp.StatusCode, body)
+	}
+	log.Printf("[%s] 任务创建成功: %s", p.Name, submitted.RequestID)
+	prog := progress(req.Progress)
+	prog.report("submitted", 15)
+
+	// 记录平台任务 ID，服务重启后可继续轮询
+	j := journal(ctx, "fal", submitted.RequestID)
+	results, err := pollFalTask(ctx, p, submitted.RequestID, prog, j)
+	j.Finish(len(results), err)
+	return results, err
+}
+
+// pollFalTask 轮询队列状态（IN_QUEUE、IN_PROGRESS、COMPLETED），完成后取结果并下载，默认最长等待 200 秒；生成被取消或超时时同时取消排队中的任务
+func pollFalTask(ctx context.Context, p Config, requestID string, prog progress, j Journal) ([]*Image, error) {
+	c := client(p.Name, 30*time.Second)
+	requestURL := falBase(p) + "/" + falApp(falModel(p)) + "/requests/" + requestID
+	poller := newPoller(p, requestID, 2*time.Second, 200*time.Second, prog, j)
+	poller.Fetch = func(ctx context.Context) ([]byte, error) {
+		_, body, err := falRequest(ctx, c, p, "GET", requestURL+"/status", nil)
+		return body, err
+	}
+	poller.Parse = func(body []byte) (pollStatus, error) {
+		var status struct {
+			Status string `json:"status"`
+		}
+		json.Unmarshal(body, &status)
+		switch status.Status {
+		case "COMPLETED":
+			return pollStatus{Done: true}, nil
+		case "IN_PROGRESS":
+			return pollStatus{Stage: "running"}, nil
+		}
+		return pollStatus{Stage: "pending"}, nil
+	}
+	poller.OnAbort = func() { cancelFalRequest(p, requestURL) }
+	if err := poller.Wait(ctx); err != nil {
+		return nil, err
+	}
+	return fetchFalResult(ctx, p, c, requestURL, prog)
+}
+
+// fetchFalResult 取队列任务的结果，任务失败时结果接口返回错误状态码和 detail
+func fetchFalResult(ctx context.Context, p Config, c *http.Client, requestURL string, prog progress) ([]*Image, error) {
+	resp, body, err := falRequest(ctx, c, p, "GET", requestURL, nil)
+	if err != nil {
+		return nil, RequestError("获取结果失败", err)
+	}
+	if resp.StatusCode >= 300 {
+		return nil, ResponseError("生成失败", resp.StatusCode, body)
+	}
+	var result falResult
+	if json.Unmarshal(body, &result) != nil || len(result.Images) == 0 {
+		return nil, Errorf(ErrCodeMalformed, "解析结果失败: %s", string(body))
+	}
+	var urls []string
+	for i, img := range result.Images {
+		if i < len(result.HasNSFWConcepts) && result.HasNSFWConcepts[i] {
+			continue
+		}
+		urls = append(urls, img.URL)
+	}
+	if len(urls) == 0 {
+		return nil, policyError("安全检查命中全部图片")
+	}
+	results, err := downloadAll(ctx, p, "fal", urls, prog)
+	// 包含实际的 seed、has_nsfw_concepts 和 timings
+	return attachMeta(results, providerMeta(body)), err
+}
+
+// cancelFalRequest 取消仍在排队的任务，失败只记录日志
+func cancelFalRequest(p Config, requestURL string) {
+	req, _ := http.NewRequest("PUT", requestURL+"/cancel", nil)
+	req.Header.Set("Authorization", "Key "+p.APIKey)
+	resp, err := client(p.Name, 10*time.Second).Do(req)
+	if err != nil {
+		log.Printf("[%s] 取消任务 %s 失败: %v", p.Name, requestURL, err)
+		return
+	}
+	resp.Body.Close()
+}
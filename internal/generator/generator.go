@@ -1,329 +1,258 @@
 package generator
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
-	"os"
-	"path/filepath"
-	"strings"
+	"math/rand"
+	"sort"
 	"sync"
 	"time"
-
-	"github.com/tmc/langchaingo/llms"
-	"github.com/tmc/langchaingo/llms/openai"
 )
 
-// ImageGenerator 图片生成器
-type ImageGenerator struct {
-	cfg        *ImageGenConfig
-	generators map[string]*PlatformGenerator
+// Provider 一种平台类型的图片生成实现，由服务启动时注册
+type Provider interface {
+	Generate(ctx context.Context, req GenerateRequest) (GenerateOutput, error)
 }
 
-// ImageGenConfig 图片生成配置
-type ImageGenConfig struct {
-	OutputDir  string
-	LogDir     string
-	Width      int
-	Height     int
-	MaxRetries int
-	RetryDelay int
-	Timeout    int
-	MaxWorkers int
+// ProviderFunc 把函数适配为 Provider
+type ProviderFunc func(ctx context.Context, req GenerateRequest) (GenerateOutput, error)
+
+func (f ProviderFunc) Generate(ctx context.Context, req GenerateRequest) (GenerateOutput, error) {
+	return f(ctx, req)
 }
 
-// PlatformConfig 平台配置 (从 config 导入)
-type PlatformConfig struct {
-	Name        string
-	EnvKey      string
-	APIKey      string
-	URL         string
-	Model       string
-	Enabled     bool
-	Description string
+// Capabilities 平台类型支持的能力
+type Capabilities struct {
+	Seed    bool // 支持 seed，生成多张时逐张请求，第 i 张使用 seed+i，保证每张都能复现
+	Keyless bool // 本地部署，不需要 API Key
+	Signed  bool // 用 AccessKey/SecretKey 签名调用，不使用 API Key
+	Img2Img bool // 支持图生图
+	Inpaint bool // 支持局部重绘
+	Control bool // 支持参考图引导
+	Upscale bool // 支持图片放大
+
+	ControlModels   map[string]string // 参考图引导内置的控制模式 → 模型，为空时需在平台配置中指定
+	SourceURL       bool              // 通过公网地址读取原图和参考图，不接受图片数据
+	TransparentMask bool              // 局部重绘的遮罩以透明区域表示重绘范围，否则为白色
 }
 
-// PlatformGenerator 平台生成器
-type PlatformGenerator struct {
-	Name    string
-	APIKey  string
-	Model   string
-	BaseURL string
+// GenerateRequest 一次生成请求
+type GenerateRequest struct {
+	Platform       string // 平台配置键
+	Config         Config // 平台配置
+	Operation      string // 为空为文生图，其他见 OpImg2Img、OpInpaint、OpControl
+	Prompt         string
+	Size           string // 宽x高
+	Model          string // 为空使用平台配置的模型，图生图和局部重绘优先使用 editModel
+	N              int
+	NegativePrompt string
+	Seed           *int64                          // 为空时支持 seed 的平台随机生成一个，只用于文生图
+	Source         *SourceImage                    // 图生图、局部重绘、放大的原图
+	Mask           *SourceImage                    // 局部重绘的遮罩
+	Strength       float64                         // 图生图与原图的差别，0-1
+	Scale          int                             // 放大倍数
+	Control        *Control                        // 参考图引导的参考图和控制参数
+	Progress       func(stage string, percent int) // 异步平台的任务状态和下载进度，可为空
 }
 
-// New 创建图片生成器
-func New(cfg *ImageGenConfig, platforms map[string]PlatformConfig) *ImageGenerator {
-	ig := &ImageGenerator{
-		cfg:        cfg,
-		generators: make(map[string]*PlatformGenerator),
+// model 本次请求使用的模型：请求指定的优先，图生图和局部重绘其次使用 editModel
+func (r GenerateRequest) model() string {
+	if r.Model != "" {
+		return r.Model
 	}
-
-	for key, platformCfg := range platforms {
-		gen := &PlatformGenerator{
-			Name:    platformCfg.Name,
-			APIKey:  platformCfg.APIKey,
-			Model:   platformCfg.Model,
-			BaseURL: platformCfg.URL,
-		}
-		ig.generators[key] = gen
-		log.Printf("已启用平台: %s - %s", key, gen.Name)
+	if (r.Operation == OpImg2Img || r.Operation == OpInpaint) && r.Config.EditModel != "" {
+		return r.Config.EditModel
 	}
-
-	return ig
+	return r.Config.Model
 }
 
-// GenerateResult 生成结果
-type GenerateResult struct {
-	Platform    string
-	FilePath    string
-	ImageURL    string
-	Success     bool
-	Error       string
-	GeneratedAt time.Time
+// Image 已保存到本地的生成结果
+type Image struct {
+	Platform string
+	Model    string
+	Filename string
+	FilePath string
+	Success  bool
+	Seed     *int64                 // 实际使用的 seed，平台不支持时为空
+	MIMEType string                 // 按文件内容识别的格式，如 image/jpeg
+	Meta     map[string]interface{} // 平台返回的其他信息，如 revised_prompt、审核标记，不含图片数据
 }
 
-// GenerateAll 并发生成所有平台的图片
-func (g *ImageGenerator) GenerateAll(prompt string) []GenerateResult {
-	if len(g.generators) == 0 {
-		log.Println("没有已启用的平台")
-		return nil
-	}
-
-	log.Println("========================================")
-	log.Printf("🚀 开始生成任务: %s", prompt)
-	log.Println("========================================")
-
-	// 创建输出目录
-	timestamp := time.Now().Format("20060102_150405")
-	safePrompt := sanitizeFilename(prompt)
-	outputDir := filepath.Join(g.cfg.OutputDir, fmt.Sprintf("%s_%s", timestamp, safePrompt))
-	os.MkdirAll(outputDir, 0755)
-
-	// 并发执行
-	var wg sync.WaitGroup
-	results := make([]GenerateResult, 0, len(g.generators))
-	resultsChan := make(chan GenerateResult, len(g.generators))
-
-	for key, gen := range g.generators {
-		wg.Add(1)
-		go func(platform string, generator *PlatformGenerator) {
-			defer wg.Done()
-
-			result := GenerateResult{
-				Platform:    generator.Name,
-				GeneratedAt: time.Now(),
-			}
-
-			startTime := time.Now()
-			log.Printf("[%s] 开始生成...", generator.Name)
+// GenerateOutput 生成结果，部分成功时只包含成功的图片
+type GenerateOutput struct {
+	Images []*Image
+}
 
-			imageURL, err := generator.Generate(prompt, g.cfg.Width, g.cfg.Height)
-			if err != nil {
-				result.Success = false
-				result.Error = err.Error()
-				log.Printf("[%s] 生成失败: %v", generator.Name, err)
-			} else {
-				filename := fmt.Sprintf("%s_%d.png", platform, time.Now().Unix())
-				filepath := filepath.Join(outputDir, filename)
+type registration struct {
+	provider     Provider
+	capabilities Capabilities
+}
 
-				if err := downloadImage(imageURL, filepath); err != nil {
-					result.Success = false
-					result.Error = err.Error()
-					log.Printf("[%s] 下载失败: %v", generator.Name, err)
-				} else {
-					result.Success = true
-					result.FilePath = filepath
-					result.ImageURL = imageURL
-					log.Printf("[%s] ✅ 生成成功: %s", generator.Name, filename)
-				}
-			}
+var (
+	mu          sync.RWMutex
+	providers   = map[string]registration{}
+	defaultType string
+)
 
-			log.Printf("[%s] 耗时: %v", generator.Name, time.Since(startTime))
-			resultsChan <- result
-		}(key, gen)
+// Register 注册平台类型的实现，重复注册同一类型时 panic
+func Register(typ string, p Provider, caps Capabilities) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := providers[typ]; ok {
+		panic("generator: 平台类型重复注册: " + typ)
 	}
+	providers[typ] = registration{provider: p, capabilities: caps}
+}
 
-	wg.Wait()
-	close(resultsChan)
+// register 注册只返回图片列表的实现
+func register(typ string, caps Capabilities, gen func(ctx context.Context, req GenerateRequest) ([]*Image, error)) {
+	Register(typ, ProviderFunc(func(ctx context.Context, req GenerateRequest) (GenerateOutput, error) {
+		images, err := gen(ctx, req)
+		return GenerateOutput{Images: images}, err
+	}), caps)
+}
 
-	for result := range resultsChan {
-		results = append(results, result)
-	}
+// SetDefault 未注册的平台类型使用的实现（如 OpenAI 兼容接口），只继承实现，不继承能力
+func SetDefault(typ string) {
+	mu.Lock()
+	defer mu.Unlock()
+	defaultType = typ
+}
 
-	successCount := 0
-	for _, r := range results {
-		if r.Success {
-			successCount++
-		}
+// Lookup 查找平台类型的实现，未注册时返回默认实现
+func Lookup(typ string) (Provider, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if r, ok := providers[typ]; ok {
+		return r.provider, true
+	}
+	if r, ok := providers[defaultType]; ok {
+		return r.provider, true
 	}
+	return nil, false
+}
 
-	log.Println("========================================")
-	log.Printf("📊 生成完成: 成功 %d/%d", successCount, len(results))
-	log.Println("========================================")
+// CapabilitiesOf 平台类型的能力，未注册的类型没有任何能力
+func CapabilitiesOf(typ string) Capabilities {
+	mu.RLock()
+	defer mu.RUnlock()
+	return providers[typ].capabilities
+}
 
-	return results
+// Types 已注册的平台类型
+func Types() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	types := make([]string, 0, len(providers))
+	for typ := range providers {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+	return types
 }
 
-// GenerateSingle 生成单个平台图片
-func (g *ImageGenerator) GenerateSingle(platform, prompt string) *GenerateResult {
-	gen, ok := g.generators[platform]
+// Generate 调用平台类型的实现生成 req.N 张图片，部分成功时返回已生成的图片
+// 支持 seed 的平台文生图时未指定 seed 随机生成一个，多张时逐张请求；ctx 取消后不再发起新的请求
+func Generate(ctx context.Context, typ string, req GenerateRequest) (GenerateOutput, error) {
+	p, ok := Lookup(typ)
 	if !ok {
-		return &GenerateResult{
-			Platform:    platform,
-			Success:    false,
-			Error:      "平台未启用",
-			GeneratedAt: time.Now(),
-		}
+		return GenerateOutput{}, fmt.Errorf("未注册的平台类型: %s", typ)
 	}
-
-	startTime := time.Now()
-	imageURL, err := gen.Generate(prompt, g.cfg.Width, g.cfg.Height)
-
-	result := &GenerateResult{
-		Platform:    gen.Name,
-		GeneratedAt: time.Now(),
+	caps := CapabilitiesOf(typ)
+	if !caps.supports(req.Operation) {
+		return GenerateOutput{}, Errorf(ErrCodeInvalid, "平台 %s 不支持%s", req.Platform, operationName(req.Operation))
 	}
-
-	if err != nil {
-		result.Success = false
-		result.Error = err.Error()
-		return result
+	if req.N < 1 {
+		req.N = 1
 	}
-
-	// 下载图片
-	timestamp := time.Now().Format("20060102_150405")
-	safePrompt := sanitizeFilename(prompt)
-	outputDir := filepath.Join(g.cfg.OutputDir, fmt.Sprintf("%s_%s", timestamp, safePrompt))
-	os.MkdirAll(outputDir, 0755)
-
-	filename := fmt.Sprintf("%s_%d.png", platform, time.Now().Unix())
-	filepath := filepath.Join(outputDir, filename)
-
-	if err := downloadImage(imageURL, filepath); err != nil {
-		result.Success = false
-		result.Error = err.Error()
-		return result
+	req.Config.Model = req.model()
+	if !caps.Seed || req.Operation != "" {
+		return invoke(ctx, p, req, false)
 	}
 
-	result.Success = true
-	result.FilePath = filepath
-	result.ImageURL = imageURL
-
-	log.Printf("[%s] 生成成功，耗时: %v", gen.Name, time.Since(startTime))
-	return result
-}
-
-// Generate 使用 HTTP 调用图片生成 API
-func (p *PlatformGenerator) Generate(prompt string, width, height int) (string, error) {
-	// 演示 langchaingo 调用
-	p.callWithLangchaingo(prompt)
-
-	// HTTP 调用
-	return p.generateViaHTTP(prompt, width, height)
-}
-
-// callWithLangchaingo 使用 langchaingo 调用 LLM (演示)
-func (p *PlatformGenerator) callWithLangchaingo(prompt string) {
-	ctx := context.Background()
-	llm, err := openai.New(
-		openai.WithBaseURL(p.BaseURL),
-		openai.WithModel(p.Model),
-	)
-	if err != nil {
-		log.Printf("[%s] langchaingo 客户端创建: %v", p.Name, err)
-		return
+	if req.Seed == nil {
+		seed := rand.Int63n(1 << 31)
+		req.Seed = &seed
 	}
-	_, err = llms.GenerateFromSinglePrompt(ctx, llm, prompt)
-	if err != nil {
-		log.Printf("[%s] langchaingo 调用: %v", p.Name, err)
+	if req.N == 1 {
+		return invoke(ctx, p, req, true)
 	}
-}
-
-// generateViaHTTP 直接 HTTP 调用
-func (p *PlatformGenerator) generateViaHTTP(prompt string, width, height int) (string, error) {
-	client := &http.Client{Timeout: 30 * time.Second}
-
-	size := fmt.Sprintf("%dx%d", width, height)
-
-	reqBody := map[string]interface{}{
-		"model": p.Model,
-		"prompt": prompt,
-		"size":   size,
-		"n":      1,
+	var (
+		out     GenerateOutput
+		lastErr error
+	)
+	base := *req.Seed
+	for i := 0; i < req.N; i++ {
+		one := req
+		one.N = 1
+		seed := base + int64(i)
+		one.Seed = &seed
+		r, err := invoke(ctx, p, one, true)
+		if err != nil {
+			lastErr = err
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		out.Images = append(out.Images, r.Images...)
 	}
-
-	bodyBytes, _ := json.Marshal(reqBody)
-
-	apiURL := p.BaseURL
-	if !strings.Contains(apiURL, "/images/generations") {
-		apiURL = apiURL + "/images/generations"
+	if len(out.Images) > 0 {
+		return out, nil
 	}
+	return out, lastErr
+}
 
-	req, err := http.NewRequest("POST", apiURL, bytes.NewReader(bodyBytes))
+// invoke 通过 Env.Acquire 占用平台后调用一次实现，seeded 时给结果标注使用的 seed；有任意一张成功即不返回错误
+func invoke(ctx context.Context, p Provider, req GenerateRequest, seeded bool) (out GenerateOutput, err error) {
+	ctx, release, err := acquire(ctx, req)
 	if err != nil {
-		return "", err
+		return out, err
 	}
+	defer func() { release(len(out.Images), err) }()
 
-	req.Header.Set("Authorization", "Bearer "+p.APIKey)
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := client.Do(req)
+	out, err = p.Generate(ctx, req)
 	if err != nil {
-		return "", err
+		log.Printf("[%s] 生成失败: %v", req.Config.Name, err)
 	}
-	defer resp.Body.Close()
-
-	respBody, _ := io.ReadAll(resp.Body)
-
-	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(respBody))
-	}
-
-	var result struct {
-		Data []struct {
-			URL string `json:"url"`
-		} `json:"data"`
-	}
-
-	if err := json.Unmarshal(respBody, &result); err != nil {
-		return "", fmt.Errorf("解析响应失败: %w", err)
+	if seeded {
+		for _, img := range out.Images {
+			img.Seed = req.Seed
+		}
 	}
-
-	if len(result.Data) == 0 || result.Data[0].URL == "" {
-		return "", fmt.Errorf("无图片返回: %s", string(respBody))
+	if len(out.Images) > 0 {
+		err = nil
 	}
-
-	return result.Data[0].URL, nil
+	return out, err
 }
 
-func sanitizeFilename(name string) string {
-	if len(name) > 20 {
-		name = name[:20]
-	}
-	name = strings.ReplaceAll(name, "/", "_")
-	name = strings.ReplaceAll(name, " ", "_")
-	name = strings.ReplaceAll(name, ":", "_")
-	return name
+// Target GenerateAll 中的一个平台
+type Target struct {
+	Type    string // 平台类型
+	Request GenerateRequest
 }
 
-func downloadImage(url, filepath string) error {
-	resp, err := httpGet(url)
-	if err != nil {
-		return err
-	}
-	return os.WriteFile(filepath, resp, 0644)
+// Outcome GenerateAll 中单个平台的结果
+type Outcome struct {
+	Output   GenerateOutput
+	Err      error
+	Duration time.Duration // 从发起请求到拿到结果的耗时，包括排队和下载
 }
 
-func httpGet(url string) ([]byte, error) {
-	client := &http.Client{Timeout: 60 * time.Second}
-	resp, err := client.Get(url)
-	if err != nil {
-		return nil, err
+// GenerateAll 并发调用多个平台，结果与 targets 按下标一一对应，单个平台失败不影响其他平台
+func GenerateAll(ctx context.Context, targets []Target) []Outcome {
+	outcomes := make([]Outcome, len(targets))
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		go func(i int, t Target) {
+			defer wg.Done()
+			start := time.Now()
+			out, err := Generate(ctx, t.Type, t.Request)
+			outcomes[i] = Outcome{Output: out, Err: err, Duration: time.Since(start)}
+		}(i, t)
 	}
-	defer resp.Body.Read(make([]byte, 0))
-	return io.ReadAll(resp.Body)
+	wg.Wait()
+	return outcomes
 }
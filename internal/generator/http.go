@@ -0,0 +1,126 @@
+package generator
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// 单次退避的上限
+const maxRetryBackoff = 30 * time.Second
+
+// retryableStatus 限流和服务端错误可以重试，其余 4xx 为请求本身有问题
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// retryableError 超时、连接失败等网络错误可以重试；请求已取消或证书错误重试也不会成功
+func retryableError(req *http.Request, err error) bool {
+	if req.Context().Err() != nil {
+		return false
+	}
+	var certErr *tls.CertificateVerificationError
+	if errors.As(err, &certErr) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// retryBackoff 第 attempt 次重试前的等待时间：RetryDelay * 2^attempt，加最多一半的随机抖动
+// 429 响应带 Retry-After 时按平台要求等待
+func retryBackoff(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+			return min(time.Duration(secs)*time.Second, maxRetryBackoff)
+		}
+	}
+	d := min(env.RetryDelay<<attempt, maxRetryBackoff)
+	return d + time.Duration(rand.Int63n(int64(d)/2+1))
+}
+
+// DoWithRetry 发送平台请求并读取响应体，可重试的错误按指数退避重试 Env.MaxRetries 次
+// 重试用尽后返回最后一次的响应，非 2xx 响应由调用方按平台格式解析错误信息
+func DoWithRetry(c *http.Client, req *http.Request) (*http.Response, []byte, error) {
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, nil, err
+			}
+			req.Body = body
+		}
+		resp, err := c.Do(req)
+		var body []byte
+		if err == nil {
+			body, err = io.ReadAll(resp.Body)
+			resp.Body.Close()
+		}
+
+		var retry bool
+		if err != nil {
+			retry = retryableError(req, err)
+		} else {
+			// 5xx 中也可能是内容审核等不可重试的错误，按响应内容再判断一次
+			retry = retryableStatus(resp.StatusCode) && Retryable(classifyBody(string(body)))
+		}
+		if !retry || attempt >= env.MaxRetries || (req.Body != nil && req.GetBody == nil) {
+			if env.OnRetryAfter != nil {
+				env.OnRetryAfter(req, resp)
+			}
+			return resp, body, err
+		}
+
+		wait := retryBackoff(attempt, resp)
+		if err != nil {
+			log.Printf("[重试] %s %s 失败: %v，%v 后第 %d 次重试", req.Method, req.URL.Host, err, wait, attempt+1)
+		} else {
+			log.Printf("[重试] %s %s 返回 HTTP %d，%v 后第 %d 次重试", req.Method, req.URL.Host, resp.StatusCode, wait, attempt+1)
+		}
+		if err := SleepCtx(req.Context(), wait); err != nil {
+			return resp, body, req.Context().Err()
+		}
+	}
+}
+
+// SleepCtx 等待 d，ctx 取消时提前返回 canceled 错误
+func SleepCtx(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return Errorf(ErrCodeCanceled, "生成已取消")
+	}
+}
+
+// DownloadURL 下载平台返回的图片，失败时按同样的策略重试
+func DownloadURL(ctx context.Context, c *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, RequestError("下载失败", err)
+	}
+	resp, data, err := DoWithRetry(c, req)
+	if err != nil {
+		return nil, RequestError("下载失败", err)
+	}
+	if resp.StatusCode != 200 {
+		return nil, ResponseError("下载失败", resp.StatusCode, data)
+	}
+	return data, nil
+}
+
+// bearerAuth 设置 Bearer 鉴权头
+func bearerAuth(key string) func(req *http.Request) {
+	return func(req *http.Request) {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+}
@@ -0,0 +1,226 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ========== 腾讯混元生图 ==========
+
+func init() {
+	// 腾讯混元异步任务，TC3 签名鉴权
+	register("hunyuan", Capabilities{Seed: true, Signed: true}, generateHunyuanImage)
+	resumers["hunyuan"] = pollHunyuanTask
+}
+
+const (
+	hunyuanService = "hunyuan"
+	hunyuanVersion = "2023-09-01"
+)
+
+// hunyuanResolutions 混元生图支持的分辨率，尺寸换算为宽高比最接近的一个
+var hunyuanResolutions = []string{"768:768", "768:1024", "1024:768", "1024:1024", "720:1280", "1280:720", "768:1280", "1280:768"}
+
+// hunyuanResponse 腾讯云 API 3.0 的响应，出错时 Response.Error 不为空
+type hunyuanResponse struct {
+	Response struct {
+		Error *struct {
+			Code    string `json:"Code"`
+			Message string `json:"Message"`
+		} `json:"Error"`
+		RequestID     string   `json:"RequestId"`
+		JobID         string   `json:"JobId"`
+		JobStatusCode string   `json:"JobStatusCode"` // 1 等待中、2 运行中、4 处理失败、5 处理完成
+		JobErrorCode  string   `json:"JobErrorCode"`
+		JobErrorMsg   string   `json:"JobErrorMsg"`
+		ResultImage   []string `json:"ResultImage"`
+	} `json:"Response"`
+}
+
+// hunyuanEndpoint 接口地址和签名使用的 host，url 为空时使用公网接入点
+func hunyuanEndpoint(p Config) (string, string) {
+	endpoint := strings.TrimSuffix(p.URL, "/")
+	if endpoint == "" {
+		endpoint = "https://hunyuan.tencentcloudapi.com"
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return endpoint, ""
+	}
+	return endpoint, u.Host
+}
+
+// tc3Sign 腾讯云 TC3-HMAC-SHA256 签名，返回 Authorization 头
+// 签名覆盖 content-type、host、x-tc-action 三个请求头和请求体的 SHA256
+func tc3Sign(secretID, secretKey, service, host, action string, payload []byte, t time.Time) string {
+	date := t.UTC().Format("2006-01-02")
+	signedHeaders := "content-type;host;x-tc-action"
+	payloadHash := sha256.Sum256(payload)
+	canonical := strings.Join([]string{
+		"POST", "/", "",
+		"content-type:application/json; charset=utf-8\nhost:" + host + "\nx-tc-action:" + strings.ToLower(action) + "\n",
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := date + "/" + service + "/tc3_request"
+	canonicalHash := sha256.Sum256([]byte(canonical))
+	stringToSign := "TC3-HMAC-SHA256\n" + strconv.FormatInt(t.Unix(), 10) + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	hmacSHA256 := func(key []byte, msg string) []byte {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(msg))
+		return mac.Sum(nil)
+	}
+	secretDate := hmacSHA256([]byte("TC3"+secretKey), date)
+	secretService := hmacSHA256(secretDate, service)
+	secretSigning := hmacSHA256(secretService, "tc3_request")
+	signature := hex.EncodeToString(hmacSHA256(secretSigning, stringToSign))
+
+	return fmt.Sprintf("TC3-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", secretID, scope, signedHeaders, signature)
+}
+
+// hunyuanCall 调用混元 API，accessKey/secretKey 为腾讯云的 SecretId/SecretKey
+func hunyuanCall(ctx context.Context, c *http.Client, p Config, action string, params interface{}) (*hunyuanResponse, []byte, error) {
+	payload, _ := json.Marshal(params)
+	endpoint, host := hunyuanEndpoint(p)
+	region := p.Region
+	if region == "" {
+		region = "ap-guangzhou"
+	}
+	req, _ := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("X-TC-Action", action)
+	req.Header.Set("X-TC-Version", hunyuanVersion)
+	req.Header.Set("X-TC-Region", region)
+	now := time.Now()
+	req.Header.Set("X-TC-Timestamp", strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set("Authorization", tc3Sign(p.AccessKey, p.SecretKey, hunyuanService, host, action, payload, now))
+
+	resp, body, err := DoWithRetry(c, req)
+	if err != nil {
+		return nil, nil, RequestError(action+" 请求失败", err)
+	}
+	var result hunyuanResponse
+	if resp.StatusCode != 200 || json.Unmarshal(body, &result) != nil {
+		return nil, body, ResponseError(action+" 请求失败", resp.StatusCode, body)
+	}
+	if e := result.Response.Error; e != nil {
+		return nil, body, hunyuanError(action, e.Code, e.Message, body)
+	}
+	return &result, body, nil
+}
+
+// hunyuanError 腾讯云的错误在响应体的 Error.Code 中（HTTP 状态码总是 200），按错误码前缀分类
+func hunyuanError(action, code, message string, body []byte) error {
+	switch {
+	case strings.HasPrefix(code, "AuthFailure"):
+		return Errorf(ErrCodeAuth, "%s 鉴权失败: %s %s", action, code, message)
+	case strings.HasPrefix(code, "RequestLimitExceeded"), strings.HasPrefix(code, "LimitExceeded"),
+		strings.HasPrefix(code, "ResourceUnavailable"), strings.HasPrefix(code, "ResourceInsufficient"):
+		return Errorf(ErrCodeProviderQuota, "%s 限流或额度不足: %s %s", action, code, message)
+	case strings.Contains(code, "IllegalDetected"):
+		return policyError(code + " " + message)
+	case strings.HasPrefix(code, "InvalidParameter"), strings.HasPrefix(code, "MissingParameter"):
+		return Errorf(ErrCodeInvalid, "%s 参数错误: %s %s", action, code, message)
+	case strings.HasPrefix(code, "InternalError"):
+		return Errorf(ErrCodeUnavailable, "%s 平台内部错误: %s %s", action, code, message)
+	}
+	return TaskFailedError(body)
+}
+
+// generateHunyuanImage 提交混元生图任务（SubmitHunyuanImageJob）并轮询结果，一次任务最多出 4 张
+// model 为空或 hunyuan-image 时使用默认风格，其他值作为 Style 传入（如 riman 日漫、xieshi 写实）
+func generateHunyuanImage(ctx context.Context, req GenerateRequest) ([]*Image, error) {
+	p := req.Config
+	width, height, err := localSize(req.Size)
+	if err != nil {
+		return nil, err
+	}
+	params := map[string]interface{}{
+		"Prompt":     req.Prompt,
+		"Resolution": nearestAspectRatio(width, height, hunyuanResolutions),
+		"Num":        min(req.N, 4),
+		"LogoAdd":    0, // 不添加"AI 生成"水印，由发布渠道按规定标注
+		"Revise":     0, // 不改写提示词，扩写由 llm 配置负责
+	}
+	if p.Model != "" && p.Model != "hunyuan-image" {
+		params["Style"] = p.Model
+	}
+	if req.NegativePrompt != "" {
+		params["NegativePrompt"] = req.NegativePrompt
+	}
+	if req.Seed != nil {
+		params["Seed"] = *req.Seed
+	}
+
+	result, _, err := hunyuanCall(ctx, client(p.Name, 30*time.Second), p, "SubmitHunyuanImageJob", params)
+	if err != nil {
+		return nil, err
+	}
+	jobID := result.Response.JobID
+	if jobID == "" {
+		return nil, Errorf(ErrCodeMalformed, "创建任务失败: 未返回 JobId")
+	}
+	log.Printf("[%s] 任务创建成功: %s (RequestId %s)", p.Name, jobID, result.Response.RequestID)
+	prog := progress(req.Progress)
+	prog.report("submitted", 15)
+
+	// 记录平台任务 ID，服务重启后可继续轮询
+	j := journal(ctx, "hunyuan", jobID)
+	results, err := pollHunyuanTask(ctx, p, jobID, prog, j)
+	j.Finish(len(results), err)
+	return results, err
+}
+
+// pollHunyuanTask 轮询 QueryHunyuanImageJob 直到完成并下载结果图片（地址 1 小时内有效），默认最长等待 3 分钟
+func pollHunyuanTask(ctx context.Context, p Config, jobID string, prog progress, j Journal) ([]*Image, error) {
+	c := client(p.Name, 30*time.Second)
+	var (
+		urls []string
+		meta map[string]interface{}
+	)
+	poller := newPoller(p, jobID, 3*time.Second, 3*time.Minute, prog, j)
+	poller.Fetch = func(ctx context.Context) ([]byte, error) {
+		_, body, err := hunyuanCall(ctx, c, p, "QueryHunyuanImageJob", map[string]string{"JobId": jobID})
+		return body, err
+	}
+	poller.Parse = func(body []byte) (pollStatus, error) {
+		var result hunyuanResponse
+		json.Unmarshal(body, &result)
+		r := result.Response
+		switch r.JobStatusCode {
+		case "5":
+			if urls = r.ResultImage; len(urls) == 0 {
+				return pollStatus{}, Errorf(ErrCodeMalformed, "解析结果失败: %s", string(body))
+			}
+			// 包含 RevisedPrompt 和每张图片的 ResultDetails
+			meta = providerMeta(body, "ResultImage")
+			return pollStatus{Done: true}, nil
+		case "4":
+			if r.JobErrorCode != "" {
+				return pollStatus{}, hunyuanError("生成", r.JobErrorCode, r.JobErrorMsg, body)
+			}
+			return pollStatus{}, TaskFailedError(body)
+		case "2":
+			return pollStatus{Stage: "running"}, nil
+		}
+		return pollStatus{Stage: "pending"}, nil
+	}
+	if err := poller.Wait(ctx); err != nil {
+		return nil, err
+	}
+	results, err := downloadAll(ctx, p, "hunyuan", urls, prog)
+	return attachMeta(results, meta), err
+}
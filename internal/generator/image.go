@@ -0,0 +1,247 @@
+package generator
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ========== 结果保存 ==========
+
+// repeatGenerate 不支持一次出多张的平台逐张生成，返回成功的部分和最后一个错误
+func repeatGenerate(ctx context.Context, n int, gen func() (*Image, error)) ([]*Image, error) {
+	var (
+		results []*Image
+		lastErr error
+	)
+	for i := 0; i < n; i++ {
+		if ctx.Err() != nil {
+			return results, Errorf(ErrCodeCanceled, "生成已取消")
+		}
+		result, err := gen()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		results = append(results, result)
+	}
+	return results, lastErr
+}
+
+// downloadAll 下载平台返回的全部图片，返回成功的部分和最后一个错误
+func downloadAll(ctx context.Context, p Config, platform string, urls []string, prog progress) ([]*Image, error) {
+	var (
+		results []*Image
+		lastErr error
+	)
+	for i, u := range urls {
+		prog.report("downloading", 80+15*i/len(urls))
+		result, err := downloadAndSave(ctx, p, platform, u, i)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		results = append(results, result)
+	}
+	return results, lastErr
+}
+
+// downloadAndSave 下载并保存图片，idx 为同一次生成中的序号，用于区分同一秒内的多张图片
+func downloadAndSave(ctx context.Context, p Config, platform, imageURL string, idx int) (*Image, error) {
+	data, err := DownloadURL(ctx, client(p.Name, 120*time.Second), imageURL)
+	if err != nil {
+		return nil, err
+	}
+	return saveImageData(p, platform, data, idx)
+}
+
+// decodeBase64Image 解码平台返回的 base64 图片，兼容带 data:image/png;base64, 前缀的写法
+func decodeBase64Image(encoded string) ([]byte, error) {
+	if _, after, ok := strings.Cut(encoded, ","); ok && strings.HasPrefix(encoded, "data:") {
+		encoded = after
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, Errorf(ErrCodeMalformed, "图片解码失败: %v", err)
+	}
+	return data, nil
+}
+
+// imageExtensions 识别出的图片格式对应的扩展名
+var imageExtensions = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/webp": ".webp",
+	"image/gif":  ".gif",
+	"image/bmp":  ".bmp",
+}
+
+// SniffImage 按文件头识别图片格式，平台返回的 Content-Type 不可靠；无法识别时按 PNG 保存
+func SniffImage(data []byte) (mime, ext string) {
+	mime = http.DetectContentType(data)
+	if ext, ok := imageExtensions[mime]; ok {
+		return mime, ext
+	}
+	return "image/png", ".png"
+}
+
+// saveImageData 把平台返回的图片数据保存到 platform 目录，扩展名按实际格式
+func saveImageData(p Config, platform string, data []byte, idx int) (*Image, error) {
+	img, err := saveImage(p, platform, data, idx)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[%s] 生成成功: %s", p.Name, img.FilePath)
+	return img, nil
+}
+
+// saveImage 通过 Env.SaveImage 保存图片，同名文件已存在时由 SaveImage 追加序号，不会覆盖同一秒内完成的其他图片
+func saveImage(p Config, platform string, data []byte, idx int) (*Image, error) {
+	if env.SaveImage == nil {
+		return nil, Errorf(ErrCodeUnknown, "未设置图片保存方式")
+	}
+	mime, ext := SniffImage(data)
+	path, err := env.SaveImage(platform, data, idx, ext)
+	if err != nil {
+		return nil, err
+	}
+	return &Image{
+		Platform: p.Name,
+		Model:    p.Model,
+		Filename: filepath.Base(path),
+		FilePath: path,
+		Success:  true,
+		MIMEType: mime,
+	}, nil
+}
+
+// ========== 平台返回的元数据 ==========
+
+// 平台响应中除图片外的信息（revised_prompt、实际的模型和 seed、审核标记、用量等）原样保存在 Image.Meta，
+// 审核页和导出时查看；图片数据和临时下载地址不保存
+var providerMetaDropped = []string{"url", "b64_json", "b64", "base64", "bytesBase64Encoded"}
+
+// providerMeta 把平台返回的一段 JSON 对象转为元数据，去掉任意层级的图片数据字段和 drop 中的字段，
+// 不是对象或去掉后为空时返回 nil
+func providerMeta(raw []byte, drop ...string) map[string]interface{} {
+	var meta map[string]interface{}
+	if err := json.Unmarshal(raw, &meta); err != nil {
+		return nil
+	}
+	stripMeta(meta, append(drop, providerMetaDropped...))
+	if len(meta) == 0 {
+		return nil
+	}
+	return meta
+}
+
+func stripMeta(v interface{}, drop []string) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for _, k := range drop {
+			delete(v, k)
+		}
+		for _, child := range v {
+			stripMeta(child, drop)
+		}
+	case []interface{}:
+		for _, child := range v {
+			stripMeta(child, drop)
+		}
+	}
+}
+
+// mergeMeta 合并多段元数据，后面的覆盖前面的同名字段
+func mergeMeta(parts ...map[string]interface{}) map[string]interface{} {
+	var merged map[string]interface{}
+	for _, part := range parts {
+		for k, v := range part {
+			if merged == nil {
+				merged = map[string]interface{}{}
+			}
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+// attachMeta 给还没有元数据的结果附上任务级的元数据，平台按任务而不是按图片返回信息时使用
+func attachMeta(results []*Image, meta map[string]interface{}) []*Image {
+	for _, r := range results {
+		if r.Meta == nil {
+			r.Meta = meta
+		}
+	}
+	return results
+}
+
+// ========== 尺寸换算 ==========
+
+// sizeSeparators 平台类型的尺寸写法，未列出的为 宽x高
+var sizeSeparators = map[string]string{
+	"aliyun": "*",
+}
+
+// providerSize 按平台类型的写法格式化尺寸，如百炼为 1024*1024
+func providerSize(p Config, size string) string {
+	if sep, ok := sizeSeparators[p.Type]; ok {
+		return strings.Replace(size, "x", sep, 1)
+	}
+	return size
+}
+
+// defaultSize 未指定尺寸时使用 Env 的宽高
+func defaultSize() string {
+	return fmt.Sprintf("%dx%d", env.Width, env.Height)
+}
+
+// ParseSize 解析 宽x高 尺寸，宽高之间也可以是 *
+func ParseSize(size string) (int, int, error) {
+	parts := strings.FieldsFunc(size, func(r rune) bool { return r == 'x' || r == '*' })
+	if len(parts) == 2 {
+		w, err1 := strconv.Atoi(parts[0])
+		h, err2 := strconv.Atoi(parts[1])
+		if err1 == nil && err2 == nil && w > 0 && h > 0 {
+			return w, h, nil
+		}
+	}
+	return 0, 0, Errorf(ErrCodeInvalid, "尺寸格式错误: %s", size)
+}
+
+// localSize 解析 宽x高 尺寸，为空时使用 Env 的宽高
+func localSize(size string) (int, int, error) {
+	if size == "" {
+		return env.Width, env.Height, nil
+	}
+	return ParseSize(size)
+}
+
+// nearestAspectRatio 与 宽/高 最接近的宽高比
+func nearestAspectRatio(width, height int, ratios []string) string {
+	want := math.Log(float64(width) / float64(height))
+	best, bestDiff := ratios[0], math.Inf(1)
+	for _, r := range ratios {
+		w, h, _ := strings.Cut(r, ":")
+		rw, _ := strconv.ParseFloat(w, 64)
+		rh, _ := strconv.ParseFloat(h, 64)
+		if diff := math.Abs(math.Log(rw/rh) - want); diff < bestDiff {
+			best, bestDiff = r, diff
+		}
+	}
+	return best
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
@@ -0,0 +1,219 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ========== Midjourney (midjourney-proxy 网关) ==========
+
+func init() {
+	// midjourney-proxy 网关，imagine 后放大四宫格中的前 n 张
+	register("midjourney", Capabilities{Keyless: true}, generateMidjourneyImage)
+}
+
+// mjTask midjourney-proxy 的任务，status 为 NOT_START、SUBMITTED、MODAL、IN_PROGRESS、SUCCESS、FAILURE、CANCEL
+type mjTask struct {
+	ID         string `json:"id"`
+	Status     string `json:"status"`
+	Progress   string `json:"progress"` // 如 "45%"
+	ImageURL   string `json:"imageUrl"`
+	FailReason string `json:"failReason"`
+	Buttons    []struct {
+		CustomID string `json:"customId"`
+		Label    string `json:"label"`
+	} `json:"buttons"` // plus 版本返回，放大使用其中 U1-U4 的 customId
+}
+
+// percent 任务进度百分比，无法解析时为 0
+func (t *mjTask) percent() int {
+	n, _ := strconv.Atoi(strings.TrimSuffix(t.Progress, "%"))
+	return n
+}
+
+// mjClient 调用 midjourney-proxy 的接口，apiKey 作为 mj-api-secret 发送
+type mjClient struct {
+	p      Config
+	client *http.Client
+}
+
+func (m *mjClient) do(ctx context.Context, method, path string, payload interface{}) ([]byte, error) {
+	var body io.Reader
+	if payload != nil {
+		data, _ := json.Marshal(payload)
+		body = bytes.NewReader(data)
+	}
+	req, _ := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(m.p.URL, "/")+path, body)
+	req.Header.Set("Content-Type", "application/json")
+	if m.p.APIKey != "" {
+		req.Header.Set("mj-api-secret", m.p.APIKey)
+	}
+	resp, data, err := DoWithRetry(m.client, req)
+	if err != nil {
+		return nil, RequestError("请求失败", err)
+	}
+	if resp.StatusCode != 200 {
+		return nil, ResponseError("请求失败", resp.StatusCode, data)
+	}
+	return data, nil
+}
+
+// submit 提交任务，返回任务 ID；code 1 为提交成功，22 为排队中，其他为失败
+func (m *mjClient) submit(ctx context.Context, path string, payload interface{}) (string, error) {
+	data, err := m.do(ctx, "POST", path, payload)
+	if err != nil {
+		return "", err
+	}
+	var resp struct {
+		Code        int    `json:"code"`
+		Description string `json:"description"`
+		Result      string `json:"result"`
+	}
+	if json.Unmarshal(data, &resp) != nil {
+		return "", ResponseError("解析任务ID失败", 200, data)
+	}
+	if (resp.Code != 1 && resp.Code != 22) || resp.Result == "" {
+		return "", TaskFailedError(data)
+	}
+	return resp.Result, nil
+}
+
+// wait 轮询任务直到完成，from/to 为该阶段在整体进度中的区间；relax 模式排队较久，默认最长等待 10 分钟
+func (m *mjClient) wait(ctx context.Context, taskID string, prog progress, from, to int) (*mjTask, error) {
+	var task mjTask
+	poller := newPoller(m.p, taskID, 3*time.Second, 10*time.Minute, prog, nil)
+	poller.From, poller.To = from, to
+	poller.Fetch = func(ctx context.Context) ([]byte, error) {
+		return m.do(ctx, "GET", "/mj/task/"+taskID+"/fetch", nil)
+	}
+	poller.Parse = func(body []byte) (pollStatus, error) {
+		task = mjTask{}
+		json.Unmarshal(body, &task)
+		switch task.Status {
+		case "SUCCESS":
+			if task.ImageURL == "" {
+				return pollStatus{}, ResponseError("解析结果失败", 200, body)
+			}
+			return pollStatus{Done: true}, nil
+		case "FAILURE", "CANCEL":
+			return pollStatus{}, TaskFailedError(body)
+		case "IN_PROGRESS":
+			// 进度为 0 时不按等待时间估算，保持在阶段起点
+			return pollStatus{Stage: "running", Percent: max(task.percent(), 1)}, nil
+		}
+		return pollStatus{Stage: "pending", Percent: 1}, nil
+	}
+	if err := poller.Wait(ctx); err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// upscale 放大网格图中的第 index 张（1-4），优先使用任务返回的按钮，旧版网关使用 /submit/change
+func (m *mjClient) upscale(ctx context.Context, grid *mjTask, index int) (string, error) {
+	label := "U" + strconv.Itoa(index)
+	for _, b := range grid.Buttons {
+		if b.Label == label {
+			return m.submit(ctx, "/mj/submit/action", map[string]interface{}{"taskId": grid.ID, "customId": b.CustomID})
+		}
+	}
+	return m.submit(ctx, "/mj/submit/change", map[string]interface{}{"taskId": grid.ID, "action": "UPSCALE", "index": index})
+}
+
+// mjPrompt 尺寸和反向提示词转换为 Midjourney 参数，提示词中已写了 --ar / --no 时不覆盖
+func mjPrompt(prompt, size, negative string) string {
+	if size != "" && !strings.Contains(prompt, "--ar") {
+		if w, h, err := localSize(size); err == nil {
+			g := gcd(w, h)
+			prompt += fmt.Sprintf(" --ar %d:%d", w/g, h/g)
+		}
+	}
+	if negative != "" && !strings.Contains(prompt, "--no") {
+		prompt += " --no " + negative
+	}
+	return prompt
+}
+
+// generateMidjourneyImage 通过 midjourney-proxy 生成：imagine 得到四宫格，再按 U1-U4 放大，每张放大结果为一条记录
+// 一次 imagine 最多出四张，n 大于 4 时提交多次 imagine
+func generateMidjourneyImage(ctx context.Context, req GenerateRequest) ([]*Image, error) {
+	p := req.Config
+	m := &mjClient{p: p, client: client(p.Name, 30*time.Second)}
+	prompt := mjPrompt(req.Prompt, req.Size, req.NegativePrompt)
+
+	var (
+		results []*Image
+		lastErr error
+	)
+	for remaining := req.N; remaining > 0; remaining -= 4 {
+		batch, err := m.generateGrid(ctx, prompt, min(remaining, 4), len(results), req.Progress)
+		results = append(results, batch...)
+		if err != nil {
+			lastErr = err
+			if ErrorCode(err) == ErrCodeCanceled {
+				break
+			}
+		}
+	}
+	if len(results) > 0 {
+		return results, nil
+	}
+	return nil, lastErr
+}
+
+// generateGrid 提交一次 imagine 并放大前 count 个象限，offset 为已生成的张数，用于文件序号
+func (m *mjClient) generateGrid(ctx context.Context, prompt string, count, offset int, prog progress) ([]*Image, error) {
+	taskID, err := m.submit(ctx, "/mj/submit/imagine", map[string]interface{}{"prompt": prompt})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[%s] imagine 任务创建成功: %s", m.p.Name, taskID)
+	prog.report("submitted", 10)
+
+	grid, err := m.wait(ctx, taskID, prog, 10, 50)
+	if err != nil {
+		return nil, err
+	}
+
+	// 四个象限的放大任务同时提交，网关按账号并发数排队
+	upscaleIDs := make([]string, 0, count)
+	var lastErr error
+	for i := 1; i <= count; i++ {
+		id, err := m.upscale(ctx, grid, i)
+		if err != nil {
+			log.Printf("[%s] 放大 U%d 提交失败: %v", m.p.Name, i, err)
+			lastErr = err
+			continue
+		}
+		upscaleIDs = append(upscaleIDs, id)
+	}
+
+	var results []*Image
+	for i, id := range upscaleIDs {
+		task, err := m.wait(ctx, id, prog, 50+40*i/len(upscaleIDs), 50+40*(i+1)/len(upscaleIDs))
+		if err != nil {
+			lastErr = err
+			if ErrorCode(err) == ErrCodeCanceled {
+				break
+			}
+			continue
+		}
+		r, err := downloadAndSave(ctx, m.p, "midjourney", task.ImageURL, offset+len(results))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		// 保留任务 ID，可在网关上继续变体、重绘
+		r.Meta = map[string]interface{}{"task_id": task.ID, "grid_task_id": grid.ID}
+		results = append(results, r)
+	}
+	return results, lastErr
+}
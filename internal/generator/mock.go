@@ -0,0 +1,48 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand"
+	"time"
+)
+
+// ========== 模拟平台 ==========
+
+func init() {
+	// 模拟平台，本地生成图片，不调用外部 API，支持全部操作用于联调
+	register("mock", Capabilities{
+		Img2Img: true, Inpaint: true, Control: true,
+		ControlModels: map[string]string{"canny": "mock", "pose": "mock", "depth": "mock"},
+	}, func(ctx context.Context, req GenerateRequest) ([]*Image, error) {
+		return repeatGenerate(ctx, req.N, func() (*Image, error) { return mockImage(ctx, req.Config) })
+	})
+}
+
+// mockImage 本地生成纯色图片，按 LatencyMs 模拟平台延迟，用于压测和联调
+func mockImage(ctx context.Context, p Config) (*Image, error) {
+	if err := SleepCtx(ctx, time.Duration(p.LatencyMs)*time.Millisecond); err != nil {
+		return nil, err
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	fill := color.RGBA{uint8(rand.Intn(256)), uint8(rand.Intn(256)), uint8(rand.Intn(256)), 255}
+	for x := 0; x < 64; x++ {
+		for y := 0; y < 64; y++ {
+			img.Set(x, y, fill)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("编码失败: %v", err)
+	}
+	if p.Model == "" {
+		p.Model = "mock"
+	}
+	// 压测时数量很多，不逐张记录日志
+	return saveImage(p, "mock", buf.Bytes(), 0)
+}
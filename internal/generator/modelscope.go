@@ -0,0 +1,135 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// ========== 魔塔社区 ==========
+
+func init() {
+	// 魔塔是异步 API，支持 size 参数，一次任务只出一张；图生图通过地址读取原图
+	register("modelscope", Capabilities{Seed: true, Img2Img: true, SourceURL: true}, generateModelScope)
+	resumers["modelscope"] = func(ctx context.Context, p Config, taskID string, prog progress, j Journal) ([]*Image, error) {
+		r, err := pollModelScopeTask(ctx, p, taskID, prog, j)
+		if r == nil {
+			return nil, err
+		}
+		return []*Image{r}, err
+	}
+}
+
+func generateModelScope(ctx context.Context, req GenerateRequest) ([]*Image, error) {
+	p := req.Config
+	params := map[string]interface{}{
+		"model":  p.Model,
+		"prompt": req.Prompt,
+	}
+	if req.Operation == OpImg2Img {
+		srcURL, err := req.Source.url()
+		if err != nil {
+			return nil, err
+		}
+		params["image_url"] = srcURL
+		if req.Size != "" {
+			params["size"] = req.Size
+		}
+	} else {
+		if req.NegativePrompt != "" {
+			params["negative_prompt"] = req.NegativePrompt
+		}
+		if req.Seed != nil {
+			params["seed"] = *req.Seed
+		}
+		// 支持 size 参数（如 "1920x1080" 或 "2048x2048"）
+		if req.Size != "" {
+			params["size"] = providerSize(p, req.Size)
+		}
+	}
+	return repeatGenerate(ctx, req.N, func() (*Image, error) { return submitModelScopeTask(ctx, p, params, req.Progress) })
+}
+
+// submitModelScopeTask 创建魔塔异步任务并轮询结果
+func submitModelScopeTask(ctx context.Context, p Config, reqParams map[string]interface{}, prog progress) (*Image, error) {
+	c := client(p.Name, 30*time.Second)
+
+	// 步骤1: 创建任务
+	reqBody, _ := json.Marshal(reqParams)
+
+	req, _ := http.NewRequestWithContext(ctx, "POST", p.URL+"/v1/images/generations", bytes.NewReader(reqBody))
+	req.Header.Set("Authorization", "Bearer "+p.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-ModelScope-Async-Mode", "true")
+
+	resp, body, err := DoWithRetry(c, req)
+	if err != nil {
+		return nil, RequestError("创建任务失败", err)
+	}
+	var taskResp struct {
+		TaskID     string `json:"task_id"`
+		TaskStatus string `json:"task_status"`
+	}
+	json.Unmarshal(body, &taskResp)
+
+	if taskResp.TaskID == "" {
+		return nil, ResponseError("解析任务ID失败", resp.StatusCode, body)
+	}
+
+	taskID := taskResp.TaskID
+	log.Printf("[%s] 任务创建成功: %s", p.Name, taskID)
+	prog.report("submitted", 15)
+
+	// 步骤2: 轮询等待任务完成，记录平台任务 ID，服务重启后可继续轮询
+	j := journal(ctx, "modelscope", taskID)
+	result, err := pollModelScopeTask(ctx, p, taskID, prog, j)
+	if result != nil {
+		j.Finish(1, err)
+	} else {
+		j.Finish(0, err)
+	}
+	return result, err
+}
+
+// pollModelScopeTask 轮询魔塔任务直到完成并下载结果，ModelScope 排队较久，默认每 3 秒查询一次，最长等待 3 分钟
+func pollModelScopeTask(ctx context.Context, p Config, taskID string, prog progress, j Journal) (*Image, error) {
+	var (
+		imageURL string
+		meta     map[string]interface{}
+	)
+	poller := newPoller(p, taskID, 3*time.Second, 3*time.Minute, prog, j)
+	poller.Fetch = pollGet(client(p.Name, 30*time.Second), p.URL+"/v1/tasks/"+taskID, func(req *http.Request) {
+		req.Header.Set("Authorization", "Bearer "+p.APIKey)
+		req.Header.Set("X-ModelScope-Task-Type", "image_generation")
+	})
+	poller.Parse = func(body []byte) (pollStatus, error) {
+		var statusResp struct {
+			TaskStatus   string   `json:"task_status"`
+			OutputImages []string `json:"output_images"`
+		}
+		json.Unmarshal(body, &statusResp)
+		switch {
+		case statusResp.TaskStatus == "SUCCEED" && len(statusResp.OutputImages) > 0:
+			imageURL = statusResp.OutputImages[0]
+			meta = providerMeta(body, "output_images")
+			return pollStatus{Done: true}, nil
+		case statusResp.TaskStatus == "FAILED":
+			return pollStatus{}, TaskFailedError(body)
+		}
+		log.Printf("[%s] 任务状态: %s", p.Name, statusResp.TaskStatus)
+		return pollStatus{Stage: taskStage(statusResp.TaskStatus)}, nil
+	}
+	if err := poller.Wait(ctx); err != nil {
+		return nil, err
+	}
+	prog.report("downloading", 80)
+	result, err := downloadAndSave(ctx, p, "modelscope", imageURL, 0)
+	if err != nil {
+		return nil, err
+	}
+	result.Meta = meta
+	return result, nil
+}
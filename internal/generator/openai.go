@@ -0,0 +1,181 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+
+	_ "golang.org/x/image/webp"
+)
+
+// ========== OpenAI 兼容的同步接口 (SiliconFlow, OpenAI) ==========
+
+func init() {
+	// SiliconFlow 等 OpenAI 兼容的同步接口，也是未知平台类型的默认实现
+	register("siliconflow", Capabilities{Seed: true, Img2Img: true}, generateSiliconFlow)
+	SetDefault("siliconflow")
+	// OpenAI 不支持反向提示词和 seed，局部重绘的遮罩以透明区域表示重绘范围
+	register("openai", Capabilities{Inpaint: true, TransparentMask: true}, generateOpenAI)
+}
+
+func generateSiliconFlow(ctx context.Context, req GenerateRequest) ([]*Image, error) {
+	if req.Operation == OpImg2Img {
+		params := map[string]interface{}{
+			"model": req.Config.Model, "prompt": req.Prompt, "image": req.Source.dataURI(), "strength": req.Strength, "n": req.N,
+		}
+		if req.Size != "" {
+			params["size"] = req.Size
+		}
+		return postSyncGeneration(ctx, req.Config, params)
+	}
+	return generateSyncImage(ctx, req.Config, req.Prompt, req.Size, req.N, req.NegativePrompt, req.Seed)
+}
+
+func generateOpenAI(ctx context.Context, req GenerateRequest) ([]*Image, error) {
+	if req.Operation == OpInpaint {
+		return openAIEdit(ctx, req.Config, req.Prompt, req.Source, req.Mask)
+	}
+	return generateSyncImage(ctx, req.Config, req.Prompt, req.Size, req.N, "", nil)
+}
+
+// generateSyncImage 文生图，size 为空时使用 Env 的尺寸
+func generateSyncImage(ctx context.Context, p Config, prompt, size string, n int, negative string, seed *int64) ([]*Image, error) {
+	if size == "" {
+		size = defaultSize()
+	}
+
+	params := map[string]interface{}{
+		"model": p.Model, "prompt": prompt, "size": providerSize(p, size), "n": n,
+	}
+	if negative != "" {
+		params["negative_prompt"] = negative
+	}
+	if seed != nil {
+		params["seed"] = *seed
+	}
+	return postSyncGeneration(ctx, p, params)
+}
+
+// postSyncGeneration 调用同步生成接口并下载返回的全部图片
+func postSyncGeneration(ctx context.Context, p Config, params map[string]interface{}) ([]*Image, error) {
+	if p.ResponseFormat != "" {
+		params["response_format"] = p.ResponseFormat
+	}
+	reqBody, _ := json.Marshal(params)
+
+	apiURL := p.URL
+	if !strings.Contains(apiURL, "/images/generations") {
+		apiURL = apiURL + "/images/generations"
+	}
+
+	req, _ := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewReader(reqBody))
+	req.Header.Set("Authorization", "Bearer "+p.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+	return doSyncRequest(p, "siliconflow", req)
+}
+
+// openAIEdit 调用 /images/edits 按遮罩重绘，遮罩透明区域为重绘范围
+func openAIEdit(ctx context.Context, p Config, prompt string, src, mask *SourceImage) ([]*Image, error) {
+	pngData, err := toPNG(src)
+	if err != nil {
+		return nil, err
+	}
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	w.WriteField("model", p.Model)
+	w.WriteField("prompt", prompt)
+	w.WriteField("n", "1")
+	for name, data := range map[string][]byte{"image": pngData, "mask": mask.Data} {
+		part, _ := w.CreateFormFile(name, name+".png")
+		part.Write(data)
+	}
+	w.Close()
+	req, _ := http.NewRequestWithContext(ctx, "POST", strings.TrimRight(p.URL, "/")+"/images/edits", &body)
+	req.Header.Set("Authorization", "Bearer "+p.APIKey)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	return doSyncRequest(p, "openai", req)
+}
+
+// toPNG OpenAI 编辑接口只接受 PNG，其他格式先转换
+func toPNG(src *SourceImage) ([]byte, error) {
+	if src.MIME == "image/png" {
+		return src.Data, nil
+	}
+	img, _, err := image.Decode(bytes.NewReader(src.Data))
+	if err != nil {
+		return nil, Errorf(ErrCodeInvalid, "解析原图失败: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// doSyncRequest 发送同步接口请求，下载返回的 data[].url 图片到 platform 目录，下载沿用 req 的 context
+// data[] 中为 b64_json 的直接解码保存；响应为图片数据（Content-Type: image/*）时直接保存
+func doSyncRequest(p Config, platform string, req *http.Request) ([]*Image, error) {
+	resp, body, err := DoWithRetry(client(p.Name, 120*time.Second), req)
+	if err != nil {
+		return nil, RequestError("HTTP错误", err)
+	}
+	if resp.StatusCode != 200 {
+		return nil, ResponseError("请求失败", resp.StatusCode, body)
+	}
+	// 部分兼容接口直接返回图片数据
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "image/") {
+		result, err := saveImageData(p, platform, body, 0)
+		if err != nil {
+			return nil, err
+		}
+		return []*Image{result}, nil
+	}
+	var result struct {
+		Data []json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil || len(result.Data) == 0 {
+		return nil, ResponseError("解析失败", resp.StatusCode, body)
+	}
+	// created、usage 等响应级字段和每张图片的 revised_prompt 等字段一起保存
+	shared := providerMeta(body, "data")
+
+	var (
+		results []*Image
+		lastErr error
+	)
+	for i, raw := range result.Data {
+		var d struct {
+			URL     string `json:"url"`
+			B64JSON string `json:"b64_json"`
+		}
+		json.Unmarshal(raw, &d)
+		var (
+			r   *Image
+			err error
+		)
+		switch {
+		case d.B64JSON != "":
+			var data []byte
+			if data, err = decodeBase64Image(d.B64JSON); err == nil {
+				r, err = saveImageData(p, platform, data, i)
+			}
+		case d.URL != "":
+			r, err = downloadAndSave(req.Context(), p, platform, d.URL, i)
+		default:
+			err = ResponseError("解析失败", resp.StatusCode, body)
+		}
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		r.Meta = mergeMeta(shared, providerMeta(raw))
+		results = append(results, r)
+	}
+	return results, lastErr
+}
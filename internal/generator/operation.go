@@ -0,0 +1,72 @@
+package generator
+
+import (
+	"encoding/base64"
+)
+
+// 生成操作，GenerateRequest.Operation 为空时为文生图
+const (
+	OpImg2Img = "img2img" // 以原图为参考生成，Strength 越大与原图差别越大
+	OpInpaint = "inpaint" // 按遮罩只重绘原图的部分区域
+	OpControl = "control" // 按参考图的边缘、姿态或深度引导生成
+	OpUpscale = "upscale" // 按 Scale 倍数放大原图，不改变内容
+)
+
+var operationNames = map[string]string{
+	OpImg2Img: "图生图",
+	OpInpaint: "局部重绘",
+	OpControl: "参考图引导",
+	OpUpscale: "图片放大",
+}
+
+func operationName(op string) string {
+	if name, ok := operationNames[op]; ok {
+		return name
+	}
+	return op
+}
+
+// supports 平台类型是否支持该操作
+func (c Capabilities) supports(op string) bool {
+	switch op {
+	case "":
+		return true
+	case OpImg2Img:
+		return c.Img2Img
+	case OpInpaint:
+		return c.Inpaint
+	case OpControl:
+		return c.Control
+	case OpUpscale:
+		return c.Upscale
+	}
+	return false
+}
+
+// SourceImage 原图、遮罩或参考图
+type SourceImage struct {
+	Name string // 文件名，上传到平台时使用
+	Data []byte
+	MIME string
+	URL  string // 可公网访问的地址，只接受图片地址的平台使用，服务未配置公网地址时为空
+}
+
+func (s *SourceImage) dataURI() string {
+	return "data:" + s.MIME + ";base64," + base64.StdEncoding.EncodeToString(s.Data)
+}
+
+// url 平台要自己下载原图时使用的地址，为空时直接报错而不是等平台返回难以理解的错误
+func (s *SourceImage) url() (string, error) {
+	if s.URL == "" {
+		return "", Errorf(ErrCodeInvalid, "server.publicUrl 未配置，平台需要可公网访问的原图地址")
+	}
+	return s.URL, nil
+}
+
+// Control 参考图引导的参考图和控制参数
+type Control struct {
+	Image    *SourceImage
+	Mode     string  // canny、pose、depth
+	Model    string  // 控制模式使用的模型
+	Strength float64 // 0-1，越大越贴近参考图
+}
@@ -0,0 +1,154 @@
+package generator
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// progress 上报生成进度，stage 为 submitted、pending、running、downloading，percent 为 0-100
+type progress func(stage string, percent int)
+
+func (f progress) report(stage string, percent int) {
+	if f != nil {
+		f(stage, percent)
+	}
+}
+
+// pollStatus 一次状态查询解析出的任务状态
+type pollStatus struct {
+	Done    bool   // 任务已成功结束，停止轮询
+	Stage   string // 未结束时的阶段 pending、running，为空按 running
+	Percent int    // 平台返回的任务进度（0-100），为 0 时按已等待时间估算
+}
+
+// asyncTaskPoller 异步平台任务的通用轮询：每隔 Interval 查询一次状态，直到完成、失败、超过 MaxWait 或 ctx 取消
+// 平台适配只需提供 Fetch（发起一次查询）和 Parse（解析状态，成功时取出结果），不必各自实现等待循环
+type asyncTaskPoller struct {
+	Name     string // 平台显示名，用于日志
+	TaskID   string
+	Interval time.Duration
+	MaxWait  time.Duration
+	Progress progress
+	From, To int     // 轮询阶段在整体进度中的区间，默认 20-80
+	Journal  Journal // 每次查询前记录轮询
+
+	// Fetch 查询一次任务状态；鉴权、参数错误直接结束轮询，其他错误等下一轮重试
+	Fetch func(ctx context.Context) ([]byte, error)
+	// Parse 解析查询结果，返回错误表示任务失败
+	Parse func(body []byte) (pollStatus, error)
+	// OnAbort 取消或超时后调用，如取消平台上仍在运行的任务，避免继续计费
+	OnAbort func()
+}
+
+// newPoller 按平台默认的查询间隔和最长等待创建轮询器，平台配置了 pollInterval / maxWait 时优先
+func newPoller(p Config, taskID string, interval, maxWait time.Duration, prog progress, j Journal) *asyncTaskPoller {
+	if p.PollInterval > 0 {
+		interval = time.Duration(p.PollInterval) * time.Second
+	}
+	if p.MaxWait > 0 {
+		maxWait = time.Duration(p.MaxWait) * time.Second
+	}
+	if j == nil {
+		j = nopJournal{}
+	}
+	return &asyncTaskPoller{Name: p.Name, TaskID: taskID, Interval: interval, MaxWait: maxWait, Progress: prog, Journal: j}
+}
+
+// Wait 轮询直到 Parse 返回完成或失败；超过最长等待返回 timeout 错误，ctx 取消返回 canceled 错误
+func (pl *asyncTaskPoller) Wait(ctx context.Context) error {
+	from, to := pl.From, pl.To
+	if from == 0 && to == 0 {
+		from, to = 20, 80
+	}
+	start := time.Now()
+	for time.Since(start) < pl.MaxWait {
+		if err := SleepCtx(ctx, pl.Interval); err != nil {
+			log.Printf("[%s] 任务 %s 已取消，停止轮询", pl.Name, pl.TaskID)
+			pl.abort()
+			return err
+		}
+
+		pl.Journal.Poll()
+		// 单次查询失败时已退避重试，重试用尽仍失败则等下一轮轮询
+		body, err := pl.Fetch(ctx)
+		if err != nil {
+			if code := ErrorCode(err); code == ErrCodeAuth || code == ErrCodeInvalid {
+				return err
+			}
+			continue
+		}
+		status, err := pl.Parse(body)
+		if err != nil {
+			return err
+		}
+		if status.Done {
+			return nil
+		}
+
+		percent := status.Percent
+		if percent <= 0 {
+			percent = int(100 * time.Since(start) / pl.MaxWait)
+		}
+		if status.Stage == "" {
+			status.Stage = "running"
+		}
+		pl.Progress.report(status.Stage, from+(to-from)*min(percent, 100)/100)
+	}
+
+	log.Printf("[%s] 任务 %s 超过 %s 未完成", pl.Name, pl.TaskID, pl.MaxWait)
+	pl.abort()
+	return Errorf(ErrCodeTimeout, "任务超时")
+}
+
+func (pl *asyncTaskPoller) abort() {
+	if pl.OnAbort != nil {
+		pl.OnAbort()
+	}
+}
+
+// pollGet 常见的 GET 状态查询，setup 设置鉴权等请求头
+func pollGet(c *http.Client, url string, setup func(req *http.Request)) func(ctx context.Context) ([]byte, error) {
+	return func(ctx context.Context) ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return nil, RequestError("查询任务失败", err)
+		}
+		if setup != nil {
+			setup(req)
+		}
+		_, body, err := DoWithRetry(c, req)
+		return body, err
+	}
+}
+
+// taskStage 统一各平台的任务状态名称
+func taskStage(status string) string {
+	switch s := strings.ToLower(status); s {
+	case "processing":
+		return "running"
+	case "", "starting":
+		return "pending"
+	default:
+		return s
+	}
+}
+
+// ========== 重启后恢复轮询 ==========
+
+// resumeFunc 继续轮询已创建的平台任务直到完成并保存结果
+type resumeFunc func(ctx context.Context, p Config, taskID string, prog progress, j Journal) ([]*Image, error)
+
+// resumers 支持重启后恢复轮询的平台任务，键为记录任务时的 provider
+var resumers = map[string]resumeFunc{}
+
+// Resume 继续轮询服务重启前创建的平台任务，provider 为 Env.Journal 收到的名称
+func Resume(ctx context.Context, provider string, p Config, taskID string, prog func(stage string, percent int), j Journal) ([]*Image, error) {
+	resume, ok := resumers[provider]
+	if !ok {
+		return nil, Errorf(ErrCodeInvalid, "不支持恢复的平台任务: %s", provider)
+	}
+	return resume(ctx, p, taskID, prog, j)
+}
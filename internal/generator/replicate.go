@@ -0,0 +1,163 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ========== Replicate ==========
+
+func init() {
+	// Replicate 预测接口，创建后轮询；ControlNet 是独立的模型，没有内置，需在平台配置 controlModels 中指定
+	// 放大调用 Real-ESRGAN 等放大模型，原图以 data URI 传入，不需要公网地址
+	register("replicate", Capabilities{Seed: true, Control: true, Upscale: true, SourceURL: true}, generateReplicateImage)
+	resumers["replicate"] = pollReplicateTask
+}
+
+// replicateAspectRatios FLUX 等模型只接受固定的宽高比，尺寸换算后不在其中时不传 aspect_ratio
+var replicateAspectRatios = map[string]bool{
+	"1:1": true, "16:9": true, "21:9": true, "3:2": true, "2:3": true, "4:5": true,
+	"5:4": true, "3:4": true, "4:3": true, "9:16": true, "9:21": true,
+}
+
+// replicatePrediction Replicate 预测的状态：starting、processing、succeeded、failed、canceled
+type replicatePrediction struct {
+	ID     string          `json:"id"`
+	Status string          `json:"status"`
+	Output json.RawMessage `json:"output"`
+}
+
+// outputURLs 输出为图片地址或地址数组，取决于模型
+func (pr *replicatePrediction) outputURLs() []string {
+	var url string
+	if json.Unmarshal(pr.Output, &url) == nil && url != "" {
+		return []string{url}
+	}
+	var urls []string
+	json.Unmarshal(pr.Output, &urls)
+	return urls
+}
+
+func replicateBase(p Config) string {
+	if p.URL == "" {
+		return "https://api.replicate.com/v1"
+	}
+	return strings.TrimSuffix(p.URL, "/")
+}
+
+// generateReplicateImage 创建 Replicate 预测并轮询结果
+// model 为 owner/name 时调用官方模型接口（如 black-forest-labs/flux-schnell），为 owner/name:version 时按版本调用
+func generateReplicateImage(ctx context.Context, req GenerateRequest) ([]*Image, error) {
+	p := req.Config
+	width, height, err := localSize(req.Size)
+	if err != nil {
+		return nil, err
+	}
+	// 不同模型的输入参数不同，模型不认识的参数会被忽略
+	input := map[string]interface{}{
+		"prompt": req.Prompt, "width": width, "height": height, "num_outputs": req.N,
+	}
+	if g := gcd(width, height); g > 0 {
+		if ratio := fmt.Sprintf("%d:%d", width/g, height/g); replicateAspectRatios[ratio] {
+			input["aspect_ratio"] = ratio
+		}
+	}
+	if req.NegativePrompt != "" {
+		input["negative_prompt"] = req.NegativePrompt
+	}
+	if req.Seed != nil {
+		input["seed"] = *req.Seed
+	}
+	if g := req.Control; g != nil {
+		// ControlNet 模型的参考图参数名不统一，常见的几种都传
+		ref, err := g.Image.url()
+		if err != nil {
+			return nil, err
+		}
+		input["image"], input["control_image"] = ref, ref
+		input["control_type"], input["control_strength"], input["conditioning_scale"] = g.Mode, g.Strength, g.Strength
+		p.Model = g.Model
+	}
+	if req.Operation == OpUpscale {
+		input = map[string]interface{}{"image": req.Source.dataURI(), "scale": req.Scale}
+	}
+
+	apiURL := replicateBase(p) + "/models/" + p.Model + "/predictions"
+	params := map[string]interface{}{"input": input}
+	if _, version, ok := strings.Cut(p.Model, ":"); ok {
+		apiURL = replicateBase(p) + "/predictions"
+		params["version"] = version
+	}
+	reqBody, _ := json.Marshal(params)
+	httpReq, _ := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewReader(reqBody))
+	httpReq.Header.Set("Authorization", "Bearer "+p.APIKey)
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, body, err := DoWithRetry(client(p.Name, 30*time.Second), httpReq)
+	if err != nil {
+		return nil, RequestError("创建任务失败", err)
+	}
+	var prediction replicatePrediction
+	if resp.StatusCode >= 300 || json.Unmarshal(body, &prediction) != nil || prediction.ID == "" {
+		return nil, ResponseError("创建任务失败", resp.StatusCode, body)
+	}
+	log.Printf("[%s] 任务创建成功: %s", p.Name, prediction.ID)
+	prog := progress(req.Progress)
+	prog.report("submitted", 15)
+
+	// 记录平台任务 ID，服务重启后可继续轮询
+	j := journal(ctx, "replicate", prediction.ID)
+	results, err := pollReplicateTask(ctx, p, prediction.ID, prog, j)
+	j.Finish(len(results), err)
+	return results, err
+}
+
+// pollReplicateTask 轮询预测直到完成并下载全部输出图片，默认最长等待 5 分钟；生成被取消或超时时同时取消 Replicate 上的预测，避免继续计费
+func pollReplicateTask(ctx context.Context, p Config, predictionID string, prog progress, j Journal) ([]*Image, error) {
+	var (
+		urls []string
+		meta map[string]interface{}
+	)
+	poller := newPoller(p, predictionID, 3*time.Second, 5*time.Minute, prog, j)
+	poller.Fetch = pollGet(client(p.Name, 30*time.Second), replicateBase(p)+"/predictions/"+predictionID, bearerAuth(p.APIKey))
+	poller.Parse = func(body []byte) (pollStatus, error) {
+		var prediction replicatePrediction
+		json.Unmarshal(body, &prediction)
+		switch prediction.Status {
+		case "succeeded":
+			if urls = prediction.outputURLs(); len(urls) == 0 {
+				return pollStatus{}, Errorf(ErrCodeMalformed, "解析结果失败: %s", string(body))
+			}
+			// 日志可能很长，输出和 urls 是图片地址，都不保存
+			meta = providerMeta(body, "output", "logs", "urls")
+			return pollStatus{Done: true}, nil
+		case "failed", "canceled":
+			return pollStatus{}, TaskFailedError(body)
+		}
+		return pollStatus{Stage: taskStage(prediction.Status)}, nil
+	}
+	poller.OnAbort = func() { cancelReplicatePrediction(p, predictionID) }
+	if err := poller.Wait(ctx); err != nil {
+		return nil, err
+	}
+	results, err := downloadAll(ctx, p, "replicate", urls, prog)
+	return attachMeta(results, meta), err
+}
+
+// cancelReplicatePrediction 取消仍在运行的预测，失败只记录日志
+func cancelReplicatePrediction(p Config, predictionID string) {
+	req, _ := http.NewRequest("POST", replicateBase(p)+"/predictions/"+predictionID+"/cancel", nil)
+	req.Header.Set("Authorization", "Bearer "+p.APIKey)
+	resp, err := client(p.Name, 10*time.Second).Do(req)
+	if err != nil {
+		log.Printf("[%s] 取消任务 %s 失败: %v", p.Name, predictionID, err)
+		return
+	}
+	resp.Body.Close()
+}
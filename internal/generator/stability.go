@@ -0,0 +1,98 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ========== Stability AI (v2beta stable-image) ==========
+
+func init() {
+	// Stability AI 直接返回图片数据，一次只出一张
+	register("stability", Capabilities{Seed: true}, func(ctx context.Context, req GenerateRequest) ([]*Image, error) {
+		return repeatGenerate(ctx, req.N, func() (*Image, error) { return generateStabilityImage(ctx, req) })
+	})
+}
+
+// stabilityAspectRatios stable-image 接口支持的宽高比，尺寸换算为最接近的一个
+var stabilityAspectRatios = []string{"21:9", "16:9", "3:2", "5:4", "1:1", "4:5", "2:3", "9:16", "9:21"}
+
+// stabilityEndpoint model 为 ultra、core 时调用对应接口，其他（如 sd3.5-large）调用 sd3 接口并传 model
+func stabilityEndpoint(p Config) (string, string) {
+	base := strings.TrimSuffix(p.URL, "/")
+	if base == "" {
+		base = "https://api.stability.ai/v2beta/stable-image/generate"
+	}
+	switch p.Model {
+	case "", "core":
+		return base + "/core", ""
+	case "ultra":
+		return base + "/ultra", ""
+	}
+	return base + "/sd3", p.Model
+}
+
+// generateStabilityImage 调用 stable-image 生成接口，multipart 表单提交，Accept: image/* 时直接返回图片数据
+// 接口一次只出一张图片
+func generateStabilityImage(ctx context.Context, req GenerateRequest) (*Image, error) {
+	p := req.Config
+	width, height, err := localSize(req.Size)
+	if err != nil {
+		return nil, err
+	}
+	apiURL, model := stabilityEndpoint(p)
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	w.WriteField("prompt", req.Prompt)
+	w.WriteField("aspect_ratio", nearestAspectRatio(width, height, stabilityAspectRatios))
+	w.WriteField("output_format", "png")
+	if model != "" {
+		w.WriteField("model", model)
+	}
+	if req.NegativePrompt != "" {
+		w.WriteField("negative_prompt", req.NegativePrompt)
+	}
+	if req.Seed != nil {
+		w.WriteField("seed", strconv.FormatInt(*req.Seed, 10))
+	}
+	w.Close()
+
+	httpReq, _ := http.NewRequestWithContext(ctx, "POST", apiURL, &body)
+	httpReq.Header.Set("Authorization", "Bearer "+p.APIKey)
+	httpReq.Header.Set("Content-Type", w.FormDataContentType())
+	httpReq.Header.Set("Accept", "image/*")
+	prog := progress(req.Progress)
+	prog.report("running", 20)
+
+	resp, data, err := DoWithRetry(client(p.Name, 120*time.Second), httpReq)
+	if err != nil {
+		return nil, RequestError("HTTP错误", err)
+	}
+	// 出错时返回 JSON，成功时响应体就是图片
+	if resp.StatusCode != 200 {
+		return nil, ResponseError("请求失败", resp.StatusCode, data)
+	}
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "image/") {
+		return nil, ResponseError("解析失败", resp.StatusCode, data)
+	}
+	// 命中内容审核时仍返回 200 和模糊处理后的图片，不作为生成结果
+	if reason := resp.Header.Get("Finish-Reason"); reason == "CONTENT_FILTERED" {
+		return nil, policyError(reason)
+	}
+	log.Printf("[%s] 生成完成，seed=%s", p.Name, resp.Header.Get("Seed"))
+	prog.report("downloading", 90)
+	r, err := saveImageData(p, "stability", data, 0)
+	if err != nil {
+		return nil, err
+	}
+	// 成功时响应体是图片，seed 和结束原因在响应头中
+	r.Meta = map[string]interface{}{"seed": resp.Header.Get("Seed"), "finish_reason": resp.Header.Get("Finish-Reason")}
+	return r, nil
+}
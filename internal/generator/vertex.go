@@ -0,0 +1,298 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ========== Google Vertex AI (Imagen) ==========
+
+func init() {
+	// Vertex AI Imagen 同步返回图片，服务账号鉴权
+	register("vertex", Capabilities{Seed: true}, generateVertexImage)
+}
+
+// vertexAspectRatios Imagen 支持的宽高比，尺寸换算为最接近的一个
+var vertexAspectRatios = []string{"1:1", "9:16", "16:9", "3:4", "4:3"}
+
+// gcpServiceAccount 服务账号 JSON 密钥中用到的字段
+type gcpServiceAccount struct {
+	ProjectID   string `json:"project_id"`
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+type gcpToken struct {
+	value   string
+	expires time.Time
+}
+
+// 按密钥文件缓存访问令牌，有效期 1 小时，提前 5 分钟刷新
+var (
+	gcpTokenMu    sync.Mutex
+	gcpTokenCache = map[string]gcpToken{}
+)
+
+func loadServiceAccount(file string) (*gcpServiceAccount, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, Errorf(ErrCodeAuth, "读取服务账号密钥失败: %v", err)
+	}
+	var sa gcpServiceAccount
+	if err := json.Unmarshal(data, &sa); err != nil || sa.ClientEmail == "" || sa.PrivateKey == "" {
+		return nil, Errorf(ErrCodeAuth, "服务账号密钥格式错误: %s", file)
+	}
+	if sa.TokenURI == "" {
+		sa.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+	return &sa, nil
+}
+
+// signJWT 用服务账号私钥（PKCS#8 PEM）生成 RS256 签名的 JWT
+func (sa *gcpServiceAccount) signJWT(now time.Time) (string, error) {
+	block, _ := pem.Decode([]byte(sa.PrivateKey))
+	if block == nil {
+		return "", Errorf(ErrCodeAuth, "服务账号私钥格式错误")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		if key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			return "", Errorf(ErrCodeAuth, "解析服务账号私钥失败: %v", err)
+		}
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return "", Errorf(ErrCodeAuth, "服务账号私钥不是 RSA 密钥")
+	}
+
+	enc := base64.RawURLEncoding
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   sa.ClientEmail,
+		"scope": "https://www.googleapis.com/auth/cloud-platform",
+		"aud":   sa.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	signing := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	sum := sha256.Sum256([]byte(signing))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", Errorf(ErrCodeAuth, "签名失败: %v", err)
+	}
+	return signing + "." + enc.EncodeToString(sig), nil
+}
+
+// serviceAccountToken 用服务账号换取 OAuth2 访问令牌（JWT bearer 授权），未过期时使用缓存
+func serviceAccountToken(ctx context.Context, p Config) (string, error) {
+	gcpTokenMu.Lock()
+	defer gcpTokenMu.Unlock()
+	if t, ok := gcpTokenCache[p.CredentialsFile]; ok && time.Until(t.expires) > 5*time.Minute {
+		return t.value, nil
+	}
+
+	sa, err := loadServiceAccount(p.CredentialsFile)
+	if err != nil {
+		return "", err
+	}
+	assertion, err := sa.signJWT(time.Now())
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, _ := http.NewRequestWithContext(ctx, "POST", sa.TokenURI, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, body, err := DoWithRetry(client(p.Name, 30*time.Second), req)
+	if err != nil {
+		return "", RequestError("获取访问令牌失败", err)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if resp.StatusCode != 200 || json.Unmarshal(body, &token) != nil || token.AccessToken == "" {
+		// 令牌接口的错误都是密钥或权限问题
+		return "", Errorf(ErrCodeAuth, "获取访问令牌失败 (HTTP %d): %s", resp.StatusCode, string(body))
+	}
+	gcpTokenCache[p.CredentialsFile] = gcpToken{
+		value:   token.AccessToken,
+		expires: time.Now().Add(time.Duration(token.ExpiresIn) * time.Second),
+	}
+	return token.AccessToken, nil
+}
+
+// vertexAuth 配置了服务账号密钥时使用 OAuth2 访问令牌，否则把 apiKey 作为 Bearer 令牌（如 gcloud auth print-access-token 的输出）
+func vertexAuth(ctx context.Context, p Config) (string, error) {
+	if p.CredentialsFile != "" {
+		return serviceAccountToken(ctx, p)
+	}
+	return p.APIKey, nil
+}
+
+// vertexEndpoint 模型的 predict 地址；project 为空时使用服务账号所属的项目
+func vertexEndpoint(p Config) (string, error) {
+	region := p.Region
+	if region == "" {
+		region = "us-central1"
+	}
+	project := p.Project
+	if project == "" && p.CredentialsFile != "" {
+		if sa, err := loadServiceAccount(p.CredentialsFile); err == nil {
+			project = sa.ProjectID
+		}
+	}
+	if project == "" {
+		return "", Errorf(ErrCodeInvalid, "未配置 Vertex AI 项目: %s", p.Name)
+	}
+	base := strings.TrimSuffix(p.URL, "/")
+	if base == "" {
+		base = fmt.Sprintf("https://%s-aiplatform.googleapis.com/v1", region)
+	}
+	model := p.Model
+	if model == "" {
+		model = "imagegeneration@006"
+	}
+	return fmt.Sprintf("%s/projects/%s/locations/%s/publishers/google/models/%s:predict", base, project, region, model), nil
+}
+
+// generateVertexImage 调用 Vertex AI 的 Imagen 模型（imagegeneration@006、imagen-3.0-generate-001 等），
+// 同步返回 base64 编码的图片；一次请求最多出 4 张，n 大于 4 时分多次请求
+func generateVertexImage(ctx context.Context, req GenerateRequest) ([]*Image, error) {
+	p := req.Config
+	width, height, err := localSize(req.Size)
+	if err != nil {
+		return nil, err
+	}
+	apiURL, err := vertexEndpoint(p)
+	if err != nil {
+		return nil, err
+	}
+	token, err := vertexAuth(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	parameters := map[string]interface{}{
+		"aspectRatio":      nearestAspectRatio(width, height, vertexAspectRatios),
+		"includeRaiReason": true,
+	}
+	if req.NegativePrompt != "" {
+		parameters["negativePrompt"] = req.NegativePrompt
+	}
+	if req.Seed != nil {
+		// 开启水印时不能指定 seed
+		parameters["seed"] = *req.Seed
+		parameters["addWatermark"] = false
+	}
+	progress(req.Progress).report("running", 20)
+
+	var (
+		results []*Image
+		lastErr error
+	)
+	for remaining := req.N; remaining > 0; remaining -= 4 {
+		parameters["sampleCount"] = min(remaining, 4)
+		batch, err := vertexPredict(ctx, p, apiURL, token, req.Prompt, parameters, len(results))
+		results = append(results, batch...)
+		if err != nil {
+			lastErr = err
+			if ErrorCode(err) == ErrCodeCanceled {
+				break
+			}
+		}
+	}
+	if len(results) > 0 {
+		log.Printf("[%s] 生成完成 %d 张", p.Name, len(results))
+		return results, nil
+	}
+	return nil, lastErr
+}
+
+// vertexPredict 调用一次 predict，offset 为已生成的张数，用于文件序号；被安全过滤的图片不会返回
+func vertexPredict(ctx context.Context, p Config, apiURL, token, prompt string, parameters map[string]interface{}, offset int) ([]*Image, error) {
+	reqBody, _ := json.Marshal(map[string]interface{}{
+		"instances":  []map[string]string{{"prompt": prompt}},
+		"parameters": parameters,
+	})
+	req, _ := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewReader(reqBody))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, body, err := DoWithRetry(client(p.Name, 120*time.Second), req)
+	if err != nil {
+		return nil, RequestError("HTTP错误", err)
+	}
+	if resp.StatusCode != 200 {
+		if resp.StatusCode == 401 && p.CredentialsFile != "" {
+			// 令牌被吊销或服务账号变更，下次请求重新换取
+			gcpTokenMu.Lock()
+			delete(gcpTokenCache, p.CredentialsFile)
+			gcpTokenMu.Unlock()
+		}
+		return nil, ResponseError("请求失败", resp.StatusCode, body)
+	}
+	var result struct {
+		Predictions []struct {
+			BytesBase64Encoded string `json:"bytesBase64Encoded"`
+			RaiFilteredReason  string `json:"raiFilteredReason"`
+		} `json:"predictions"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, ResponseError("解析失败", resp.StatusCode, body)
+	}
+	// 每条 prediction 中的 prompt（开启 enhancePrompt 时为改写后的提示词）等字段按原样保存
+	var raw struct {
+		Predictions []json.RawMessage `json:"predictions"`
+	}
+	json.Unmarshal(body, &raw)
+
+	var (
+		results []*Image
+		lastErr error
+	)
+	for i, pred := range result.Predictions {
+		if pred.BytesBase64Encoded == "" {
+			if pred.RaiFilteredReason != "" {
+				lastErr = policyError(pred.RaiFilteredReason)
+			}
+			continue
+		}
+		data, err := base64.StdEncoding.DecodeString(pred.BytesBase64Encoded)
+		if err != nil {
+			lastErr = Errorf(ErrCodeMalformed, "图片解码失败: %v", err)
+			continue
+		}
+		r, err := saveImageData(p, "vertex", data, offset+len(results))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		r.Meta = providerMeta(raw.Predictions[i])
+		results = append(results, r)
+	}
+	if len(results) == 0 && lastErr == nil {
+		// 全部被过滤时 predictions 为空
+		lastErr = policyError(providerReason(body))
+	}
+	return results, lastErr
+}
@@ -0,0 +1,151 @@
+package moderation
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+)
+
+// Moderator 自动审核服务接口
+// Check 返回 0-1 的得分，越高越适合发布
+type Moderator interface {
+	Name() string
+	Check(ctx context.Context, img Image) (*Result, error)
+}
+
+// Image 待审核的图片
+type Image struct {
+	ID     uint
+	Path   string
+	Prompt string
+}
+
+// Result 单个审核服务的结果
+type Result struct {
+	Score  float64  `json:"score"`
+	Reason string   `json:"reason,omitempty"`
+	Labels []string `json:"labels,omitempty"` // 命中的违规标签
+}
+
+// Mode 多个审核服务的组合方式
+type Mode string
+
+const (
+	ModeAll      Mode = "all"      // 每个服务的得分都达到其阈值才通过，总得分取最低分
+	ModeWeighted Mode = "weighted" // 总得分为各服务得分的加权平均，达到总阈值通过
+)
+
+// Check 单个审核服务的结果，出错时 Error 不为空
+type Check struct {
+	Moderator string   `json:"moderator"`
+	Score     float64  `json:"score"`
+	Passed    bool     `json:"passed"`
+	Reason    string   `json:"reason,omitempty"`
+	Labels    []string `json:"labels,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// Verdict 组合后的审核结论
+type Verdict struct {
+	Score  float64 `json:"score"`
+	Passed bool    `json:"passed"`
+	Checks []Check `json:"checks"`
+}
+
+// Reason 各服务的结论摘要
+func (v *Verdict) Reason() string {
+	parts := make([]string, 0, len(v.Checks))
+	for _, c := range v.Checks {
+		switch {
+		case c.Error != "":
+			parts = append(parts, fmt.Sprintf("%s 失败: %s", c.Moderator, c.Error))
+		case c.Reason != "":
+			parts = append(parts, fmt.Sprintf("%s %.2f: %s", c.Moderator, c.Score, c.Reason))
+		default:
+			parts = append(parts, fmt.Sprintf("%s %.2f", c.Moderator, c.Score))
+		}
+	}
+	return strings.Join(parts, "；")
+}
+
+// registered 已注册的审核服务及其权重和阈值
+type registered struct {
+	moderator Moderator
+	weight    float64
+	threshold float64
+}
+
+// Manager 审核管理器，按注册顺序依次调用各审核服务
+type Manager struct {
+	mode       Mode
+	threshold  float64
+	moderators []registered
+}
+
+// New 创建审核管理器，threshold 为 weighted 模式的总通过分数
+func New(mode Mode, threshold float64) *Manager {
+	if mode == "" {
+		mode = ModeAll
+	}
+	return &Manager{mode: mode, threshold: threshold}
+}
+
+// Register 注册审核服务，weight 为 weighted 模式的权重，threshold 为该服务判定通过的最低得分
+func (m *Manager) Register(mod Moderator, weight, threshold float64) {
+	m.moderators = append(m.moderators, registered{moderator: mod, weight: weight, threshold: threshold})
+	log.Printf("🛡️ 已注册审核服务: %s", mod.Name())
+}
+
+// List 列出所有审核服务
+func (m *Manager) List() []Moderator {
+	result := make([]Moderator, 0, len(m.moderators))
+	for _, r := range m.moderators {
+		result = append(result, r.moderator)
+	}
+	return result
+}
+
+// Check 依次调用各审核服务并组合结论
+// all 模式下任一服务出错即不通过；weighted 模式下出错的服务不计入加权，全部出错时返回错误
+func (m *Manager) Check(ctx context.Context, img Image) (*Verdict, error) {
+	if len(m.moderators) == 0 {
+		return nil, fmt.Errorf("未配置审核服务")
+	}
+	v := &Verdict{Passed: true, Score: 1}
+	var weighted, weights float64
+	var lastErr error
+	for _, r := range m.moderators {
+		c := Check{Moderator: r.moderator.Name()}
+		res, err := r.moderator.Check(ctx, img)
+		if err != nil {
+			c.Error = err.Error()
+			lastErr = fmt.Errorf("%s: %w", c.Moderator, err)
+			if m.mode == ModeAll {
+				v.Passed = false
+			}
+			v.Checks = append(v.Checks, c)
+			continue
+		}
+		c.Score = math.Max(0, math.Min(1, res.Score))
+		c.Passed = c.Score >= r.threshold
+		c.Reason, c.Labels = res.Reason, res.Labels
+		v.Checks = append(v.Checks, c)
+
+		weighted += c.Score * r.weight
+		weights += r.weight
+		if m.mode == ModeAll {
+			v.Score = math.Min(v.Score, c.Score)
+			v.Passed = v.Passed && c.Passed
+		}
+	}
+	if weights == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	if m.mode == ModeWeighted {
+		v.Score = weighted / weights
+		v.Passed = v.Score >= m.threshold
+	}
+	return v, nil
+}
@@ -0,0 +1,321 @@
+package moderation
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"image-platform/internal/requestid"
+)
+
+// ========== 阿里云内容安全 ==========
+
+// AliyunGreen 阿里云内容安全增强版图片审核（ImageModeration），按风险等级给分
+// 接口只接受图片 URL，本地图片通过 ImageURL 上传到图床后再审核
+type AliyunGreen struct {
+	name      string
+	endpoint  string
+	service   string
+	accessKey string
+	secretKey string
+	imageURL  func(ctx context.Context, path string) (string, error)
+	client    *http.Client
+}
+
+// NewAliyunGreen 创建阿里云内容安全审核，service 为检测服务（默认 baselineCheck），endpoint 为空时使用上海地域
+func NewAliyunGreen(name, endpoint, service, accessKey, secretKey string, imageURL func(ctx context.Context, path string) (string, error)) *AliyunGreen {
+	if name == "" {
+		name = "阿里云内容安全"
+	}
+	if endpoint == "" {
+		endpoint = "https://green-cip.cn-shanghai.aliyuncs.com"
+	}
+	if service == "" {
+		service = "baselineCheck"
+	}
+	return &AliyunGreen{
+		name: name, endpoint: strings.TrimSuffix(endpoint, "/"), service: service,
+		accessKey: accessKey, secretKey: secretKey, imageURL: imageURL,
+		client: requestid.Client(30 * time.Second),
+	}
+}
+
+func (a *AliyunGreen) Name() string { return a.name }
+
+// greenRiskScores 风险等级对应的得分
+var greenRiskScores = map[string]float64{"none": 1, "low": 0.7, "medium": 0.4, "high": 0}
+
+func (a *AliyunGreen) Check(ctx context.Context, img Image) (*Result, error) {
+	if a.accessKey == "" || a.secretKey == "" {
+		return nil, fmt.Errorf("未配置 AccessKey")
+	}
+	if a.imageURL == nil {
+		return nil, fmt.Errorf("未配置图床，无法获取图片外链")
+	}
+	imgURL, err := a.imageURL(ctx, img.Path)
+	if err != nil {
+		return nil, err
+	}
+	serviceParams, _ := json.Marshal(map[string]string{"imageUrl": imgURL, "dataId": fmt.Sprint(img.ID)})
+
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	params := map[string]string{
+		"Action":            "ImageModeration",
+		"Format":            "JSON",
+		"Version":           "2022-03-02",
+		"AccessKeyId":       a.accessKey,
+		"SignatureMethod":   "HMAC-SHA1",
+		"SignatureVersion":  "1.0",
+		"SignatureNonce":    hex.EncodeToString(nonce),
+		"Timestamp":         time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+		"Service":           a.service,
+		"ServiceParameters": string(serviceParams),
+	}
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = aliyunEscape(k) + "=" + aliyunEscape(params[k])
+	}
+	canonical := strings.Join(pairs, "&")
+	mac := hmac.New(sha1.New, []byte(a.secretKey+"&"))
+	mac.Write([]byte("POST&%2F&" + aliyunEscape(canonical)))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	req, _ := http.NewRequestWithContext(ctx, "POST", a.endpoint+"/", strings.NewReader(canonical+"&Signature="+aliyunEscape(signature)))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	body, err := doJSON(a.client, req)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Code int    `json:"Code"`
+		Msg  string `json:"Msg"`
+		Data struct {
+			RiskLevel string `json:"RiskLevel"`
+			Result    []struct {
+				Label       string  `json:"Label"`
+				Confidence  float64 `json:"Confidence"`
+				Description string  `json:"Description"`
+			} `json:"Result"`
+		} `json:"Data"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %s", string(body))
+	}
+	if resp.Code != 200 {
+		return nil, fmt.Errorf("审核失败 (%d): %s", resp.Code, resp.Msg)
+	}
+	score, ok := greenRiskScores[strings.ToLower(resp.Data.RiskLevel)]
+	if !ok {
+		return nil, fmt.Errorf("未知风险等级: %s", resp.Data.RiskLevel)
+	}
+	result := &Result{Score: score, Reason: "风险等级 " + resp.Data.RiskLevel}
+	for _, r := range resp.Data.Result {
+		if r.Label != "" && r.Label != "nonLabel" {
+			result.Labels = append(result.Labels, r.Label)
+		}
+	}
+	return result, nil
+}
+
+// aliyunEscape 阿里云 RPC 签名要求的 URL 编码
+func aliyunEscape(s string) string {
+	s = url.QueryEscape(s)
+	s = strings.ReplaceAll(s, "+", "%20")
+	s = strings.ReplaceAll(s, "*", "%2A")
+	return strings.ReplaceAll(s, "%7E", "~")
+}
+
+// ========== AWS Rekognition ==========
+
+// Rekognition 调用 DetectModerationLabels，得分为 1 - 最高违规标签置信度
+type Rekognition struct {
+	name      string
+	region    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+}
+
+// NewRekognition 创建 Rekognition 审核，使用 SigV4 签名
+func NewRekognition(name, region, accessKey, secretKey string) *Rekognition {
+	if name == "" {
+		name = "AWS Rekognition"
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+	return &Rekognition{name: name, region: region, accessKey: accessKey, secretKey: secretKey, client: requestid.Client(30 * time.Second)}
+}
+
+func (r *Rekognition) Name() string { return r.name }
+
+func (r *Rekognition) Check(ctx context.Context, img Image) (*Result, error) {
+	if r.accessKey == "" || r.secretKey == "" {
+		return nil, fmt.Errorf("未配置 AccessKey")
+	}
+	data, err := os.ReadFile(img.Path)
+	if err != nil {
+		return nil, fmt.Errorf("读取图片失败: %w", err)
+	}
+	// 接口直接传图片时上限 5MB
+	if len(data) > 5<<20 {
+		return nil, fmt.Errorf("图片超过 5MB")
+	}
+	payload, _ := json.Marshal(map[string]interface{}{
+		"Image":         map[string]string{"Bytes": base64.StdEncoding.EncodeToString(data)},
+		"MinConfidence": 50,
+	})
+	host := "rekognition." + r.region + ".amazonaws.com"
+	req, _ := http.NewRequestWithContext(ctx, "POST", "https://"+host+"/", bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "RekognitionService.DetectModerationLabels")
+	r.sign(req, host, payload, time.Now())
+
+	body, err := doJSON(r.client, req)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		ModerationLabels []struct {
+			Name       string  `json:"Name"`
+			ParentName string  `json:"ParentName"`
+			Confidence float64 `json:"Confidence"`
+		} `json:"ModerationLabels"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %s", string(body))
+	}
+	result := &Result{Score: 1}
+	for _, l := range resp.ModerationLabels {
+		result.Score = min(result.Score, 1-l.Confidence/100)
+		if l.ParentName == "" {
+			result.Labels = append(result.Labels, l.Name)
+		}
+	}
+	if len(result.Labels) > 0 {
+		result.Reason = "命中 " + strings.Join(result.Labels, ", ")
+	}
+	return result, nil
+}
+
+// sign AWS SigV4 签名，签名覆盖 content-type、host、x-amz-date、x-amz-target
+func (r *Rekognition) sign(req *http.Request, host string, payload []byte, t time.Time) {
+	amzDate := t.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	signedHeaders := "content-type;host;x-amz-date;x-amz-target"
+	payloadHash := sha256.Sum256(payload)
+	canonical := strings.Join([]string{
+		"POST", "/", "",
+		"content-type:" + req.Header.Get("Content-Type") + "\nhost:" + host + "\nx-amz-date:" + amzDate + "\nx-amz-target:" + req.Header.Get("X-Amz-Target") + "\n",
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	scope := date + "/" + r.region + "/rekognition/aws4_request"
+	canonicalHash := sha256.Sum256([]byte(canonical))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	hmacSHA256 := func(key []byte, msg string) []byte {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(msg))
+		return mac.Sum(nil)
+	}
+	key := hmacSHA256([]byte("AWS4"+r.secretKey), date)
+	key = hmacSHA256(key, r.region)
+	key = hmacSHA256(key, "rekognition")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", r.accessKey, scope, signedHeaders, signature))
+}
+
+// ========== 本地 NSFW 模型 ==========
+
+// NSFW 调用本地部署的 NSFW 分类服务（如 opennsfw2、nsfw_model 的 HTTP 封装），得分为 1 - NSFW 概率
+// 图片以 multipart 的 image 字段上传，响应 JSON 中 scoreField 字段为 0-1 的 NSFW 概率
+type NSFW struct {
+	name       string
+	url        string
+	scoreField string
+	client     *http.Client
+}
+
+// NewNSFW 创建本地 NSFW 审核，scoreField 默认 nsfw
+func NewNSFW(name, url, scoreField string) *NSFW {
+	if name == "" {
+		name = "NSFW"
+	}
+	if scoreField == "" {
+		scoreField = "nsfw"
+	}
+	return &NSFW{name: name, url: url, scoreField: scoreField, client: requestid.Client(30 * time.Second)}
+}
+
+func (n *NSFW) Name() string { return n.name }
+
+func (n *NSFW) Check(ctx context.Context, img Image) (*Result, error) {
+	f, err := os.Open(img.Path)
+	if err != nil {
+		return nil, fmt.Errorf("读取图片失败: %w", err)
+	}
+	defer f.Close()
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	part, _ := w.CreateFormFile("image", filepath.Base(img.Path))
+	if _, err := io.Copy(part, f); err != nil {
+		return nil, fmt.Errorf("读取图片失败: %w", err)
+	}
+	w.Close()
+
+	req, _ := http.NewRequestWithContext(ctx, "POST", n.url, &buf)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	body, err := doJSON(n.client, req)
+	if err != nil {
+		return nil, err
+	}
+	var resp map[string]interface{}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %s", string(body))
+	}
+	prob, ok := resp[n.scoreField].(float64)
+	if !ok {
+		return nil, fmt.Errorf("响应中没有 %s 字段: %s", n.scoreField, string(body))
+	}
+	return &Result{Score: 1 - prob, Reason: fmt.Sprintf("NSFW 概率 %.2f", prob)}, nil
+}
+
+// doJSON 发送请求并读取响应体，非 2xx 时返回错误
+func doJSON(client *http.Client, req *http.Request) ([]byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
+	}
+	return body, nil
+}
@@ -0,0 +1,143 @@
+package publisher
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"image-platform/internal/requestid"
+)
+
+const PlatformImageHost PlatformType = "imagehost"
+
+// ImageHost 图床，上传图片并返回外链地址
+// 也作为需要公网图片 URL 的平台（如 Instagram、部分 CMS）的依赖，见 URLPublisher
+type ImageHost struct {
+	Provider  string // smms, imgur, custom
+	APIURL    string
+	Token     string
+	FileField string // custom 图床的文件字段名，默认 file
+	URLPath   string // custom 图床响应中外链的 JSON 路径，如 data.url
+}
+
+func NewImageHost(provider, apiURL, token, fileField, urlPath string) *ImageHost {
+	h := &ImageHost{Provider: provider, APIURL: apiURL, Token: token, FileField: fileField, URLPath: urlPath}
+	switch provider {
+	case "smms":
+		if h.APIURL == "" {
+			h.APIURL = "https://sm.ms/api/v2/upload"
+		}
+		h.FileField = "smfile"
+	case "imgur":
+		if h.APIURL == "" {
+			h.APIURL = "https://api.imgur.com/3/image"
+		}
+		h.FileField = "image"
+	default:
+		if h.FileField == "" {
+			h.FileField = "file"
+		}
+	}
+	return h
+}
+
+func (p *ImageHost) Name() string       { return "图床(" + p.Provider + ")" }
+func (p *ImageHost) Type() PlatformType { return PlatformImageHost }
+
+// Publish 上传到图床，返回外链
+func (p *ImageHost) Publish(ctx context.Context, imgPath, title, content string) (string, error) {
+	return p.Upload(ctx, imgPath)
+}
+
+// Upload 上传图片，返回外链
+func (p *ImageHost) Upload(ctx context.Context, imgPath string) (string, error) {
+	log.Printf("[%s] 上传: %s", p.Name(), imgPath)
+	if p.APIURL == "" {
+		return "", fmt.Errorf("未配置图床 API URL")
+	}
+	file, err := os.Open(imgPath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile(p.FileField, filepath.Base(imgPath))
+	if err != nil {
+		return "", err
+	}
+	io.Copy(part, file)
+	writer.Close()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.APIURL, body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if p.Token != "" {
+		switch p.Provider {
+		case "imgur":
+			req.Header.Set("Authorization", "Client-ID "+p.Token)
+		case "smms":
+			req.Header.Set("Authorization", p.Token)
+		default:
+			req.Header.Set("Authorization", "Bearer "+p.Token)
+		}
+	}
+
+	client := requestid.Client(60 * time.Second)
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 400 {
+		return "", fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	var result map[string]interface{}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return "", fmt.Errorf("解析响应失败: %s", string(respBody))
+	}
+	var url string
+	switch p.Provider {
+	case "smms":
+		url = jsonString(result, "data.url")
+		if url == "" && jsonString(result, "code") == "image_repeated" {
+			url = jsonString(result, "images") // 重复上传时返回已有图片地址
+		}
+	case "imgur":
+		url = jsonString(result, "data.link")
+	default:
+		url = jsonString(result, p.URLPath)
+	}
+	if url == "" {
+		return "", fmt.Errorf("响应中没有外链: %s", string(respBody))
+	}
+	return url, nil
+}
+
+// jsonString 按点分路径取 JSON 中的字符串值
+func jsonString(data map[string]interface{}, path string) string {
+	var cur interface{} = data
+	for _, key := range strings.Split(path, ".") {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		cur = m[key]
+	}
+	s, _ := cur.(string)
+	return s
+}
@@ -1,7 +1,9 @@
 package publisher
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
@@ -11,6 +13,8 @@ import (
 	"path/filepath"
 	"strings"
 	"time"
+
+	"image-platform/internal/requestid"
 )
 
 // Xiaohongshu 小红书平台
@@ -42,6 +46,11 @@ func (p *Xiaohongshu) Type() PlatformType {
 	return PlatformXiaohongshu
 }
 
+// PreferredFormat 小红书会二次压缩，上传无损 PNG 画质更好
+func (p *Xiaohongshu) PreferredFormat() ImageFormat {
+	return ImageFormat{Format: "png"}
+}
+
 // Publish 发布图片到小红书
 func (p *Xiaohongshu) Publish(ctx context.Context, imgPath, title, content string) (string, error) {
 	log.Printf("[小红书] 开始发布: %s", imgPath)
@@ -67,8 +76,28 @@ func (p *Xiaohongshu) Publish(ctx context.Context, imgPath, title, content strin
 	return "发布成功", nil
 }
 
-// publishViaMCP 通过 MCP 发布
-func (p *Xiaohongshu) publishViaMCP(imgPath, title, content string) error {
+// PublishImages 发布多图笔记，第一张为封面，小红书单篇最多 18 张
+func (p *Xiaohongshu) PublishImages(ctx context.Context, imgPaths []string, title, content string) (string, error) {
+	log.Printf("[小红书] 开始发布多图笔记: %d 张", len(imgPaths))
+	if len(imgPaths) > 18 {
+		return "", fmt.Errorf("小红书单篇最多 18 张图片，当前 %d 张", len(imgPaths))
+	}
+	for _, imgPath := range imgPaths {
+		if _, err := os.Stat(imgPath); err != nil {
+			return "", fmt.Errorf("打开图片失败: %w", err)
+		}
+	}
+
+	if err := p.publishViaMCP(imgPaths[0], title, content, imgPaths[1:]...); err != nil {
+		return "", fmt.Errorf("发布失败: %w", err)
+	}
+
+	log.Printf("[小红书] 发布成功")
+	return "发布成功", nil
+}
+
+// publishViaMCP 通过 MCP 发布，more 为封面之后的图片
+func (p *Xiaohongshu) publishViaMCP(imgPath, title, content string, more ...string) error {
 	// 构建 MCP 请求
 	// 注意：实际 MCP 接口格式需要根据具体实现
 	req, err := http.NewRequest("POST", p.APIURL+"/publish", nil)
@@ -85,11 +114,73 @@ func (p *Xiaohongshu) publishViaMCP(imgPath, title, content string) error {
 	}
 
 	// 这里简化处理，实际需要根据 MCP 接口格式
-	log.Printf("[小红书] 调用 MCP 发布图片: %s", filepath.Base(imgPath))
+	log.Printf("[小红书] 调用 MCP 发布图片: %s（另 %d 张）", filepath.Base(imgPath), len(more))
 	
 	return nil
 }
 
+// TestCredentials 通过 MCP 的 check_login_status 工具检测登录状态
+func (p *Xiaohongshu) TestCredentials(ctx context.Context) (string, error) {
+	reqBody, _ := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "tools/call",
+		"params": map[string]interface{}{
+			"name":      "check_login_status",
+			"arguments": map[string]interface{}{},
+		},
+	})
+	req, err := http.NewRequestWithContext(ctx, "POST", p.APIURL, bytes.NewReader(reqBody))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	if p.Cookies != "" {
+		req.Header.Set("Cookie", p.Cookies)
+	}
+	if p.XSecToken != "" {
+		req.Header.Set("X-Sec-Token", p.XSecToken)
+	}
+
+	client := requestid.Client(15 * time.Second)
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("连接 MCP 失败: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 200 {
+		return "", fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		Result struct {
+			Content []struct {
+				Text string `json:"text"`
+			} `json:"content"`
+			IsError bool `json:"isError"`
+		} `json:"result"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("解析响应失败: %s", string(body))
+	}
+	if result.Error != nil {
+		return "", fmt.Errorf("MCP 错误: %s", result.Error.Message)
+	}
+	text := ""
+	if len(result.Result.Content) > 0 {
+		text = result.Result.Content[0].Text
+	}
+	if result.Result.IsError || strings.Contains(text, "未登录") {
+		return "", fmt.Errorf("未登录: %s", text)
+	}
+	return text, nil
+}
+
 // SetCookies 设置 Cookies
 func (p *Xiaohongshu) SetCookies(cookies string) {
 	p.Cookies = cookies
@@ -137,78 +228,160 @@ func (p *Bilibili) Publish(ctx context.Context, imgPath, title, content string)
 	return "B站发布功能开发中", nil
 }
 
-// CustomPlatform 自定义平台
+// TestCredentials 调用 B站 nav 接口检测 Cookie 是否有效
+func (p *Bilibili) TestCredentials(ctx context.Context) (string, error) {
+	if p.Cookie == "" {
+		return "", fmt.Errorf("未配置 Cookie")
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", "https://api.bilibili.com/x/web-interface/nav", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Cookie", p.Cookie)
+	req.Header.Set("User-Agent", "Mozilla/5.0")
+
+	client := requestid.Client(15 * time.Second)
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	var result struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Data    struct {
+			IsLogin bool   `json:"isLogin"`
+			Uname   string `json:"uname"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("解析响应失败: %s", string(body))
+	}
+	if result.Code != 0 || !result.Data.IsLogin {
+		return "", fmt.Errorf("Cookie 已失效: %s", result.Message)
+	}
+	return result.Data.Uname, nil
+}
+
+// CustomPlatform 自定义平台，通过 HTTP 接口发布（如自建站点、CMS）
+// 发布为 POST multipart（image、title、content），修改为 PUT，额外携带 post 字段标识已发布的内容
+// 多图发布时封面之后的图片按顺序以 images 字段上传
 type CustomPlatform struct {
 	NameVal    string
 	TypeVal    PlatformType
 	APIURL     string
 	AuthHeader string
+	RefPath    string // 响应中内容标识（ID 或链接）的 JSON 路径，如 data.url，修改已发布内容时使用
 }
 
-func NewCustomPlatform(name string, ptype PlatformType, apiURL, authHeader string) *CustomPlatform {
+func NewCustomPlatform(name string, ptype PlatformType, apiURL, authHeader, refPath string) *CustomPlatform {
 	return &CustomPlatform{
 		NameVal:    name,
 		TypeVal:    ptype,
 		APIURL:     apiURL,
 		AuthHeader: authHeader,
+		RefPath:    refPath,
 	}
 }
 
-func (p *CustomPlatform) Name() string   { return p.NameVal }
+func (p *CustomPlatform) Name() string       { return p.NameVal }
 func (p *CustomPlatform) Type() PlatformType { return p.TypeVal }
 
 func (p *CustomPlatform) Publish(ctx context.Context, imgPath, title, content string) (string, error) {
 	log.Printf("[%s] 发布: %s", p.NameVal, imgPath)
-	
-	// 通用 HTTP 发布
+	return p.send(ctx, "POST", "", imgPath, title, content)
+}
+
+// PublishImages 多图发布，第一张作为 image 上传，其余按顺序作为 images
+func (p *CustomPlatform) PublishImages(ctx context.Context, imgPaths []string, title, content string) (string, error) {
+	log.Printf("[%s] 多图发布: %d 张", p.NameVal, len(imgPaths))
+	return p.send(ctx, "POST", "", imgPaths[0], title, content, imgPaths[1:]...)
+}
+
+// UpdatePost 修改已发布的内容，imgPath 为空时不替换图片
+func (p *CustomPlatform) UpdatePost(ctx context.Context, postRef, imgPath, title, content string) (string, error) {
+	log.Printf("[%s] 修改已发布内容: %s", p.NameVal, postRef)
+	return p.send(ctx, "PUT", postRef, imgPath, title, content)
+}
+
+func (p *CustomPlatform) send(ctx context.Context, method, postRef, imgPath, title, content string, more ...string) (string, error) {
 	if p.APIURL == "" {
 		return "", fmt.Errorf("未配置 API URL")
 	}
 
-	client := &http.Client{Timeout: 30 * time.Second}
-	
-	// 读取图片
-	file, err := os.Open(imgPath)
-	if err != nil {
-		return "", err
-	}
-	defer file.Close()
-
 	// 构建 multipart 请求
-	body := &strings.Builder{}
+	body := &bytes.Buffer{}
 	writer := multipart.NewWriter(body)
-	
-	// 添加图片
-	part, err := writer.CreateFormFile("image", filepath.Base(imgPath))
-	if err != nil {
-		return "", err
+	if imgPath != "" {
+		file, err := os.Open(imgPath)
+		if err != nil {
+			return "", err
+		}
+		defer file.Close()
+		part, err := writer.CreateFormFile("image", filepath.Base(imgPath))
+		if err != nil {
+			return "", err
+		}
+		io.Copy(part, file)
+	}
+	for _, extra := range more {
+		if err := attachFile(writer, "images", extra); err != nil {
+			return "", err
+		}
+	}
+	if postRef != "" {
+		writer.WriteField("post", postRef)
 	}
-	io.Copy(part, file)
-	
-	// 添加其他字段
 	writer.WriteField("title", title)
 	writer.WriteField("content", content)
 	writer.Close()
 
-	req, err := http.NewRequest("POST", p.APIURL, strings.NewReader(body.String()))
+	req, err := http.NewRequestWithContext(ctx, method, p.APIURL, body)
 	if err != nil {
 		return "", err
 	}
-	
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 	if p.AuthHeader != "" {
 		req.Header.Set("Authorization", p.AuthHeader)
 	}
 
+	client := requestid.Client(30 * time.Second)
 	resp, err := client.Do(req)
 	if err != nil {
 		return "", err
 	}
 	defer resp.Body.Close()
-
+	respBody, _ := io.ReadAll(resp.Body)
 	if resp.StatusCode >= 400 {
-		return "", fmt.Errorf("HTTP %d", resp.StatusCode)
+		return "", fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(respBody))
 	}
 
+	// 返回内容标识，后续修改时作为 post 字段传回；未配置或取不到时沿用原标识
+	var result map[string]interface{}
+	if p.RefPath != "" && json.Unmarshal(respBody, &result) == nil {
+		if ref := jsonString(result, p.RefPath); ref != "" {
+			return ref, nil
+		}
+	}
+	if postRef != "" {
+		return postRef, nil
+	}
 	return "发布成功", nil
 }
+
+// attachFile 把文件作为 multipart 的一个文件字段写入
+func attachFile(writer *multipart.Writer, field, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	part, err := writer.CreateFormFile(field, filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(part, file)
+	return err
+}
@@ -13,6 +13,41 @@ type Platform interface {
 	Type() PlatformType
 }
 
+// CredentialTester 支持凭证检测的平台实现该接口
+// TestCredentials 执行一次无副作用的鉴权调用，返回当前登录的账号名
+type CredentialTester interface {
+	TestCredentials(ctx context.Context) (string, error)
+}
+
+// URLPublisher 只接受公网图片 URL 的平台实现该接口
+// Manager 发布时先通过图床上传拿到外链，再调用 PublishURL
+type URLPublisher interface {
+	PublishURL(ctx context.Context, imageURL, title, content string) (string, error)
+}
+
+// MultiImagePublisher 支持一篇内容带多张图片（如小红书图文笔记）的平台实现该接口
+// imgPaths 按展示顺序排列，第一张为封面
+type MultiImagePublisher interface {
+	PublishImages(ctx context.Context, imgPaths []string, title, content string) (string, error)
+}
+
+// PostEditor 支持修改已发布内容的平台实现该接口
+// postRef 为 Publish 返回的内容标识，imgPath 为空时只修改标题和正文
+type PostEditor interface {
+	UpdatePost(ctx context.Context, postRef, imgPath, title, content string) (string, error)
+}
+
+// ImageFormat 平台偏好的图片格式，Quality 只用于 jpeg（1-100）
+type ImageFormat struct {
+	Format  string // png, jpeg
+	Quality int
+}
+
+// FormatPreferrer 对图片格式有要求的平台实现该接口，发布前按该格式转码
+type FormatPreferrer interface {
+	PreferredFormat() ImageFormat
+}
+
 // PlatformType 平台类型
 type PlatformType string
 
@@ -27,6 +62,7 @@ const (
 // Manager 发布管理器
 type Manager struct {
 	platforms map[PlatformType]Platform
+	imageHost *ImageHost
 }
 
 // New 创建发布管理器
@@ -39,6 +75,9 @@ func New() *Manager {
 // Register 注册平台
 func (m *Manager) Register(p Platform) {
 	m.platforms[p.Type()] = p
+	if h, ok := p.(*ImageHost); ok {
+		m.imageHost = h
+	}
 	log.Printf("📤 已注册发布平台: %s", p.Name())
 }
 
@@ -62,9 +101,84 @@ func (m *Manager) Publish(platformType PlatformType, ctx context.Context, imgPat
 	if !ok {
 		return "", fmt.Errorf("未支持的平台: %s", platformType)
 	}
+	if up, ok := p.(URLPublisher); ok {
+		url, err := m.HostedURL(ctx, imgPath)
+		if err != nil {
+			return "", err
+		}
+		return up.PublishURL(ctx, url, title, content)
+	}
 	return p.Publish(ctx, imgPath, title, content)
 }
 
+// PublishImages 以一篇多图内容发布到指定平台，平台不支持多图时返回错误
+func (m *Manager) PublishImages(platformType PlatformType, ctx context.Context, imgPaths []string, title, content string) (string, error) {
+	p, ok := m.platforms[platformType]
+	if !ok {
+		return "", fmt.Errorf("未支持的平台: %s", platformType)
+	}
+	mp, ok := p.(MultiImagePublisher)
+	if !ok {
+		return "", fmt.Errorf("%s 不支持多图发布", p.Name())
+	}
+	return mp.PublishImages(ctx, imgPaths, title, content)
+}
+
+// CanPublishImages 平台是否支持多图发布
+func (m *Manager) CanPublishImages(platformType PlatformType) bool {
+	_, ok := m.platforms[platformType].(MultiImagePublisher)
+	return ok
+}
+
+// UpdatePost 修改已发布到指定平台的内容，返回新的内容标识
+func (m *Manager) UpdatePost(platformType PlatformType, ctx context.Context, postRef, imgPath, title, content string) (string, error) {
+	p, ok := m.platforms[platformType]
+	if !ok {
+		return "", fmt.Errorf("未支持的平台: %s", platformType)
+	}
+	editor, ok := p.(PostEditor)
+	if !ok {
+		return "", fmt.Errorf("%s 不支持修改已发布内容", p.Name())
+	}
+	return editor.UpdatePost(ctx, postRef, imgPath, title, content)
+}
+
+// CanUpdate 平台是否支持修改已发布内容
+func (m *Manager) CanUpdate(platformType PlatformType) bool {
+	_, ok := m.platforms[platformType].(PostEditor)
+	return ok
+}
+
+// PreferredFormat 平台声明的图片格式，未声明时 ok 为 false
+func (m *Manager) PreferredFormat(platformType PlatformType) (ImageFormat, bool) {
+	fp, ok := m.platforms[platformType].(FormatPreferrer)
+	if !ok {
+		return ImageFormat{}, false
+	}
+	return fp.PreferredFormat(), true
+}
+
+// HostedURL 通过已注册的图床上传图片，返回外链
+func (m *Manager) HostedURL(ctx context.Context, imgPath string) (string, error) {
+	if m.imageHost == nil {
+		return "", fmt.Errorf("未配置图床，无法获取图片外链")
+	}
+	return m.imageHost.Upload(ctx, imgPath)
+}
+
+// TestCredentials 检测指定平台的凭证是否可用
+func (m *Manager) TestCredentials(ctx context.Context, platformType PlatformType) (string, error) {
+	p, ok := m.platforms[platformType]
+	if !ok {
+		return "", fmt.Errorf("未支持的平台: %s", platformType)
+	}
+	tester, ok := p.(CredentialTester)
+	if !ok {
+		return "", fmt.Errorf("%s 不支持凭证检测", p.Name())
+	}
+	return tester.TestCredentials(ctx)
+}
+
 // PublishAll 发布到所有平台
 func (m *Manager) PublishAll(ctx context.Context, imgPath, title, content string) map[string]string {
 	results := make(map[string]string)
@@ -0,0 +1,95 @@
+// Package requestid 在请求、异步任务和对外 HTTP 调用之间传递请求 ID，
+// 平台和发布渠道的工单可以据此对应到我们的请求或任务
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Header 请求 ID 的 HTTP 头，收到的请求和发出的请求都使用
+const Header = "X-Request-ID"
+
+// 平台在响应头中返回的自己的请求 ID，按顺序取第一个
+var upstreamHeaders = []string{"X-Request-Id", "Request-Id", "X-Acs-Request-Id", "X-Amzn-Requestid", "X-Trace-Id"}
+
+type ctxKey struct{}
+
+// New 生成新的请求 ID
+func New() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// With 把请求 ID 放入 ctx
+func With(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// From 取出 ctx 中的请求 ID，没有时返回空
+func From(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKey{}).(string)
+	return id
+}
+
+// Transport 发出的请求带上 ctx 中的请求 ID（没有时新生成一个），并记录调用日志：
+// 提交类请求（非 GET）为 info，查询和下载为 debug，失败为 warn；日志中带上平台返回的请求 ID
+type Transport struct {
+	Next http.RoundTripper // 为空时使用 http.DefaultTransport
+}
+
+// Client 带请求 ID 的 HTTP 客户端
+func Client(timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: &Transport{}}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.Next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	id := req.Header.Get(Header)
+	if id == "" {
+		if id = From(req.Context()); id == "" {
+			id = New()
+		}
+		// RoundTripper 不应修改原请求
+		req = req.Clone(req.Context())
+		req.Header.Set(Header, id)
+	}
+
+	start := time.Now()
+	resp, err := next.RoundTrip(req)
+	attrs := []any{
+		slog.String("request_id", id),
+		slog.String("method", req.Method),
+		slog.String("host", req.URL.Host),
+		slog.String("path", req.URL.Path),
+		slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+	}
+	switch {
+	case err != nil:
+		slog.Warn("outbound", append(attrs, slog.String("error", err.Error()))...)
+	default:
+		attrs = append(attrs, slog.Int("status", resp.StatusCode))
+		for _, h := range upstreamHeaders {
+			if v := resp.Header.Get(h); v != "" && v != id {
+				attrs = append(attrs, slog.String("upstream_request_id", v))
+				break
+			}
+		}
+		level := slog.LevelDebug
+		if resp.StatusCode >= 400 {
+			level = slog.LevelWarn
+		} else if req.Method != http.MethodGet {
+			level = slog.LevelInfo
+		}
+		slog.Log(req.Context(), level, "outbound", attrs...)
+	}
+	return resp, err
+}